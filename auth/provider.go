@@ -6,6 +6,7 @@ package auth
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/foundriesio/dg-satellite/storage"
 	"github.com/foundriesio/dg-satellite/storage/users"
@@ -40,6 +41,13 @@ type Provider interface {
 	DropSession(c echo.Context, session *Session)
 }
 
+// UserCreator is implemented by providers which manage user credentials themselves.
+// Other providers create users on their first login.
+type UserCreator interface {
+	// CreateUser returns an HTTP status code along with an error if a user cannot be created.
+	CreateUser(username, password string, scopes []string) (*users.User, int, error)
+}
+
 const AuthCookieName = "dg-satellite-session"
 const AuthLoginPath = "/auth/login"
 const AuthCallbackPath = "/auth/callback"
@@ -51,6 +59,7 @@ func NewProvider(e *echo.Echo, db *storage.DbHandle, fs *storage.FsHandle, users
 	if err != nil {
 		return nil, fmt.Errorf("failed to get auth config: %w", err)
 	}
+	users.SetMaxTokenLifetime(time.Duration(authConfig.MaxTokenLifetimeDays) * 24 * time.Hour)
 
 	if provider, ok := providers[authConfig.Type]; ok {
 		if err := provider.Configure(e, users, authConfig); err != nil {
@@ -4,12 +4,15 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/foundriesio/dg-satellite/server"
+	"github.com/foundriesio/dg-satellite/storage"
 	"github.com/foundriesio/dg-satellite/storage/users"
 	"github.com/labstack/echo/v4"
 )
@@ -22,6 +25,91 @@ type commonProvider struct {
 	users       *users.Storage
 	rateLimiter *authRateLimiter
 	renderer    loginPageRenderer
+
+	newUserScopes users.Scopes
+	groupScopes   map[string]users.Scopes
+}
+
+// configureUserScopes parses scopes granted to users created on their first login.
+func (p *commonProvider) configureUserScopes(cfg *storage.AuthConfig) error {
+	var err error
+	p.newUserScopes, err = users.ScopesFromSlice(cfg.NewUserDefaultScopes)
+	if err != nil {
+		return fmt.Errorf("unable to parse new user default scopes: %w", err)
+	}
+	p.groupScopes = nil
+	for group, scopes := range cfg.GroupScopes {
+		if p.groupScopes == nil {
+			p.groupScopes = make(map[string]users.Scopes, len(cfg.GroupScopes))
+		}
+		if p.groupScopes[group], err = users.ScopesFromSlice(scopes); err != nil {
+			return fmt.Errorf("unable to parse scopes of group %s: %w", group, err)
+		}
+	}
+	return nil
+}
+
+// provisionUser returns a user authenticated by an identity provider, creating them on their first login.
+// When group scopes are configured, user scopes are set to scopes of their groups, so that
+// removing a user from a group in an identity provider removes scopes of that group.
+// A user whose groups grant no scopes is denied, and their existing sessions and tokens lose all scopes.
+// A username of a service account is denied, so that an identity provider cannot log in as one.
+// It returns an HTTP status code along with an error if a user cannot log in.
+func (p commonProvider) provisionUser(username, email string, groups []string) (*users.User, int, error) {
+	if p.groupScopes == nil {
+		user, err := p.users.Upsert(username, email, p.newUserScopes)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("unexpected error retrieving user")
+		} else if user.ServiceAccount {
+			return nil, http.StatusForbidden, users.ErrServiceAccountLogin
+		}
+		return user, 0, nil
+	}
+
+	var scopes users.Scopes
+	for _, group := range groups {
+		scopes |= p.groupScopes[group]
+	}
+	user, err := p.users.Get(username)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("unexpected error retrieving user")
+	} else if user != nil && user.ServiceAccount {
+		return nil, http.StatusForbidden, users.ErrServiceAccountLogin
+	} else if user == nil && scopes != 0 {
+		if user, err = p.users.Upsert(username, email, scopes); err != nil {
+			return nil, http.StatusInternalServerError, errors.New("unexpected error creating user")
+		}
+	} else if user != nil && user.AllowedScopes != scopes {
+		slog.Info("Updating user scopes from groups", "user", username, "groups", groups, "scopes", scopes)
+		user.AllowedScopes = scopes
+		if err = user.Update("Scopes changed by group membership: " + strings.Join(groups, ",")); err != nil {
+			return nil, http.StatusInternalServerError, errors.New("unexpected error updating user")
+		}
+	}
+	if scopes == 0 {
+		return nil, http.StatusForbidden, errors.New("none of your groups grants access to this server")
+	}
+	return user, 0, nil
+}
+
+// createSession starts a web UI session of a user, setting session and CSRF cookies.
+func createSession(c echo.Context, user *users.User, timeout time.Duration) error {
+	expires := time.Now().Add(timeout)
+	sessionId, err := user.CreateSession(c.RealIP(), expires.Unix(), user.AllowedScopes)
+	if err != nil {
+		return err
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     AuthCookieName,
+		Value:    sessionId,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	SetCsrfCookie(c, expires)
+	return nil
 }
 
 func (p *commonProvider) DropSession(c echo.Context, session *Session) {
@@ -45,7 +133,7 @@ func (p *commonProvider) GetUser(c echo.Context) (*users.User, error) {
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 			return nil, fmt.Errorf("invalid authorization header")
 		}
-		user, err := p.users.GetByToken(parts[1])
+		user, err := p.users.GetByToken(parts[1], c.RealIP())
 		if err != nil {
 			p.rateLimiter.FlagBadOperation(c)
 			slog.Warn("unable to get user by token", "error", err)
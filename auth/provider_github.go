@@ -26,6 +26,7 @@ type authConfigGithub struct {
 type ghProvider struct {
 	oauth2BaseProvider
 	AllowedOrgs []string
+	apiUrl      string
 }
 
 func (p *ghProvider) Configure(e *echo.Echo, users *users.Storage, cfg *storage.AuthConfig) error {
@@ -58,59 +59,78 @@ type ghOrg struct {
 	Login string `json:"login"`
 }
 
+type ghTeam struct {
+	Slug         string `json:"slug"`
+	Organization ghOrg  `json:"organization"`
+}
+
 func (p *ghProvider) userFromToken(c echo.Context, token *oauth2.Token) (*users.User, error) {
 	client := p.oauthConfig.Client(c.Request().Context(), token)
-	resp, err := client.Get("https://api.github.com/user")
-	if err != nil {
-		return nil, c.String(http.StatusInternalServerError, "Unable to request user profile")
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			slog.Error("unable to close github user body", "error", err)
-		}
-	}()
-	if resp.StatusCode != 200 {
-		msg, _ := io.ReadAll(resp.Body)
-		return nil, c.String(resp.StatusCode, "Unable to read user profile: "+string(msg))
-	}
 	var profile ghProfile
-	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
-		return nil, c.String(resp.StatusCode, "Unable to unmarshall user profile: "+err.Error())
+	if rc, err := p.getJson(client, "/user", "user profile", &profile); err != nil {
+		return nil, c.String(rc, err.Error())
 	}
 
 	// Check organization membership
-	resp, err = client.Get("https://api.github.com/user/orgs")
-	if err != nil {
-		return nil, c.String(http.StatusInternalServerError, "Unable to request user organizations")
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			slog.Error("unable to close github user organizations body", "error", err)
-		}
-	}()
-	if resp.StatusCode != 200 {
-		msg, _ := io.ReadAll(resp.Body)
-		return nil, c.String(resp.StatusCode, "Unable to read user organizations: "+string(msg))
-	}
 	var orgs []ghOrg
-	if err := json.NewDecoder(resp.Body).Decode(&orgs); err != nil {
-		return nil, c.String(resp.StatusCode, "Unable to unmarshall user organizations: "+err.Error())
+	if rc, err := p.getJson(client, "/user/orgs?per_page=100", "user organizations", &orgs); err != nil {
+		return nil, c.String(rc, err.Error())
 	}
 	found := false
+	var groups []string
 	for _, org := range orgs {
 		if slices.Contains(p.AllowedOrgs, org.Login) {
 			found = true
 		}
+		groups = append(groups, org.Login)
 	}
 	if !found {
 		return nil, c.String(http.StatusUnauthorized, "Unauthorized organization")
 	}
 
-	user, err := p.users.Upsert(profile.Login, profile.Email, p.newUserScopes)
+	if p.hasTeamScopes() {
+		var teams []ghTeam
+		if rc, err := p.getJson(client, "/user/teams?per_page=100", "user teams", &teams); err != nil {
+			return nil, c.String(rc, err.Error())
+		}
+		for _, team := range teams {
+			groups = append(groups, team.Organization.Login+"/"+team.Slug)
+		}
+	}
+
+	return p.upsertUser(c, profile.Login, profile.Email, groups)
+}
+
+// hasTeamScopes tells if scopes are granted to any team, named as "<org>/<team>".
+// Teams of a user are only looked up in that case.
+func (p *ghProvider) hasTeamScopes() bool {
+	for group := range p.groupScopes {
+		if strings.Contains(group, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// getJson reads a GitHub API resource, and returns an HTTP status code along with an error if that fails.
+func (p *ghProvider) getJson(client *http.Client, resource, what string, dst any) (int, error) {
+	resp, err := client.Get(p.apiUrl + resource)
 	if err != nil {
-		return nil, c.String(http.StatusInternalServerError, "Unexpected error retrieving user")
+		return http.StatusInternalServerError, fmt.Errorf("unable to request %s", what)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Error("unable to close github "+what+" body", "error", err)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		msg, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("unable to read %s: %s", what, msg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return resp.StatusCode, fmt.Errorf("unable to unmarshall %s: %w", what, err)
 	}
-	return user, nil
+	return 0, nil
 }
 
 func init() {
@@ -119,6 +139,7 @@ func init() {
 			name:        "github",
 			displayName: "GitHub",
 		},
+		apiUrl: "https://api.github.com",
 	}
 	p.checkToken = p.userFromToken
 	RegisterProvider(&p)
@@ -0,0 +1,76 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+func TestGithubProviderGroupScopes(t *testing.T) {
+	teamsRequested := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		require.Nil(t, json.NewEncoder(w).Encode(ghProfile{Login: "alice", Email: "alice@example.com"}))
+	})
+	mux.HandleFunc("/user/orgs", func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewEncoder(w).Encode([]ghOrg{{Login: "acme"}, {Login: "other"}}))
+	})
+	mux.HandleFunc("/user/teams", func(w http.ResponseWriter, r *http.Request) {
+		teamsRequested = true
+		require.Nil(t, json.NewEncoder(w).Encode([]ghTeam{
+			{Slug: "fleet-admins", Organization: ghOrg{Login: "acme"}},
+			{Slug: "fleet-admins", Organization: ghOrg{Login: "other"}},
+		}))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	login := func(groupScopes map[string][]string) (*users.User, *httptest.ResponseRecorder) {
+		e := echo.New()
+		userStorage := newTestUserStorage(t)
+		p := &ghProvider{
+			oauth2BaseProvider: oauth2BaseProvider{name: "github"},
+			apiUrl:             server.URL,
+		}
+		cfg := storage.AuthConfig{
+			Type:                 "github",
+			NewUserDefaultScopes: []string{"devices:read"},
+			GroupScopes:          groupScopes,
+			Config:               json.RawMessage(`{"AllowedOrgs": ["acme"]}`),
+		}
+		require.Nil(t, p.Configure(e, userStorage, &cfg))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, AuthCallbackPath, nil), rec)
+		u, err := p.userFromToken(c, &oauth2.Token{AccessToken: "access", TokenType: "Bearer"})
+		require.Nil(t, err)
+		return u, rec
+	}
+
+	u, _ := login(nil)
+	require.Equal(t, users.ScopeDevicesR, u.AllowedScopes)
+	require.False(t, teamsRequested)
+
+	u, _ = login(map[string][]string{"acme": {"updates:read"}})
+	require.Equal(t, users.ScopeUpdatesR, u.AllowedScopes)
+	require.False(t, teamsRequested)
+
+	u, _ = login(map[string][]string{"acme": {"updates:read"}, "acme/fleet-admins": {"devices:read-update"}})
+	require.Equal(t, users.ScopeUpdatesR|users.ScopeDevicesRU, u.AllowedScopes)
+	require.True(t, teamsRequested)
+
+	u, rec := login(map[string][]string{"acme/fleet-viewers": {"devices:read"}})
+	require.Nil(t, u)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
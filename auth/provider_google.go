@@ -6,7 +6,9 @@ package auth
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"slices"
 	"strings"
 
@@ -21,12 +23,16 @@ import (
 type authConfigGoogle struct {
 	authConfigOauth2
 	AllowedDomains []string
+	// LookupGroups adds Google Workspace groups of a user to their groups, which requires the Cloud Identity API.
+	LookupGroups bool
 }
 
 type googleProvider struct {
 	oauth2BaseProvider
 
-	AllowedDomains []string
+	AllowedDomains   []string
+	LookupGroups     bool
+	cloudIdentityUrl string
 }
 
 func (p *googleProvider) Configure(e *echo.Echo, userStorage *users.Storage, cfg *storage.AuthConfig) error {
@@ -35,6 +41,7 @@ func (p *googleProvider) Configure(e *echo.Echo, userStorage *users.Storage, cfg
 		return fmt.Errorf("unable to unmarshal google config: %w", err)
 	}
 	p.AllowedDomains = cfgGoogle.AllowedDomains
+	p.LookupGroups = cfgGoogle.LookupGroups
 	p.oauthConfig = &oauth2.Config{
 		RedirectURL:  cfgGoogle.BaseUrl + AuthCallbackPath,
 		ClientID:     cfgGoogle.ClientID,
@@ -42,6 +49,9 @@ func (p *googleProvider) Configure(e *echo.Echo, userStorage *users.Storage, cfg
 		Scopes:       []string{"openid", "email", "profile"},
 		Endpoint:     google.Endpoint,
 	}
+	if p.LookupGroups {
+		p.oauthConfig.Scopes = append(p.oauthConfig.Scopes, "https://www.googleapis.com/auth/cloud-identity.groups.readonly")
+	}
 	return p.configure(e, userStorage, cfg)
 }
 
@@ -74,11 +84,55 @@ func (p *googleProvider) userFromToken(c echo.Context, token *oauth2.Token) (*us
 		return nil, c.String(http.StatusUnauthorized, fmt.Sprintf("Unauthorized domain: %s", profile.HostedDomain))
 	}
 
-	user, err := p.users.Upsert(profile.Username(), profile.Email, p.newUserScopes)
-	if err != nil {
-		return nil, c.String(http.StatusInternalServerError, fmt.Sprintf("Unexpected error retrieving user: %v", err))
+	groups := []string{profile.HostedDomain}
+	if p.LookupGroups {
+		workspaceGroups, err := p.lookupGroups(c, token, profile.Email)
+		if err != nil {
+			slog.Warn("unable to look up google groups", "user", profile.Email, "error", err)
+			return nil, c.String(http.StatusInternalServerError, "Unable to look up user groups")
+		}
+		groups = append(groups, workspaceGroups...)
+	}
+	return p.upsertUser(c, profile.Username(), profile.Email, groups)
+}
+
+// lookupGroups returns emails of Google Workspace groups which a user is a direct member of.
+func (p *googleProvider) lookupGroups(c echo.Context, token *oauth2.Token, email string) ([]string, error) {
+	client := p.oauthConfig.Client(c.Request().Context(), token)
+	query := url.Values{"query": {fmt.Sprintf("member_key_id == '%s'", email)}}
+	var groups []string
+	for {
+		resp, err := client.Get(p.cloudIdentityUrl + "/v1/groups/-/memberships:searchDirectGroups?" + query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Memberships []struct {
+				GroupKey struct {
+					Id string `json:"id"`
+				} `json:"groupKey"`
+			} `json:"memberships"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		}
+		if err := resp.Body.Close(); err != nil {
+			slog.Error("unable to close google groups body", "error", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range page.Memberships {
+			groups = append(groups, m.GroupKey.Id)
+		}
+		if len(page.NextPageToken) == 0 {
+			return groups, nil
+		}
+		query.Set("page_token", page.NextPageToken)
 	}
-	return user, nil
 }
 
 func init() {
@@ -87,6 +141,7 @@ func init() {
 			name:        "google",
 			displayName: "Google",
 		},
+		cloudIdentityUrl: "https://cloudidentity.googleapis.com",
 	}
 	p.checkToken = p.userFromToken
 	RegisterProvider(&p)
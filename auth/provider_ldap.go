@@ -0,0 +1,235 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/labstack/echo/v4"
+
+	"github.com/foundriesio/dg-satellite/server"
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+type authConfigLdap struct {
+	// Url of a directory server, e.g. ldaps://dc.example.com or ldap://dc.example.com:389.
+	Url string
+	// StartTLS upgrades an ldap:// connection to TLS before sending any credentials.
+	StartTLS bool
+	// CaFile is a PEM file with CA certificates trusted for a server certificate, system ones by default.
+	CaFile string
+	// BindDN and BindPassword are credentials of a service account used to search for users and groups.
+	// The search is anonymous if BindDN is empty.
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users are searched, e.g. "ou=people,dc=example,dc=com".
+	BaseDN string
+	// UserFilter is an optional filter which users must match, e.g. "(objectClass=person)".
+	UserFilter string
+	// UsernameAttribute holds a login name of a user, "uid" by default; Active Directory uses "sAMAccountName".
+	UsernameAttribute string
+	// EmailAttribute holds an email of a user, "mail" by default.
+	EmailAttribute string
+	// GroupAttribute lists DNs of user groups in a user entry, "memberOf" by default.
+	GroupAttribute string
+	// GroupFilter optionally searches for groups of a user under GroupBaseDN (BaseDN by default),
+	// for servers without a "memberOf" attribute, e.g. "(&(objectClass=groupOfNames)(member={dn}))".
+	// "{dn}" and "{username}" are replaced with the user DN and login name.
+	GroupFilter string
+	GroupBaseDN string
+	// TimeoutSec limits connecting to and each request of a server, 10 seconds by default.
+	TimeoutSec int
+}
+
+type ldapProvider struct {
+	commonProvider
+	cfg            authConfigLdap
+	tlsConfig      *tls.Config
+	timeout        time.Duration
+	sessionTimeout time.Duration
+}
+
+func (p ldapProvider) Name() string {
+	return "ldap"
+}
+
+func (p *ldapProvider) Configure(e *echo.Echo, userStorage *users.Storage, cfg *storage.AuthConfig) error {
+	p.cfg = authConfigLdap{}
+	if err := json.Unmarshal(cfg.Config, &p.cfg); err != nil {
+		return fmt.Errorf("unable to unmarshal ldap config: %w", err)
+	}
+	u, err := url.Parse(p.cfg.Url)
+	if err != nil {
+		return fmt.Errorf("invalid ldap Url: %w", err)
+	} else if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return fmt.Errorf("ldap Url must start with ldap:// or ldaps://, got: %s", p.cfg.Url)
+	} else if u.Scheme == "ldap" && !p.cfg.StartTLS {
+		slog.Warn("LDAP passwords are sent in plain text, consider using ldaps:// or StartTLS", "url", p.cfg.Url)
+	}
+	if len(p.cfg.BaseDN) == 0 {
+		return errors.New("ldap config requires a BaseDN")
+	}
+	p.cfg.UsernameAttribute = cmp.Or(p.cfg.UsernameAttribute, "uid")
+	p.cfg.EmailAttribute = cmp.Or(p.cfg.EmailAttribute, "mail")
+	p.cfg.GroupAttribute = cmp.Or(p.cfg.GroupAttribute, "memberOf")
+	p.cfg.GroupBaseDN = cmp.Or(p.cfg.GroupBaseDN, p.cfg.BaseDN)
+	p.timeout = time.Duration(cmp.Or(p.cfg.TimeoutSec, 10)) * time.Second
+
+	p.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	if len(p.cfg.CaFile) > 0 {
+		pem, err := os.ReadFile(p.cfg.CaFile)
+		if err != nil {
+			return fmt.Errorf("unable to read ldap CaFile: %w", err)
+		}
+		p.tlsConfig.RootCAs = x509.NewCertPool()
+		if !p.tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in ldap CaFile: %s", p.cfg.CaFile)
+		}
+	}
+
+	if err := p.configureUserScopes(cfg); err != nil {
+		return err
+	}
+	p.users = userStorage
+	p.rateLimiter = NewRateLimiter(cfg.RateLimits)
+	p.renderer = p
+	p.sessionTimeout = time.Duration(cfg.SessionTimeoutHours) * time.Hour
+
+	e.POST(AuthLoginPath, p.handleLogin, p.rateLimiter.Middleware)
+	return nil
+}
+
+func (p ldapProvider) renderLoginPage(c echo.Context, reason string) error {
+	return renderPasswordLoginPage(c, reason, false)
+}
+
+func (p *ldapProvider) handleLogin(c echo.Context) error {
+	username := c.FormValue("username")
+	password := c.FormValue("password")
+	// An empty password makes an unauthenticated bind, which many servers accept.
+	if len(username) == 0 || len(password) == 0 {
+		p.rateLimiter.FlagBadOperation(c)
+		return p.renderLoginPage(c, "Invalid username or password")
+	}
+
+	entry, groups, err := p.authenticate(username, password)
+	if errors.Is(err, errLdapInvalidCredentials) {
+		p.rateLimiter.FlagBadOperation(c)
+		return p.renderLoginPage(c, "Invalid username or password")
+	} else if err != nil {
+		return server.EchoError(c, err, http.StatusBadGateway, "Unable to authenticate with the directory server")
+	}
+
+	user, rc, err := p.provisionUser(entry.GetAttributeValue(p.cfg.UsernameAttribute), entry.GetAttributeValue(p.cfg.EmailAttribute), groups)
+	if errors.Is(err, users.ErrServiceAccountLogin) {
+		p.rateLimiter.FlagBadOperation(c)
+		return p.renderLoginPage(c, "Service accounts cannot log in")
+	} else if rc == http.StatusForbidden {
+		return p.renderLoginPage(c, "None of your groups grants access to this server")
+	} else if err != nil {
+		return server.EchoError(c, err, rc, err.Error())
+	}
+
+	if err = createSession(c, user, p.sessionTimeout); err != nil {
+		return server.EchoError(c, err, http.StatusInternalServerError, "Could not create user session")
+	}
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+var errLdapInvalidCredentials = errors.New("invalid username or password")
+
+// authenticate finds a user entry along with its groups, and verifies a user password by binding as that user.
+func (p *ldapProvider) authenticate(username, password string) (*ldap.Entry, []string, error) {
+	conn, err := p.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			slog.Warn("unable to close ldap connection", "error", err)
+		}
+	}()
+
+	if len(p.cfg.BindDN) > 0 {
+		if err = conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, nil, fmt.Errorf("unable to bind as %s: %w", p.cfg.BindDN, err)
+		}
+	}
+
+	filter := fmt.Sprintf("(%s=%s)", p.cfg.UsernameAttribute, ldap.EscapeFilter(username))
+	if len(p.cfg.UserFilter) > 0 {
+		filter = "(&" + p.cfg.UserFilter + filter + ")"
+	}
+	attrs := []string{p.cfg.UsernameAttribute, p.cfg.EmailAttribute, p.cfg.GroupAttribute}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(p.timeout.Seconds()), false, filter, attrs, nil))
+	// A size limit is exceeded when a username matches several entries, which is handled below.
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, nil, fmt.Errorf("unable to search for user: %w", err)
+	} else if len(res.Entries) != 1 {
+		if len(res.Entries) > 1 {
+			slog.Warn("LDAP username matches multiple users", "username", username, "filter", filter)
+		}
+		return nil, nil, errLdapInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	// Groups are looked up before binding as a user, who may not be allowed to read them.
+	groups := entry.GetAttributeValues(p.cfg.GroupAttribute)
+	if len(p.cfg.GroupFilter) > 0 {
+		filter := strings.NewReplacer(
+			"{dn}", ldap.EscapeFilter(entry.DN),
+			"{username}", ldap.EscapeFilter(username),
+		).Replace(p.cfg.GroupFilter)
+		res, err := conn.Search(ldap.NewSearchRequest(
+			p.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(p.timeout.Seconds()), false, filter, []string{"1.1"}, nil))
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to search for user groups: %w", err)
+		}
+		for _, group := range res.Entries {
+			groups = append(groups, group.DN)
+		}
+	}
+
+	if err = conn.Bind(entry.DN, password); ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, nil, errLdapInvalidCredentials
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("unable to bind as %s: %w", entry.DN, err)
+	}
+	return entry, groups, nil
+}
+
+func (p *ldapProvider) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.cfg.Url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.timeout}), ldap.DialWithTLSConfig(p.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %w", p.cfg.Url, err)
+	}
+	conn.SetTimeout(p.timeout)
+	if p.cfg.StartTLS {
+		if err = conn.StartTLS(p.tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("unable to start TLS with %s: %w", p.cfg.Url, err)
+		}
+	}
+	return conn, nil
+}
+
+func init() {
+	RegisterProvider(&ldapProvider{})
+}
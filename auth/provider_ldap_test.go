@@ -0,0 +1,411 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/foundriesio/dg-satellite/context"
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+const (
+	testLdapBaseDN   = "dc=example,dc=com"
+	testLdapBindDN   = "cn=satellite,ou=services,dc=example,dc=com"
+	testLdapAliceDN  = "uid=alice,ou=people,dc=example,dc=com"
+	testLdapAdminsDN = "cn=fleet-admins,ou=groups,dc=example,dc=com"
+	testLdapViewerDN = "cn=fleet-viewers,ou=groups,dc=example,dc=com"
+)
+
+// mockLdap is a minimal in-process LDAP server, supporting simple binds, searches, and StartTLS.
+type mockLdap struct {
+	t         *testing.T
+	url       string
+	caFile    string
+	tlsConfig *tls.Config
+
+	lock      sync.Mutex
+	passwords map[string]string
+	entries   map[string]map[string][]string
+	binds     []string
+}
+
+func newMockLdap(t *testing.T, ldaps bool) *mockLdap {
+	m := &mockLdap{
+		t: t,
+		passwords: map[string]string{
+			testLdapBindDN:  "service-secret",
+			testLdapAliceDN: "alice-secret",
+		},
+		entries: map[string]map[string][]string{
+			testLdapAliceDN: {
+				"objectClass": {"person"},
+				"uid":         {"alice"},
+				"mail":        {"alice@example.com"},
+				"memberOf":    {testLdapViewerDN},
+			},
+			testLdapAdminsDN: {
+				"objectClass": {"groupOfNames"},
+				"member":      {testLdapAliceDN},
+			},
+			testLdapViewerDN: {
+				"objectClass": {"groupOfNames"},
+			},
+		},
+	}
+	m.tlsConfig, m.caFile = newTestTlsConfig(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	m.url = "ldap://" + l.Addr().String()
+	if ldaps {
+		l = tls.NewListener(l, m.tlsConfig)
+		m.url = "ldaps://" + l.Addr().String()
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+func (m *mockLdap) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	var bound string
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultSuccess)
+			m.lock.Lock()
+			if expected, ok := m.passwords[dn]; !ok || expected != password {
+				code = ldap.LDAPResultInvalidCredentials
+			} else {
+				bound = dn
+				m.binds = append(m.binds, dn)
+			}
+			m.lock.Unlock()
+			m.write(conn, ldapResult(id, ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			// Only the service account may search the directory.
+			if bound != testLdapBindDN {
+				m.write(conn, ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			base, sizeLimit, filter := op.Children[0].Data.String(), op.Children[3].Value.(int64), op.Children[6]
+			code, found := uint16(ldap.LDAPResultSuccess), int64(0)
+			m.lock.Lock()
+			for dn, attrs := range m.entries {
+				if !strings.HasSuffix(strings.ToLower(dn), strings.ToLower(base)) || !m.match(attrs, filter) {
+					continue
+				} else if sizeLimit > 0 && found == sizeLimit {
+					code = ldap.LDAPResultSizeLimitExceeded
+					break
+				}
+				found++
+				m.write(conn, ldapEntry(id, dn, attrs))
+			}
+			m.lock.Unlock()
+			m.write(conn, ldapResult(id, ldap.ApplicationSearchResultDone, code))
+		case ldap.ApplicationExtendedRequest:
+			m.write(conn, ldapResult(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+			conn = tls.Server(conn, m.tlsConfig)
+		default:
+			return
+		}
+	}
+}
+
+// match evaluates a search filter, supporting only filters sent by the ldap provider.
+func (m *mockLdap) match(attrs map[string][]string, filter *ber.Packet) bool {
+	get := func(name string) []string {
+		for attr, values := range attrs {
+			if strings.EqualFold(attr, name) {
+				return values
+			}
+		}
+		return nil
+	}
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, f := range filter.Children {
+			if !m.match(attrs, f) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, f := range filter.Children {
+			if m.match(attrs, f) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterEqualityMatch:
+		for _, v := range get(filter.Children[0].Data.String()) {
+			if strings.EqualFold(v, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(get(filter.Data.String())) > 0
+	}
+	m.t.Errorf("unsupported ldap filter: %d", filter.Tag)
+	return false
+}
+
+func (m *mockLdap) write(conn net.Conn, packet *ber.Packet) {
+	_, err := conn.Write(packet.Bytes())
+	require.Nil(m.t, err)
+}
+
+func (m *mockLdap) resetBinds() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	binds := m.binds
+	m.binds = nil
+	return binds
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapResult(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "MatchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic"))
+	return ldapMessage(id, op)
+}
+
+func ldapEntry(id int64, dn string, attrs map[string][]string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Name"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	op.AppendChild(list)
+	return ldapMessage(id, op)
+}
+
+// newTestTlsConfig returns a server config with a self-signed certificate for 127.0.0.1, and a CA file trusting it.
+func newTestTlsConfig(t *testing.T) (*tls.Config, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.Nil(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.Nil(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, caFile
+}
+
+type ldapTestClient struct {
+	t     *testing.T
+	e     *echo.Echo
+	users *users.Storage
+}
+
+func newLdapTestClient(t *testing.T, cfg storage.AuthConfig) *ldapTestClient {
+	userStorage := newTestUserStorage(t)
+	cfg.Type = "ldap"
+	cfg.SessionTimeoutHours = 1
+	cfg.RateLimits = storage.RateLimitConfig{AttemptsPerSecond: 1000, BadAuthLimit: 1000}
+	e := echo.New()
+	require.Nil(t, (&ldapProvider{}).Configure(e, userStorage, &cfg))
+	return &ldapTestClient{t: t, e: e, users: userStorage}
+}
+
+func (tc *ldapTestClient) login(username, password string) *httptest.ResponseRecorder {
+	form := url.Values{"username": {username}, "password": {password}}
+	req := httptest.NewRequest(http.MethodPost, AuthLoginPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "text/html")
+	req = req.WithContext(context.CtxWithLog(tc.t.Context(), slog.Default()))
+	rec := httptest.NewRecorder()
+	tc.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLdapProvider(t *testing.T) {
+	server := newMockLdap(t, false)
+	tc := newLdapTestClient(t, storage.AuthConfig{
+		NewUserDefaultScopes: []string{"devices:read"},
+		Config: json.RawMessage(`{
+			"Url": "` + server.url + `",
+			"StartTLS": true,
+			"CaFile": "` + server.caFile + `",
+			"BindDN": "` + testLdapBindDN + `",
+			"BindPassword": "service-secret",
+			"BaseDN": "` + testLdapBaseDN + `",
+			"UserFilter": "(objectClass=person)"
+		}`),
+	})
+
+	rec := tc.login("alice", "alice-secret")
+	require.Equal(t, http.StatusSeeOther, rec.Code, rec.Body.String())
+	require.Equal(t, []string{testLdapBindDN, testLdapAliceDN}, server.resetBinds())
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == AuthCookieName {
+			session = c
+		}
+	}
+	require.NotNil(t, session)
+	u, err := tc.users.GetBySession(session.Value)
+	require.Nil(t, err)
+	require.NotNil(t, u)
+	require.Equal(t, "alice", u.Username)
+	require.Equal(t, "alice@example.com", u.Email)
+	require.Equal(t, users.ScopeDevicesR, u.AllowedScopes)
+
+	for name, creds := range map[string][2]string{
+		"bad password":     {"alice", "wrong"},
+		"empty password":   {"alice", ""},
+		"unknown user":     {"bob", "alice-secret"},
+		"filter injection": {"*", "alice-secret"},
+		"filtered out":     {"fleet-admins", "alice-secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := tc.login(creds[0], creds[1])
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Contains(t, rec.Body.String(), "Invalid username or password")
+			require.NotContains(t, server.resetBinds(), testLdapAliceDN)
+		})
+	}
+
+	t.Run("ambiguous username", func(t *testing.T) {
+		server.lock.Lock()
+		server.entries["uid=alice,ou=contractors,dc=example,dc=com"] = map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"alice"},
+		}
+		server.lock.Unlock()
+		rec := tc.login("alice", "alice-secret")
+		require.Contains(t, rec.Body.String(), "Invalid username or password")
+		require.Equal(t, []string{testLdapBindDN}, server.resetBinds())
+	})
+
+	t.Run("server unavailable", func(t *testing.T) {
+		tc := newLdapTestClient(t, storage.AuthConfig{
+			Config: json.RawMessage(`{"Url": "ldap://127.0.0.1:1", "BaseDN": "` + testLdapBaseDN + `", "TimeoutSec": 1}`),
+		})
+		require.Equal(t, http.StatusBadGateway, tc.login("alice", "alice-secret").Code)
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		tc := newLdapTestClient(t, storage.AuthConfig{
+			Config: json.RawMessage(`{"Url": "` + server.url + `", "StartTLS": true, "BaseDN": "` + testLdapBaseDN + `"}`),
+		})
+		require.Equal(t, http.StatusBadGateway, tc.login("alice", "alice-secret").Code)
+		require.Empty(t, server.resetBinds())
+	})
+}
+
+func TestLdapProviderGroupScopes(t *testing.T) {
+	server := newMockLdap(t, true)
+	tc := newLdapTestClient(t, storage.AuthConfig{
+		GroupScopes: map[string][]string{
+			testLdapViewerDN: {"devices:read", "updates:read"},
+			testLdapAdminsDN: {"devices:read-update", "users:read"},
+		},
+		Config: json.RawMessage(`{
+			"Url": "` + server.url + `",
+			"CaFile": "` + server.caFile + `",
+			"BindDN": "` + testLdapBindDN + `",
+			"BindPassword": "service-secret",
+			"BaseDN": "` + testLdapBaseDN + `",
+			"GroupFilter": "(&(objectClass=groupOfNames)(member={dn}))"
+		}`),
+	})
+
+	// Groups are found both in a user memberOf attribute and with a group search.
+	require.Equal(t, http.StatusSeeOther, tc.login("alice", "alice-secret").Code)
+	u, err := tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Equal(t, users.ScopeDevicesRU|users.ScopeUpdatesR|users.ScopeUsersR, u.AllowedScopes)
+
+	// Removing a user from all groups revokes their access.
+	server.lock.Lock()
+	delete(server.entries[testLdapAliceDN], "memberOf")
+	delete(server.entries[testLdapAdminsDN], "member")
+	server.lock.Unlock()
+	rec := tc.login("alice", "alice-secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "None of your groups grants access to this server")
+	u, err = tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Equal(t, users.Scopes(0), u.AllowedScopes)
+}
+
+func TestLdapProviderConfig(t *testing.T) {
+	for name, tt := range map[string]struct{ config, err string }{
+		"scheme":  {`{"Url": "https://dc.example.com", "BaseDN": "dc=example"}`, "must start with ldap:// or ldaps://"},
+		"base dn": {`{"Url": "ldaps://dc.example.com"}`, "requires a BaseDN"},
+		"ca file": {`{"Url": "ldaps://dc.example.com", "BaseDN": "dc=example", "CaFile": "/does/not/exist"}`, "unable to read ldap CaFile"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := storage.AuthConfig{Type: "ldap", Config: json.RawMessage(tt.config)}
+			require.ErrorContains(t, (&ldapProvider{}).Configure(echo.New(), nil, &cfg), tt.err)
+		})
+	}
+}
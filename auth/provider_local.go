@@ -39,18 +39,29 @@ type authConfigLocal struct {
 	AttemptsBlockDurationSec int
 	BadAuthLimit             int
 	BadAuthBlockDurationSec  int
+	// TotpRequired forces users to enroll into two-factor authentication before using the server.
+	TotpRequired bool
+	// TotpIssuer names the server in authenticator apps, "dg-satellite" by default.
+	TotpIssuer string
 }
 
 type localProvider struct {
 	commonProvider
 	authConfig     *authConfigLocal
-	newUserScopes  users.Scopes
 	sessionTimeout time.Duration
 }
 
 type localProviderUserData struct {
 	PasswordTimestamp int64
 	PasswordHistory   []string
+	// TotpSecret is set once a user enrolls into two-factor authentication.
+	TotpSecret string `json:",omitempty"`
+	// TotpPendingSecret is shown during an enrollment, until a user confirms it with a valid code.
+	TotpPendingSecret string `json:",omitempty"`
+	// TotpCounter is a time step of the last accepted code, so that codes cannot be replayed.
+	TotpCounter uint64 `json:",omitempty"`
+	// TotpRecoveryCodes are hashes of unused recovery codes.
+	TotpRecoveryCodes []string `json:",omitempty"`
 }
 
 func (p localProvider) Name() string {
@@ -75,6 +86,8 @@ func (p *localProvider) Configure(e *echo.Echo, userStorage *users.Storage, cfg
 	e.POST("/users", p.handleUserCreate, p.rateLimiter.Middleware)
 	e.POST("/users/:username/password", p.handlePasswordChange, p.rateLimiter.Middleware)
 	e.POST("/users/:username/reset-password", p.handlePasswordReset, p.rateLimiter.Middleware)
+	e.GET("/users/:username/totp", p.handleTotpGet)
+	e.POST("/users/:username/totp", p.handleTotpEnroll, p.rateLimiter.Middleware)
 	return nil
 }
 
@@ -102,46 +115,54 @@ func (p *localProvider) handleUserCreate(c echo.Context) error {
 		return server.EchoError(c, err, http.StatusBadRequest, "Could not parse request")
 	}
 
-	if req.Username == "" || req.Password == "" {
-		return server.EchoError(c, errors.New("missing fields"), http.StatusBadRequest, "Username and password are required")
+	if _, rc, err := p.CreateUser(req.Username, req.Password, req.Scopes); err != nil {
+		return server.EchoError(c, err, rc, err.Error())
 	}
+	return c.String(http.StatusCreated, "User created")
+}
 
-	if existing, err := p.users.Get(req.Username); err == nil && existing != nil {
-		return server.EchoError(c, fmt.Errorf("user %q already exists", req.Username), http.StatusConflict, fmt.Sprintf("User %q already exists", req.Username))
+// CreateUser creates a user with a password, which must meet the configured complexity rules.
+// Configured default scopes are granted if none are requested.
+func (p localProvider) CreateUser(username, password string, scopes []string) (*users.User, int, error) {
+	if username == "" || password == "" {
+		return nil, http.StatusBadRequest, errors.New("username and password are required")
 	}
 
-	if p.authConfig.MinPasswordLength > 0 && len(req.Password) < p.authConfig.MinPasswordLength {
-		err := fmt.Errorf("password must be at least %d characters", p.authConfig.MinPasswordLength)
-		return server.EchoError(c, err, http.StatusBadRequest, err.Error())
+	if existing, err := p.users.Get(username); err == nil && existing != nil {
+		return nil, http.StatusConflict, fmt.Errorf("user %q already exists", username)
 	}
 
-	if err := p.validatePasswordComplexity(req.Password); err != nil {
-		return server.EchoError(c, err, http.StatusBadRequest, err.Error())
+	if p.authConfig.MinPasswordLength > 0 && len(password) < p.authConfig.MinPasswordLength {
+		return nil, http.StatusBadRequest, fmt.Errorf("password must be at least %d characters", p.authConfig.MinPasswordLength)
+	}
+
+	if err := p.validatePasswordComplexity(password); err != nil {
+		return nil, http.StatusBadRequest, err
 	}
 
-	hashed, err := PasswordHash(req.Password)
+	hashed, err := PasswordHash(password)
 	if err != nil {
-		return server.EchoError(c, err, http.StatusInternalServerError, "Unable to hash password")
+		return nil, http.StatusInternalServerError, errors.New("unable to hash password")
 	}
 
-	scopes := p.newUserScopes
-	if len(req.Scopes) > 0 {
-		scopes, err = users.ScopesFromSlice(req.Scopes)
+	allowed := p.newUserScopes
+	if len(scopes) > 0 {
+		allowed, err = users.ScopesFromSlice(scopes)
 		if err != nil {
-			return server.EchoError(c, err, http.StatusBadRequest, fmt.Sprintf("Invalid scope: %s", err))
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid scope: %w", err)
 		}
 	}
 
 	u := &users.User{
-		Username:      req.Username,
+		Username:      username,
 		Password:      hashed,
-		AllowedScopes: scopes,
+		AllowedScopes: allowed,
 	}
 
 	if err := p.users.Create(u); err != nil {
-		return server.EchoError(c, err, http.StatusInternalServerError, "Unable to create user")
+		return nil, http.StatusInternalServerError, errors.New("unable to create user")
 	}
-	return c.String(http.StatusCreated, "User created")
+	return u, 0, nil
 }
 
 func (p *localProvider) handleLogin(c echo.Context) error {
@@ -151,7 +172,7 @@ func (p *localProvider) handleLogin(c echo.Context) error {
 	user, err := p.users.Get(username)
 	if err != nil {
 		return server.EchoError(c, err, http.StatusInternalServerError, "Unable to look up user")
-	} else if user == nil {
+	} else if user == nil || user.ServiceAccount {
 		p.rateLimiter.FlagBadOperation(c)
 		return p.renderLoginPage(c, "Invalid username or password")
 	}
@@ -163,26 +184,28 @@ func (p *localProvider) handleLogin(c echo.Context) error {
 		return p.renderLoginPage(c, "Invalid username or password")
 	}
 
-	expires := time.Now().Add(p.sessionTimeout)
-	sessionId, err := user.CreateSession(c.RealIP(), expires.Unix(), user.AllowedScopes)
-	if err != nil {
+	// The same message is shown for a wrong code, so that it does not tell a password is right.
+	if ok, err := p.verifyTotp(user, c.FormValue("code"), time.Now()); err != nil {
+		return server.EchoError(c, err, http.StatusInternalServerError, "Internal error verifying authentication code")
+	} else if !ok {
+		p.rateLimiter.FlagBadOperation(c)
+		return p.renderLoginPage(c, "Invalid username, password, or authentication code")
+	}
+
+	if err = createSession(c, user, p.sessionTimeout); err != nil {
 		return server.EchoError(c, err, http.StatusInternalServerError, "Could not create user session")
 	}
-	c.SetCookie(&http.Cookie{
-		Name:     AuthCookieName,
-		Value:    sessionId,
-		Path:     "/",
-		Expires:  expires,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-	})
-	SetCsrfCookie(c, expires)
 
 	return c.Redirect(http.StatusSeeOther, "/")
 }
 
 func (p localProvider) renderLoginPage(c echo.Context, reason string) error {
+	return renderPasswordLoginPage(c, reason, true)
+}
+
+// renderPasswordLoginPage renders a login form posting a username and password to AuthLoginPath,
+// along with an optional two-factor authentication code.
+func renderPasswordLoginPage(c echo.Context, reason string, totp bool) error {
 	accepts := c.Request().Header.Get("Accept")
 	if !strings.Contains(accepts, "text/html") {
 		return c.JSON(http.StatusUnauthorized, map[string]string{
@@ -198,10 +221,12 @@ func (p localProvider) renderLoginPage(c echo.Context, reason string) error {
 		User      *users.User
 		NavItems  []string
 		CsrfToken string
+		Totp      bool
 	}{
 		Title:     "Login",
 		Reason:    reason,
 		CsrfToken: csrfToken,
+		Totp:      totp,
 	}
 	return templates.Templates.ExecuteTemplate(c.Response(), localLoginTemplate, context)
 }
@@ -232,9 +257,40 @@ func (p localProvider) GetSession(c echo.Context) (*Session, error) {
 		}
 	}
 
+	// Likewise, users must enroll into two-factor authentication when it is required.
+	// Only the password change and the enrollment handlers are allowed until they do.
+	totpPage := "/users/" + session.User.Username + "/totp"
+	if p.authConfig.TotpRequired && c.Request().URL.Path != totpPage && c.Request().URL.Path != passwordPage {
+		var localData localProviderUserData
+		if err := json.Unmarshal(session.User.AuthProviderData, &localData); err != nil {
+			slog.Warn("unable to unmarshal auth provider data", "user", session.User.Username, "error", err)
+		} else if len(localData.TotpSecret) == 0 {
+			return nil, p.handleTotpPage(c, session, "Two-factor authentication is required. Please enroll your authenticator app.")
+		}
+	}
+
 	return session, nil
 }
 
+// GetUser makes users enroll into two-factor authentication before they can call the REST API with a session cookie.
+// Requests with API tokens are allowed, as tokens are used by scripts which cannot enroll.
+func (p *localProvider) GetUser(c echo.Context) (*users.User, error) {
+	user, err := p.commonProvider.GetUser(c)
+	if err != nil || user == nil {
+		return user, err
+	}
+
+	if p.authConfig.TotpRequired && len(c.Request().Header.Get("Authorization")) == 0 {
+		var localData localProviderUserData
+		if err := json.Unmarshal(user.AuthProviderData, &localData); err != nil {
+			slog.Warn("unable to unmarshal auth provider data", "user", user.Username, "error", err)
+		} else if len(localData.TotpSecret) == 0 {
+			return nil, c.String(http.StatusForbidden, "Two-factor authentication is required")
+		}
+	}
+	return user, nil
+}
+
 func (p *localProvider) handlePasswordPage(c echo.Context, session *Session) error {
 	var csrfToken string
 	if cookie, err := c.Cookie(CsrfCookieName); err == nil {
@@ -317,6 +373,9 @@ func (p *localProvider) handlePasswordReset(c echo.Context) error {
 	if username == session.User.Username {
 		err := errors.New("users cannot reset their own password")
 		return server.EchoError(c, err, http.StatusBadRequest, err.Error())
+	} else if u.ServiceAccount {
+		err := errors.New("service accounts have no password")
+		return server.EchoError(c, err, http.StatusBadRequest, err.Error())
 	}
 
 	newPassword := c.FormValue("newPassword")
@@ -0,0 +1,262 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"image/png"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+
+	"github.com/foundriesio/dg-satellite/server"
+	"github.com/foundriesio/dg-satellite/server/ui/web/templates"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+const localTotpTemplate = "local-totp.html"
+
+const (
+	totpPeriod        = 30
+	totpRecoveryCodes = 10
+)
+
+// TotpResetter is implemented by providers which support two-factor authentication with TOTP.
+type TotpResetter interface {
+	// ResetTotp removes two-factor authentication of a user, who must enroll again if it is required.
+	ResetTotp(u *users.User, by string) error
+}
+
+// verifyTotp checks a TOTP or a recovery code of a user enrolled into two-factor authentication.
+// Users who are not enrolled pass without a code.
+// A time step of an accepted TOTP code and a used recovery code are saved, so that they cannot be replayed.
+func (p localProvider) verifyTotp(u *users.User, code string, now time.Time) (bool, error) {
+	var localData localProviderUserData
+	if err := json.Unmarshal(u.AuthProviderData, &localData); err != nil {
+		return false, fmt.Errorf("unable to unmarshal auth provider data: %w", err)
+	}
+	if len(localData.TotpSecret) == 0 {
+		return true, nil
+	}
+
+	reason := "Logged in with two-factor authentication"
+	if !localData.checkTotpCode(localData.TotpSecret, code, now) {
+		if !localData.useRecoveryCode(code) {
+			return false, nil
+		}
+		reason = fmt.Sprintf("Logged in with a recovery code, %d left", len(localData.TotpRecoveryCodes))
+	}
+
+	var err error
+	if u.AuthProviderData, err = json.Marshal(localData); err != nil {
+		return false, fmt.Errorf("unable to marshal auth provider data: %w", err)
+	} else if err = u.Update(reason); err != nil {
+		return false, fmt.Errorf("unable to update user: %w", err)
+	}
+	return true, nil
+}
+
+// checkTotpCode accepts a code of the current time step, or an adjacent one to allow for clock drift.
+// Time steps up to the last accepted one are refused.
+func (d *localProviderUserData) checkTotpCode(secret, code string, now time.Time) bool {
+	if len(code) != int(otp.DigitsSix) {
+		return false
+	}
+	counter := uint64(now.Unix()) / totpPeriod
+	for _, step := range []uint64{counter - 1, counter, counter + 1} {
+		if step <= d.TotpCounter {
+			continue
+		}
+		ok, err := hotp.ValidateCustom(code, step, secret, hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && ok {
+			d.TotpCounter = step
+			return true
+		}
+	}
+	return false
+}
+
+// useRecoveryCode removes a matching recovery code, which can only be used once.
+func (d *localProviderUserData) useRecoveryCode(code string) bool {
+	hashed := hashRecoveryCode(code)
+	idx := slices.IndexFunc(d.TotpRecoveryCodes, func(c string) bool {
+		return subtle.ConstantTimeCompare([]byte(c), []byte(hashed)) == 1
+	})
+	if idx < 0 {
+		return false
+	}
+	d.TotpRecoveryCodes = slices.Delete(d.TotpRecoveryCodes, idx, idx+1)
+	return true
+}
+
+// newRecoveryCodes replaces recovery codes of a user, and returns them in plain text to be shown once.
+// Codes have 80 random bits, so a fast hash is enough to store them.
+func (d *localProviderUserData) newRecoveryCodes() []string {
+	codes := make([]string, totpRecoveryCodes)
+	d.TotpRecoveryCodes = make([]string, totpRecoveryCodes)
+	for i := range codes {
+		text := strings.ToLower(rand.Text()[:16])
+		codes[i] = text[:4] + "-" + text[4:8] + "-" + text[8:12] + "-" + text[12:]
+		d.TotpRecoveryCodes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// handleTotpPage shows a QR code to enroll into two-factor authentication, or the enrollment status.
+// Each visit generates a new secret, which is only enabled once a user confirms it with a valid code.
+func (p *localProvider) handleTotpPage(c echo.Context, session *Session, message string) error {
+	var localData localProviderUserData
+	if err := json.Unmarshal(session.User.AuthProviderData, &localData); err != nil {
+		return server.EchoError(c, err, http.StatusInternalServerError, "Unable to unmarshal auth provider data")
+	}
+
+	var csrfToken string
+	if cookie, err := c.Cookie(CsrfCookieName); err == nil {
+		csrfToken = cookie.Value
+	}
+	context := struct {
+		Title         string
+		Message       string
+		User          *users.User
+		NavItems      []string
+		CsrfToken     string
+		Enabled       bool
+		RecoveryCodes int
+		Secret        string
+		QrCode        template.URL
+	}{
+		Title:         "Two-Factor Authentication",
+		Message:       message,
+		User:          session.User,
+		CsrfToken:     csrfToken,
+		Enabled:       len(localData.TotpSecret) > 0,
+		RecoveryCodes: len(localData.TotpRecoveryCodes),
+	}
+
+	if !context.Enabled {
+		key, err := totp.Generate(totp.GenerateOpts{
+			Issuer:      cmp.Or(p.authConfig.TotpIssuer, "dg-satellite"),
+			AccountName: session.User.Username,
+			Period:      totpPeriod,
+			Digits:      otp.DigitsSix,
+			Algorithm:   otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return server.EchoError(c, err, http.StatusInternalServerError, "Unable to generate TOTP secret")
+		}
+		img, err := key.Image(200, 200)
+		if err != nil {
+			return server.EchoError(c, err, http.StatusInternalServerError, "Unable to generate QR code")
+		}
+		var buf bytes.Buffer
+		if err = png.Encode(&buf, img); err != nil {
+			return server.EchoError(c, err, http.StatusInternalServerError, "Unable to encode QR code")
+		}
+		context.Secret = key.Secret()
+		context.QrCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+
+		localData.TotpPendingSecret = key.Secret()
+		if session.User.AuthProviderData, err = json.Marshal(localData); err != nil {
+			return server.EchoError(c, err, http.StatusInternalServerError, "Unable to marshal auth provider data")
+		} else if err = session.User.Update("Two-factor authentication enrollment started"); err != nil {
+			return server.EchoError(c, err, http.StatusInternalServerError, "Unable to update user")
+		}
+	}
+	return templates.Templates.ExecuteTemplate(c.Response(), localTotpTemplate, context)
+}
+
+func (p *localProvider) handleTotpGet(c echo.Context) error {
+	session, err := p.GetSession(c)
+	if err != nil || session == nil {
+		return err
+	} else if session.User.Username != c.Param("username") {
+		err := errors.New("users can only manage their own two-factor authentication")
+		return server.EchoError(c, err, http.StatusForbidden, err.Error())
+	}
+	return p.handleTotpPage(c, session, "")
+}
+
+// handleTotpEnroll enables two-factor authentication once a user confirms a secret with a valid code.
+// It returns recovery codes, which a user must save as they are never shown again.
+func (p *localProvider) handleTotpEnroll(c echo.Context) error {
+	session, err := p.GetSession(c)
+	if err != nil {
+		return server.EchoError(c, err, http.StatusInternalServerError, err.Error())
+	} else if session == nil {
+		err := errors.New("authentication required")
+		return server.EchoError(c, err, http.StatusUnauthorized, "authentication required")
+	}
+	u := session.User
+	if u.Username != c.Param("username") {
+		err := errors.New("users can only manage their own two-factor authentication")
+		return server.EchoError(c, err, http.StatusForbidden, err.Error())
+	}
+
+	var localData localProviderUserData
+	if err := json.Unmarshal(u.AuthProviderData, &localData); err != nil {
+		return server.EchoError(c, err, http.StatusInternalServerError, "Unable to unmarshal auth provider data")
+	} else if len(localData.TotpSecret) > 0 {
+		err := errors.New("two-factor authentication is already enabled")
+		return server.EchoError(c, err, http.StatusConflict, err.Error())
+	} else if len(localData.TotpPendingSecret) == 0 {
+		err := errors.New("two-factor authentication enrollment was not started")
+		return server.EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+
+	if !localData.checkTotpCode(localData.TotpPendingSecret, c.FormValue("code"), time.Now()) {
+		p.rateLimiter.FlagBadOperation(c)
+		err := errors.New("invalid authentication code")
+		return server.EchoError(c, err, http.StatusBadRequest, "Invalid authentication code")
+	}
+	localData.TotpSecret = localData.TotpPendingSecret
+	localData.TotpPendingSecret = ""
+	codes := localData.newRecoveryCodes()
+	if u.AuthProviderData, err = json.Marshal(localData); err != nil {
+		return server.EchoError(c, err, http.StatusInternalServerError, "Unable to marshal auth provider data")
+	} else if err = u.Update("Two-factor authentication enabled"); err != nil {
+		return server.EchoError(c, err, http.StatusInternalServerError, "Unable to update user")
+	}
+	return c.JSON(http.StatusOK, map[string][]string{"recovery-codes": codes})
+}
+
+// ResetTotp removes two-factor authentication of a user, e.g. when they lose their authenticator device.
+func (p localProvider) ResetTotp(u *users.User, by string) error {
+	var localData localProviderUserData
+	if err := json.Unmarshal(u.AuthProviderData, &localData); err != nil {
+		return fmt.Errorf("unable to unmarshal auth provider data: %w", err)
+	}
+	localData.TotpSecret = ""
+	localData.TotpPendingSecret = ""
+	localData.TotpRecoveryCodes = nil
+	var err error
+	if u.AuthProviderData, err = json.Marshal(localData); err != nil {
+		return fmt.Errorf("unable to marshal auth provider data: %w", err)
+	}
+	return u.Update("Two-factor authentication reset by " + by)
+}
@@ -0,0 +1,225 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/foundriesio/dg-satellite/context"
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+type localTestClient struct {
+	t     *testing.T
+	e     *echo.Echo
+	p     *localProvider
+	users *users.Storage
+}
+
+func newLocalTestClient(t *testing.T, config string) *localTestClient {
+	userStorage := newTestUserStorage(t)
+	cfg := storage.AuthConfig{
+		Type:                "local",
+		SessionTimeoutHours: 1,
+		RateLimits:          storage.RateLimitConfig{AttemptsPerSecond: 1000, BadAuthLimit: 1000},
+		Config:              json.RawMessage(config),
+	}
+	e := echo.New()
+	p := &localProvider{}
+	require.Nil(t, p.Configure(e, userStorage, &cfg))
+	_, _, err := p.CreateUser("alice", "alice-secret", []string{"devices:read"})
+	require.Nil(t, err)
+	return &localTestClient{t: t, e: e, p: p, users: userStorage}
+}
+
+func (tc *localTestClient) do(req *http.Request) *httptest.ResponseRecorder {
+	req.Header.Set("Accept", "text/html")
+	req = req.WithContext(context.CtxWithLog(tc.t.Context(), slog.Default()))
+	rec := httptest.NewRecorder()
+	tc.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func (tc *localTestClient) post(path string, session *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if session != nil {
+		req.AddCookie(session)
+	}
+	return tc.do(req)
+}
+
+// login returns a session cookie, or nil if a login fails.
+func (tc *localTestClient) login(code string) *http.Cookie {
+	rec := tc.post(AuthLoginPath, nil, url.Values{"username": {"alice"}, "password": {"alice-secret"}, "code": {code}})
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == AuthCookieName {
+			require.Equal(tc.t, http.StatusSeeOther, rec.Code)
+			return c
+		}
+	}
+	require.Equal(tc.t, http.StatusOK, rec.Code)
+	require.Contains(tc.t, rec.Body.String(), "Invalid username, password, or authentication code")
+	return nil
+}
+
+// getSession checks a session on a page other than the enrollment one, returning a rendered page if it is denied.
+func (tc *localTestClient) getSession(cookie *http.Cookie) (*Session, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/devices", nil)
+	req.Header.Set("Accept", "text/html")
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	session, err := tc.p.GetSession(tc.e.NewContext(req, rec))
+	require.Nil(tc.t, err)
+	return session, rec
+}
+
+// getUser authenticates a REST API request, returning a response if it is denied.
+func (tc *localTestClient) getUser(cookie *http.Cookie, token string) (*users.User, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/devices", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	u, err := tc.p.GetUser(tc.e.NewContext(req, rec))
+	require.Nil(tc.t, err)
+	return u, rec
+}
+
+func (tc *localTestClient) userData() localProviderUserData {
+	u, err := tc.users.Get("alice")
+	require.Nil(tc.t, err)
+	var data localProviderUserData
+	require.Nil(tc.t, json.Unmarshal(u.AuthProviderData, &data))
+	return data
+}
+
+func TestLocalProviderTotp(t *testing.T) {
+	tc := newLocalTestClient(t, `{"TotpRequired": true}`)
+
+	// Users who did not enroll yet can log in, but can only use the enrollment page.
+	session := tc.login("")
+	require.NotNil(t, session)
+	s, rec := tc.getSession(session)
+	require.Nil(t, s)
+	require.Contains(t, rec.Body.String(), "Two-factor authentication is required")
+
+	rec = tc.do(withCookie(httptest.NewRequest(http.MethodGet, "/users/alice/totp", nil), session))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "data:image/png;base64,")
+	secret := tc.userData().TotpPendingSecret
+	require.NotEmpty(t, secret)
+	require.Contains(t, rec.Body.String(), secret)
+
+	require.Equal(t, http.StatusBadRequest, tc.post("/users/alice/totp", session, url.Values{"code": {"000000"}}).Code)
+	now := time.Now()
+	code, err := totp.GenerateCode(secret, now)
+	require.Nil(t, err)
+	rec = tc.post("/users/alice/totp", session, url.Values{"code": {code}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var recovery map[string][]string
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &recovery))
+	require.Len(t, recovery["recovery-codes"], totpRecoveryCodes)
+	require.Equal(t, http.StatusConflict, tc.post("/users/alice/totp", session, url.Values{"code": {code}}).Code)
+
+	data := tc.userData()
+	require.Equal(t, secret, data.TotpSecret)
+	require.Empty(t, data.TotpPendingSecret)
+	s, _ = tc.getSession(session)
+	require.NotNil(t, s)
+
+	// Codes are required once enrolled, and cannot be replayed.
+	require.Nil(t, tc.login(""))
+	require.Nil(t, tc.login("123456"))
+	require.Nil(t, tc.login(code))
+	next, err := totp.GenerateCode(secret, now.Add(totpPeriod*time.Second))
+	require.Nil(t, err)
+	require.NotNil(t, tc.login(next))
+	require.Nil(t, tc.login(next))
+
+	// Recovery codes work once each.
+	require.NotNil(t, tc.login(strings.ToUpper(recovery["recovery-codes"][3])))
+	require.Nil(t, tc.login(recovery["recovery-codes"][3]))
+	require.Len(t, tc.userData().TotpRecoveryCodes, totpRecoveryCodes-1)
+
+	// Reset makes a user enroll again.
+	u, err := tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Nil(t, tc.p.ResetTotp(u, "root"))
+	session = tc.login("")
+	require.NotNil(t, session)
+	s, _ = tc.getSession(session)
+	require.Nil(t, s)
+	log, err := u.GetAuditLog()
+	require.Nil(t, err)
+	require.Contains(t, log, "Two-factor authentication enabled")
+	require.Contains(t, log, "Logged in with a recovery code, 9 left")
+	require.Contains(t, log, "Two-factor authentication reset by root")
+}
+
+func TestLocalProviderTotpApi(t *testing.T) {
+	tc := newLocalTestClient(t, `{"TotpRequired": true}`)
+
+	// A session cookie must not get around the enrollment page when calling the REST API.
+	session := tc.login("")
+	require.NotNil(t, session)
+	u, rec := tc.getUser(session, "")
+	require.Nil(t, u)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "Two-factor authentication is required")
+
+	// API tokens are used by scripts, which cannot enroll.
+	alice, err := tc.users.Get("alice")
+	require.Nil(t, err)
+	token, err := alice.GenerateToken("cli", time.Now().Add(time.Hour).Unix(), users.ScopeDevicesR)
+	require.Nil(t, err)
+	u, _ = tc.getUser(nil, token.Value)
+	require.NotNil(t, u)
+	require.Equal(t, "alice", u.Username)
+
+	require.Equal(t, http.StatusOK, tc.do(withCookie(httptest.NewRequest(http.MethodGet, "/users/alice/totp", nil), session)).Code)
+	code, err := totp.GenerateCode(tc.userData().TotpPendingSecret, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, tc.post("/users/alice/totp", session, url.Values{"code": {code}}).Code)
+	u, _ = tc.getUser(session, "")
+	require.NotNil(t, u)
+	require.Equal(t, "alice", u.Username)
+}
+
+func TestLocalProviderTotpOptional(t *testing.T) {
+	tc := newLocalTestClient(t, `{}`)
+	session := tc.login("")
+	require.NotNil(t, session)
+	s, _ := tc.getSession(session)
+	require.NotNil(t, s)
+	u, _ := tc.getUser(session, "")
+	require.NotNil(t, u)
+
+	// Users may only manage their own two-factor authentication.
+	require.Nil(t, tc.users.Create(&users.User{Username: "bob", AllowedScopes: users.ScopeDevicesR}))
+	rec := tc.do(withCookie(httptest.NewRequest(http.MethodGet, "/users/bob/totp", nil), session))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, http.StatusForbidden, tc.post("/users/bob/totp", session, url.Values{"code": {"123456"}}).Code)
+	require.Equal(t, http.StatusBadRequest, tc.post("/users/alice/totp", session, url.Values{"code": {"123456"}}).Code)
+}
+
+func withCookie(req *http.Request, cookie *http.Cookie) *http.Request {
+	req.AddCookie(cookie)
+	return req
+}
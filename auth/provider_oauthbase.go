@@ -20,6 +20,8 @@ import (
 	"golang.org/x/oauth2"
 )
 
+const oauthNonceCookieName = "dg-oauthnonce"
+
 type authConfigOauth2 struct {
 	ClientID     string
 	ClientSecret string
@@ -32,8 +34,9 @@ type oauth2BaseProvider struct {
 	displayName string
 
 	checkToken func(echo.Context, *oauth2.Token) (*users.User, error)
+	// useNonce makes a login send a nonce, which checkToken must find in an ID token.
+	useNonce bool
 
-	newUserScopes  users.Scopes
 	oauthConfig    *oauth2.Config
 	loginTip       string
 	sessionTimeout time.Duration
@@ -53,10 +56,8 @@ func (p *oauth2BaseProvider) configure(e *echo.Echo, usersStorage *users.Storage
 		return fmt.Errorf("unable to unmarshal oauth2 config: %w", err)
 	}
 
-	var err error
-	p.newUserScopes, err = users.ScopesFromSlice(cfg.NewUserDefaultScopes)
-	if err != nil {
-		return fmt.Errorf("unable to parse new user default scopes: %w", err)
+	if err := p.configureUserScopes(cfg); err != nil {
+		return err
 	}
 	p.users = usersStorage
 	p.rateLimiter = NewRateLimiter(cfg.RateLimits)
@@ -68,6 +69,15 @@ func (p *oauth2BaseProvider) configure(e *echo.Echo, usersStorage *users.Storage
 	return nil
 }
 
+// upsertUser returns a user who logged in, creating them on their first login.
+func (p oauth2BaseProvider) upsertUser(c echo.Context, username, email string, groups []string) (*users.User, error) {
+	user, rc, err := p.provisionUser(username, email, groups)
+	if err != nil {
+		return nil, c.String(rc, err.Error())
+	}
+	return user, nil
+}
+
 func (p oauth2BaseProvider) renderLoginPage(c echo.Context, reason string) error {
 	accepts := c.Request().Header.Get("Accept")
 	if !strings.Contains(accepts, "text/html") {
@@ -99,7 +109,11 @@ func (p oauth2BaseProvider) renderLoginPage(c echo.Context, reason string) error
 
 func (p oauth2BaseProvider) handleLogin(c echo.Context) error {
 	oauthState := generateStateOauthCookie(c)
-	u := p.oauthConfig.AuthCodeURL(oauthState, oauth2.AccessTypeOffline)
+	opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOffline}
+	if p.useNonce {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", generateNonceOauthCookie(c)))
+	}
+	u := p.oauthConfig.AuthCodeURL(oauthState, opts...)
 	return c.Redirect(http.StatusTemporaryRedirect, u)
 }
 
@@ -129,21 +143,9 @@ func (p oauth2BaseProvider) handleOauthCallback(c echo.Context) error {
 		return err
 	}
 
-	expires := time.Now().Add(p.sessionTimeout)
-	sessionId, err := user.CreateSession(c.RealIP(), expires.Unix(), user.AllowedScopes)
-	if err != nil {
+	if err = createSession(c, user, p.sessionTimeout); err != nil {
 		return c.String(http.StatusInternalServerError, "Could not create user session")
 	}
-	c.SetCookie(&http.Cookie{
-		Name:     AuthCookieName,
-		Value:    sessionId,
-		Path:     "/",
-		Expires:  expires,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-	})
-	SetCsrfCookie(c, expires)
 
 	// Return an HTML page that performs a same-site navigation instead of
 	// a direct redirect. Browsers won't send SameSiteStrict cookies on a
@@ -156,15 +158,33 @@ func (p oauth2BaseProvider) handleOauthCallback(c echo.Context) error {
 }
 
 func generateStateOauthCookie(c echo.Context) string {
+	return generateOauthCookie(c, "dg-oauthstate")
+}
+
+func generateNonceOauthCookie(c echo.Context) string {
+	return generateOauthCookie(c, oauthNonceCookieName)
+}
+
+func generateOauthCookie(c echo.Context, name string) string {
 	expiration := time.Now().Add(1 * time.Hour)
-	state := rand.Text()
+	value := rand.Text()
 	c.SetCookie(&http.Cookie{
-		Name:     "dg-oauthstate",
-		Value:    state,
+		Name:     name,
+		Value:    value,
 		Expires:  expiration,
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
 	})
-	return state
+	return value
+}
+
+func expireOauthCookie(c echo.Context, name string) {
+	c.SetCookie(&http.Cookie{
+		Name:     name,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
@@ -0,0 +1,230 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+	"gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+const oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+type authConfigOidc struct {
+	authConfigOauth2
+	// Issuer is an identifier of the identity provider, e.g. https://keycloak.example.com/realms/acme.
+	Issuer string
+	// DisplayName is shown on the login page, "OpenID Connect" by default.
+	DisplayName string
+	// Scopes are requested in addition to "openid", "email" and "profile".
+	Scopes []string
+	// UsernameClaim and EmailClaim name ID token claims holding user details.
+	// They default to "sub" and "email": many providers let users change
+	// their "preferred_username", which would let them take over other accounts.
+	UsernameClaim string
+	EmailClaim    string
+	// GroupsClaim names an ID token claim listing user groups, "groups" by default.
+	GroupsClaim string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	oauth2BaseProvider
+
+	issuer        string
+	usernameClaim string
+	emailClaim    string
+	groupsClaim   string
+	jwksUri       string
+	client        *http.Client
+
+	keysLock sync.Mutex
+	keys     *jose.JSONWebKeySet
+}
+
+func (p *oidcProvider) Configure(e *echo.Echo, userStorage *users.Storage, cfg *storage.AuthConfig) error {
+	var cfgOidc authConfigOidc
+	if err := json.Unmarshal(cfg.Config, &cfgOidc); err != nil {
+		return fmt.Errorf("unable to unmarshal oidc config: %w", err)
+	}
+	if len(cfgOidc.Issuer) == 0 {
+		return errors.New("oidc config requires an Issuer")
+	}
+	if p.client == nil {
+		p.client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJson(strings.TrimSuffix(cfgOidc.Issuer, "/")+oidcDiscoveryPath, &discovery); err != nil {
+		return fmt.Errorf("unable to discover oidc issuer configuration: %w", err)
+	}
+	// An ID token issuer must match the discovered issuer exactly, so reject a misconfiguration early.
+	if discovery.Issuer != cfgOidc.Issuer {
+		return fmt.Errorf("oidc issuer mismatch: configured %s, discovered %s", cfgOidc.Issuer, discovery.Issuer)
+	}
+	if len(discovery.AuthorizationEndpoint) == 0 || len(discovery.TokenEndpoint) == 0 || len(discovery.JwksUri) == 0 {
+		return errors.New("oidc issuer configuration lacks required endpoints")
+	}
+
+	p.issuer = discovery.Issuer
+	p.jwksUri = discovery.JwksUri
+	p.keys = nil
+	p.usernameClaim = cmp.Or(cfgOidc.UsernameClaim, "sub")
+	p.emailClaim = cmp.Or(cfgOidc.EmailClaim, "email")
+	p.groupsClaim = cmp.Or(cfgOidc.GroupsClaim, "groups")
+	p.displayName = cmp.Or(cfgOidc.DisplayName, "OpenID Connect")
+	p.oauthConfig = &oauth2.Config{
+		RedirectURL:  cfgOidc.BaseUrl + AuthCallbackPath,
+		ClientID:     cfgOidc.ClientID,
+		ClientSecret: cfgOidc.ClientSecret,
+		Scopes:       append([]string{"openid", "email", "profile"}, cfgOidc.Scopes...),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}
+	return p.configure(e, userStorage, cfg)
+}
+
+func (p *oidcProvider) userFromToken(c echo.Context, token *oauth2.Token) (*users.User, error) {
+	idTok, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, c.String(http.StatusBadRequest, "Missing ID token")
+	}
+	claims, err := p.verifyIdToken(idTok)
+	if err != nil {
+		slog.Warn("invalid oidc ID token", "error", err)
+		return nil, c.String(http.StatusUnauthorized, fmt.Sprintf("Invalid ID token: %v", err))
+	}
+
+	nonce, err := c.Cookie(oauthNonceCookieName)
+	if err != nil {
+		return nil, c.String(http.StatusBadRequest, "Could not read oauth nonce cookie")
+	}
+	tokNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokNonce), []byte(nonce.Value)) != 1 {
+		return nil, c.String(http.StatusUnauthorized, "Invalid ID token nonce")
+	}
+	expireOauthCookie(c, oauthNonceCookieName)
+
+	username, _ := claims[p.usernameClaim].(string)
+	if len(username) == 0 {
+		return nil, c.String(http.StatusUnauthorized, fmt.Sprintf("ID token lacks a %s claim", p.usernameClaim))
+	}
+	email, _ := claims[p.emailClaim].(string)
+	var groups []string
+	// Some providers send a single group as a string rather than a list.
+	switch v := claims[p.groupsClaim].(type) {
+	case string:
+		groups = []string{v}
+	case []any:
+		for _, g := range v {
+			if group, ok := g.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	}
+	return p.upsertUser(c, username, email, groups)
+}
+
+// verifyIdToken checks an ID token signature, issuer, audience, and expiry, and returns all its claims.
+func (p *oidcProvider) verifyIdToken(idTok string) (map[string]any, error) {
+	tok, err := jwt.ParseSigned(idTok)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse: %w", err)
+	} else if len(tok.Headers) != 1 {
+		return nil, errors.New("must have exactly one signature")
+	}
+
+	keys, err := p.getKeys(tok.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+	var std jwt.Claims
+	var claims map[string]any
+	if err = tok.Claims(keys, &std, &claims); err != nil {
+		return nil, fmt.Errorf("could not verify signature: %w", err)
+	}
+	expected := jwt.Expected{
+		Issuer:   p.issuer,
+		Audience: jwt.Audience{p.oauthConfig.ClientID},
+		Time:     time.Now(),
+	}
+	if err = std.Validate(expected); err != nil {
+		return nil, err
+	} else if std.Expiry == nil {
+		return nil, errors.New("no expiry")
+	}
+	return claims, nil
+}
+
+// getKeys returns issuer signing keys, refetching them once a token is signed by an unknown key.
+// This follows key rotations of the issuer.
+func (p *oidcProvider) getKeys(keyId string) (*jose.JSONWebKeySet, error) {
+	p.keysLock.Lock()
+	defer p.keysLock.Unlock()
+	if p.keys == nil || len(p.keys.Key(keyId)) == 0 {
+		var keys jose.JSONWebKeySet
+		if err := p.getJson(p.jwksUri, &keys); err != nil {
+			return nil, fmt.Errorf("unable to fetch issuer keys: %w", err)
+		}
+		p.keys = &keys
+	}
+	return p.keys, nil
+}
+
+func (p *oidcProvider) getJson(url string, dst any) error {
+	res, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			slog.Warn("unable to close oidc response body", "url", url, "error", err)
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %d from %s", res.StatusCode, url)
+	}
+	if err = json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return fmt.Errorf("unable to parse response from %s: %w", url, err)
+	}
+	return nil
+}
+
+func newOidcProvider() *oidcProvider {
+	p := &oidcProvider{
+		oauth2BaseProvider: oauth2BaseProvider{
+			name:     "oidc",
+			useNonce: true,
+		},
+	}
+	p.checkToken = p.userFromToken
+	return p
+}
+
+func init() {
+	RegisterProvider(newOidcProvider())
+}
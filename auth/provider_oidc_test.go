@@ -0,0 +1,349 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+
+	"github.com/foundriesio/dg-satellite/context"
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+// mockIssuer is a minimal OpenID Connect issuer, which returns an ID token built by a test for any code.
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	keyId  string
+	// idToken returns claims of the next ID token, given a nonce sent by a login.
+	idToken func(nonce string) map[string]any
+	// signKey overrides a key used to sign the next ID token.
+	signKey *rsa.PrivateKey
+	nonce   string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	m := &mockIssuer{t: t, key: key, keyId: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		m.writeJson(w, map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		m.writeJson(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: m.key.Public(), KeyID: m.keyId, Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		signKey := m.key
+		if m.signKey != nil {
+			signKey = m.signKey
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{
+			Algorithm: jose.RS256,
+			Key:       jose.JSONWebKey{Key: signKey, KeyID: m.keyId},
+		}, nil)
+		require.Nil(m.t, err)
+		idToken, err := jwt.Signed(signer).Claims(m.idToken(m.nonce)).CompactSerialize()
+		require.Nil(m.t, err)
+		m.writeJson(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	require.Nil(m.t, json.NewEncoder(w).Encode(v))
+}
+
+func (m *mockIssuer) claims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":                m.server.URL,
+		"aud":                "client-id",
+		"sub":                "alice",
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"preferred_username": "Alice",
+		"email":              "alice@example.com",
+	}
+}
+
+type oidcTestClient struct {
+	t      *testing.T
+	e      *echo.Echo
+	issuer *mockIssuer
+	users  *users.Storage
+}
+
+func newTestUserStorage(t *testing.T) *users.Storage {
+	tmpdir := t.TempDir()
+	db, err := storage.NewDb(filepath.Join(tmpdir, "sql.db"))
+	require.Nil(t, err)
+	fs, err := storage.NewFs(tmpdir)
+	require.Nil(t, err)
+	require.Nil(t, fs.Auth.InitHmacSecret())
+	userStorage, err := users.NewStorage(db, fs)
+	require.Nil(t, err)
+	return userStorage
+}
+
+func newOidcTestClient(t *testing.T, groupScopes map[string][]string) *oidcTestClient {
+	userStorage := newTestUserStorage(t)
+	issuer := newMockIssuer(t)
+	issuer.idToken = issuer.claims
+	cfg := storage.AuthConfig{
+		Type:                 "oidc",
+		SessionTimeoutHours:  1,
+		NewUserDefaultScopes: []string{"devices:read"},
+		GroupScopes:          groupScopes,
+		RateLimits:           storage.RateLimitConfig{AttemptsPerSecond: 1000},
+		Config: json.RawMessage(`{
+			"ClientID": "client-id",
+			"ClientSecret": "client-secret",
+			"BaseUrl": "https://dg.example.com",
+			"Issuer": "` + issuer.server.URL + `"
+		}`),
+	}
+	e := echo.New()
+	p := newOidcProvider()
+	require.Nil(t, p.Configure(e, userStorage, &cfg))
+	return &oidcTestClient{t: t, e: e, issuer: issuer, users: userStorage}
+}
+
+func (tc *oidcTestClient) do(req *http.Request) *httptest.ResponseRecorder {
+	req = req.WithContext(context.CtxWithLog(tc.t.Context(), slog.Default()))
+	rec := httptest.NewRecorder()
+	tc.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// login goes through a login redirect and a callback, and returns the callback response.
+func (tc *oidcTestClient) login() *httptest.ResponseRecorder {
+	rec := tc.do(httptest.NewRequest(http.MethodGet, AuthLoginPath, nil))
+	require.Equal(tc.t, http.StatusTemporaryRedirect, rec.Code)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.Nil(tc.t, err)
+	require.Equal(tc.t, tc.issuer.server.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	query := location.Query()
+	require.Equal(tc.t, "client-id", query.Get("client_id"))
+	require.Equal(tc.t, "https://dg.example.com"+AuthCallbackPath, query.Get("redirect_uri"))
+	require.NotEmpty(tc.t, query.Get("nonce"))
+	tc.issuer.nonce = query.Get("nonce")
+
+	req := httptest.NewRequest(http.MethodGet, AuthCallbackPath+"?code=code&state="+query.Get("state"), nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return tc.do(req)
+}
+
+func TestOidcProvider(t *testing.T) {
+	tc := newOidcTestClient(t, nil)
+
+	rec := tc.login()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var session, nonce *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		switch c.Name {
+		case AuthCookieName:
+			session = c
+		case oauthNonceCookieName:
+			nonce = c
+		}
+	}
+	require.NotNil(t, session)
+	require.NotNil(t, nonce, "nonce cookie must be expired once used")
+	require.Less(t, nonce.MaxAge, 0)
+	u, err := tc.users.GetBySession(session.Value)
+	require.Nil(t, err)
+	require.NotNil(t, u)
+	require.Equal(t, "alice", u.Username)
+	require.Equal(t, "alice@example.com", u.Email)
+	require.Equal(t, users.ScopeDevicesR, u.AllowedScopes)
+
+	for name, claims := range map[string]func(nonce string) map[string]any{
+		"audience": func(nonce string) map[string]any {
+			c := tc.issuer.claims(nonce)
+			c["aud"] = "other-client"
+			return c
+		},
+		"issuer": func(nonce string) map[string]any {
+			c := tc.issuer.claims(nonce)
+			c["iss"] = "https://evil.example.com"
+			return c
+		},
+		"nonce": func(nonce string) map[string]any {
+			return tc.issuer.claims("replayed")
+		},
+		"expiry": func(nonce string) map[string]any {
+			c := tc.issuer.claims(nonce)
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+			return c
+		},
+		"no expiry": func(nonce string) map[string]any {
+			c := tc.issuer.claims(nonce)
+			delete(c, "exp")
+			return c
+		},
+		"username": func(nonce string) map[string]any {
+			c := tc.issuer.claims(nonce)
+			delete(c, "sub")
+			return c
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tc.issuer.idToken = claims
+			rec := tc.login()
+			require.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+		})
+	}
+
+	t.Run("preferred username", func(t *testing.T) {
+		// Users may change their preferred username, so it must not select an account.
+		require.Nil(t, tc.users.Create(&users.User{Username: "bob", AllowedScopes: users.ScopeDevicesR}))
+		tc.issuer.idToken = func(nonce string) map[string]any {
+			c := tc.issuer.claims(nonce)
+			c["preferred_username"] = "bob"
+			return c
+		}
+		rec := tc.login()
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == AuthCookieName {
+				u, err := tc.users.GetBySession(c.Value)
+				require.Nil(t, err)
+				require.Equal(t, "alice", u.Username)
+			}
+		}
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		tc.issuer.idToken = tc.issuer.claims
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.Nil(t, err)
+		tc.issuer.signKey = otherKey
+		rec := tc.login()
+		require.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+		tc.issuer.signKey = nil
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		tc.issuer.idToken = tc.issuer.claims
+		newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.Nil(t, err)
+		tc.issuer.key = newKey
+		tc.issuer.keyId = "key-2"
+		rec := tc.login()
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	})
+}
+
+func TestOidcProviderGroupScopes(t *testing.T) {
+	tc := newOidcTestClient(t, map[string][]string{
+		"fleet-viewers": {"devices:read", "updates:read"},
+		"fleet-admins":  {"devices:read-update", "users:read"},
+	})
+	withGroups := func(groups ...any) func(string) map[string]any {
+		return func(nonce string) map[string]any {
+			c := tc.issuer.claims(nonce)
+			c["groups"] = groups
+			return c
+		}
+	}
+
+	// Users not in any mapped group are not created.
+	tc.issuer.idToken = withGroups("other")
+	require.Equal(t, http.StatusForbidden, tc.login().Code)
+	u, err := tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Nil(t, u)
+
+	tc.issuer.idToken = withGroups("fleet-viewers", "fleet-admins", "other")
+	require.Equal(t, http.StatusOK, tc.login().Code)
+	u, err = tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Equal(t, users.ScopeDevicesRU|users.ScopeUpdatesR|users.ScopeUsersR, u.AllowedScopes)
+
+	// Scopes follow group membership at each login, overriding manual changes.
+	u.AllowedScopes = users.ScopeUsersD
+	require.Nil(t, u.Update("test"))
+	tc.issuer.idToken = withGroups("fleet-viewers")
+	require.Equal(t, http.StatusOK, tc.login().Code)
+	u, err = tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Equal(t, users.ScopeDevicesR|users.ScopeUpdatesR, u.AllowedScopes)
+
+	// Removing a user from all groups revokes their access.
+	tc.issuer.idToken = withGroups()
+	require.Equal(t, http.StatusForbidden, tc.login().Code)
+	u, err = tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Equal(t, users.Scopes(0), u.AllowedScopes)
+	log, err := u.GetAuditLog()
+	require.Nil(t, err)
+	require.Contains(t, log, "Scopes changed by group membership: fleet-viewers")
+
+	// A single group may be sent as a string.
+	tc.issuer.idToken = func(nonce string) map[string]any {
+		c := tc.issuer.claims(nonce)
+		c["groups"] = "fleet-admins"
+		return c
+	}
+	require.Equal(t, http.StatusOK, tc.login().Code)
+	u, err = tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Equal(t, users.ScopeDevicesRU|users.ScopeUsersR, u.AllowedScopes)
+
+	// An identity provider cannot log in as a service account, nor change its scopes.
+	_, err = tc.users.CreateServiceAccount("ci", "alice", users.ScopeDevicesR, "alice")
+	require.Nil(t, err)
+	tc.issuer.idToken = func(nonce string) map[string]any {
+		c := withGroups("fleet-admins")(nonce)
+		c["sub"] = "ci"
+		return c
+	}
+	require.Equal(t, http.StatusForbidden, tc.login().Code)
+	u, err = tc.users.Get("ci")
+	require.Nil(t, err)
+	require.Equal(t, users.ScopeDevicesR, u.AllowedScopes)
+}
+
+func TestOidcProviderIssuerMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	cfg := storage.AuthConfig{
+		Type:   "oidc",
+		Config: json.RawMessage(`{"ClientID": "client-id", "Issuer": "` + issuer.server.URL + `/"}`),
+	}
+	err := newOidcProvider().Configure(echo.New(), nil, &cfg)
+	require.ErrorContains(t, err, "oidc issuer mismatch")
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+type authConfigProxy struct {
+	// TrustedProxies lists CIDRs of reverse proxies allowed to set identity headers, e.g. "10.0.0.5/32".
+	TrustedProxies []string
+	// UserHeader holds a username, "X-Forwarded-User" by default.
+	UserHeader string
+	// EmailHeader holds an email of a user, "X-Forwarded-Email" by default.
+	EmailHeader string
+	// GroupsHeader holds a comma separated list of user groups, "X-Forwarded-Groups" by default.
+	GroupsHeader string
+}
+
+// proxyProvider trusts a reverse proxy, like oauth2-proxy or Authelia, which authenticates users
+// and passes their identity in request headers. There is no login page and no server side session;
+// every request is authenticated by a proxy, except for API token requests.
+type proxyProvider struct {
+	commonProvider
+	cfg            authConfigProxy
+	trusted        []*net.IPNet
+	sessionTimeout time.Duration
+}
+
+func (p proxyProvider) Name() string {
+	return "proxy"
+}
+
+func (p *proxyProvider) Configure(e *echo.Echo, userStorage *users.Storage, cfg *storage.AuthConfig) error {
+	p.cfg = authConfigProxy{}
+	if err := json.Unmarshal(cfg.Config, &p.cfg); err != nil {
+		return fmt.Errorf("unable to unmarshal proxy config: %w", err)
+	}
+	if len(p.cfg.TrustedProxies) == 0 {
+		return errors.New("proxy config requires TrustedProxies")
+	}
+	p.trusted = nil
+	for _, cidr := range p.cfg.TrustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid proxy TrustedProxies entry: %w", err)
+		}
+		p.trusted = append(p.trusted, ipNet)
+	}
+	p.cfg.UserHeader = cmp.Or(p.cfg.UserHeader, "X-Forwarded-User")
+	p.cfg.EmailHeader = cmp.Or(p.cfg.EmailHeader, "X-Forwarded-Email")
+	p.cfg.GroupsHeader = cmp.Or(p.cfg.GroupsHeader, "X-Forwarded-Groups")
+
+	if err := p.configureUserScopes(cfg); err != nil {
+		return err
+	}
+	p.users = userStorage
+	p.rateLimiter = NewRateLimiter(cfg.RateLimits)
+	p.renderer = p
+	p.sessionTimeout = time.Duration(cfg.SessionTimeoutHours) * time.Hour
+	return nil
+}
+
+func (p proxyProvider) renderLoginPage(c echo.Context, reason string) error {
+	return c.String(http.StatusUnauthorized, cmp.Or(reason, "Request was not authenticated by a trusted proxy"))
+}
+
+// isTrustedProxy tells if a request comes directly from a trusted proxy.
+// A peer address is used rather than c.RealIP, which is taken from headers any client can set.
+func (p proxyProvider) isTrustedProxy(c echo.Context) bool {
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, ipNet := range p.trusted {
+		if ip != nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyUser returns a user set by a trusted proxy in request headers, or renders an error if there is none.
+func (p *proxyProvider) proxyUser(c echo.Context) (*users.User, error) {
+	header := c.Request().Header
+	username := strings.TrimSpace(header.Get(p.cfg.UserHeader))
+	if len(username) == 0 {
+		return nil, p.renderLoginPage(c, "")
+	} else if !p.isTrustedProxy(c) {
+		slog.Warn("Ignoring identity headers from an untrusted address", "address", c.Request().RemoteAddr, "user", username)
+		return nil, p.renderLoginPage(c, "")
+	}
+
+	var groups []string
+	for _, group := range strings.Split(header.Get(p.cfg.GroupsHeader), ",") {
+		if group = strings.TrimSpace(group); len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	user, rc, err := p.provisionUser(username, strings.TrimSpace(header.Get(p.cfg.EmailHeader)), groups)
+	if err != nil {
+		slog.Warn("Unable to provision a proxy user", "user", username, "groups", groups, "error", err)
+		return nil, c.String(rc, err.Error())
+	}
+	return user, nil
+}
+
+func (p *proxyProvider) GetUser(c echo.Context) (*users.User, error) {
+	if len(c.Request().Header.Get("Authorization")) > 0 {
+		return p.commonProvider.GetUser(c)
+	}
+	return p.proxyUser(c)
+}
+
+func (p *proxyProvider) GetSession(c echo.Context) (*Session, error) {
+	user, err := p.proxyUser(c)
+	if user == nil || err != nil {
+		return nil, err
+	}
+	if _, err = c.Cookie(CsrfCookieName); err != nil {
+		// Web pages read a CSRF token from a request, so it is added there as well.
+		token := SetCsrfCookie(c, time.Now().Add(p.sessionTimeout))
+		c.Request().AddCookie(&http.Cookie{Name: CsrfCookieName, Value: token})
+	}
+	// Web pages call the REST API through a proxy, which authenticates them with its own cookies.
+	return &Session{
+		BaseUrl: c.Scheme() + "://" + c.Request().Host,
+		User:    user,
+		Client:  newHttpClientWithCookies(c.Request().Cookies()),
+	}, nil
+}
+
+// DropSession does nothing, as sessions are kept by a proxy; users must log out there.
+func (p *proxyProvider) DropSession(echo.Context, *Session) {
+}
+
+func init() {
+	RegisterProvider(&proxyProvider{})
+}
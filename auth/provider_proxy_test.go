@@ -0,0 +1,146 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package auth
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/foundriesio/dg-satellite/context"
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+type proxyTestClient struct {
+	t     *testing.T
+	p     *proxyProvider
+	users *users.Storage
+}
+
+func newProxyTestClient(t *testing.T, cfg storage.AuthConfig) *proxyTestClient {
+	userStorage := newTestUserStorage(t)
+	cfg.Type = "proxy"
+	cfg.SessionTimeoutHours = 1
+	cfg.RateLimits = storage.RateLimitConfig{AttemptsPerSecond: 1000, BadAuthLimit: 1000}
+	p := &proxyProvider{}
+	require.Nil(t, p.Configure(echo.New(), userStorage, &cfg))
+	return &proxyTestClient{t: t, p: p, users: userStorage}
+}
+
+func (tc *proxyTestClient) request(remoteAddr string, headers ...string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/devices", nil)
+	req.RemoteAddr = remoteAddr
+	for i := 0; i < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	req = req.WithContext(context.CtxWithLog(tc.t.Context(), slog.Default()))
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func (tc *proxyTestClient) getUser(remoteAddr string, headers ...string) (*users.User, *httptest.ResponseRecorder) {
+	c, rec := tc.request(remoteAddr, headers...)
+	u, err := tc.p.GetUser(c)
+	require.Nil(tc.t, err)
+	return u, rec
+}
+
+func TestProxyProvider(t *testing.T) {
+	tc := newProxyTestClient(t, storage.AuthConfig{
+		NewUserDefaultScopes: []string{"devices:read"},
+		Config:               json.RawMessage(`{"TrustedProxies": ["10.0.0.0/24", "::1/128"]}`),
+	})
+
+	u, _ := tc.getUser("10.0.0.5:4321", "X-Forwarded-User", "alice", "X-Forwarded-Email", "alice@example.com")
+	require.NotNil(t, u)
+	require.Equal(t, "alice", u.Username)
+	require.Equal(t, "alice@example.com", u.Email)
+	require.Equal(t, users.ScopeDevicesR, u.AllowedScopes)
+	u, _ = tc.getUser("[::1]:4321", "X-Forwarded-User", "alice")
+	require.NotNil(t, u)
+	require.Equal(t, "alice", u.Username)
+
+	// Identity headers are ignored unless a peer is a trusted proxy, whatever X-Forwarded-For says.
+	u, rec := tc.getUser("10.0.1.5:4321", "X-Forwarded-User", "alice", "X-Forwarded-For", "10.0.0.5")
+	require.Nil(t, u)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	u, rec = tc.getUser("10.0.0.5:4321")
+	require.Nil(t, u)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// API tokens work without a proxy.
+	alice, err := tc.users.Get("alice")
+	require.Nil(t, err)
+	token, err := alice.GenerateToken("cli", time.Now().Add(time.Hour).Unix(), users.ScopeDevicesR)
+	require.Nil(t, err)
+	u, _ = tc.getUser("192.0.2.1:4321", "Authorization", "Bearer "+token.Value)
+	require.NotNil(t, u)
+	require.Equal(t, "alice", u.Username)
+
+	// Service accounts can't be impersonated by a proxy.
+	_, err = tc.users.CreateServiceAccount("ci", "alice", users.ScopeDevicesR, "alice")
+	require.Nil(t, err)
+	u, rec = tc.getUser("10.0.0.5:4321", "X-Forwarded-User", "ci")
+	require.Nil(t, u)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Web pages get a CSRF token, and call the REST API with cookies of a proxy.
+	c, rec := tc.request("10.0.0.5:4321", "X-Forwarded-User", "alice", "Cookie", "_oauth2_proxy=secret")
+	session, err := tc.p.GetSession(c)
+	require.Nil(t, err)
+	require.NotNil(t, session)
+	require.Equal(t, "alice", session.User.Username)
+	csrf, err := c.Cookie(CsrfCookieName)
+	require.Nil(t, err)
+	require.Contains(t, rec.Header().Get("Set-Cookie"), CsrfCookieName+"="+csrf.Value)
+	cookies := session.Client.Transport.(*cookieRoundTripper).cookies
+	require.Len(t, cookies, 2)
+	require.Equal(t, "_oauth2_proxy", cookies[0].Name)
+}
+
+func TestProxyProviderGroupScopes(t *testing.T) {
+	tc := newProxyTestClient(t, storage.AuthConfig{
+		GroupScopes: map[string][]string{
+			"fleet-viewers": {"devices:read", "updates:read"},
+			"fleet-admins":  {"devices:read-update", "users:read"},
+		},
+		Config: json.RawMessage(`{
+			"TrustedProxies": ["127.0.0.1/32"],
+			"UserHeader": "Remote-User",
+			"EmailHeader": "Remote-Email",
+			"GroupsHeader": "Remote-Groups"
+		}`),
+	})
+
+	u, _ := tc.getUser("127.0.0.1:4321", "Remote-User", "alice", "Remote-Groups", "fleet-viewers, fleet-admins")
+	require.NotNil(t, u)
+	require.Equal(t, users.ScopeDevicesRU|users.ScopeUpdatesR|users.ScopeUsersR, u.AllowedScopes)
+
+	// Removing a user from all groups revokes their access.
+	u, rec := tc.getUser("127.0.0.1:4321", "Remote-User", "alice", "Remote-Groups", "other")
+	require.Nil(t, u)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	u, err := tc.users.Get("alice")
+	require.Nil(t, err)
+	require.Equal(t, users.Scopes(0), u.AllowedScopes)
+}
+
+func TestProxyProviderConfig(t *testing.T) {
+	for name, tt := range map[string]struct{ config, err string }{
+		"no proxies": {`{}`, "requires TrustedProxies"},
+		"bad cidr":   {`{"TrustedProxies": ["10.0.0.5"]}`, "invalid proxy TrustedProxies entry"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := storage.AuthConfig{Type: "proxy", Config: json.RawMessage(tt.config)}
+			require.ErrorContains(t, (&proxyProvider{}).Configure(echo.New(), nil, &cfg), tt.err)
+		})
+	}
+}
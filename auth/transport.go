@@ -9,17 +9,21 @@ import (
 )
 
 func newHttpClientWithSessionCookie(cookie *http.Cookie) *http.Client {
+	return newHttpClientWithCookies([]*http.Cookie{cookie})
+}
+
+func newHttpClientWithCookies(cookies []*http.Cookie) *http.Client {
 	return &http.Client{
 		Transport: &cookieRoundTripper{
-			base:   http.DefaultTransport,
-			cookie: cookie,
+			base:    http.DefaultTransport,
+			cookies: cookies,
 		},
 	}
 }
 
 type cookieRoundTripper struct {
-	base   http.RoundTripper
-	cookie *http.Cookie
+	base    http.RoundTripper
+	cookies []*http.Cookie
 }
 
 func (t cookieRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -35,7 +39,9 @@ func (t cookieRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	}
 
 	req2 := req.Clone(req.Context())
-	req2.AddCookie(t.cookie)
+	for _, cookie := range t.cookies {
+		req2.AddCookie(cookie)
+	}
 
 	// req.Body is assumed to be closed by the base RoundTripper.
 	reqBodyClosed = true
@@ -0,0 +1,56 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+
+	models "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+type AuditEntry = models.AuditEntry
+type AuditFilter = models.AuditFilter
+
+type AuditApi struct {
+	api *Api
+}
+
+func (a *Api) Audit() AuditApi {
+	return AuditApi{api: a}
+}
+
+func (a AuditApi) List(filter AuditFilter, limit int) ([]AuditEntry, error) {
+	query := auditQuery(filter)
+	query.Set("limit", strconv.Itoa(limit))
+	var entries []AuditEntry
+	return entries, a.api.Get("/v1/audit?"+query.Encode(), &entries)
+}
+
+// Export returns a stream of JSON lines, one per audit entry, oldest first.
+func (a AuditApi) Export(filter AuditFilter) (io.ReadCloser, error) {
+	return a.api.GetStream("/v1/audit/export?" + auditQuery(filter).Encode())
+}
+
+func auditQuery(filter AuditFilter) url.Values {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"actor":    filter.Actor,
+		"method":   filter.Method,
+		"resource": filter.Resource,
+		"outcome":  filter.Outcome,
+	} {
+		if len(value) > 0 {
+			query.Set(name, value)
+		}
+	}
+	if filter.Since > 0 {
+		query.Set("since", strconv.FormatInt(filter.Since, 10))
+	}
+	if filter.Until > 0 {
+		query.Set("until", strconv.FormatInt(filter.Until, 10))
+	}
+	return query
+}
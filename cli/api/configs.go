@@ -4,9 +4,19 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
+	"net/url"
+
+	models "github.com/foundriesio/dg-satellite/storage/api"
 )
 
+type ConfigFile = models.ConfigFile
+type ConfigPropagation = models.ConfigPropagation
+type ConfigScopeDiff = models.ConfigScopeDiff
+type ConfigVersion = models.ConfigVersion
+
 type ConfigsApi struct {
 	api *Api
 }
@@ -19,3 +29,63 @@ func (a ConfigsApi) Upload(r io.Reader, opts ...HttpOption) error {
 	_, err := a.api.Put("/v1/configs", r, opts...)
 	return err
 }
+
+// DiffUpload validates configs without saving them, and returns changes an upload would make.
+func (a ConfigsApi) DiffUpload(r io.Reader, opts ...HttpOption) ([]ConfigScopeDiff, error) {
+	data, err := a.api.Put("/v1/configs?dry-run=true", r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var diff []ConfigScopeDiff
+	if err = json.Unmarshal(data, &diff); err != nil {
+		return nil, fmt.Errorf("failed to parse configs diff: %w", err)
+	}
+	return diff, nil
+}
+
+// In below APIs a scope is either "factory", "group/<name>", or "device/<uuid>".
+
+func (a ConfigsApi) Get(scope string) (*ConfigVersion, error) {
+	var cfg ConfigVersion
+	if err := a.api.Get("/v1/configs/"+scope, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (a ConfigsApi) Set(scope string, files map[string]ConfigFile) error {
+	_, err := a.api.Put("/v1/configs/"+scope, files)
+	return err
+}
+
+func (a ConfigsApi) SetFile(scope, name string, file ConfigFile) error {
+	_, err := a.api.Put(fmt.Sprintf("/v1/configs/%s/files/%s", scope, name), file)
+	return err
+}
+
+func (a ConfigsApi) DeleteFile(scope, name string) error {
+	return a.api.Delete(fmt.Sprintf("/v1/configs/%s/files/%s", scope, name))
+}
+
+func (a ConfigsApi) History(scope string, limit int) ([]ConfigVersion, error) {
+	var versions []ConfigVersion
+	return versions, a.api.Get(fmt.Sprintf("/v1/configs/%s/history?limit=%d", scope, limit), &versions)
+}
+
+func (a ConfigsApi) PurgeHistory(scope string, keep int) error {
+	return a.api.Delete(fmt.Sprintf("/v1/configs/%s/history?keep=%d", scope, keep))
+}
+
+func (a ConfigsApi) Rollback(scope, hash string) error {
+	_, err := a.api.Post(fmt.Sprintf("/v1/configs/%s/rollback", scope), models.ConfigRollbackReq{Hash: hash})
+	return err
+}
+
+// Status reports which devices fetched their latest config; an empty group reports all devices.
+func (a ConfigsApi) Status(group string) (*ConfigPropagation, error) {
+	var report ConfigPropagation
+	if err := a.api.Get("/v1/config-status?group="+url.QueryEscape(group), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
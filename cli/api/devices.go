@@ -4,6 +4,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
@@ -28,14 +29,17 @@ func (a *Api) Devices() DeviceApi {
 	}
 }
 
-// ListPage fetches a single page of devices. It returns the devices,
-// whether more pages are available, and the total number of pages.
-func (d DeviceApi) ListPage(page int, limit int, sortBy string) ([]DeviceListItem, bool, int, error) {
+// ListPage fetches a single page of devices, optionally only those in a given state (online or offline).
+// It returns the devices, whether more pages are available, and the total number of pages.
+func (d DeviceApi) ListPage(page int, limit int, sortBy, state string) ([]DeviceListItem, bool, int, error) {
 	offset := (page - 1) * limit
 	resource := fmt.Sprintf("/v1/devices?limit=%d&offset=%d", limit, offset)
 	if sortBy != "" {
 		resource += "&order-by=" + sortBy
 	}
+	if state != "" {
+		resource += "&state=" + state
+	}
 	var devices []DeviceListItem
 	headers, err := d.api.GetWithHeaders(resource, &devices)
 	if err != nil {
@@ -106,3 +110,55 @@ func (d *DeviceApi) Test(uuid, testId string) (*TargetTest, error) {
 func (d *DeviceApi) TestArtifact(uuid, testId, artifact string) (io.ReadCloser, error) {
 	return d.api.GetStream(fmt.Sprintf("/v1/devices/%s/tests/%s/%s", uuid, testId, artifact))
 }
+
+type TagMigration = models.TagMigration
+
+func (d DeviceApi) SetTag(uuid, tag string) error {
+	_, err := d.api.Put(fmt.Sprintf("/v1/devices/%s/tag", uuid), models.TagReq{Tag: tag})
+	return err
+}
+
+func (d DeviceApi) SetGroupTag(group, tag string) ([]string, error) {
+	var uuids []string
+	if data, err := d.api.Put(fmt.Sprintf("/v1/device-groups/%s/tag", group), models.TagReq{Tag: tag}); err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(data, &uuids); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return uuids, nil
+}
+
+func (d DeviceApi) TagMigrations(tag string) ([]TagMigration, error) {
+	var migrations []TagMigration
+	return migrations, d.api.Get("/v1/tag-migrations?tag="+url.QueryEscape(tag), &migrations)
+}
+
+type DeviceApps = models.DeviceApps
+
+func (d DeviceApi) Apps(uuid string) (*DeviceApps, error) {
+	var apps DeviceApps
+	if err := d.api.Get(fmt.Sprintf("/v1/devices/%s/apps", uuid), &apps); err != nil {
+		return nil, err
+	}
+	return &apps, nil
+}
+
+func (d DeviceApi) SetApps(uuid string, apps []string) error {
+	_, err := d.api.Put(fmt.Sprintf("/v1/devices/%s/apps", uuid), models.AppsReq{Apps: apps})
+	return err
+}
+
+func (d DeviceApi) SetGroupApps(group string, apps []string) error {
+	_, err := d.api.Put(fmt.Sprintf("/v1/device-groups/%s/apps", group), models.AppsReq{Apps: apps})
+	return err
+}
+
+type EffectiveConfig = models.EffectiveConfig
+
+func (d DeviceApi) Config(uuid string) (*EffectiveConfig, error) {
+	var cfg EffectiveConfig
+	if err := d.api.Get(fmt.Sprintf("/v1/devices/%s/config", uuid), &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type ServiceAccountsApi struct {
+	api *Api
+}
+
+func (a *Api) ServiceAccounts() ServiceAccountsApi {
+	return ServiceAccountsApi{api: a}
+}
+
+func (a ServiceAccountsApi) List() ([]User, error) {
+	var list []User
+	return list, a.api.Get("/v1/service-accounts", &list)
+}
+
+// Create adds a service account; the server sets the caller as its owner if none is given.
+func (a ServiceAccountsApi) Create(name, owner string, scopes []string) (*User, error) {
+	req := map[string]any{"name": name, "owner": owner, "scopes": scopes}
+	data, err := a.api.Post("/v1/service-accounts", req)
+	if err != nil {
+		return nil, err
+	}
+	var u User
+	if err = json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("failed to parse service account: %w", err)
+	}
+	return &u, nil
+}
+
+func (a ServiceAccountsApi) SetOwner(name, owner string) error {
+	_, err := a.api.Put(fmt.Sprintf("/v1/service-accounts/%s/owner", name), map[string]string{"owner": owner})
+	return err
+}
+
+func (a ServiceAccountsApi) CreateToken(name, description string, expires time.Time, scopes []string) (*Token, error) {
+	req := map[string]any{"description": description, "expires": expires.Format(time.RFC3339), "scopes": scopes}
+	data, err := a.api.Post(fmt.Sprintf("/v1/service-accounts/%s/tokens", name), req)
+	if err != nil {
+		return nil, err
+	}
+	var t Token
+	if err = json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	return &t, nil
+}
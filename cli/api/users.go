@@ -0,0 +1,116 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+type User = users.User
+type Token = users.Token
+type Session = users.Session
+
+type UsersApi struct {
+	api *Api
+}
+
+func (a *Api) Users() UsersApi {
+	return UsersApi{api: a}
+}
+
+func (a UsersApi) List() ([]User, error) {
+	var list []User
+	return list, a.api.Get("/v1/users", &list)
+}
+
+func (a UsersApi) Get(username string) (*User, error) {
+	var u User
+	if err := a.api.Get("/v1/users/"+username, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Create adds a user; it is only supported by servers using the local authentication.
+func (a UsersApi) Create(username, password string, scopes []string) (*User, error) {
+	req := map[string]any{"username": username, "password": password, "scopes": scopes}
+	data, err := a.api.Post("/v1/users", req)
+	if err != nil {
+		return nil, err
+	}
+	var u User
+	if err = json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("failed to parse user: %w", err)
+	}
+	return &u, nil
+}
+
+func (a UsersApi) Delete(username string) error {
+	return a.api.Delete("/v1/users/" + username)
+}
+
+func (a UsersApi) SetScopes(username string, scopes []string) error {
+	_, err := a.api.Put(fmt.Sprintf("/v1/users/%s/scopes", username), map[string][]string{"scopes": scopes})
+	return err
+}
+
+// SetDeviceAccess limits a user to devices with the given tags and groups; empty lists remove the limits.
+func (a UsersApi) SetDeviceAccess(username string, tags, groups []string) error {
+	req := map[string][]string{"tags": tags, "groups": groups}
+	_, err := a.api.Put(fmt.Sprintf("/v1/users/%s/device-access", username), req)
+	return err
+}
+
+func (a UsersApi) Tokens(username string) ([]Token, error) {
+	var tokens []Token
+	return tokens, a.api.Get(fmt.Sprintf("/v1/users/%s/tokens", username), &tokens)
+}
+
+func (a UsersApi) DeleteToken(username string, id int64) error {
+	return a.api.Delete(fmt.Sprintf("/v1/users/%s/tokens/%d", username, id))
+}
+
+// RotateToken replaces a token of a current user, the old one stays valid for a grace period.
+func (a UsersApi) RotateToken(username string, id int64, grace string) (*Token, error) {
+	resource := fmt.Sprintf("/v1/users/%s/tokens/%d/rotate", username, id)
+	if len(grace) > 0 {
+		resource += "?grace=" + url.QueryEscape(grace)
+	}
+	data, err := a.api.Post(resource, nil)
+	if err != nil {
+		return nil, err
+	}
+	var t Token
+	if err = json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	return &t, nil
+}
+
+func (a UsersApi) Sessions(username string) ([]Session, error) {
+	var sessions []Session
+	return sessions, a.api.Get(fmt.Sprintf("/v1/users/%s/sessions", username), &sessions)
+}
+
+func (a UsersApi) DeleteSession(username, id string) error {
+	return a.api.Delete(fmt.Sprintf("/v1/users/%s/sessions/%s", username, id))
+}
+
+// DeleteSessions logs a user out everywhere.
+func (a UsersApi) DeleteSessions(username string) error {
+	return a.api.Delete(fmt.Sprintf("/v1/users/%s/sessions", username))
+}
+
+func (a UsersApi) ResetTotp(username string) error {
+	return a.api.Delete(fmt.Sprintf("/v1/users/%s/totp", username))
+}
+
+func (a UsersApi) AuditLog(username string) (io.ReadCloser, error) {
+	return a.api.GetStream(fmt.Sprintf("/v1/users/%s/audit-log", username))
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	models "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+type Webhook = models.Webhook
+type WebhookAttempt = models.WebhookAttempt
+type WebhookReq = models.WebhookReq
+
+var WebhookEventTypes = models.WebhookEventTypes
+
+type WebhooksApi struct {
+	api *Api
+}
+
+func (a *Api) Webhooks() WebhooksApi {
+	return WebhooksApi{api: a}
+}
+
+func (a WebhooksApi) List() ([]Webhook, error) {
+	var webhooks []Webhook
+	return webhooks, a.api.Get("/v1/webhooks", &webhooks)
+}
+
+func (a WebhooksApi) Get(id int64) (*Webhook, error) {
+	var w Webhook
+	if err := a.api.Get(fmt.Sprintf("/v1/webhooks/%d", id), &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Create returns a new webhook along with its secret, which cannot be retrieved later.
+func (a WebhooksApi) Create(req WebhookReq) (*Webhook, error) {
+	return a.parseWebhook(a.api.Post("/v1/webhooks", req))
+}
+
+func (a WebhooksApi) Update(id int64, req WebhookReq) (*Webhook, error) {
+	return a.parseWebhook(a.api.Put(fmt.Sprintf("/v1/webhooks/%d", id), req))
+}
+
+func (a WebhooksApi) Delete(id int64) error {
+	return a.api.Delete(fmt.Sprintf("/v1/webhooks/%d", id))
+}
+
+func (a WebhooksApi) Deliveries(id int64, limit int) ([]WebhookAttempt, error) {
+	var attempts []WebhookAttempt
+	return attempts, a.api.Get(fmt.Sprintf("/v1/webhooks/%d/deliveries?limit=%d", id, limit), &attempts)
+}
+
+func (a WebhooksApi) parseWebhook(data []byte, err error) (*Webhook, error) {
+	if err != nil {
+		return nil, err
+	}
+	var w Webhook
+	if err = json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	return &w, nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit trail",
+	Long: `Commands for inspecting the audit trail.
+Each API or web call which may change server data is recorded with its user, authentication method, remote IP and outcome.`,
+}
+
+const timeFormat = "2006-01-02 15:04:05"
+
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("actor", "", "Only show calls made by this user")
+	cmd.Flags().String("method", "", "Only show calls with this HTTP method")
+	cmd.Flags().String("resource", "", "Only show calls to resources with this path prefix, e.g. /v1/devices/<uuid>")
+	cmd.Flags().String("outcome", "", "Only show calls with this outcome (success, failure)")
+	cmd.Flags().String("since", "", "Only show calls at or after this time (YYYY-MM-DD or RFC3339)")
+	cmd.Flags().String("until", "", "Only show calls at or before this time (YYYY-MM-DD or RFC3339)")
+}
+
+func parseFilterFlags(cmd *cobra.Command) api.AuditFilter {
+	var filter api.AuditFilter
+	filter.Actor, _ = cmd.Flags().GetString("actor")
+	filter.Method, _ = cmd.Flags().GetString("method")
+	filter.Resource, _ = cmd.Flags().GetString("resource")
+	filter.Outcome, _ = cmd.Flags().GetString("outcome")
+	filter.Since = parseTimeFlag(cmd, "since")
+	filter.Until = parseTimeFlag(cmd, "until")
+	return filter
+}
+
+func parseTimeFlag(cmd *cobra.Command, name string) int64 {
+	value, _ := cmd.Flags().GetString(name)
+	if len(value) == 0 {
+		return 0
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Unix()
+		}
+	}
+	cobra.CheckErr(fmt.Errorf("invalid --%s time: %s", name, value))
+	return 0
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package audit
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export audit trail entries as JSON lines, oldest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		body, err := api.Audit().Export(parseFilterFlags(cmd))
+		cobra.CheckErr(err)
+		defer func() {
+			if err := body.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to close response body: %v\n", err)
+			}
+		}()
+
+		out := os.Stdout
+		if path, _ := cmd.Flags().GetString("output"); len(path) > 0 {
+			out, err = os.Create(path)
+			cobra.CheckErr(err)
+			defer func() {
+				if err := out.Close(); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: failed to close %s: %v\n", path, err)
+				}
+			}()
+		}
+		_, err = io.Copy(out, body)
+		cobra.CheckErr(err)
+		return nil
+	},
+}
+
+func init() {
+	AuditCmd.AddCommand(exportCmd)
+	addFilterFlags(exportCmd)
+	exportCmd.Flags().StringP("output", "o", "", "Write entries to this file instead of stdout")
+}
@@ -0,0 +1,45 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package audit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List latest audit trail entries, newest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit, _ := cmd.Flags().GetInt("limit")
+		api := api.CtxGetApi(cmd.Context())
+		entries, err := api.Audit().List(parseFilterFlags(cmd), limit)
+		cobra.CheckErr(err)
+		table := subcommands.NewTableWriter([]string{"TIME", "ACTOR", "AUTH", "REMOTE IP", "METHOD", "RESOURCE", "STATUS"})
+		for _, e := range entries {
+			auth := e.AuthMethod
+			if len(e.AuthId) > 0 {
+				auth += ":" + e.AuthId
+			}
+			table.AddRow(
+				time.Unix(e.Timestamp, 0).Format(timeFormat),
+				e.Actor, auth, e.RemoteIp, e.Method, e.Resource, strconv.Itoa(e.Status),
+			)
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	AuditCmd.AddCommand(listCmd)
+	addFilterFlags(listCmd)
+	listCmd.Flags().IntP("limit", "n", 100, "Maximum number of entries to show")
+}
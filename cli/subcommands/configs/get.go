@@ -0,0 +1,93 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package configs
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+const scopeHelp = `A scope is one of: "factory", "group/<name>", or "device/<uuid>".`
+
+var getCmd = &cobra.Command{
+	Use:   "get <scope> [<file>]",
+	Short: "Show a config",
+	Long: `Show files of the latest factory, group, or device config.
+When a file name is given, print the file content.
+
+` + scopeHelp,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := parseScope(args[0])
+		if err != nil {
+			return err
+		}
+		api := api.CtxGetApi(cmd.Context())
+		if len(args) == 2 {
+			showConfigFile(api.Configs(), scope, args[1])
+		} else {
+			showConfig(api.Configs(), scope)
+		}
+		return nil
+	},
+}
+
+func init() {
+	ConfigsCmd.AddCommand(getCmd)
+}
+
+func parseScope(scope string) (string, error) {
+	if scope == "factory" {
+		return scope, nil
+	}
+	for _, prefix := range []string{"group/", "device/"} {
+		if name, ok := strings.CutPrefix(scope, prefix); ok && len(name) > 0 && !strings.Contains(name, "/") {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("invalid scope '%s'; %s", scope, scopeHelp)
+}
+
+func showConfig(configs api.ConfigsApi, scope string) {
+	cfg, err := configs.Get(scope)
+	cobra.CheckErr(err)
+	if len(cfg.Hash) == 0 {
+		fmt.Println("No config is set")
+		return
+	}
+	fmt.Printf("Version: %s\n", cfg.Hash)
+	fmt.Printf("Created: %s\n\n", formatTimestamp(cfg.Timestamp))
+	showConfigFiles(cfg.Files)
+}
+
+func showConfigFiles(files map[string]api.ConfigFile) {
+	table := subcommands.NewTableWriter([]string{"NAME", "SIZE", "UNENCRYPTED", "ON CHANGED"})
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		file := files[name]
+		unencrypted := file.Unencrypted != nil && *file.Unencrypted
+		onChanged := "-"
+		if len(file.OnChanged) > 0 {
+			onChanged = strings.Join(file.OnChanged, " ")
+		}
+		table.AddRow(name, len(file.Value), unencrypted, onChanged)
+	}
+	table.Render()
+}
+
+func showConfigFile(configs api.ConfigsApi, scope, name string) {
+	cfg, err := configs.Get(scope)
+	cobra.CheckErr(err)
+	if file, ok := cfg.Files[name]; !ok {
+		cobra.CheckErr(fmt.Errorf("config file '%s' not found in %s config", name, scope))
+	} else {
+		fmt.Print(file.Value)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package configs
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history <scope>",
+	Short: "Show previous versions of a config",
+	Long: `Show previous versions of a factory, group, or device config, the latest version first.
+Use a version hash with the 'rollback' command to restore that version.
+
+` + scopeHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := parseScope(args[0])
+		if err != nil {
+			return err
+		}
+		api := api.CtxGetApi(cmd.Context())
+		if keep, _ := cmd.Flags().GetInt("purge"); keep > 0 {
+			cobra.CheckErr(api.Configs().PurgeHistory(scope, keep))
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		showHistory(api.Configs(), scope, limit)
+		return nil
+	},
+}
+
+func init() {
+	ConfigsCmd.AddCommand(historyCmd)
+	historyCmd.Flags().IntP("limit", "n", 10, "Maximum number of versions to show")
+	historyCmd.Flags().Int("purge", 0, "Remove all but this number of latest versions from the server first")
+}
+
+func showHistory(configs api.ConfigsApi, scope string, limit int) {
+	versions, err := configs.History(scope, limit)
+	cobra.CheckErr(err)
+
+	table := subcommands.NewTableWriter([]string{"VERSION", "CREATED", "FILES"})
+	for _, v := range versions {
+		table.AddRow(v.Hash, formatTimestamp(v.Timestamp), strings.Join(slices.Sorted(maps.Keys(v.Files)), ", "))
+	}
+	table.Render()
+}
+
+func formatTimestamp(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,37 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package configs
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <scope> <version>",
+	Short: "Restore a previous version of a config",
+	Long: `Restore a previous version of a factory, group, or device config.
+The restored version becomes the latest config version.
+Use the 'history' command to find available versions.
+
+` + scopeHelp,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := parseScope(args[0])
+		if err != nil {
+			return err
+		}
+		api := api.CtxGetApi(cmd.Context())
+		cobra.CheckErr(api.Configs().Rollback(scope, args[1]))
+		fmt.Printf("Restored %s config version %s\n", scope, args[1])
+		return nil
+	},
+}
+
+func init() {
+	ConfigsCmd.AddCommand(rollbackCmd)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var setCmd = &cobra.Command{
+	Use:   "set <scope> <file> (--value <content> | --value-file <path> | --delete)",
+	Short: "Add, replace, or remove a single config file",
+	Long: `Add, replace, or remove a single file of a factory, group, or device config.
+Each change creates a new config version, which can later be rolled back.
+
+` + scopeHelp,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := parseScope(args[0])
+		if err != nil {
+			return err
+		}
+		api := api.CtxGetApi(cmd.Context())
+		if del, _ := cmd.Flags().GetBool("delete"); del {
+			cobra.CheckErr(api.Configs().DeleteFile(scope, args[1]))
+			return nil
+		}
+		file, err := configFileFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		cobra.CheckErr(api.Configs().SetFile(scope, args[1], file))
+		return nil
+	},
+}
+
+func init() {
+	ConfigsCmd.AddCommand(setCmd)
+	setCmd.Flags().String("value", "", "Config file content")
+	setCmd.Flags().String("value-file", "", "Read config file content from a local file")
+	setCmd.Flags().Bool("unencrypted", false, "Do not encrypt a config file content for a device")
+	setCmd.Flags().Bool("template", false, "Render a config file content for each device, e.g. {{ .Labels.site }}")
+	setCmd.Flags().StringSlice("on-changed", nil, "A command (and its arguments) to run on a device when a config file changes")
+	setCmd.Flags().Bool("delete", false, "Remove a config file")
+	setCmd.MarkFlagsMutuallyExclusive("value", "value-file", "delete")
+}
+
+func configFileFromFlags(cmd *cobra.Command) (file api.ConfigFile, err error) {
+	flags := cmd.Flags()
+	if path, _ := flags.GetString("value-file"); len(path) > 0 {
+		var data []byte
+		if data, err = os.ReadFile(path); err != nil {
+			return file, fmt.Errorf("failed to read file '%s': %w", path, err)
+		}
+		file.Value = string(data)
+	} else if flags.Changed("value") {
+		file.Value, _ = flags.GetString("value")
+	} else {
+		return file, errors.New("either --value, --value-file, or --delete must be given")
+	}
+	if unencrypted, _ := flags.GetBool("unencrypted"); unencrypted {
+		file.Unencrypted = &unencrypted
+	}
+	file.Template, _ = flags.GetBool("template")
+	file.OnChanged, _ = flags.GetStringSlice("on-changed")
+	return
+}
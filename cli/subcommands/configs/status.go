@@ -0,0 +1,51 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package configs
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which devices fetched their latest config",
+	Long: `Show which devices fetched their latest config.
+A device config is pending until the device fetches it, and applied afterwards.
+Use it to follow a config propagation after changing a group config.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		group, _ := cmd.Flags().GetString("group")
+		api := api.CtxGetApi(cmd.Context())
+		report, err := api.Configs().Status(group)
+		cobra.CheckErr(err)
+		showConfigStatus(report)
+		return nil
+	},
+}
+
+func init() {
+	ConfigsCmd.AddCommand(statusCmd)
+	statusCmd.Flags().String("group", "", "Only show devices in this group")
+}
+
+func showConfigStatus(report *api.ConfigPropagation) {
+	table := subcommands.NewTableWriter([]string{"UUID", "NAME", "GROUP", "STATUS", "FETCHED AT", "CHECKED AT"})
+	for _, d := range report.Devices {
+		fetchedAt, checkedAt := "-", "-"
+		if d.Fetch.FetchedAt > 0 {
+			fetchedAt = formatTimestamp(d.Fetch.FetchedAt)
+		}
+		if d.Fetch.CheckedAt > 0 {
+			checkedAt = formatTimestamp(d.Fetch.CheckedAt)
+		}
+		table.AddRow(d.Uuid, d.Name, d.GroupName, d.Status, fetchedAt, checkedAt)
+	}
+	table.Render()
+	fmt.Printf("\n%d of %d devices applied their latest config\n", report.Applied, report.Applied+report.Pending)
+}
@@ -20,13 +20,15 @@ var uploadCmd = &cobra.Command{
 	Short: "Upload configs",
 	Long: `Upload configs to the Satellite server.
 
-	Supported file formats are .tar, .tar.gz, and .tgz.`,
+	Supported file formats are .tar, .tar.gz, and .tgz.
+	With --dry-run configs are only validated, and changes they would make to each config scope are shown.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		path := args[0]
 		isDir, _ := cmd.Flags().GetBool("dir")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
 		api := api.CtxGetApi(cmd.Context())
-		cobra.CheckErr(uploadConfigs(api.Configs(), path, isDir))
+		cobra.CheckErr(uploadConfigs(api.Configs(), path, isDir, dryRun))
 	},
 	Hidden: true,
 }
@@ -34,9 +36,10 @@ var uploadCmd = &cobra.Command{
 func init() {
 	ConfigsCmd.AddCommand(uploadCmd)
 	uploadCmd.Flags().BoolP("dir", "d", false, "Archive a directory with configs to upload")
+	uploadCmd.Flags().Bool("dry-run", false, "Validate configs and show changes without saving them")
 }
 
-func uploadConfigs(capi api.ConfigsApi, path string, isDir bool) error {
+func uploadConfigs(capi api.ConfigsApi, path string, isDir, dryRun bool) error {
 	var (
 		reader   io.ReadCloser
 		reporter func(string, chan bool, chan bool)
@@ -110,11 +113,37 @@ func uploadConfigs(capi api.ConfigsApi, path string, isDir bool) error {
 	// This gives us an extremely accurate precision, when we focus solely on input data sizes.
 	go reporter("Uploaded:", stop, done)
 
-	err := capi.Upload(reader,
+	opts := []api.HttpOption{
 		api.HttpHeader("Content-Type", "application/x-tar"),
 		api.HttpHeader("Content-Encoding", "gzip"),
+	}
+	var (
+		diff []api.ConfigScopeDiff
+		err  error
 	)
+	if dryRun {
+		diff, err = capi.DiffUpload(reader, opts...)
+	} else {
+		err = capi.Upload(reader, opts...)
+	}
 	stop <- err == nil
 	<-done
+	if err == nil && dryRun {
+		showConfigsDiff(diff)
+	}
 	return err
 }
+
+func showConfigsDiff(diff []api.ConfigScopeDiff) {
+	if len(diff) == 0 {
+		fmt.Println("No changes")
+		return
+	}
+	table := subcommands.NewTableWriter([]string{"SCOPE", "FILE", "CHANGE"})
+	for _, scope := range diff {
+		for _, change := range scope.Changes {
+			table.AddRow(scope.Scope, change.Name, change.Change)
+		}
+	}
+	table.Render()
+}
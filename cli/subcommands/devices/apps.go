@@ -0,0 +1,87 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package devices
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/spf13/cobra"
+)
+
+var appsCmd = &cobra.Command{
+	Use:   "apps <uuid>",
+	Short: "Show compose apps enabled on a device",
+	Long:  `Show compose apps enabled on a device, and compare them to apps the device reports running`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		showApps(api.Devices(), args[0])
+		return nil
+	},
+}
+
+var setAppsCmd = &cobra.Command{
+	Use:   "set-apps <uuid|group> <apps>",
+	Short: "Set compose apps enabled on a device or a device group",
+	Long: `Set compose apps enabled on a device or a device group.
+
+Apps are given as a comma-separated list; use an empty string to disable all apps.
+Each app must be available in the update assigned to the device (or to devices in the group).
+This sets the [pacman] compose_apps value in the sota toml override (z-50-fioctl.toml)
+of the device config, or of the group config when --group is given.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		group, _ := cmd.Flags().GetBool("group")
+		setApps(api.Devices(), args[0], args[1], group)
+		return nil
+	},
+}
+
+func init() {
+	DevicesCmd.AddCommand(appsCmd)
+	DevicesCmd.AddCommand(setAppsCmd)
+	setAppsCmd.Flags().Bool("group", false, "Treat the first argument as a device group name")
+}
+
+func showApps(devices api.DeviceApi, uuid string) {
+	apps, err := devices.Apps(uuid)
+	cobra.CheckErr(err)
+
+	list := func(apps []string) string {
+		if len(apps) == 0 {
+			return "-"
+		}
+		return strings.Join(apps, ", ")
+	}
+	enabled := list(apps.Enabled)
+	if !apps.Configured {
+		enabled += " (all apps in the target)"
+	}
+	fmt.Printf("Enabled:    %s\n", enabled)
+	fmt.Printf("Reported:   %s\n", list(apps.Reported))
+	fmt.Printf("Available:  %s\n", list(apps.Available))
+	if apps.InSync() {
+		fmt.Println("\nThe device runs all enabled apps.")
+	} else {
+		fmt.Printf("\nMissing:    %s\n", list(apps.Missing))
+		fmt.Printf("Unexpected: %s\n", list(apps.Unexpected))
+	}
+}
+
+func setApps(devices api.DeviceApi, target, appsStr string, group bool) {
+	apps := []string{}
+	for app := range strings.SplitSeq(appsStr, ",") {
+		if app = strings.TrimSpace(app); app != "" {
+			apps = append(apps, app)
+		}
+	}
+	if group {
+		cobra.CheckErr(devices.SetGroupApps(target, apps))
+	} else {
+		cobra.CheckErr(devices.SetApps(target, apps))
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package devices
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config <uuid> [<file>]",
+	Short: "Preview a config which a device receives",
+	Long: `Preview a config which a device receives on its next fetch: factory, group, and device configs merged.
+Show which config layers define each file, and which files changed since the device fetched its config.
+When a file name is given, print the merged file content.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		file := ""
+		if len(args) == 2 {
+			file = args[1]
+		}
+		showConfig(api.Devices(), args[0], file)
+		return nil
+	},
+}
+
+func init() {
+	DevicesCmd.AddCommand(configCmd)
+}
+
+func showConfig(devices api.DeviceApi, uuid, name string) {
+	cfg, err := devices.Config(uuid)
+	cobra.CheckErr(err)
+
+	if len(name) > 0 {
+		if file, ok := cfg.Files[name]; !ok {
+			cobra.CheckErr(fmt.Errorf("config file '%s' not found in device config", name))
+		} else {
+			fmt.Print(file.Value)
+		}
+		return
+	}
+
+	changes := make(map[string]string, len(cfg.Changes))
+	for _, c := range cfg.Changes {
+		changes[c.Name] = c.Change
+	}
+	table := subcommands.NewTableWriter([]string{"NAME", "LAYERS", "SIZE", "CHANGE"})
+	for _, name := range slices.Sorted(maps.Keys(cfg.Files)) {
+		file := cfg.Files[name]
+		change := changes[name]
+		if len(change) == 0 {
+			change = "-"
+		}
+		table.AddRow(name, strings.Join(file.Layers, ", "), len(file.Value), change)
+	}
+	for _, c := range cfg.Changes {
+		if c.Change == "removed" {
+			table.AddRow(c.Name, "-", "-", c.Change)
+		}
+	}
+	table.Render()
+
+	fmt.Println()
+	if cfg.Fetched == nil {
+		fmt.Println("The device never fetched its config.")
+	} else {
+		fmt.Printf("Fetched at: %s\n", time.Unix(cfg.Fetched.FetchedAt, 0).Format("2006-01-02 15:04:05"))
+		if cfg.Pending() {
+			fmt.Println("The device has not yet fetched the latest config.")
+		} else {
+			fmt.Println("The device has the latest config.")
+		}
+	}
+}
@@ -20,6 +20,7 @@ var allColumns = []string{
 	"group",
 	"target",
 	"last-seen",
+	"online",
 	"created-at",
 	"is-prod",
 	"tag",
@@ -41,9 +42,13 @@ var listCmd = &cobra.Command{
 		if err := validateSortBy(sortBy); err != nil {
 			return err
 		}
+		state, _ := cmd.Flags().GetString("state")
+		if state != "" && state != "online" && state != "offline" {
+			return fmt.Errorf("invalid state: %s (valid: online, offline)", state)
+		}
 		page, _ := cmd.Flags().GetInt("page")
 		api := api.CtxGetApi(cmd.Context())
-		listDevices(api.Devices(), columns, page, sortBy)
+		listDevices(api.Devices(), columns, page, sortBy, state)
 		return nil
 	},
 }
@@ -53,6 +58,7 @@ var validSortValues = []string{
 	"created-at-asc", "created-at-desc",
 	"last-seen-asc", "last-seen-desc",
 	"uuid-asc", "uuid-desc",
+	"online-asc", "online-desc",
 }
 
 func init() {
@@ -63,6 +69,7 @@ func init() {
 		"Comma-separated list of columns to display (available: "+colmnsStr+")")
 	listCmd.Flags().IntP("page", "p", 1, "Page number to display")
 	listCmd.Flags().StringP("sort", "s", "", "Sort order for devices ("+sortStr+")")
+	listCmd.Flags().String("state", "", "Only list devices in this state (online, offline)")
 }
 
 func validateSortBy(sortBy string) error {
@@ -85,8 +92,8 @@ func validateColumns(columnsStr string) ([]string, error) {
 	return columns, nil
 }
 
-func listDevices(dapi api.DeviceApi, columns []string, page int, sortBy string) {
-	devices, hasMore, totalPages, err := dapi.ListPage(page, defaultPageLimit, sortBy)
+func listDevices(dapi api.DeviceApi, columns []string, page int, sortBy, state string) {
+	devices, hasMore, totalPages, err := dapi.ListPage(page, defaultPageLimit, sortBy, state)
 	cobra.CheckErr(err)
 
 	headers := make([]string, 0, len(columns))
@@ -120,6 +127,11 @@ func getColumnValue(device *api.DeviceListItem, column string) string {
 			return time.Unix(device.LastSeen, 0).Format("2006-01-02 15:04:05")
 		}
 		return "-"
+	case "online":
+		if device.Online {
+			return "online"
+		}
+		return "offline"
 	case "created-at":
 		if device.CreatedAt > 0 {
 			return time.Unix(device.CreatedAt, 0).Format("2006-01-02 15:04:05")
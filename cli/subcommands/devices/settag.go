@@ -0,0 +1,45 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package devices
+
+import (
+	"fmt"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/spf13/cobra"
+)
+
+var setTagCmd = &cobra.Command{
+	Use:   "set-tag <uuid|group> <tag>",
+	Short: "Move a device or a device group to a new tag",
+	Long: `Move a device or a device group to a new tag.
+
+This sets the [pacman] tags value in the sota toml override (z-50-fioctl.toml)
+of the device config, or of the group config when --group is given.
+Devices pick it up with their next config fetch.
+Use 'tag-migrations' to watch which devices have reported the new tag.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		group, _ := cmd.Flags().GetBool("group")
+		setTag(api.Devices(), args[0], args[1], group)
+		return nil
+	},
+}
+
+func init() {
+	DevicesCmd.AddCommand(setTagCmd)
+	setTagCmd.Flags().Bool("group", false, "Treat the first argument as a device group name")
+}
+
+func setTag(devices api.DeviceApi, target, tag string, group bool) {
+	if group {
+		uuids, err := devices.SetGroupTag(target, tag)
+		cobra.CheckErr(err)
+		fmt.Printf("Moving %d devices of group %s to tag %s\n", len(uuids), target, tag)
+	} else {
+		cobra.CheckErr(devices.SetTag(target, tag))
+		fmt.Printf("Moving device %s to tag %s\n", target, tag)
+	}
+}
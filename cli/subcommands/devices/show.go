@@ -54,6 +54,14 @@ func showDevice(devices api.DeviceApi, uuid string, aktoml, hwinfo bool) {
 	if device.LastSeen > 0 {
 		fmt.Printf("Last Seen:    %s\n", time.Unix(device.LastSeen, 0).Format("2006-01-02 15:04:05"))
 	}
+	state := "offline"
+	if device.Online {
+		state = "online"
+	}
+	if device.PollingInterval > 0 {
+		state += fmt.Sprintf(" (polling every %ds)", device.PollingInterval)
+	}
+	fmt.Printf("State:        %s\n", state)
 
 	if device.UpdateName != "" {
 		fmt.Printf("Update Name:  %s\n", device.UpdateName)
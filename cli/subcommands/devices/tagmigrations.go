@@ -0,0 +1,51 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package devices
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+	"github.com/spf13/cobra"
+)
+
+var tagMigrationsCmd = &cobra.Command{
+	Use:   "tag-migrations",
+	Short: "Show progress of moving devices to new tags",
+	Long:  `Show devices which were moved to a new tag with 'set-tag', and whether they already reported that tag`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		tag, _ := cmd.Flags().GetString("tag")
+		listTagMigrations(api.Devices(), tag)
+		return nil
+	},
+}
+
+func init() {
+	DevicesCmd.AddCommand(tagMigrationsCmd)
+	tagMigrationsCmd.Flags().String("tag", "", "Only show devices moving to this tag")
+}
+
+func listTagMigrations(devices api.DeviceApi, tag string) {
+	migrations, err := devices.TagMigrations(tag)
+	cobra.CheckErr(err)
+
+	table := subcommands.NewTableWriter([]string{"UUID", "NAME", "GROUP", "TAG", "TARGET TAG", "MIGRATED AT"})
+	done := 0
+	for _, m := range migrations {
+		migratedAt := "-"
+		if m.Migrated() {
+			done++
+			if m.MigratedAt > 0 {
+				migratedAt = time.Unix(m.MigratedAt, 0).Format("2006-01-02 15:04:05")
+			}
+		}
+		table.AddRow(m.Uuid, m.Name, m.GroupName, m.Tag, m.TargetTag, migratedAt)
+	}
+	table.Render()
+	fmt.Printf("\n%d of %d devices migrated\n", done, len(migrations))
+}
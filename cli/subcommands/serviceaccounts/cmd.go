@@ -0,0 +1,27 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package serviceaccounts
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var ServiceAccountsCmd = &cobra.Command{
+	Use:   "service-accounts",
+	Short: "Manage service accounts",
+	Long: `Commands for managing service accounts, which hold API tokens for automation like CI pipelines.
+Service accounts cannot log in, and their tokens are kept when their owner is deleted.
+Use "satcli users" commands to show, change scopes of, revoke tokens of, or delete a service account.`,
+}
+
+func formatScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+func formatTimestamp(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package serviceaccounts
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var createCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a service account",
+	Long: `Create a service account owned by a team or an administrator, the current user by default.
+At least one scope is required.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		owner, _ := cmd.Flags().GetString("owner")
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		api := api.CtxGetApi(cmd.Context())
+		u, err := api.ServiceAccounts().Create(args[0], owner, scopes)
+		cobra.CheckErr(err)
+		fmt.Printf("Name:    %s\n", u.Username)
+		fmt.Printf("Owner:   %s\n", u.Owner)
+		fmt.Printf("Created: %s\n", formatTimestamp(u.CreatedAt))
+		fmt.Printf("Scopes:  %s\n", formatScopes(u.AllowedScopes.ToSlice()))
+		return nil
+	},
+}
+
+var setOwnerCmd = &cobra.Command{
+	Use:   "set-owner <name> <owner>",
+	Short: "Change an owner of a service account",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		cobra.CheckErr(api.ServiceAccounts().SetOwner(args[0], args[1]))
+		return nil
+	},
+}
+
+func init() {
+	ServiceAccountsCmd.AddCommand(createCmd)
+	ServiceAccountsCmd.AddCommand(setOwnerCmd)
+	createCmd.Flags().String("owner", "", "A team or an administrator responsible for the service account")
+	createCmd.Flags().StringSlice("scope", nil, "Scopes allowed for the service account")
+}
@@ -0,0 +1,32 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package serviceaccounts
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List service accounts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		list, err := api.ServiceAccounts().List()
+		cobra.CheckErr(err)
+		table := subcommands.NewTableWriter([]string{"NAME", "OWNER", "CREATED", "SCOPES"})
+		for _, u := range list {
+			table.AddRow(u.Username, u.Owner, formatTimestamp(u.CreatedAt), formatScopes(u.AllowedScopes.ToSlice()))
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	ServiceAccountsCmd.AddCommand(listCmd)
+}
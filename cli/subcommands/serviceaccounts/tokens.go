@@ -0,0 +1,46 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package serviceaccounts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var createTokenCmd = &cobra.Command{
+	Use:   "create-token <name> <description>",
+	Short: "Create an API token of a service account",
+	Long: `Create an API token of a service account.
+The token value is only shown once.
+The token gets all scopes of the service account if none are given.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		days, _ := cmd.Flags().GetInt("days")
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		api := api.CtxGetApi(cmd.Context())
+		if len(scopes) == 0 {
+			u, err := api.Users().Get(args[0])
+			cobra.CheckErr(err)
+			scopes = u.AllowedScopes.ToSlice()
+		}
+		expires := time.Now().AddDate(0, 0, days)
+		t, err := api.ServiceAccounts().CreateToken(args[0], args[1], expires, scopes)
+		cobra.CheckErr(err)
+		fmt.Printf("Token ID: %d\n", t.PublicID)
+		fmt.Printf("Expires:  %s\n", formatTimestamp(t.ExpiresAt))
+		fmt.Printf("Scopes:   %s\n", formatScopes(t.Scopes.ToSlice()))
+		fmt.Printf("Value:    %s\n", t.Value)
+		return nil
+	},
+}
+
+func init() {
+	ServiceAccountsCmd.AddCommand(createTokenCmd)
+	createTokenCmd.Flags().Int("days", 90, "Number of days the token is valid for")
+	createTokenCmd.Flags().StringSlice("scope", nil, "Scopes of the token")
+}
@@ -14,8 +14,12 @@ import (
 var createRolloutCmd = &cobra.Command{
 	Use:   "create-rollout <ci|prod> <tag> <update-name> <rollout-name>",
 	Short: "Create a new rollout for an update",
-	Long:  `Create a new rollout specifying device UUIDs and/or groups to target`,
-	Args:  cobra.ExactArgs(4),
+	Long: `Create a new rollout specifying device UUIDs and/or groups to target.
+
+By default, only devices with the update tag are targeted.
+Use --tags to roll the update out to devices on other tags as well;
+the update must contain targets for each of the given tags.`,
+	Args: cobra.ExactArgs(4),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		api := api.CtxGetApi(cmd.Context())
 		prodType := args[0]
@@ -27,9 +31,10 @@ var createRolloutCmd = &cobra.Command{
 
 		uuids, _ := cmd.Flags().GetString("uuids")
 		groups, _ := cmd.Flags().GetString("groups")
+		tags, _ := cmd.Flags().GetString("tags")
 
 		updates := api.Updates(prodType)
-		cobra.CheckErr(createRollout(updates, args[1], args[2], args[3], uuids, groups))
+		cobra.CheckErr(createRollout(updates, args[1], args[2], args[3], uuids, groups, tags))
 		return nil
 	},
 }
@@ -38,38 +43,29 @@ func init() {
 	UpdatesCmd.AddCommand(createRolloutCmd)
 	createRolloutCmd.Flags().String("uuids", "", "Comma-separated list of device UUIDs")
 	createRolloutCmd.Flags().String("groups", "", "Comma-separated list of device groups")
+	createRolloutCmd.Flags().String("tags", "", "Comma-separated list of device tags (default: the update tag)")
 }
 
-func createRollout(updates api.UpdatesApi, tag, updateName, rolloutName, uuidsStr, groupsStr string) error {
+func createRollout(updates api.UpdatesApi, tag, updateName, rolloutName, uuidsStr, groupsStr, tagsStr string) error {
 	if uuidsStr == "" && groupsStr == "" {
 		return fmt.Errorf("at least one of --uuids or --groups must be specified")
 	}
 
-	var uuids []string
-	if uuidsStr != "" {
-		for uuid := range strings.SplitSeq(uuidsStr, ",") {
-			trimmed := strings.TrimSpace(uuid)
-			if trimmed != "" {
-				uuids = append(uuids, trimmed)
-			}
-		}
-	}
-
-	var groups []string
-	if groupsStr != "" {
-		for group := range strings.SplitSeq(groupsStr, ",") {
-			trimmed := strings.TrimSpace(group)
-			if trimmed != "" {
-				groups = append(groups, trimmed)
-			}
-		}
-	}
-
 	rollout := api.Rollout{
-		Uuids:  uuids,
-		Groups: groups,
+		Uuids:  splitList(uuidsStr),
+		Groups: splitList(groupsStr),
+		Tags:   splitList(tagsStr),
 	}
 
 	cobra.CheckErr(updates.CreateRollout(tag, updateName, rolloutName, rollout))
 	return nil
 }
+
+func splitList(value string) (res []string) {
+	for item := range strings.SplitSeq(value, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			res = append(res, trimmed)
+		}
+	}
+	return
+}
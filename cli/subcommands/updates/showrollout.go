@@ -5,6 +5,8 @@ package updates
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/foundriesio/dg-satellite/cli/api"
@@ -42,6 +44,9 @@ func showRollout(updates api.UpdatesApi, tag, updateName, rollout string) {
 	fmt.Printf("Rollout: %s\n", rollout)
 	fmt.Printf("Update: %s (%s)\n", updateName, strings.ToUpper(updates.Type))
 	fmt.Printf("Tag: %s\n", tag)
+	if len(rolloutData.Tags) > 0 {
+		fmt.Printf("Device tags: %s\n", strings.Join(rolloutData.Tags, ", "))
+	}
 	fmt.Printf("Committed: %v\n\n", rolloutData.Commit)
 
 	if len(rolloutData.Groups) > 0 {
@@ -65,6 +70,12 @@ func showRollout(updates api.UpdatesApi, tag, updateName, rollout string) {
 		for _, uuid := range rolloutData.Effect {
 			fmt.Printf("  - %s\n", uuid)
 		}
+		if len(rolloutData.EffectByTag) > 0 {
+			fmt.Println("\nDevices by tag:")
+			for _, t := range slices.Sorted(maps.Keys(rolloutData.EffectByTag)) {
+				fmt.Printf("  %s: %d\n", t, len(rolloutData.EffectByTag[t]))
+			}
+		}
 	} else {
 		fmt.Println("The rollout is request is still being processed.")
 	}
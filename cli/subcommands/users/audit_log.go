@@ -0,0 +1,37 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var auditLogCmd = &cobra.Command{
+	Use:   "audit-log <username>",
+	Short: "Show changes of a user account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		body, err := api.Users().AuditLog(args[0])
+		cobra.CheckErr(err)
+		defer func() {
+			if err := body.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to close response body: %v\n", err)
+			}
+		}()
+		_, err = io.Copy(os.Stdout, body)
+		cobra.CheckErr(err)
+		return nil
+	},
+}
+
+func init() {
+	UsersCmd.AddCommand(auditLogCmd)
+}
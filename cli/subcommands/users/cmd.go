@@ -0,0 +1,36 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var UsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Manage users",
+	Long: `Commands for managing users, their scopes and API tokens.
+Users can only be created by servers using the local authentication; other providers create users on their first login.`,
+}
+
+func parseTokenId(arg string) int64 {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		cobra.CheckErr(fmt.Errorf("invalid token ID: %s", arg))
+	}
+	return id
+}
+
+func formatScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+func formatTimestamp(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
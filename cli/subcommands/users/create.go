@@ -0,0 +1,49 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var createCmd = &cobra.Command{
+	Use:   "create <username>",
+	Short: "Create a user",
+	Long: `Create a user on a server using the local authentication.
+The password is read from the terminal if not provided.
+The server default scopes are granted if none are given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, _ := cmd.Flags().GetString("password")
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		if password == "" {
+			fmt.Print("Enter password: ")
+			pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			cobra.CheckErr(err)
+			if password = strings.TrimSpace(string(pw)); password == "" {
+				cobra.CheckErr(errors.New("password cannot be empty"))
+			}
+		}
+		api := api.CtxGetApi(cmd.Context())
+		u, err := api.Users().Create(args[0], password, scopes)
+		cobra.CheckErr(err)
+		showUser(u)
+		return nil
+	},
+}
+
+func init() {
+	UsersCmd.AddCommand(createCmd)
+	createCmd.Flags().String("password", "", "Password of the new user")
+	createCmd.Flags().StringSlice("scope", nil, "Scopes allowed for the new user")
+}
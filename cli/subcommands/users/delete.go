@@ -0,0 +1,25 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <username>",
+	Short: "Delete a user along with their API tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		cobra.CheckErr(api.Users().Delete(args[0]))
+		return nil
+	},
+}
+
+func init() {
+	UsersCmd.AddCommand(deleteCmd)
+}
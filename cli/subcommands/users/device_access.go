@@ -0,0 +1,32 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var deviceAccessCmd = &cobra.Command{
+	Use:   "limit-access <username>",
+	Short: "Limit a user to devices with some tags or groups",
+	Long: `Limit a user to devices with some tags or groups.
+The limits are replaced on every call; run without --tag and --group to remove them.
+Limited users can't use fleet-wide APIs like webhooks, the event stream, or factory configs.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		groups, _ := cmd.Flags().GetStringSlice("group")
+		api := api.CtxGetApi(cmd.Context())
+		cobra.CheckErr(api.Users().SetDeviceAccess(args[0], tags, groups))
+		return nil
+	},
+}
+
+func init() {
+	UsersCmd.AddCommand(deviceAccessCmd)
+	deviceAccessCmd.Flags().StringSlice("tag", nil, "Device tags the user may access")
+	deviceAccessCmd.Flags().StringSlice("group", nil, "Device groups the user may access")
+}
@@ -0,0 +1,32 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		list, err := api.Users().List()
+		cobra.CheckErr(err)
+		table := subcommands.NewTableWriter([]string{"USERNAME", "EMAIL", "CREATED", "SCOPES"})
+		for _, u := range list {
+			table.AddRow(u.Username, u.Email, formatTimestamp(u.CreatedAt), formatScopes(u.AllowedScopes.ToSlice()))
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	UsersCmd.AddCommand(listCmd)
+}
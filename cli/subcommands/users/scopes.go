@@ -0,0 +1,27 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var scopesCmd = &cobra.Command{
+	Use:   "set-scopes <username> <scope>...",
+	Short: "Replace scopes allowed for a user",
+	Long: `Replace scopes allowed for a user.
+All sessions and API tokens of the user are revoked if the scopes change.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		cobra.CheckErr(api.Users().SetScopes(args[0], args[1:]))
+		return nil
+	},
+}
+
+func init() {
+	UsersCmd.AddCommand(scopesCmd)
+}
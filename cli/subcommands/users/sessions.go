@@ -0,0 +1,59 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions <username>",
+	Short: "List active web sessions of a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		sessions, err := api.Users().Sessions(args[0])
+		cobra.CheckErr(err)
+		table := subcommands.NewTableWriter([]string{"SESSION ID", "IP ADDRESS", "CREATED", "EXPIRES", "SCOPES"})
+		for _, s := range sessions {
+			table.AddRow(
+				s.ID, s.RemoteIP, formatTimestamp(s.CreatedAt), formatTimestamp(s.ExpiresAt), formatScopes(s.Scopes.ToSlice()),
+			)
+		}
+		table.Render()
+		return nil
+	},
+}
+
+var revokeSessionCmd = &cobra.Command{
+	Use:   "revoke-session <username> [<session-id>]",
+	Short: "Revoke a web session of a user",
+	Long: `Revoke a web session of a user.
+Use --all to log the user out everywhere.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) == 2) {
+			return errors.New("either a session ID or --all is required")
+		}
+		if all {
+			cobra.CheckErr(api.Users().DeleteSessions(args[0]))
+		} else {
+			cobra.CheckErr(api.Users().DeleteSession(args[0], args[1]))
+		}
+		return nil
+	},
+}
+
+func init() {
+	revokeSessionCmd.Flags().Bool("all", false, "Revoke all sessions of the user")
+	UsersCmd.AddCommand(sessionsCmd)
+	UsersCmd.AddCommand(revokeSessionCmd)
+}
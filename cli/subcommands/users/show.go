@@ -0,0 +1,60 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show <username>",
+	Short: "Show a user and their API tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		u, err := api.Users().Get(args[0])
+		cobra.CheckErr(err)
+		tokens, err := api.Users().Tokens(args[0])
+		cobra.CheckErr(err)
+		showUser(u)
+		fmt.Println()
+		table := subcommands.NewTableWriter([]string{"TOKEN ID", "DESCRIPTION", "CREATED", "EXPIRES", "LAST USED", "SCOPES"})
+		for _, t := range tokens {
+			lastUsed := "never"
+			if t.LastUsedAt > 0 {
+				lastUsed = formatTimestamp(t.LastUsedAt) + " from " + t.LastUsedIP
+			}
+			table.AddRow(
+				strconv.FormatInt(t.PublicID, 10), t.Description,
+				formatTimestamp(t.CreatedAt), formatTimestamp(t.ExpiresAt), lastUsed, formatScopes(t.Scopes.ToSlice()),
+			)
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func showUser(u *api.User) {
+	fmt.Printf("Username: %s\n", u.Username)
+	fmt.Printf("Email:    %s\n", u.Email)
+	fmt.Printf("Created:  %s\n", formatTimestamp(u.CreatedAt))
+	fmt.Printf("Scopes:   %s\n", formatScopes(u.AllowedScopes.ToSlice()))
+	if len(u.AllowedTags) > 0 {
+		fmt.Printf("Tags:     %s\n", strings.Join(u.AllowedTags, ","))
+	}
+	if len(u.AllowedGroups) > 0 {
+		fmt.Printf("Groups:   %s\n", strings.Join(u.AllowedGroups, ","))
+	}
+}
+
+func init() {
+	UsersCmd.AddCommand(showCmd)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var revokeTokenCmd = &cobra.Command{
+	Use:   "revoke-token <username> <token-id>",
+	Short: "Revoke an API token of a user",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		cobra.CheckErr(api.Users().DeleteToken(args[0], parseTokenId(args[1])))
+		return nil
+	},
+}
+
+var rotateTokenCmd = &cobra.Command{
+	Use:   "rotate-token <username> <token-id>",
+	Short: "Replace an API token with a new one",
+	Long: `Replace an API token with a new one, which has the same description, scopes, and lifetime.
+The old token stays valid for a grace period, so that clients can switch to the new one.
+Users can only rotate their own tokens.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		grace, _ := cmd.Flags().GetString("grace")
+		t, err := api.Users().RotateToken(args[0], parseTokenId(args[1]), grace)
+		cobra.CheckErr(err)
+		fmt.Printf("Token ID: %d\n", t.PublicID)
+		fmt.Printf("Expires:  %s\n", formatTimestamp(t.ExpiresAt))
+		fmt.Printf("Value:    %s\n", t.Value)
+		return nil
+	},
+}
+
+func init() {
+	rotateTokenCmd.Flags().String("grace", "", "How long the old token stays valid, e.g. 30m or 24h; one hour by default")
+	UsersCmd.AddCommand(revokeTokenCmd)
+	UsersCmd.AddCommand(rotateTokenCmd)
+}
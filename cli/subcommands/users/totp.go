@@ -0,0 +1,27 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package users
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var resetTotpCmd = &cobra.Command{
+	Use:   "reset-totp <username>",
+	Short: "Reset two-factor authentication of a user",
+	Long: `Reset two-factor authentication of a user, e.g. after they lose their authenticator device.
+The user must enroll again at their next login if two-factor authentication is required.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		cobra.CheckErr(api.Users().ResetTotp(args[0]))
+		return nil
+	},
+}
+
+func init() {
+	UsersCmd.AddCommand(resetTotpCmd)
+}
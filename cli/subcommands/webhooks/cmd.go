@@ -0,0 +1,57 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package webhooks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var WebhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Manage webhooks",
+	Long: `Commands for managing webhooks which receive fleet events.
+Each event is sent as a JSON POST request with an X-Satellite-Signature header.
+The header value is "sha256=" followed by a hex HMAC-SHA256 of the request body keyed with the webhook secret.
+Available events: ` + strings.Join(api.WebhookEventTypes, ", "),
+}
+
+func webhookReq(cmd *cobra.Command, url string) api.WebhookReq {
+	events, _ := cmd.Flags().GetStringSlice("event")
+	description, _ := cmd.Flags().GetString("description")
+	return api.WebhookReq{Url: url, Events: events, Description: description}
+}
+
+func parseId(arg string) int64 {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		cobra.CheckErr(fmt.Errorf("invalid webhook ID: %s", arg))
+	}
+	return id
+}
+
+func showWebhook(w *api.Webhook) {
+	fmt.Printf("ID:          %d\n", w.Id)
+	fmt.Printf("URL:         %s\n", w.Url)
+	fmt.Printf("Events:      %s\n", formatEvents(w.Events))
+	fmt.Printf("Description: %s\n", w.Description)
+	fmt.Printf("Created:     %s\n", formatTimestamp(w.CreatedAt))
+}
+
+func formatEvents(events []string) string {
+	if len(events) == 0 {
+		return "all"
+	}
+	return strings.Join(events, ",")
+}
+
+func formatTimestamp(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
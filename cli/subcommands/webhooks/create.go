@@ -0,0 +1,35 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package webhooks
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var createCmd = &cobra.Command{
+	Use:   "create <url>",
+	Short: "Create a webhook",
+	Long: `Create a webhook for a given URL.
+The webhook secret is only shown once; save it to verify signatures of received events.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := webhookReq(cmd, args[0])
+		api := api.CtxGetApi(cmd.Context())
+		w, err := api.Webhooks().Create(req)
+		cobra.CheckErr(err)
+		showWebhook(w)
+		fmt.Printf("Secret:      %s\n", w.Secret)
+		return nil
+	},
+}
+
+func init() {
+	WebhooksCmd.AddCommand(createCmd)
+	createCmd.Flags().StringSlice("event", nil, "Only send these events; all events are sent by default")
+	createCmd.Flags().String("description", "", "Webhook description")
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package webhooks
+
+import (
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhooks",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		api := api.CtxGetApi(cmd.Context())
+		webhooks, err := api.Webhooks().List()
+		cobra.CheckErr(err)
+		table := subcommands.NewTableWriter([]string{"ID", "URL", "EVENTS", "DESCRIPTION"})
+		for _, w := range webhooks {
+			table.AddRow(strconv.FormatInt(w.Id, 10), w.Url, formatEvents(w.Events), w.Description)
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	WebhooksCmd.AddCommand(listCmd)
+}
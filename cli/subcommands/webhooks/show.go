@@ -0,0 +1,52 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package webhooks
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+	"github.com/foundriesio/dg-satellite/cli/subcommands"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a webhook and its latest deliveries",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := parseId(args[0])
+		limit, _ := cmd.Flags().GetInt("limit")
+		api := api.CtxGetApi(cmd.Context())
+		w, err := api.Webhooks().Get(id)
+		cobra.CheckErr(err)
+		attempts, err := api.Webhooks().Deliveries(id, limit)
+		cobra.CheckErr(err)
+		showWebhook(w)
+		fmt.Println()
+		table := subcommands.NewTableWriter([]string{"TIME", "DELIVERY", "EVENT", "ATTEMPT", "RESULT"})
+		for _, a := range attempts {
+			result := "ok"
+			if !a.Success {
+				result = a.Error
+				if a.StatusCode > 0 {
+					result = fmt.Sprintf("HTTP %d", a.StatusCode)
+				}
+				if a.Final {
+					result += " (gave up)"
+				}
+			}
+			table.AddRow(formatTimestamp(a.Timestamp), a.DeliveryId, a.Event, strconv.Itoa(a.Attempt), result)
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func init() {
+	WebhooksCmd.AddCommand(showCmd)
+	showCmd.Flags().Int("limit", 20, "Maximum number of deliveries to show")
+}
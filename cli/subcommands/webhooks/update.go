@@ -0,0 +1,31 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package webhooks
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foundriesio/dg-satellite/cli/api"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update <id> <url>",
+	Short: "Update a webhook",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := parseId(args[0])
+		req := webhookReq(cmd, args[1])
+		api := api.CtxGetApi(cmd.Context())
+		w, err := api.Webhooks().Update(id, req)
+		cobra.CheckErr(err)
+		showWebhook(w)
+		return nil
+	},
+}
+
+func init() {
+	WebhooksCmd.AddCommand(updateCmd)
+	updateCmd.Flags().StringSlice("event", nil, "Only send these events; all events are sent by default")
+	updateCmd.Flags().String("description", "", "Webhook description")
+}
@@ -9,10 +9,14 @@ import (
 
 	"github.com/foundriesio/dg-satellite/cli/api"
 	"github.com/foundriesio/dg-satellite/cli/config"
+	"github.com/foundriesio/dg-satellite/cli/subcommands/audit"
 	"github.com/foundriesio/dg-satellite/cli/subcommands/configs"
 	"github.com/foundriesio/dg-satellite/cli/subcommands/devices"
 	"github.com/foundriesio/dg-satellite/cli/subcommands/login"
+	"github.com/foundriesio/dg-satellite/cli/subcommands/serviceaccounts"
 	"github.com/foundriesio/dg-satellite/cli/subcommands/updates"
+	"github.com/foundriesio/dg-satellite/cli/subcommands/users"
+	"github.com/foundriesio/dg-satellite/cli/subcommands/webhooks"
 	version "github.com/foundriesio/dg-satellite/cmd"
 	"github.com/spf13/cobra"
 )
@@ -66,6 +70,10 @@ func init() {
 	rootCmd.AddCommand(configs.ConfigsCmd)
 	rootCmd.AddCommand(devices.DevicesCmd)
 	rootCmd.AddCommand(updates.UpdatesCmd)
+	rootCmd.AddCommand(webhooks.WebhooksCmd)
+	rootCmd.AddCommand(users.UsersCmd)
+	rootCmd.AddCommand(serviceaccounts.ServiceAccountsCmd)
+	rootCmd.AddCommand(audit.AuditCmd)
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Print the version of satcli",
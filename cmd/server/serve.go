@@ -14,14 +14,18 @@ import (
 	"github.com/foundriesio/dg-satellite/server"
 	"github.com/foundriesio/dg-satellite/server/gateway"
 	"github.com/foundriesio/dg-satellite/server/ui"
+	"github.com/foundriesio/dg-satellite/server/ui/daemons"
 	"github.com/foundriesio/dg-satellite/storage"
 )
 
 type ServeCmd struct {
-	startedCb func(uiAddress, gatewayAddress string)
+	startedCb func(uiAddress, gatewayAddress, metricsAddress string)
 
 	UiAddr      string `default:":8080"`
 	GatewayAddr string `default:":8443"`
+	MetricsAddr string `help:"Bind address of the Prometheus metrics endpoint, disabled if empty"`
+
+	PollingInterval time.Duration `default:"5m" help:"Expected interval between device check-ins, unless a device reports it in aktoml"`
 }
 
 func (c *ServeCmd) Run(args CommonArgs) error {
@@ -33,7 +37,7 @@ func (c *ServeCmd) Run(args CommonArgs) error {
 	if err != nil {
 		return fmt.Errorf("failed to load database: %w", err)
 	}
-	uiServer, err := ui.NewServer(args.ctx, db, fs, c.UiAddr)
+	uiServer, err := ui.NewServer(args.ctx, db, fs, c.UiAddr, daemons.WithPollingInterval(c.PollingInterval))
 	if err != nil {
 		return err
 	}
@@ -42,14 +46,26 @@ func (c *ServeCmd) Run(args CommonArgs) error {
 		return err
 	}
 
-	quitErr := make(chan error, 2)
-	uiServer.Start(quitErr)
-	gtwServer.Start(quitErr)
+	servers := []server.Server{uiServer, gtwServer}
+	var metricsServer server.Server
+	if len(c.MetricsAddr) > 0 {
+		metricsServer = server.NewMetricsServer(args.ctx, c.MetricsAddr)
+		servers = append(servers, metricsServer)
+	}
+
+	quitErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv.Start(quitErr)
+	}
 
 	if c.startedCb != nil {
 		// Testing code, see serve_test.go
 		time.Sleep(time.Millisecond * 2)
-		c.startedCb(uiServer.GetAddress(), gtwServer.GetAddress())
+		metricsAddress := ""
+		if metricsServer != nil {
+			metricsAddress = metricsServer.GetAddress()
+		}
+		c.startedCb(uiServer.GetAddress(), gtwServer.GetAddress(), metricsAddress)
 	}
 
 	// setup channel to gracefully terminate server
@@ -63,8 +79,8 @@ func (c *ServeCmd) Run(args CommonArgs) error {
 	}
 
 	var wg sync.WaitGroup
-	wg.Add(2)
-	for _, srv := range []server.Server{uiServer, gtwServer} {
+	wg.Add(len(servers))
+	for _, srv := range servers {
 		go func() {
 			srv.Shutdown(time.Minute)
 			wg.Done()
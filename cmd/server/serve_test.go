@@ -5,6 +5,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"syscall"
 	"testing"
@@ -27,15 +28,18 @@ func TestServe(t *testing.T) {
 	require.Nil(t, fs.Auth.SaveAuthConfig(authConfig))
 	apiAddress := ""
 	gatewayAddress := ""
+	metricsAddress := ""
 	wait := make(chan bool)
 	server := ServeCmd{
-		startedCb: func(apiAddr, gwAddr string) {
+		startedCb: func(apiAddr, gwAddr, metricsAddr string) {
 			apiAddress = apiAddr
 			gatewayAddress = gwAddr
+			metricsAddress = metricsAddr
 			wait <- true
 		},
 		UiAddr:      "127.0.0.1:0",
 		GatewayAddr: "127.0.0.1:0",
+		MetricsAddr: "127.0.0.1:0",
 	}
 
 	log, err := context.InitLogger("debug")
@@ -77,5 +81,14 @@ func TestServe(t *testing.T) {
 	require.NotNil(t, err)
 	require.Contains(t, err.Error(), "failed to verify certificate")
 
+	r, err = http.Get(fmt.Sprintf("http://%s/metrics", metricsAddress))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, r.StatusCode)
+	body, err := io.ReadAll(r.Body)
+	require.Nil(t, err)
+	require.Nil(t, r.Body.Close())
+	require.Contains(t, string(body), `dg_http_requests_total{server="rest-api",method="GET",route="unmatched",status="404"} 1`)
+	require.Contains(t, string(body), "# TYPE dg_devices gauge")
+
 	require.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGINT))
 }
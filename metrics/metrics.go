@@ -0,0 +1,309 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+// Package metrics implements a minimal subset of Prometheus instrumentation:
+// counters, gauges, histograms, and gauges collected at scrape time, exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefaultBuckets suit request latencies in seconds.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// UploadBuckets suit durations of large uploads in seconds.
+	UploadBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+	// DefaultRegistry is where all metrics created by this package are registered.
+	DefaultRegistry = NewRegistry()
+)
+
+// Handler serves metrics of the default registry.
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	lock       sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register adds a collector; a collector with the same name is replaced.
+func (r *Registry) register(name string, c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors[name] = c
+}
+
+// WriteText writes all metrics in the Prometheus text format, sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.Lock()
+	names := slices.Sorted(maps.Keys(r.collectors))
+	collectors := make([]collector, len(names))
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.lock.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := r.WriteText(w); err != nil {
+		slog.Error("Failed to write metrics", "error", err)
+	}
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Histograms only
+	buckets []uint64
+	count   uint64
+}
+
+type vec struct {
+	lock   sync.Mutex
+	kind   string
+	name   string
+	help   string
+	labels []string
+	series map[string]*series
+}
+
+func newVec(kind, name, help string, labels []string) vec {
+	return vec{kind: kind, name: name, help: help, labels: labels, series: make(map[string]*series)}
+}
+
+// get returns series for given label values, creating it on the first use; a caller must hold the lock.
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) sortedSeries() []*series {
+	keys := slices.Sorted(maps.Keys(v.series))
+	res := make([]*series, len(keys))
+	for i, key := range keys {
+		res[i] = v.series[key]
+	}
+	return res
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.kind)
+}
+
+type Counter struct {
+	vec
+}
+
+// NewCounter registers a counter; a value only grows until the server restarts.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec("counter", name, help, labels)}
+	DefaultRegistry.register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.get(labelValues).value += value
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writeHeader(w)
+	for _, s := range c.sortedSeries() {
+		writeSample(w, c.name, c.labels, s.labelValues, s.value)
+	}
+}
+
+type Gauge struct {
+	vec
+}
+
+// NewGauge registers a gauge; a value can go up and down.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec("gauge", name, help, labels)}
+	DefaultRegistry.register(name, g)
+	return g
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.get(labelValues).value += value
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.get(labelValues).value = value
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.writeHeader(w)
+	for _, s := range g.sortedSeries() {
+		writeSample(w, g.name, g.labels, s.labelValues, s.value)
+	}
+}
+
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogram registers a histogram with given upper bounds of buckets, sorted in increasing order.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{vec: newVec("histogram", name, help, labels), buckets: buckets}
+	DefaultRegistry.register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.buckets[i] += 1
+		}
+	}
+	s.count += 1
+	s.value += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.writeHeader(w)
+	labels := append(slices.Clone(h.labels), "le")
+	for _, s := range h.sortedSeries() {
+		values := append(slices.Clone(s.labelValues), "")
+		for i, bound := range h.buckets {
+			values[len(values)-1] = formatFloat(bound)
+			writeSample(w, h.name+"_bucket", labels, values, float64(s.buckets[i]))
+		}
+		values[len(values)-1] = "+Inf"
+		writeSample(w, h.name+"_bucket", labels, values, float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, s.value)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, float64(s.count))
+	}
+}
+
+// Sample is a single value of a metric collected at scrape time.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type gaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func() ([]Sample, error)
+}
+
+// NewGaugeFunc registers a gauge which values are collected on each scrape.
+// A collect failure is logged, and the metric is omitted from that scrape.
+func NewGaugeFunc(name, help string, labels []string, collect func() ([]Sample, error)) {
+	DefaultRegistry.register(name, &gaugeFunc{name: name, help: help, labels: labels, collect: collect})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	samples, err := g.collect()
+	if err != nil {
+		slog.Error("Failed to collect metric", "metric", g.name, "error", err)
+		return
+	}
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, s := range samples {
+		writeSample(w, g.name, g.labels, s.LabelValues, s.Value)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, value float64) {
+	_, _ = w.WriteString(name)
+	if len(labels) > 0 {
+		_ = w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = fmt.Fprintf(w, `%s="%s"`, label, labelValueEscaper.Replace(values[i]))
+		}
+		_ = w.WriteByte('}')
+	}
+	_ = w.WriteByte(' ')
+	_, _ = w.WriteString(formatFloat(value))
+	_ = w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	saved := DefaultRegistry
+	DefaultRegistry = NewRegistry()
+	defer func() { DefaultRegistry = saved }()
+
+	counter := NewCounter("test_requests_total", "Requests\nserved", "route", "status")
+	counter.Inc("/b", "200")
+	counter.Inc("/a", "500")
+	counter.Add(2, "/b", "200")
+	assert.Panics(t, func() { counter.Inc("/a") })
+
+	gauge := NewGauge("test_streams", "Active streams")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+
+	histogram := NewHistogram("test_duration_seconds", "Durations", []float64{0.1, 1}, "kind")
+	histogram.Observe(0.05, "up")
+	histogram.Observe(0.5, "up")
+	histogram.Observe(5, "up")
+
+	failing := true
+	NewGaugeFunc("test_devices", "Devices", []string{"tag"}, func() ([]Sample, error) {
+		if failing {
+			return nil, errors.New("db is down")
+		}
+		return []Sample{{LabelValues: []string{`quote"d`}, Value: 3}}, nil
+	})
+
+	expected := `# HELP test_duration_seconds Durations
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{kind="up",le="0.1"} 1
+test_duration_seconds_bucket{kind="up",le="1"} 2
+test_duration_seconds_bucket{kind="up",le="+Inf"} 3
+test_duration_seconds_sum{kind="up"} 5.55
+test_duration_seconds_count{kind="up"} 3
+# HELP test_requests_total Requests\nserved
+# TYPE test_requests_total counter
+test_requests_total{route="/a",status="500"} 1
+test_requests_total{route="/b",status="200"} 3
+# HELP test_streams Active streams
+# TYPE test_streams gauge
+test_streams 1
+`
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, expected, rec.Body.String())
+
+	failing = false
+	expected = `# HELP test_devices Devices
+# TYPE test_devices gauge
+test_devices{tag="quote\"d"} 3
+` + expected
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, expected, rec.Body.String())
+}
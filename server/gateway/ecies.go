@@ -0,0 +1,93 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package gateway
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ECIES parameters which fioconfig uses for devices with P-256 keys: AES-128-CTR, SHA-256 KDF and HMAC.
+const (
+	eciesKeyLen    = 16
+	eciesBlockSize = aes.BlockSize
+)
+
+// parseEcdhPubKey parses a device public key (as stored by the authDevice middleware) for config encryption.
+func parseEcdhPubKey(pubPem string) (*ecdh.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pubPem))
+	if block == nil {
+		return nil, errors.New("device public key is not PEM encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device public key: %w", err)
+	}
+	if ecPub, ok := pub.(*ecdsa.PublicKey); !ok || ecPub.Curve != elliptic.P256() {
+		return nil, errors.New("config encryption requires a device key on the P-256 curve")
+	} else {
+		return ecPub.ECDH()
+	}
+}
+
+// eciesEncrypt encrypts a value the way fioconfig on a device can decrypt it with the device private key.
+// The result is a base64 encoded: ephemeral public key || IV || AES-CTR ciphertext || HMAC tag.
+func eciesEncrypt(pub *ecdh.PublicKey, value []byte) (string, error) {
+	ephemeral, err := pub.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+	ke, km := eciesDeriveKeys(shared)
+
+	block, err := aes.NewCipher(ke)
+	if err != nil {
+		return "", err
+	}
+	em := make([]byte, eciesBlockSize+len(value))
+	iv := em[:eciesBlockSize]
+	if _, err = rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to generate IV: %w", err)
+	}
+	cipher.NewCTR(block, iv).XORKeyStream(em[eciesBlockSize:], value)
+
+	mac := hmac.New(sha256.New, km)
+	mac.Write(em)
+
+	ct := append(ephemeral.PublicKey().Bytes(), em...)
+	ct = mac.Sum(ct)
+	return base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// eciesDeriveKeys implements a NIST SP 800-56 concatenation KDF with empty shared info,
+// returning an encryption key and a MAC key.
+func eciesDeriveKeys(shared []byte) (ke, km []byte) {
+	var k []byte
+	counter := make([]byte, 4)
+	for i := uint32(1); len(k) < 2*eciesKeyLen; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		h := sha256.New()
+		h.Write(counter)
+		h.Write(shared)
+		k = h.Sum(k)
+	}
+	ke = k[:eciesKeyLen]
+	kmHash := sha256.Sum256(k[eciesKeyLen : 2*eciesKeyLen])
+	return ke, kmHash[:]
+}
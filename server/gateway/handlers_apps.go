@@ -41,7 +41,7 @@ func (h handlers) blobGet(c echo.Context) error {
 	}
 	device := CtxGetDevice(c.Request().Context())
 	path = device.GetAppsFilePath("blobs/sha256/" + hash)
-	return c.File(path)
+	return serveFile(c, "apps", path)
 }
 
 // parseRegistryHash extracts the sha256 hash from a registry wildcard path.
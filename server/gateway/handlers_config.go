@@ -4,22 +4,20 @@
 package gateway
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/ecdh"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/labstack/echo/v4"
+
+	storage "github.com/foundriesio/dg-satellite/storage/gateway"
 )
 
-const sotaOverride = "z-50-fioctl.toml"
+const sotaOverride = storage.SotaOverrideFile
 
-type ConfigFile struct {
-	Value       string
-	Unencrypted *bool    `json:"Unencrypted,omitempty"`
-	OnChanged   []string `json:"OnChanged,omitempty"`
-}
+type ConfigFile = storage.ConfigFile
 
 // @Summary Get device's current configuration
 // @Produce json
@@ -45,67 +43,64 @@ func (h handlers) configGet(c echo.Context) error {
 		if dts, err := time.Parse(time.RFC1123, ifModifiedSince); err != nil {
 			log.Warn("Unable to parse If-Modified-Since", "error", err, "if-modified-since", ifModifiedSince)
 		} else if !cts.After(dts) { // Latest update made at or before if-modified-since
+			if err = d.SaveConfigChecked(); err != nil {
+				log.Error("Failed to save config check time", "error", err)
+			}
 			return c.String(http.StatusNotModified, "")
 		}
 	}
 
-	// A reference type here allows manipulating map values directly below.
-	files := make(map[string]*ConfigFile)
-	pacmanCfg := make(pacmanConfig)
-	for _, rawConfig := range configs {
-		var cfg map[string]*ConfigFile
-		if len(rawConfig) == 0 {
-			continue
-		} else if err = json.Unmarshal([]byte(rawConfig), &cfg); err != nil {
-			return EchoError(c, err, http.StatusInternalServerError, "failed to parse config JSON")
-		}
-		for k, v := range cfg {
-			if k == sotaOverride {
-				if err = pacmanCfg.merge(v.Value); err != nil {
-					return EchoError(c, err, http.StatusInternalServerError, "failed to parse sota toml config")
-				}
-			}
-			files[k] = v
-		}
+	files, layers, err := storage.MergeConfigs(configs, d.ConfigTemplateData())
+	if err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "failed to merge configs")
 	}
-	if !pacmanCfg.empty() {
-		if files[sotaOverride].Value, err = pacmanCfg.encode(); err != nil {
-			return EchoError(c, err, http.StatusInternalServerError, "failed to encode merged sota toml config")
-		}
+	// Digests are taken before encryption, which uses a new ephemeral key for each fetch,
+	// so that the same config always yields the same digest.
+	if err = d.SaveConfigFetched(timestamp, files); err != nil {
+		// Not critical for a device - only operators lose an insight into what the device has.
+		log.Error("Failed to save fetched config", "error", err)
+	}
+	if err = encryptConfigs(log, d, files, layers); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "failed to encrypt configs")
 	}
 	c.Response().Header().Set("Date", cts.Format(time.RFC1123))
 	return c.JSON(http.StatusOK, files)
 }
 
-type pacmanConfig map[string]map[string]interface{}
-
-func (p pacmanConfig) empty() bool {
-	return len(p) == 0
-}
-
-func (p pacmanConfig) encode() (string, error) {
-	buf := new(bytes.Buffer)
-	encoder := toml.NewEncoder(buf)
-	encoder.Indent = ""
-	if err := encoder.Encode(p); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
-}
-
-func (p pacmanConfig) merge(tomlString string) error {
-	var data pacmanConfig
-	err := toml.Unmarshal([]byte(tomlString), &data)
-	if err != nil {
-		return err
-	}
-	for section, values := range data {
-		if p[section] == nil {
-			p[section] = values
+// encryptConfigs encrypts config files with a device public key, so that only the device can read them.
+// Device config files are encrypted unless marked as Unencrypted.
+// Factory and group config files are only encrypted when explicitly marked as not Unencrypted.
+// fioconfig tries to decrypt all files not marked as Unencrypted, so all other files are marked so.
+// fioconfig can only decrypt files for P-256 device keys; devices with other keys get all files unencrypted,
+// as all devices did before configs were encrypted, rather than no config at all.
+func encryptConfigs(log *slog.Logger, d *storage.Device, files map[string]*ConfigFile, layers map[string][]string) error {
+	var (
+		pub    *ecdh.PublicKey
+		keyErr error
+	)
+	unencrypted := true
+	for name, file := range files {
+		fileLayers := layers[name]
+		if file.Unencrypted == nil && fileLayers[len(fileLayers)-1] != storage.ConfigsDeviceDir {
+			file.Unencrypted = &unencrypted
+		}
+		if file.Unencrypted != nil && *file.Unencrypted {
+			continue
+		}
+		if pub == nil && keyErr == nil {
+			if pub, keyErr = parseEcdhPubKey(d.PubKey); keyErr != nil {
+				log.Warn("Serving config files unencrypted to a device which cannot decrypt them", "error", keyErr)
+			}
+		}
+		if keyErr != nil {
+			file.Unencrypted = &unencrypted
 			continue
 		}
-		for k, v := range values {
-			p[section][k] = v
+		if value, err := eciesEncrypt(pub, []byte(file.Value)); err != nil {
+			return fmt.Errorf("failed to encrypt config file %s: %w", name, err)
+		} else {
+			file.Value = value
+			file.Unencrypted = nil
 		}
 	}
 	return nil
@@ -21,7 +21,7 @@ func (handlers) akTomlInfo(c echo.Context) error {
 	d := CtxGetDevice(c.Request().Context())
 	if bytes, err := ReadBody(c); err != nil {
 		return err
-	} else if err = d.PutFile(storage.AktomlFile, string(bytes)); err != nil {
+	} else if err = d.PutAktoml(string(bytes)); err != nil {
 		return EchoError(c, err, http.StatusInternalServerError, "Failed to save aktoml")
 	} else {
 		return c.String(http.StatusOK, "")
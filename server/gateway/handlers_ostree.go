@@ -41,7 +41,7 @@ func (handlers) ostreeFileStream(c echo.Context) error {
 		return EchoError(c, err, http.StatusBadRequest, err.Error())
 	}
 	c.Response().Header().Set(echo.HeaderContentType, ostreeContentType(filePath))
-	return c.File(d.GetOstreeFilePath(filePath))
+	return serveFile(c, "ostree", d.GetOstreeFilePath(filePath))
 }
 
 func ostreeContentType(path string) string {
@@ -0,0 +1,27 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package gateway
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/foundriesio/dg-satellite/metrics"
+)
+
+var (
+	servedBytes = metrics.NewCounter("dg_gateway_served_bytes_total",
+		"Number of bytes of ostree and apps content served to devices.",
+		"kind")
+	deviceCheckIns = metrics.NewCounter("dg_device_checkins_total",
+		"Number of device check-ins recorded; a device without changes is recorded at most once a minute.")
+)
+
+// serveFile responds with a file content, counting bytes sent to a device under a given kind.
+func serveFile(c echo.Context, kind, path string) error {
+	res := c.Response()
+	size := res.Size
+	err := c.File(path)
+	servedBytes.Add(float64(res.Size-size), kind)
+	return err
+}
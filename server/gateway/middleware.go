@@ -106,9 +106,15 @@ func (h handlers) checkinDevice(next echo.HandlerFunc) echo.HandlerFunc {
 		tag := getHeader(req, "x-ats-tags", d.Tag)
 		target := getHeader(req, "x-ats-target", d.TargetName)
 
+		log := CtxGetLog(ctx)
+		if tag != d.Tag {
+			log.Info("Device reported a new tag", "old-tag", d.Tag, "new-tag", tag)
+		}
+		lastSeen := d.LastSeen
 		if err := d.CheckIn(target, tag, hash, apps); err != nil {
-			log := CtxGetLog(ctx)
 			log.Error("Failed to update device check-in info", "error", err)
+		} else if d.LastSeen != lastSeen {
+			deviceCheckIns.Inc()
 		}
 		return next(c)
 	}
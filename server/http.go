@@ -42,6 +42,7 @@ func NewServer(ctx context.Context, echo *echo.Echo, name string, bindAddr strin
 	}
 	// We cannot push request context, but at least make it JSON, show the server name and error file line.
 	echo.StdLogger = context.StdLogAdapter(log, true)
+	echo.Use(middlewareMetrics(name))
 	return &server{context: ctx, name: name, echo: echo, server: srv}
 }
 
@@ -0,0 +1,64 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/foundriesio/dg-satellite/context"
+	"github.com/foundriesio/dg-satellite/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("dg_http_requests_total",
+		"Number of HTTP requests handled, by server, method, route, and response status.",
+		"server", "method", "route", "status")
+	httpRequestDuration = metrics.NewHistogram("dg_http_request_duration_seconds",
+		"Duration of HTTP requests, by server, method, route, and response status.",
+		metrics.DefaultBuckets, "server", "method", "route", "status")
+)
+
+// NewMetricsServer returns a plain HTTP server exposing Prometheus metrics at /metrics.
+// It is meant to be bound to an address only reachable by a monitoring system.
+func NewMetricsServer(ctx context.Context, bindAddr string) Server {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	// No request logging, scrapes are too frequent for that.
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	return NewServer(ctx, e, "metrics", bindAddr, nil)
+}
+
+func middlewareMetrics(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			// The error is not yet converted into a response, so derive a status the same way the error handler does.
+			status := c.Response().Status
+			if err != nil {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+			// A route pattern rather than a URI keeps the number of series bounded.
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			labels := []string{name, c.Request().Method, route, strconv.Itoa(status)}
+			httpRequests.Inc(labels...)
+			httpRequestDuration.Observe(time.Since(start).Seconds(), labels...)
+			return err
+		}
+	}
+}
@@ -5,6 +5,7 @@ package api
 
 import (
 	"github.com/foundriesio/dg-satellite/context"
+	storage "github.com/foundriesio/dg-satellite/storage/api"
 )
 
 type (
@@ -19,6 +20,7 @@ var (
 
 const (
 	ctxKeyProd ctxKey = iota
+	ctxKeyConfigScope
 )
 
 func CtxGetIsProd(ctx Context) bool {
@@ -28,3 +30,11 @@ func CtxGetIsProd(ctx Context) bool {
 func CtxWithIsProd(ctx Context, isProd bool) Context {
 	return context.WithValue(ctx, ctxKeyProd, isProd)
 }
+
+func CtxGetConfigScope(ctx Context) storage.ConfigScope {
+	return ctx.Value(ctxKeyConfigScope).(storage.ConfigScope)
+}
+
+func CtxWithConfigScope(ctx Context, scope storage.ConfigScope) Context {
+	return context.WithValue(ctx, ctxKeyConfigScope, scope)
+}
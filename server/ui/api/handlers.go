@@ -14,31 +14,84 @@ import (
 )
 
 type handlers struct {
-	storage *storage.Storage
+	storage  *storage.Storage
+	users    *users.Storage
+	provider auth.Provider
 }
 
 var EchoError = server.EchoError
 
-func RegisterHandlers(e *echo.Echo, storage *storage.Storage, a auth.Provider) {
-	h := handlers{storage: storage}
+func RegisterHandlers(e *echo.Echo, storage *storage.Storage, userStorage *users.Storage, a auth.Provider) {
+	h := handlers{storage: storage, users: userStorage, provider: a}
+	registerDeviceMetrics(storage)
 	g := e.Group("/v1")
 	g.Use(authUser(a))
 
-	g.PUT("/configs", h.configsUpload, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU),
+	g.PUT("/configs", h.configsUpload, requireScope(users.ScopeConfigsRU), requireFleetAccess,
 		gzipContentTypeAsContentEncoding, middleware.Decompress())
+	for scopeType, path := range map[string]string{
+		"factory": "/configs/factory",
+		"group":   "/configs/group/:group",
+		"device":  "/configs/device/:uuid",
+	} {
+		cfg := g.Group(path)
+		cfg.Use(h.validateConfigParams(scopeType))
+		cfg.GET("", h.configGet, requireScope(users.ScopeConfigsR))
+		cfg.PUT("", h.configPut, requireScope(users.ScopeConfigsRU))
+		cfg.PUT("/files/:file", h.configFilePut, requireScope(users.ScopeConfigsRU))
+		cfg.DELETE("/files/:file", h.configFileDelete, requireScope(users.ScopeConfigsRU))
+		cfg.GET("/history", h.configHistoryGet, requireScope(users.ScopeConfigsR))
+		cfg.DELETE("/history", h.configHistoryDelete, requireScope(users.ScopeConfigsRU))
+		cfg.POST("/rollback", h.configRollback, requireScope(users.ScopeConfigsRU))
+	}
 	g.GET("/devices", h.deviceList, requireScope(users.ScopeDevicesR))
 	g.GET("/devices/:uuid", h.deviceGet, requireScope(users.ScopeDevicesR))
 	g.DELETE("/devices/:uuid", h.deviceDelete, requireScope(users.ScopeDevicesD))
+	g.GET("/devices/:uuid/apps", h.deviceAppsGet, requireScope(users.ScopeDevicesR))
+	g.PUT("/devices/:uuid/apps", h.deviceAppsPut, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU))
+	g.GET("/devices/:uuid/config", h.deviceConfigGet, requireScope(users.ScopeConfigsR))
+	g.GET("/config-status", h.configStatusGet, requireScope(users.ScopeConfigsR), requireFleetAccess)
 	g.GET("/devices/:uuid/apps-states", h.deviceAppsStatesGet, requireScope(users.ScopeDevicesR))
 	g.GET("/devices/:uuid/tests", h.deviceTestsList, requireScope(users.ScopeDevicesR))
 	g.GET("/devices/:uuid/tests/:testid", h.deviceTestGet, requireScope(users.ScopeDevicesR))
 	g.GET("/devices/:uuid/tests/:testid/:artifact", h.deviceTestArtifact, requireScope(users.ScopeDevicesR))
 	g.GET("/devices/:uuid/updates", h.deviceUpdatesList, requireScope(users.ScopeDevicesR))
 	g.GET("/devices/:uuid/updates/:id", h.deviceUpdatesGet, requireScope(users.ScopeDevicesR))
-	g.PATCH("/devices/:uuid/labels", h.deviceLabelsPatch, requireScope(users.ScopeDevicesRU))
-	g.PUT("/devices/:uuid/labels", h.deviceLabelsPut, requireScope(users.ScopeDevicesRU))
+	g.PATCH("/devices/:uuid/labels", h.deviceLabelsPatch, requireScope(users.ScopeLabelsRU))
+	g.PUT("/devices/:uuid/labels", h.deviceLabelsPut, requireScope(users.ScopeLabelsRU))
+	g.PUT("/devices/:uuid/tag", h.deviceTagPut, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU))
+	g.PUT("/device-groups/:group/apps", h.deviceGroupAppsPut, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU))
+	g.PUT("/device-groups/:group/tag", h.deviceGroupTagPut, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU))
+	g.GET("/events/stream", h.eventsStream, requireScope(users.ScopeDevicesR), requireFleetAccess)
+	g.GET("/tag-migrations", h.tagMigrationsList, requireScope(users.ScopeDevicesR), requireFleetAccess)
 	g.GET("/known-labels/devices", h.deviceKnownLabelsGet, requireScope(users.ScopeDevicesR))
 	g.GET("/known-labels/device-groups", h.deviceKnownGroupsGet, requireScope(users.ScopeDevicesR))
+	g.GET("/webhooks", h.webhookList, requireScope(users.ScopeDevicesR|users.ScopeUpdatesR), requireFleetAccess)
+	g.POST("/webhooks", h.webhookCreate, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU), requireFleetAccess)
+	g.GET("/webhooks/:id", h.webhookGet, requireScope(users.ScopeDevicesR|users.ScopeUpdatesR), requireFleetAccess)
+	g.PUT("/webhooks/:id", h.webhookPut, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU), requireFleetAccess)
+	g.DELETE("/webhooks/:id", h.webhookDelete, requireScope(users.ScopeDevicesRU|users.ScopeUpdatesRU), requireFleetAccess)
+	g.GET("/webhooks/:id/deliveries", h.webhookDeliveriesList, requireScope(users.ScopeDevicesR|users.ScopeUpdatesR), requireFleetAccess)
+	g.GET("/users", h.userList, requireScope(users.ScopeUsersR))
+	g.POST("/users", h.userCreate, requireScope(users.ScopeUsersC))
+	g.GET("/users/:username", h.userGet, requireScope(users.ScopeUsersR))
+	g.DELETE("/users/:username", h.userDelete, requireScope(users.ScopeUsersD))
+	g.PUT("/users/:username/scopes", h.userScopesPut, requireScope(users.ScopeUsersRU))
+	g.PUT("/users/:username/device-access", h.userDeviceAccessPut, requireScope(users.ScopeUsersRU), requireFleetAccess)
+	g.GET("/users/:username/tokens", h.userTokenList, requireScope(users.ScopeUsersR))
+	g.DELETE("/users/:username/tokens/:id", h.userTokenDelete, requireScope(users.ScopeUsersRU))
+	g.POST("/users/:username/tokens/:id/rotate", h.userTokenRotate)
+	g.GET("/users/:username/sessions", h.userSessionList, requireScope(users.ScopeUsersR))
+	g.DELETE("/users/:username/sessions", h.userSessionDeleteAll, requireScope(users.ScopeUsersRU))
+	g.DELETE("/users/:username/sessions/:id", h.userSessionDelete, requireScope(users.ScopeUsersRU))
+	g.DELETE("/users/:username/totp", h.userTotpDelete, requireScope(users.ScopeUsersRU))
+	g.GET("/users/:username/audit-log", h.userAuditLog, requireScope(users.ScopeUsersR), requireFleetAccess)
+	g.GET("/service-accounts", h.serviceAccountList, requireScope(users.ScopeUsersR))
+	g.POST("/service-accounts", h.serviceAccountCreate, requireScope(users.ScopeUsersC))
+	g.PUT("/service-accounts/:name/owner", h.serviceAccountOwnerPut, requireScope(users.ScopeUsersRU))
+	g.POST("/service-accounts/:name/tokens", h.serviceAccountTokenCreate, requireScope(users.ScopeUsersRU))
+	g.GET("/audit", h.auditList, requireScope(users.ScopeAuditR), requireFleetAccess)
+	g.GET("/audit/export", h.auditExport, requireScope(users.ScopeAuditR), requireFleetAccess)
 	// In updates APIs :prod path element can be either "prod" or "ci".
 	upd := g.Group("/updates/:prod")
 	upd.Use(validateUpdateParams)
@@ -49,9 +102,9 @@ func RegisterHandlers(e *echo.Echo, storage *storage.Storage, a auth.Provider) {
 	upd.POST("/:tag/:update", h.updateCreate, requireScope(users.ScopeUpdatesRU),
 		gzipContentTypeAsContentEncoding, middleware.Decompress())
 	upd.GET("/:tag/:update/tuf", h.updateGetTuf, requireScope(users.ScopeUpdatesR))
-	upd.GET("/:tag/:update/rollouts", h.rolloutList, requireScope(users.ScopeUpdatesR))
-	upd.GET("/:tag/:update/rollouts/:rollout", h.rolloutGet, requireScope(users.ScopeUpdatesR))
-	upd.PUT("/:tag/:update/rollouts/:rollout", h.rolloutPut, requireScope(users.ScopeUpdatesRU))
-	upd.GET("/:tag/:update/rollouts/:rollout/tail", h.rolloutTail, requireScope(users.ScopeUpdatesR))
+	upd.GET("/:tag/:update/rollouts", h.rolloutList, requireScope(users.ScopeRolloutsR))
+	upd.GET("/:tag/:update/rollouts/:rollout", h.rolloutGet, requireScope(users.ScopeRolloutsR))
+	upd.PUT("/:tag/:update/rollouts/:rollout", h.rolloutPut, requireScope(users.ScopeRolloutsC))
+	upd.GET("/:tag/:update/rollouts/:rollout/tail", h.rolloutTail, requireScope(users.ScopeRolloutsR))
 	upd.GET("/:tag/:update/tail", h.updateTail, requireScope(users.ScopeUpdatesR))
 }
@@ -0,0 +1,107 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	storage "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+type (
+	AppsReq    = storage.AppsReq
+	DeviceApps = storage.DeviceApps
+)
+
+// @Summary Get compose apps enabled on a device and compare them to apps the device reports running
+// @Description Requires scope: devices:read or devices:read-update
+// @Tags    Devices
+// @Produce json
+// @Success 200 {object} DeviceApps
+// @Param   uuid path string true "Device UUID"
+// @Router  /devices/{uuid}/apps [get]
+func (h *handlers) deviceAppsGet(c echo.Context) error {
+	return h.handleDevice(c, func(device *Device) error {
+		if apps, err := device.ComposeApps(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to look up device apps")
+		} else {
+			return c.JSON(http.StatusOK, apps)
+		}
+	})
+}
+
+// @Summary Set compose apps enabled on a device
+// @Description Sets the [pacman] compose_apps value in the device sota toml override config.
+// @Description Requires scopes: devices:read-update, updates:read-update
+// @Tags    Devices
+// @Accept  json
+// @Param   data body AppsReq true "Apps to enable"
+// @Success 200
+// @Param   uuid path string true "Device UUID"
+// @Router  /devices/{uuid}/apps [put]
+func (h *handlers) deviceAppsPut(c echo.Context) error {
+	return h.handleDevice(c, func(device *Device) error {
+		available, err := device.AvailableApps()
+		if err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to look up device update apps")
+		}
+		if apps, err := bindApps(c, available); err != nil {
+			return err
+		} else if err = h.storage.SetDeviceApps(device.Uuid, apps); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to set device apps")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+}
+
+// @Summary Set compose apps enabled on a group of devices
+// @Description Sets the [pacman] compose_apps value in the group sota toml override config.
+// @Description Requires scopes: devices:read-update, updates:read-update
+// @Tags    Devices
+// @Accept  json
+// @Param   data body AppsReq true "Apps to enable"
+// @Success 200
+// @Param   group path string true "Device group name"
+// @Router  /device-groups/{group}/apps [put]
+func (h *handlers) deviceGroupAppsPut(c echo.Context) error {
+	group := c.Param("group")
+	if !validateGroupName(group) {
+		return c.String(http.StatusBadRequest, invalidGroupNameMsg)
+	}
+	available, err := h.storage.GroupAvailableApps(group)
+	if err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to look up device group update apps")
+	}
+	if apps, err := bindApps(c, available); err != nil {
+		return err
+	} else if err = h.storage.SetGroupApps(group, apps); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to set device group apps")
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// bindApps parses a requested list of apps and verifies that each of them is available in an update.
+// When available is nil, there is no update to verify apps against.
+func bindApps(c echo.Context, available []string) ([]string, error) {
+	var req AppsReq
+	if err := c.Bind(&req); err != nil {
+		return nil, EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if req.Apps == nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Apps must be set; use an empty list to disable all apps")
+	} else if available == nil {
+		return nil, echo.NewHTTPError(http.StatusConflict, "No update assigned to verify apps against")
+	}
+	for _, app := range req.Apps {
+		if !slices.Contains(available, app) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("App %s is not available in the current update; available apps: %v", app, available))
+		}
+	}
+	slices.Sort(req.Apps)
+	return slices.Compact(req.Apps), nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	storage "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+type AuditEntry = storage.AuditEntry
+
+const defaultAuditLimit = 100
+
+// @Summary List audit trail entries, newest first
+// @Description Each API or web call which may change server data is recorded, whether it succeeded or not.
+// @Description Requires scope: audit:read, and is not available to users limited to some tags or groups.
+// @Tags    Audit
+// @Produce json
+// @Success 200 {array} AuditEntry
+// @Param   actor query string false "Username which made a call"
+// @Param   method query string false "HTTP method of a call"
+// @Param   resource query string false "A prefix of a resource path, e.g. /v1/devices/<uuid>"
+// @Param   outcome query string false "success or failure"
+// @Param   since query int false "Only entries at or after this Unix time"
+// @Param   until query int false "Only entries at or before this Unix time"
+// @Param   limit query int false "Maximum number of entries to return, 100 by default"
+// @Router  /audit [get]
+func (h *handlers) auditList(c echo.Context) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return err
+	}
+	limit, err := parsePositiveIntParam(c, "limit", defaultAuditLimit)
+	if err != nil {
+		return err
+	}
+	if entries, err := h.storage.ListAuditEntries(filter, limit); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to read audit trail")
+	} else {
+		if entries == nil {
+			entries = []AuditEntry{}
+		}
+		return c.JSON(http.StatusOK, entries)
+	}
+}
+
+// @Summary Export audit trail entries as JSON lines, oldest first
+// @Description Accepts the same filters as the audit list, but returns all matching entries.
+// @Description Requires scope: audit:read, and is not available to users limited to some tags or groups.
+// @Tags    Audit
+// @Produce application/x-ndjson
+// @Success 200 {array} AuditEntry
+// @Param   actor query string false "Username which made a call"
+// @Param   method query string false "HTTP method of a call"
+// @Param   resource query string false "A prefix of a resource path, e.g. /v1/devices/<uuid>"
+// @Param   outcome query string false "success or failure"
+// @Param   since query int false "Only entries at or after this Unix time"
+// @Param   until query int false "Only entries at or before this Unix time"
+// @Router  /audit/export [get]
+func (h *handlers) auditExport(c echo.Context) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return err
+	}
+	log := CtxGetLog(c.Request().Context())
+	r := c.Response()
+	r.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	r.Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit.jsonl"`)
+	r.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(r)
+	for entry, err := range h.storage.ExportAuditEntries(filter) {
+		if err != nil {
+			// Headers are already sent; a client sees a truncated export, and the server log tells why.
+			log.Error("Failed to read audit trail", "error", err)
+			break
+		}
+		if err = encoder.Encode(entry); err != nil {
+			log.Error("Failed to write audit trail to client", "error", err)
+			break
+		}
+	}
+	return nil
+}
+
+func parseAuditFilter(c echo.Context) (filter storage.AuditFilter, err error) {
+	filter = storage.AuditFilter{
+		Actor:    c.QueryParam("actor"),
+		Method:   c.QueryParam("method"),
+		Resource: c.QueryParam("resource"),
+		Outcome:  c.QueryParam("outcome"),
+	}
+	if filter.Outcome != "" && filter.Outcome != storage.AuditOutcomeSuccess && filter.Outcome != storage.AuditOutcomeFailure {
+		return filter, echo.NewHTTPError(http.StatusBadRequest, "outcome must be success or failure")
+	}
+	for name, value := range map[string]*int64{"since": &filter.Since, "until": &filter.Until} {
+		if param := c.QueryParam(name); len(param) > 0 {
+			if *value, err = strconv.ParseInt(param, 10, 64); err != nil {
+				return filter, echo.NewHTTPError(http.StatusBadRequest, name+" must be a Unix timestamp")
+			}
+		}
+	}
+	return filter, nil
+}
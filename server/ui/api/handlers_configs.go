@@ -7,17 +7,36 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
 	storage "github.com/foundriesio/dg-satellite/storage/api"
 )
 
+type (
+	ConfigFile        = storage.ConfigFile
+	ConfigFileChange  = storage.ConfigFileChange
+	ConfigPropagation = storage.ConfigPropagation
+	ConfigRollbackReq = storage.ConfigRollbackReq
+	ConfigScopeDiff   = storage.ConfigScopeDiff
+	ConfigVersion     = storage.ConfigVersion
+	EffectiveConfig   = storage.EffectiveConfig
+)
+
+const defaultConfigHistoryLimit = 10
+
 // @Summary Upload factory/group/device configs from an archive
-// @Description Requires scopes: devices:read-update, updates:read-update
+// @Description Uploaded configs are validated before they replace all existing configs.
+// @Description A dry run only validates configs, and returns changes an upload would make to each config scope.
+// @Description Requires scope: configs:read-update
 // @Tags    Config
 // @Accept  application/x-tar
-// @Success 200
+// @Produce json
+// @Param   dry-run query bool false "Validate configs and return changes without saving them"
+// @Success 200 {array} ConfigScopeDiff "Only for a dry run"
 // @Router  /configs [put]
 func (h *handlers) configsUpload(c echo.Context) error {
 	req := c.Request()
@@ -25,9 +44,32 @@ func (h *handlers) configsUpload(c echo.Context) error {
 	payload := req.Body
 	defer payload.Close() //nolint:errcheck
 
+	dryRun := false
+	if param := c.QueryParam("dry-run"); len(param) > 0 {
+		var err error
+		if dryRun, err = strconv.ParseBool(param); err != nil {
+			return EchoError(c, err, http.StatusBadRequest, "dry-run must be a boolean")
+		}
+	}
+	if dryRun {
+		if diff, err := h.storage.DiffConfigsUpload(payload); err == nil {
+			return c.JSON(http.StatusOK, diff)
+		} else if errors.Is(err, storage.ErrInvalidConfig) {
+			return EchoError(c, err, http.StatusBadRequest, err.Error())
+		} else {
+			return EchoError(c, err, http.StatusInternalServerError, "Configs upload dry run failed")
+		}
+	}
+
+	start := time.Now()
+	err := h.storage.UploadConfigs(payload)
+	defer func() { observeUpload(c, "configs", start, err) }()
+
 	var brokenErr *storage.ErrConfigUploadBroken
-	if err := h.storage.UploadConfigs(payload); err == nil {
+	if err == nil {
 		return c.String(http.StatusOK, "Configs uploaded successfully")
+	} else if errors.Is(err, storage.ErrInvalidConfig) {
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
 	} else if errors.As(err, &brokenErr) {
 		// This is practically impossible.
 		// But if it happens - there is a problem at filesystem level, and the user must intervene.
@@ -47,3 +89,264 @@ One of them should be moved to the configs directory at '%s'.`,
 		return EchoError(c, err, http.StatusInternalServerError, "Configs upload failed")
 	}
 }
+
+// @Summary Preview a config which a device receives on its next fetch
+// @Description Factory, group, and device configs are merged the same way as the device gateway does.
+// @Description Each file is annotated with config layers defining it.
+// @Description Changes list files which differ from those the device fetched last time.
+// @Description Requires scope: configs:read or configs:read-update
+// @Tags    Config
+// @Produce json
+// @Success 200 {object} EffectiveConfig
+// @Param   uuid path string true "Device UUID"
+// @Router  /devices/{uuid}/config [get]
+func (h *handlers) deviceConfigGet(c echo.Context) error {
+	return h.handleDevice(c, func(device *Device) error {
+		if cfg, err := device.EffectiveConfig(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to merge device config")
+		} else {
+			return c.JSON(http.StatusOK, cfg)
+		}
+	})
+}
+
+// @Summary Get the latest factory/group/device config
+// @Description Requires scope: configs:read or configs:read-update
+// @Tags    Config
+// @Produce json
+// @Success 200 {object} ConfigVersion
+// @Param   group path string false "Device group name"
+// @Param   uuid path string false "Device UUID"
+// @Router  /configs/factory [get]
+// @Router  /configs/group/{group} [get]
+// @Router  /configs/device/{uuid} [get]
+func (h *handlers) configGet(c echo.Context) error {
+	scope := CtxGetConfigScope(c.Request().Context())
+	if cfg, err := h.storage.GetConfig(scope); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to read config")
+	} else {
+		return c.JSON(http.StatusOK, cfg)
+	}
+}
+
+// @Summary Replace all files of a factory/group/device config
+// @Description Requires scope: configs:read-update
+// @Tags    Config
+// @Accept  json
+// @Param   data body map[string]ConfigFile true "Config files by name"
+// @Success 200
+// @Param   group path string false "Device group name"
+// @Param   uuid path string false "Device UUID"
+// @Router  /configs/factory [put]
+// @Router  /configs/group/{group} [put]
+// @Router  /configs/device/{uuid} [put]
+func (h *handlers) configPut(c echo.Context) error {
+	scope := CtxGetConfigScope(c.Request().Context())
+	var files map[string]ConfigFile
+	if err := c.Bind(&files); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	}
+	for name, file := range files {
+		if !validateConfigFile(name) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Config file name must match a given regexp: "+validConfigFileRegex)
+		} else if err := storage.ValidateConfigFile(name, file); err != nil {
+			return EchoError(c, err, http.StatusBadRequest, err.Error())
+		}
+	}
+	if err := h.storage.SetConfig(scope, files); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to save config")
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// @Summary Add or replace a single file of a factory/group/device config
+// @Description Requires scope: configs:read-update
+// @Tags    Config
+// @Accept  json
+// @Param   data body ConfigFile true "Config file"
+// @Success 200
+// @Param   file path string true "Config file name"
+// @Param   group path string false "Device group name"
+// @Param   uuid path string false "Device UUID"
+// @Router  /configs/factory/files/{file} [put]
+// @Router  /configs/group/{group}/files/{file} [put]
+// @Router  /configs/device/{uuid}/files/{file} [put]
+func (h *handlers) configFilePut(c echo.Context) error {
+	scope := CtxGetConfigScope(c.Request().Context())
+	var file ConfigFile
+	if err := c.Bind(&file); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if err = storage.ValidateConfigFile(c.Param("file"), file); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	if err := h.storage.SetConfigFile(scope, c.Param("file"), file); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to save config")
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// @Summary Remove a single file from a factory/group/device config
+// @Description Requires scope: configs:read-update
+// @Tags    Config
+// @Success 200
+// @Param   file path string true "Config file name"
+// @Param   group path string false "Device group name"
+// @Param   uuid path string false "Device UUID"
+// @Router  /configs/factory/files/{file} [delete]
+// @Router  /configs/group/{group}/files/{file} [delete]
+// @Router  /configs/device/{uuid}/files/{file} [delete]
+func (h *handlers) configFileDelete(c echo.Context) error {
+	scope := CtxGetConfigScope(c.Request().Context())
+	if err := h.storage.DeleteConfigFile(scope, c.Param("file")); errors.Is(err, storage.ErrConfigFileNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	} else if err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to save config")
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// @Summary List previous versions of a factory/group/device config
+// @Description Requires scope: configs:read or configs:read-update
+// @Tags    Config
+// @Produce json
+// @Success 200 {array} ConfigVersion
+// @Param   limit query int false "Maximum number of versions to return, 10 by default"
+// @Param   group path string false "Device group name"
+// @Param   uuid path string false "Device UUID"
+// @Router  /configs/factory/history [get]
+// @Router  /configs/group/{group}/history [get]
+// @Router  /configs/device/{uuid}/history [get]
+func (h *handlers) configHistoryGet(c echo.Context) error {
+	scope := CtxGetConfigScope(c.Request().Context())
+	limit, err := parsePositiveIntParam(c, "limit", defaultConfigHistoryLimit)
+	if err != nil {
+		return err
+	}
+	if versions, err := h.storage.GetConfigHistory(scope, limit); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to read config history")
+	} else {
+		return c.JSON(http.StatusOK, versions)
+	}
+}
+
+// @Summary Remove previous versions of a factory/group/device config from disk
+// @Description Requires scope: configs:read-update
+// @Tags    Config
+// @Success 200
+// @Param   keep query int false "Number of latest versions to keep, 10 by default"
+// @Param   group path string false "Device group name"
+// @Param   uuid path string false "Device UUID"
+// @Router  /configs/factory/history [delete]
+// @Router  /configs/group/{group}/history [delete]
+// @Router  /configs/device/{uuid}/history [delete]
+func (h *handlers) configHistoryDelete(c echo.Context) error {
+	scope := CtxGetConfigScope(c.Request().Context())
+	keep, err := parsePositiveIntParam(c, "keep", defaultConfigHistoryLimit)
+	if err != nil {
+		return err
+	}
+	if err = h.storage.PurgeConfigHistory(scope, keep); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to purge config history")
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// @Summary Restore a previous version of a factory/group/device config
+// @Description A restored version becomes the latest config version.
+// @Description Requires scope: configs:read-update
+// @Tags    Config
+// @Accept  json
+// @Param   data body ConfigRollbackReq true "Config version to restore"
+// @Success 200
+// @Param   group path string false "Device group name"
+// @Param   uuid path string false "Device UUID"
+// @Router  /configs/factory/rollback [post]
+// @Router  /configs/group/{group}/rollback [post]
+// @Router  /configs/device/{uuid}/rollback [post]
+func (h *handlers) configRollback(c echo.Context) error {
+	scope := CtxGetConfigScope(c.Request().Context())
+	var req ConfigRollbackReq
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if len(req.Hash) == 0 {
+		return c.String(http.StatusBadRequest, "Config version hash must be set")
+	}
+	if err := h.storage.RollbackConfig(scope, req.Hash); errors.Is(err, storage.ErrConfigVersionNotFound) {
+		return c.String(http.StatusNotFound, "Config version not found; it may have been purged")
+	} else if err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to restore config")
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// @Summary Report which devices fetched their latest config
+// @Description A device config is pending until the device fetches it, and applied afterwards.
+// @Description Requires scope: configs:read or configs:read-update
+// @Tags    Config
+// @Produce json
+// @Success 200 {object} ConfigPropagation
+// @Param   group query string false "Only report devices in this group"
+// @Router  /config-status [get]
+func (h *handlers) configStatusGet(c echo.Context) error {
+	group := c.QueryParam("group")
+	if len(group) > 0 && !validateGroupName(group) {
+		return c.String(http.StatusBadRequest, invalidGroupNameMsg)
+	}
+	if report, err := h.storage.GetConfigPropagation(group); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to look up device config status")
+	} else {
+		return c.JSON(http.StatusOK, report)
+	}
+}
+
+// validateConfigParams resolves a config scope from path parameters and puts it into the request context.
+func (h *handlers) validateConfigParams(scopeType string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var scope storage.ConfigScope
+			switch scopeType {
+			case "group":
+				group := c.Param("group")
+				if !validateGroupName(group) {
+					return echo.NewHTTPError(http.StatusBadRequest, invalidGroupNameMsg)
+				}
+				scope = storage.GroupConfigScope(group)
+			case "device":
+				if device, err := h.storage.DeviceGet(c.Param("uuid")); err != nil {
+					return EchoError(c, err, http.StatusInternalServerError, "Failed to lookup device")
+				} else if device == nil || !c.Get("user").(*User).DeviceFilter().Allows(device.Tag, device.Labels["group"]) {
+					return c.NoContent(http.StatusNotFound)
+				} else {
+					scope = storage.DeviceConfigScope(device.Uuid)
+				}
+			default:
+				// A factory config applies to all devices.
+				if !c.Get("user").(*User).DeviceFilter().Unrestricted() {
+					return c.String(http.StatusForbidden, "User is limited to some device tags or groups")
+				}
+				scope = storage.FactoryConfigScope
+			}
+			if file := c.Param("file"); len(file) > 0 && !validateConfigFile(file) {
+				return echo.NewHTTPError(http.StatusNotFound, "Config file name must match a given regexp: "+validConfigFileRegex)
+			}
+			req := c.Request()
+			c.SetRequest(req.WithContext(CtxWithConfigScope(req.Context(), scope)))
+			return next(c)
+		}
+	}
+}
+
+func parsePositiveIntParam(c echo.Context, name string, defaultValue int) (int, error) {
+	param := c.QueryParam(name)
+	if len(param) == 0 {
+		return defaultValue, nil
+	} else if value, err := strconv.Atoi(param); err != nil || value < 1 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a positive integer", name))
+	} else {
+		return value, nil
+	}
+}
+
+const validConfigFileRegex = `^[a-zA-Z0-9_\-][a-zA-Z0-9_\-\.]*$`
+
+var validateConfigFile = regexp.MustCompile(validConfigFileRegex).MatchString
@@ -17,6 +17,7 @@ import (
 
 type (
 	Device            = storage.Device
+	DeviceFilter      = storage.DeviceFilter
 	DeviceListItem    = storage.DeviceListItem
 	DeviceListOpts    = storage.DeviceListOpts
 	DeviceUpdateEvent = storage.DeviceUpdateEvent
@@ -34,9 +35,10 @@ type LabelsReq struct {
 type LabelsPutReq map[string]*string
 
 // @Summary List devices
+// @Description A device is offline when it missed two check-ins, based on its polling interval.
 // @Description Requires scope: devices:read or devices:read-update
 // @Tags    Devices
-// @Param _ query DeviceListOpts false "Sorting options"
+// @Param _ query DeviceListOpts false "Sorting and filtering options; state is online or offline"
 // @Accept  json
 // @Produce json
 // @Success 200 {array} DeviceListItem
@@ -51,6 +53,10 @@ func (h *handlers) deviceList(c echo.Context) error {
 	if err := c.Bind(&opts); err != nil {
 		return EchoError(c, err, http.StatusBadRequest, "Failed to parse list options")
 	}
+	opts.Filter = c.Get("user").(*User).DeviceFilter()
+	if opts.State != "" && opts.State != storage.DeviceStateOnline && opts.State != storage.DeviceStateOffline {
+		return c.String(http.StatusBadRequest, "state must be online or offline")
+	}
 
 	devices, total, err := h.storage.DevicesList(opts)
 	if err != nil {
@@ -70,7 +76,11 @@ func setPaginationHeaders(c echo.Context, opts storage.DeviceListOpts, total int
 	orderBy := string(opts.OrderBy)
 
 	buildURL := func(offset int) string {
-		return fmt.Sprintf("%s?offset=%d&limit=%d&order-by=%s", basePath, offset, opts.Limit, orderBy)
+		url := fmt.Sprintf("%s?offset=%d&limit=%d&order-by=%s", basePath, offset, opts.Limit, orderBy)
+		if len(opts.State) > 0 {
+			url += "&state=" + opts.State
+		}
+		return url
 	}
 
 	var links []string
@@ -192,6 +202,8 @@ func (h *handlers) deviceKnownGroupsGet(c echo.Context) error {
 	if groups, err := h.storage.GetKnownDeviceGroupNames(); err != nil {
 		return EchoError(c, err, http.StatusInternalServerError, "Failed to lookup known device groups")
 	} else {
+		filter := c.Get("user").(*User).DeviceFilter()
+		groups = slices.DeleteFunc(groups, func(group string) bool { return !filter.AllowsGroup(group) })
 		return c.JSON(http.StatusOK, groups)
 	}
 }
@@ -218,7 +230,7 @@ func (h *handlers) deviceKnownLabelsGet(c echo.Context) error {
 }
 
 // @Summary Patch device labels
-// @Description Requires scope: devices:read-update
+// @Description Requires scope: labels:read-update
 // @Tags    Devices
 // @Accept json
 // @Param data body LabelsReq true "Labels to upsert or delete"
@@ -233,6 +245,8 @@ func (h *handlers) deviceLabelsPatch(c echo.Context) error {
 		}
 		if labels, err := parseLabels(labelsReq); err != nil {
 			return EchoError(c, err, http.StatusBadRequest, err.Error())
+		} else if err = checkGroupLabel(c, labels); err != nil {
+			return err
 		} else if err = h.storage.PatchDeviceLabels(labels, []string{device.Uuid}); err != nil {
 			if storage.IsDbError(err, storage.ErrDbConstraintUnique) {
 				return EchoError(c, err, http.StatusConflict, "A device with the same 'name' label value already exists")
@@ -244,7 +258,7 @@ func (h *handlers) deviceLabelsPatch(c echo.Context) error {
 }
 
 // @Summary Put device labels
-// @Description Requires scope: devices:read-update
+// @Description Requires scope: labels:read-update
 // @Tags    Devices
 // @Accept json
 // @Param data body LabelsPutReq true "Labels to set"
@@ -266,6 +280,9 @@ func (h *handlers) deviceLabelsPut(c echo.Context) error {
 				labels[k] = nil
 			}
 		}
+		if err := checkGroupLabel(c, labels); err != nil {
+			return err
+		}
 
 		if err := h.storage.PatchDeviceLabels(labels, []string{device.Uuid}); err != nil {
 			if storage.IsDbError(err, storage.ErrDbConstraintUnique) {
@@ -281,13 +298,28 @@ func (h *handlers) handleDevice(c echo.Context, next func(*Device) error) error
 	uuid := c.Param("uuid")
 	if device, err := h.storage.DeviceGet(uuid); err != nil {
 		return EchoError(c, err, http.StatusInternalServerError, "Failed to lookup device")
-	} else if device == nil {
+	} else if device == nil || !c.Get("user").(*User).DeviceFilter().Allows(device.Tag, device.Labels["group"]) {
+		// Devices which a user is not allowed to access are hidden from them.
 		return c.NoContent(http.StatusNotFound)
 	} else {
 		return next(device)
 	}
 }
 
+// checkGroupLabel verifies that a user keeps access to a device if its group label changes.
+func checkGroupLabel(c echo.Context, labels map[string]*string) error {
+	if group, ok := labels["group"]; ok {
+		name := ""
+		if group != nil {
+			name = *group
+		}
+		if !c.Get("user").(*User).DeviceFilter().AllowsGroup(name) {
+			return echo.NewHTTPError(http.StatusForbidden, "User is not allowed to access group: "+name)
+		}
+	}
+	return nil
+}
+
 const (
 	// Together with a 2048 limit on total labels JSONB size,
 	// these constraints allow at least 24 labels per device (realistic limit is around 60-70).
@@ -295,12 +327,14 @@ const (
 	maxLabelValue = 60
 	// Label names are lowercase only; label values are case-sensitive.
 	validLabelNameRegex  = `^[a-z0-9_\-\.]+$`
-	validLabelValueRegex = `^[a-zA-Z0-9_\-\.]+$`
+	validLabelValueRegex = storage.ValidLabelValueRegex
+	invalidGroupNameMsg  = "Group name must match a given regexp: " + validLabelValueRegex + ", other than . and .."
 )
 
 var (
 	validateLabelName  = regexp.MustCompile(validLabelNameRegex).MatchString
-	validateLabelValue = regexp.MustCompile(validLabelValueRegex).MatchString
+	validateLabelValue = storage.ValidLabelValue
+	validateGroupName  = storage.ValidGroupName
 )
 
 func parseLabels(req LabelsReq) (map[string]*string, error) {
@@ -334,6 +368,8 @@ func validateLabels(labels map[string]*string) error {
 			return fmt.Errorf("label %s name must match a given regexp: %s", k, validLabelNameRegex)
 		case v != nil && !validateLabelValue(*v):
 			return fmt.Errorf("label %s value must match a given regexp: %s", k, validLabelValueRegex)
+		case k == "group" && v != nil && !validateGroupName(*v):
+			return fmt.Errorf("label %s value cannot be %s", k, *v)
 		}
 	}
 	return nil
@@ -0,0 +1,136 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	storage "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+type LiveEvent = storage.LiveEvent
+
+// @Summary Stream live device events
+// @Description Server-sent events for device activity: check-ins, new devices, update events, apps states, and test results.
+// @Description Each SSE event name is an event type, and its data is a LiveEvent JSON.
+// @Description Send a Last-Event-ID header to resume a stream after reconnecting.
+// @Description Each filter accepts a comma separated list of values.
+// @Description Requires scope: devices:read or devices:read-update
+// @Tags    Devices
+// @Produce text/event-stream
+// @Success 200 {object} LiveEvent
+// @Param   uuid query string false "Only stream events of these devices"
+// @Param   group query string false "Only stream events of devices in these groups"
+// @Param   tag query string false "Only stream events of devices on these tags"
+// @Param   type query string false "Only stream events of these types"
+// @Router  /events/stream [get]
+func (h *handlers) eventsStream(c echo.Context) error {
+	filter, err := parseLiveEventFilter(c)
+	if err != nil {
+		return err
+	}
+	req := c.Request()
+	ctx := req.Context()
+	log := CtxGetLog(ctx)
+	var lastId uint64
+	if val := req.Header.Get("Last-Event-ID"); len(val) > 0 {
+		if lastId, err = strconv.ParseUint(val, 10, 64); err != nil {
+			log.Warn("Invalid Last-Event-ID - ignoring", "value", val)
+		}
+	}
+
+	events, cancel := h.storage.SubscribeEvents(lastId, filter)
+	defer cancel()
+
+	r := c.Response()
+	r.Header().Set("Content-Type", "text/event-stream")
+	// Below two headers prevent proxy caching and buffering.
+	r.Header().Set("Cache-Control", "no-cache")
+	r.Header().Set("X-Accel-Buffering", "no")
+	r.WriteHeader(http.StatusOK)
+	r.Flush()
+
+	eventStreamReader := func(yield func(string, error) bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-events:
+				if !ok {
+					// A client did not keep up with events; let it reconnect and resume from its last event.
+					_ = yield("event: error\nretry: 1000\ndata: Event stream fell behind; reconnecting.\n\n", nil)
+					return
+				}
+				data, err := json.Marshal(evt)
+				if err != nil {
+					log.Error("Failed to marshal live event", "error", err)
+					continue
+				}
+				if !yield(fmt.Sprintf("event: %s\nid: %d\ndata: %s\n\n", evt.Type, evt.Id, data), nil) {
+					return
+				}
+			}
+		}
+	}
+
+	sseStreams.Inc("events")
+	defer sseStreams.Dec("events")
+	for line := range keepaliveReader(eventStreamReader) {
+		if _, err := r.Write([]byte(line)); err != nil {
+			// Client disconnected - only log unexpected errors
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Error("Failed to write events to client", "error", err)
+			}
+			break
+		}
+		r.Flush()
+	}
+	return nil
+}
+
+func parseLiveEventFilter(c echo.Context) (func(LiveEvent) bool, error) {
+	params := func(name string) (res []string) {
+		for _, val := range c.QueryParams()[name] {
+			for _, item := range strings.Split(val, ",") {
+				if item = strings.TrimSpace(item); len(item) > 0 {
+					res = append(res, item)
+				}
+			}
+		}
+		return
+	}
+	uuids, groups, tags, types := params("uuid"), params("group"), params("tag"), params("type")
+	for _, group := range groups {
+		if !validateGroupName(group) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, invalidGroupNameMsg)
+		}
+	}
+	for _, tag := range tags {
+		if !validateTag(tag) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Tag must match a given regexp: "+validTagRegex)
+		}
+	}
+	for _, typ := range types {
+		if !slices.Contains(storage.LiveEventTypes, typ) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Unknown event type '%s', must be one of: %s", typ, strings.Join(storage.LiveEventTypes, ", ")))
+		}
+	}
+	matches := func(values []string, value string) bool {
+		return len(values) == 0 || slices.Contains(values, value)
+	}
+	return func(evt LiveEvent) bool {
+		return matches(uuids, evt.Uuid) && matches(groups, evt.Group) && matches(tags, evt.Tag) && matches(types, evt.Type)
+	}, nil
+}
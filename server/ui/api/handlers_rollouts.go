@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"maps"
 	"net"
 	"net/http"
 	"os"
@@ -20,6 +21,7 @@ import (
 	"github.com/labstack/echo/v4"
 
 	storage "github.com/foundriesio/dg-satellite/storage/api"
+	"github.com/foundriesio/dg-satellite/storage/users"
 )
 
 type Rollout = storage.Rollout
@@ -43,6 +45,8 @@ func (h *handlers) updateList(c echo.Context) error {
 		if updates == nil {
 			updates = map[string][]string{}
 		}
+		filter := c.Get("user").(*User).DeviceFilter()
+		maps.DeleteFunc(updates, func(tag string, _ []string) bool { return !filter.AllowsTag(tag) })
 		return c.JSON(http.StatusOK, updates)
 	}
 }
@@ -67,7 +71,7 @@ func (h *handlers) updateTail(c echo.Context) error {
 }
 
 // @Summary List update rollouts
-// @Description Requires scope: updates:read or updates:read-update
+// @Description Requires scope: rollouts:read
 // @Tags    Updates
 // @Produce json
 // @Success 200 {array} string
@@ -92,7 +96,7 @@ func (h *handlers) rolloutList(c echo.Context) error {
 }
 
 // @Summary Get update rollout
-// @Description Requires scope: updates:read or updates:read-update
+// @Description Requires scope: rollouts:read
 // @Tags    Updates
 // @Produce json
 // @Success 200 {object} Rollout
@@ -120,7 +124,8 @@ func (h *handlers) rolloutGet(c echo.Context) error {
 }
 
 // @Summary Create update rollout
-// @Description Requires scope: updates:read-update
+// @Description Rollouts of production updates must be approved, so they also require rollouts:approve.
+// @Description Requires scope: rollouts:create
 // @Tags    Updates
 // @Accept json
 // @Param data body Rollout true "Rollout data"
@@ -144,12 +149,32 @@ func (h *handlers) rolloutPut(c echo.Context) error {
 	if err = c.Bind(&rollout); err != nil {
 		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
 	}
+	if isProd && !c.Get("user").(*User).AllowedScopes.Has(users.ScopeRolloutsApprove) {
+		return c.String(http.StatusForbidden, "User missing required scope(s): "+users.ScopeRolloutsApprove.String())
+	}
 	if len(rollout.Uuids) == 0 && len(rollout.Groups) == 0 {
 		return c.String(http.StatusBadRequest, "Either uuids or groups must be set")
 	}
-	if len(rollout.Effect) > 0 {
+	if len(rollout.Effect) > 0 || len(rollout.EffectByTag) > 0 {
 		return c.String(http.StatusBadRequest, "Effective uuids are readonly")
 	}
+	for _, t := range rollout.Tags {
+		if !validateTag(t) {
+			return c.String(http.StatusBadRequest, "Tags must match a given regexp: "+validTagRegex)
+		}
+	}
+	// A rollout only applies to devices which its author is allowed to access.
+	rollout.Filter = c.Get("user").(*User).DeviceFilter()
+	for _, t := range rollout.Tags {
+		if !rollout.Filter.AllowsTag(t) {
+			return c.String(http.StatusForbidden, "User is not allowed to access tag: "+t)
+		}
+	}
+	for _, g := range rollout.Groups {
+		if !rollout.Filter.AllowsGroup(g) {
+			return c.String(http.StatusForbidden, "User is not allowed to access group: "+g)
+		}
+	}
 
 	// Check if update with this name exists
 	if updates, err := h.storage.ListUpdates(tag, isProd); err != nil {
@@ -157,6 +182,14 @@ func (h *handlers) rolloutPut(c echo.Context) error {
 	} else if tagUpdates, ok := updates[tag]; !ok || !slices.Contains(tagUpdates, updateName) {
 		return c.String(http.StatusNotFound, "Update with this name does not exist")
 	}
+	if len(rollout.Tags) > 0 {
+		if err = h.storage.CheckUpdateTags(tag, updateName, isProd, rollout.Tags); err != nil {
+			if errors.Is(err, storage.ErrInvalidUpdate) {
+				return EchoError(c, err, http.StatusBadRequest, err.Error())
+			}
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to check update targets")
+		}
+	}
 
 	// Check if rollout with this name already exists
 	if _, err = h.storage.GetRollout(tag, updateName, rolloutName, isProd); err != nil {
@@ -180,7 +213,7 @@ func (h *handlers) rolloutPut(c echo.Context) error {
 }
 
 // @Summary Tail rollout logs
-// @Description Requires scope: updates:read or updates:read-update
+// @Description Requires scope: rollouts:read
 // @Tags    Updates
 // @Produce text/plain
 // @Success 200
@@ -308,6 +341,8 @@ func streamUpdateLogs(c echo.Context, reader iter.Seq2[string, error]) error {
 		}
 	}
 
+	sseStreams.Inc("rollout-logs")
+	defer sseStreams.Dec("rollout-logs")
 	// Errors are already handled by the eventStreamReader
 	for line := range keepaliveReader(eventStreamReader) {
 		if _, err := r.Write([]byte(line)); err != nil {
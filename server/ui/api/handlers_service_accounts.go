@@ -0,0 +1,172 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/foundriesio/dg-satellite/storage"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+type ServiceAccountCreateReq struct {
+	Name string `json:"name"`
+	// Owner is a team or an administrator responsible for a service account, a caller by default.
+	Owner  string   `json:"owner"`
+	Scopes []string `json:"scopes"`
+}
+
+type ServiceAccountOwnerReq struct {
+	Owner string `json:"owner"`
+}
+
+type ServiceAccountTokenReq struct {
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes"`
+	// Expires is an RFC 3339 time, e.g. 2030-01-02T15:04:05Z.
+	Expires string `json:"expires"`
+}
+
+// @Summary List service accounts
+// @Description Service accounts are not included in the users list.
+// @Description Requires scope: users:read
+// @Tags    Service Accounts
+// @Produce json
+// @Success 200 {array} User
+// @Router  /service-accounts [get]
+func (h *handlers) serviceAccountList(c echo.Context) error {
+	if list, err := h.users.List(); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to list service accounts")
+	} else {
+		accounts := []User{}
+		for _, u := range list {
+			if u.ServiceAccount {
+				accounts = append(accounts, u)
+			}
+		}
+		return c.JSON(http.StatusOK, accounts)
+	}
+}
+
+// @Summary Create a service account
+// @Description A service account cannot log in, and only holds API tokens for automation.
+// @Description Its tokens are kept when its owner is deleted.
+// @Description Other operations, like listing tokens or deleting it, use the users API.
+// @Description Requires scope: users:create
+// @Tags    Service Accounts
+// @Accept  json
+// @Param   data body ServiceAccountCreateReq true "Service account definition"
+// @Produce json
+// @Success 201 {object} User
+// @Router  /service-accounts [post]
+func (h *handlers) serviceAccountCreate(c echo.Context) error {
+	var req ServiceAccountCreateReq
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if len(req.Name) == 0 {
+		err := errors.New("name is required")
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	} else if len(req.Scopes) == 0 {
+		err := errors.New("at least one scope is required")
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	scopes, err := users.ScopesFromSlice(req.Scopes)
+	if err != nil {
+		return EchoError(c, err, http.StatusBadRequest, fmt.Sprintf("Invalid scope: %s", err))
+	}
+
+	caller := c.Get("user").(*User).Username
+	if len(req.Owner) == 0 {
+		req.Owner = caller
+	}
+	u, err := h.users.CreateServiceAccount(req.Name, req.Owner, scopes, caller)
+	if storage.IsDbError(err, storage.ErrDbConstraintUnique) {
+		err = fmt.Errorf("user %q already exists", req.Name)
+		return EchoError(c, err, http.StatusConflict, err.Error())
+	} else if err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to create service account")
+	}
+	return c.JSON(http.StatusCreated, u)
+}
+
+// @Summary Change an owner of a service account
+// @Description Requires scope: users:read-update
+// @Tags    Service Accounts
+// @Accept  json
+// @Param   data body ServiceAccountOwnerReq true "New owner"
+// @Success 204
+// @Param   name path string true "Service account name"
+// @Router  /service-accounts/{name}/owner [put]
+func (h *handlers) serviceAccountOwnerPut(c echo.Context) error {
+	var req ServiceAccountOwnerReq
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if len(req.Owner) == 0 {
+		err := errors.New("owner is required")
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	return h.handleServiceAccount(c, func(u *User) error {
+		u.Owner = req.Owner
+		if err := u.Update(fmt.Sprintf("Owner changed to %s by %s", req.Owner, c.Get("user").(*User).Username)); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to update service account")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary Create an API token of a service account
+// @Description The token value is only returned once.
+// @Description Requires scope: users:read-update
+// @Tags    Service Accounts
+// @Accept  json
+// @Param   data body ServiceAccountTokenReq true "Token definition"
+// @Produce json
+// @Success 201 {object} Token
+// @Param   name path string true "Service account name"
+// @Router  /service-accounts/{name}/tokens [post]
+func (h *handlers) serviceAccountTokenCreate(c echo.Context) error {
+	var req ServiceAccountTokenReq
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if len(req.Description) == 0 {
+		err := errors.New("token description is required")
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	} else if len(req.Scopes) == 0 {
+		err := errors.New("at least one scope is required")
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	scopes, err := users.ScopesFromSlice(req.Scopes)
+	if err != nil {
+		return EchoError(c, err, http.StatusBadRequest, fmt.Sprintf("Invalid scope: %s", err))
+	}
+	expires, err := time.Parse(time.RFC3339, req.Expires)
+	if err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Invalid expiration, expected an RFC 3339 time")
+	} else if expires.Before(time.Now()) {
+		err := errors.New("expiration must be in the future")
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	return h.handleServiceAccount(c, func(u *User) error {
+		if token, err := u.GenerateToken(req.Description, expires.Unix(), scopes); err != nil {
+			return EchoError(c, err, http.StatusBadRequest, err.Error())
+		} else {
+			return c.JSON(http.StatusCreated, token)
+		}
+	})
+}
+
+func (h *handlers) handleServiceAccount(c echo.Context, next func(*User) error) error {
+	if u, err := h.users.Get(c.Param("name")); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to lookup service account")
+	} else if u == nil || !u.ServiceAccount {
+		return c.NoContent(http.StatusNotFound)
+	} else {
+		return next(u)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	storage "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+type (
+	TagMigration = storage.TagMigration
+	TagReq       = storage.TagReq
+)
+
+// @Summary Move a device to a new tag
+// @Description Sets the [pacman] tags value in the device sota toml override config.
+// @Description Requires scopes: devices:read-update, updates:read-update
+// @Tags    Devices
+// @Accept  json
+// @Param   data body TagReq true "A new device tag"
+// @Success 200
+// @Param   uuid path string true "Device UUID"
+// @Router  /devices/{uuid}/tag [put]
+func (h *handlers) deviceTagPut(c echo.Context) error {
+	return h.handleDevice(c, func(device *Device) error {
+		if tag, err := bindTag(c); err != nil {
+			return err
+		} else if err = h.storage.SetDeviceTag(device.Uuid, tag); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to set device tag")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+}
+
+// @Summary Move a group of devices to a new tag
+// @Description Sets the [pacman] tags value in the group sota toml override config.
+// @Description Requires scopes: devices:read-update, updates:read-update
+// @Tags    Devices
+// @Accept  json
+// @Param   data body TagReq true "A new devices tag"
+// @Produce json
+// @Success 200 {array} string
+// @Param   group path string true "Device group name"
+// @Router  /device-groups/{group}/tag [put]
+func (h *handlers) deviceGroupTagPut(c echo.Context) error {
+	group := c.Param("group")
+	if !validateGroupName(group) {
+		return c.String(http.StatusBadRequest, invalidGroupNameMsg)
+	}
+	if tag, err := bindTag(c); err != nil {
+		return err
+	} else if uuids, err := h.storage.SetGroupTag(group, tag); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to set device group tag")
+	} else {
+		if uuids == nil {
+			uuids = []string{}
+		}
+		return c.JSON(http.StatusOK, uuids)
+	}
+}
+
+// @Summary List devices being moved to a new tag
+// @Description Requires scope: devices:read or devices:read-update
+// @Tags    Devices
+// @Produce json
+// @Success 200 {array} TagMigration
+// @Param   tag query string false "Only show devices moving to this tag"
+// @Router  /tag-migrations [get]
+func (h *handlers) tagMigrationsList(c echo.Context) error {
+	tag := c.QueryParam("tag")
+	if len(tag) > 0 && !validateTag(tag) {
+		return c.String(http.StatusBadRequest, "Tag must match a given regexp: "+validTagRegex)
+	}
+	if migrations, err := h.storage.ListTagMigrations(tag); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to look up tag migrations")
+	} else {
+		if migrations == nil {
+			migrations = []TagMigration{}
+		}
+		return c.JSON(http.StatusOK, migrations)
+	}
+}
+
+func bindTag(c echo.Context) (string, error) {
+	var req TagReq
+	if err := c.Bind(&req); err != nil {
+		return "", EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if !validateTag(req.Tag) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Tag must match a given regexp: "+validTagRegex)
+	} else if !c.Get("user").(*User).DeviceFilter().AllowsTag(req.Tag) {
+		return "", echo.NewHTTPError(http.StatusForbidden, "User is not allowed to access tag: "+req.Tag)
+	}
+	return req.Tag, nil
+}
@@ -6,14 +6,21 @@ package api
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -22,6 +29,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/foundriesio/dg-satellite/auth"
+	"github.com/foundriesio/dg-satellite/clock"
 	"github.com/foundriesio/dg-satellite/context"
 	"github.com/foundriesio/dg-satellite/server"
 	"github.com/foundriesio/dg-satellite/server/ui/daemons"
@@ -56,13 +64,14 @@ func generateUpdateEvents(corId, pack string, num int) []storage.DeviceUpdateEve
 }
 
 type testClient struct {
-	t   *testing.T
-	ctx Context
-	fs  *apiStorage.FsHandle
-	api *apiStorage.Storage
-	gw  *gatewayStorage.Storage
-	u   *users.User
-	e   *echo.Echo
+	t     *testing.T
+	ctx   Context
+	fs    *apiStorage.FsHandle
+	api   *apiStorage.Storage
+	gw    *gatewayStorage.Storage
+	users *users.Storage
+	u     *users.User
+	e     *echo.Echo
 }
 
 func (c testClient) Do(req *http.Request) *httptest.ResponseRecorder {
@@ -165,7 +174,8 @@ func (c testClient) marshalBody(data any) io.Reader {
 }
 
 type testAuthProvider struct {
-	user *users.User
+	user  *users.User
+	users *users.Storage
 }
 
 func (testAuthProvider) Name() string {
@@ -187,6 +197,22 @@ func (p testAuthProvider) GetSession(c echo.Context) (*auth.Session, error) {
 func (testAuthProvider) DropSession(echo.Context, *auth.Session) {
 }
 
+func (p testAuthProvider) CreateUser(username, password string, scopes []string) (*users.User, int, error) {
+	allowed, err := users.ScopesFromSlice(scopes)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	u := &users.User{Username: username, Password: password, AllowedScopes: allowed}
+	if err = p.users.Create(u); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return u, 0, nil
+}
+
+func (p testAuthProvider) ResetTotp(u *users.User, by string) error {
+	return u.Update("Two-factor authentication reset by " + by)
+}
+
 func NewTestClient(t *testing.T) *testClient {
 	ctx := context.Background()
 	tmpDir := t.TempDir()
@@ -198,6 +224,9 @@ func NewTestClient(t *testing.T) *testClient {
 	require.Nil(t, err)
 	gwS, err := gatewayStorage.NewStorage(db, fsS)
 	require.Nil(t, err)
+	require.Nil(t, fsS.Auth.InitHmacSecret())
+	usersS, err := users.NewStorage(db, fsS)
+	require.Nil(t, err)
 
 	log, err := context.InitLogger("debug")
 	require.Nil(t, err)
@@ -209,16 +238,18 @@ func NewTestClient(t *testing.T) *testClient {
 		Username:      "root",
 		AllowedScopes: 0,
 	}
-	RegisterHandlers(e, apiS, &testAuthProvider{user: u})
+	e.Use(AuditTrail(apiS))
+	RegisterHandlers(e, apiS, usersS, &testAuthProvider{user: u, users: usersS})
 
 	tc := testClient{
-		t:   t,
-		ctx: ctx,
-		fs:  fsS,
-		api: apiS,
-		gw:  gwS,
-		u:   u,
-		e:   e,
+		t:     t,
+		ctx:   ctx,
+		fs:    fsS,
+		api:   apiS,
+		gw:    gwS,
+		users: usersS,
+		u:     u,
+		e:     e,
 	}
 	return &tc
 }
@@ -293,8 +324,22 @@ func TestApiDeviceList(t *testing.T) {
 	assert.NotContains(t, linkHeader, `rel="next"`)
 	assert.Contains(t, linkHeader, `rel="last"`)
 
+	// test connectivity state filter
+	data = tc.GET("/devices?state=online", 200)
+	require.Nil(t, json.Unmarshal(data, &devices))
+	require.Len(t, devices, 2)
+	assert.True(t, devices[0].Online)
+	data = tc.GET("/devices?state=offline", 200)
+	require.Nil(t, json.Unmarshal(data, &devices))
+	require.Len(t, devices, 0)
+	_ = tc.GET("/devices?state=asleep", 400)
+	req = httptest.NewRequest(http.MethodGet, "/v1/devices?limit=1&state=online", nil)
+	rec = tc.Do(req)
+	require.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Header().Get("Link"), "state=online")
+
 	// Set device name to override the uuid sort.
-	tc.u.AllowedScopes = users.ScopeDevicesRU
+	tc.u.AllowedScopes = users.ScopeDevicesR | users.ScopeLabelsRU
 	tc.PATCH("/devices/test-device-2/labels", 200,
 		`{"upserts":{"name":"test-device-3"}}`, "content-type", "application/json")
 	// Device with name before device without name.
@@ -383,6 +428,8 @@ func TestApiDeviceLabelsPatch(t *testing.T) {
 	assert.Equal(t, []string{}, groups)
 
 	tc.u.AllowedScopes = users.ScopeDevicesRU
+	tc.PATCH("/devices/test-device-1/labels", 403, data, headers...)
+	tc.u.AllowedScopes = users.ScopeDevicesR | users.ScopeLabelsRU
 	tc.PATCH("/devices/test-device-1/labels", 200, data, headers...)
 
 	var device apiStorage.Device
@@ -417,6 +464,8 @@ func TestApiDeviceLabelsPatch(t *testing.T) {
 	tc.PATCH("/devices/test-device-1/labels", 400, data, headers...)
 	data = `{"upserts":{"foo":"special&value"}}`
 	tc.PATCH("/devices/test-device-1/labels", 400, data, headers...)
+	data = `{"upserts":{"group":".."}}`
+	tc.PATCH("/devices/test-device-1/labels", 400, data, headers...)
 
 	// Duplicates are not allowed for a "name" label, but allowed for other labels.
 	// Note that label names are lowercase only i.e. there can be a label "name" but not "Name".
@@ -452,6 +501,8 @@ func TestApiDeviceLabelsPut(t *testing.T) {
 	tc.u.AllowedScopes = users.ScopeDevicesR
 	tc.PUT("/devices/test-device-1/labels", 403, data, headers...)
 	tc.u.AllowedScopes = users.ScopeDevicesRU
+	tc.PUT("/devices/test-device-1/labels", 403, data, headers...)
+	tc.u.AllowedScopes = users.ScopeDevicesR | users.ScopeLabelsRU
 	tc.PUT("/devices/test-device-1/labels", 200, data, headers...)
 
 	var device apiStorage.Device
@@ -593,6 +644,8 @@ func TestApiRolloutList(t *testing.T) {
 	tc.GET("/updates/ci/tag/update/rollouts", 403)
 	tc.GET("/updates/prod/tag/update/rollouts", 403)
 	tc.u.AllowedScopes = users.ScopeUpdatesR
+	tc.GET("/updates/ci/tag/update/rollouts", 403)
+	tc.u.AllowedScopes = users.ScopeRolloutsR
 
 	tc.GET("/updates/non-prod/tag/update/rollouts", 404)
 
@@ -629,7 +682,7 @@ func TestApiRolloutGet(t *testing.T) {
 	tc := NewTestClient(t)
 	tc.GET("/updates/ci/tag/update/rollouts/rolling", 403)
 	tc.GET("/updates/prod/tag/update/rollouts/stones", 403)
-	tc.u.AllowedScopes = users.ScopeUpdatesR
+	tc.u.AllowedScopes = users.ScopeRolloutsR
 
 	tc.GET("/updates/non-prod/tag/update/rollouts/rocks", 404)
 
@@ -665,6 +718,8 @@ func TestApiRolloutPut(t *testing.T) {
 	tc.PUT("/updates/ci/tag/update/rollouts/rolling", 403, "{}")
 	tc.PUT("/updates/prod/tag/update/rollouts/stones", 403, "{}")
 	tc.u.AllowedScopes = users.ScopeUpdatesRU
+	tc.PUT("/updates/ci/tag/update/rollouts/rolling", 403, "{}")
+	tc.u.AllowedScopes = users.ScopeRolloutsR | users.ScopeRolloutsC | users.ScopeRolloutsApprove
 
 	tc.PUT("/updates/non-prod/tag/update/rollouts/rocks", 404, "{}")
 
@@ -707,6 +762,11 @@ func TestApiRolloutPut(t *testing.T) {
 		`{"uuids":["ci1","ci2"]}`, "content-type", "application/json")
 	tc.PUT("/updates/ci/tag1/update1/rollouts/rocks", 409,
 		`{"uuids":["ci1"]}`, "content-type", "application/json")
+	// Production rollouts must be approved.
+	tc.u.AllowedScopes = users.ScopeRolloutsR | users.ScopeRolloutsC
+	tc.PUT("/updates/prod/tag2/update2/rollouts/rocks", 403,
+		`{"uuids":["prod2"],"groups":["grp1"]}`, "content-type", "application/json")
+	tc.u.AllowedScopes = users.ScopeRolloutsR | users.ScopeRolloutsC | users.ScopeRolloutsApprove
 	tc.PUT("/updates/prod/tag2/update2/rollouts/rocks", 202,
 		`{"uuids":["prod2"],"groups":["grp1"]}`, "content-type", "application/json")
 	tc.PUT("/updates/prod/tag1/update1/rollouts/rocks", 404,
@@ -746,19 +806,59 @@ func TestApiRolloutPut(t *testing.T) {
 	tc.PUT("/updates/prod/tag/update/rollouts/omg+", 404, "foo")
 }
 
+func TestApiRolloutPutMultiTag(t *testing.T) {
+	tc := NewTestClient(t)
+	tc.u.AllowedScopes = users.ScopeRolloutsR | users.ScopeRolloutsC | users.ScopeRolloutsApprove
+
+	targets := `{"signed":{"targets":{
+		"t-1":{"custom":{"tags":["tag2","tag3"]}},
+		"t-2":{"custom":{"tags":["tag4"]}}
+	}}}`
+	require.Nil(t, tc.fs.Updates.Prod.Tuf.WriteFile("tag2", "update2", storage.TufTargetsFile, targets))
+	for uuid, tag := range map[string]string{"prod1": "tag2", "prod2": "tag3", "prod3": "tag4", "prod4": "tag5"} {
+		d, err := tc.gw.DeviceCreate(uuid, "pubkey", true)
+		require.Nil(t, err)
+		require.Nil(t, d.CheckIn("", tag, "", ""))
+	}
+
+	tc.PUT("/updates/prod/tag2/update2/rollouts/rocks", 400,
+		`{"uuids":["prod1"],"tags":["bad^tag"]}`, "content-type", "application/json")
+	tc.PUT("/updates/prod/tag2/update2/rollouts/rocks", 400,
+		`{"uuids":["prod1"],"tags":["tag2","tag5"]}`, "content-type", "application/json")
+	tc.PUT("/updates/prod/tag2/update2/rollouts/rocks", 202,
+		`{"uuids":["prod1","prod2","prod3","prod4"],"tags":["tag2","tag3"]}`, "content-type", "application/json")
+
+	s := func(data []byte) string {
+		return strings.TrimSpace(string(data))
+	}
+	time.Sleep(50 * time.Millisecond) // Allow async database updates to finish
+
+	data := tc.GET("/updates/prod/tag2/update2/rollouts/rocks", 200)
+	assert.Equal(t, `{"uuids":["prod1","prod2","prod3","prod4"],"tags":["tag2","tag3"],`+
+		`"effective-uuids":["prod1","prod2"],"effective-uuids-by-tag":{"tag2":["prod1"],"tag3":["prod2"]},`+
+		`"committed":true}`, s(data))
+
+	for uuid, updateName := range map[string]string{"prod1": "update2", "prod2": "update2", "prod3": "", "prod4": ""} {
+		d, err := tc.gw.DeviceGet(uuid)
+		require.Nil(t, err)
+		assert.Equal(t, updateName, d.UpdateName)
+		if len(updateName) > 0 {
+			assert.Equal(t, "tag2", d.UpdateTag)
+			content, err := d.GetTufMeta(d.Tag, storage.TufTargetsFile)
+			require.Nil(t, err)
+			assert.Equal(t, targets, content)
+		}
+	}
+}
+
 func TestApiRolloutDaemon(t *testing.T) {
 	tc := NewTestClient(t)
 
-	require.Nil(t, tc.fs.Auth.InitHmacSecret())
-	db, err := apiStorage.NewDb(filepath.Join(t.TempDir(), apiStorage.DbFile))
-	require.Nil(t, err)
-	usersS, err := users.NewStorage(db, tc.fs)
-	require.Nil(t, err)
-	daemons := daemons.New(tc.ctx, tc.api, usersS, daemons.WithRolloverInterval(20*time.Millisecond))
+	daemons := daemons.New(tc.ctx, tc.api, tc.users, daemons.WithRolloverInterval(20*time.Millisecond))
 
 	daemons.Start()
 	defer daemons.Shutdown()
-	tc.u.AllowedScopes = users.ScopeUpdatesR
+	tc.u.AllowedScopes = users.ScopeRolloutsR
 
 	require.Nil(t, tc.fs.Updates.Ci.Ostree.WriteFile("tag1", "update1", "foo", "bar"))
 	require.Nil(t, tc.fs.Updates.Prod.Ostree.WriteFile("tag2", "update2", "foo", "bar"))
@@ -817,7 +917,7 @@ func TestApiUpdateTail(t *testing.T) {
 	d, err = tc.gw.DeviceCreate("test-device-3", "pubkey1", true)
 	require.Nil(t, err)
 	require.Nil(t, d.CheckIn("", "tag1", "", ""))
-	_, err = tc.api.SetUpdateName("tag1", "update1", true, []string{"test-device-1", "test-device-2"}, nil)
+	_, err = tc.api.SetUpdateName("tag1", "update1", true, []string{"test-device-1", "test-device-2"}, nil, DeviceFilter{})
 	require.Nil(t, err)
 
 	d1, err := tc.gw.DeviceGet("test-device-1")
@@ -951,8 +1051,376 @@ func TestApiDeviceDelete(t *testing.T) {
 	tc.GET("/devices/del-device", 404)
 }
 
+func TestApiDeviceTagPut(t *testing.T) {
+	tc := NewTestClient(t)
+	tc.PUT("/devices/dev1/tag", 403, `{"tag":"new"}`)
+	tc.PUT("/device-groups/grp1/tag", 403, `{"tag":"new"}`)
+	tc.GET("/tag-migrations", 403)
+	tc.u.AllowedScopes = users.ScopeDevicesRU | users.ScopeUpdatesRU
+
+	for _, uuid := range []string{"dev1", "dev2", "dev3"} {
+		d, err := tc.gw.DeviceCreate(uuid, "pubkey", false)
+		require.Nil(t, err)
+		require.Nil(t, d.CheckIn("", "old", "", ""))
+	}
+	grp1 := "grp1"
+	require.Nil(t, tc.api.PatchDeviceLabels(map[string]*string{"group": &grp1}, []string{"dev2", "dev3"}))
+
+	ct := []string{"content-type", "application/json"}
+	tc.PUT("/devices/no-such-device/tag", 404, `{"tag":"new"}`, ct...)
+	tc.PUT("/devices/dev1/tag", 400, `{"tag":"bad^tag"}`, ct...)
+	tc.PUT("/device-groups/bad^group/tag", 400, `{"tag":"new"}`, ct...)
+	tc.PUT("/device-groups/../tag", 400, `{"tag":"new"}`, ct...)
+
+	// Device config keeps other files and other sota toml values.
+	require.Nil(t, tc.fs.Configs.WriteDeviceConfig("dev1",
+		`{"foo":{"Value":"bar"},"z-50-fioctl.toml":{"Value":"[pacman]\napps = \"app1\"\n"}}`))
+	tc.PUT("/devices/dev1/tag", 200, `{"tag":"new"}`, ct...)
+	cfg, _, err := tc.fs.Configs.ReadDeviceConfig("dev1")
+	require.Nil(t, err)
+	assert.Equal(t,
+		`{"foo":{"Value":"bar"},"z-50-fioctl.toml":{"Value":"[pacman]\napps = \"app1\"\ntags = \"new\"\n"}}`, cfg)
+
+	data := tc.PUT("/device-groups/grp1/tag", 200, `{"tag":"new"}`, ct...)
+	assert.Equal(t, `["dev2","dev3"]`, strings.TrimSpace(string(data)))
+	cfg, _, err = tc.fs.Configs.ReadGroupConfig("grp1")
+	require.Nil(t, err)
+	assert.Equal(t, `{"z-50-fioctl.toml":{"Value":"[pacman]\ntags = \"new\"\n",`+
+		`"OnChanged":["/usr/share/fioconfig/handlers/aktualizr-toml-update"]}}`, cfg)
+
+	getMigrations := func(resource string) (res []TagMigration) {
+		require.Nil(t, json.Unmarshal(tc.GET(resource, 200), &res))
+		return
+	}
+	migrations := getMigrations("/tag-migrations")
+	require.Equal(t, 3, len(migrations))
+	for _, m := range migrations {
+		assert.Equal(t, "old", m.Tag)
+		assert.Equal(t, "new", m.TargetTag)
+		assert.False(t, m.Migrated())
+		assert.Zero(t, m.MigratedAt)
+	}
+	assert.Equal(t, 0, len(getMigrations("/tag-migrations?tag=other")))
+	tc.GET("/tag-migrations?tag=bad^tag", 400)
+
+	// A device reporting a new tag is migrated.
+	d, err := tc.gw.DeviceGet("dev2")
+	require.Nil(t, err)
+	require.Nil(t, d.CheckIn("", "new", "", ""))
+	migrations = getMigrations("/tag-migrations?tag=new")
+	require.Equal(t, 3, len(migrations))
+	assert.Equal(t, "dev2", migrations[1].Uuid)
+	assert.Equal(t, "grp1", migrations[1].GroupName)
+	assert.True(t, migrations[1].Migrated())
+	assert.NotZero(t, migrations[1].MigratedAt)
+	assert.False(t, migrations[0].Migrated())
+	assert.False(t, migrations[2].Migrated())
+}
+
+func TestApiDeviceApps(t *testing.T) {
+	tc := NewTestClient(t)
+	tc.GET("/devices/dev1/apps", 403)
+	tc.PUT("/devices/dev1/apps", 403, `{"apps":[]}`)
+	tc.PUT("/device-groups/grp1/apps", 403, `{"apps":[]}`)
+	tc.u.AllowedScopes = users.ScopeDevicesRU | users.ScopeUpdatesRU
+
+	targets := `{"signed":{"targets":{
+		"t-1":{"custom":{"tags":["tag1"],"docker_compose_apps":{"app1":{"uri":"x"},"app2":{"uri":"y"}}}},
+		"t-2":{"custom":{"tags":["tag2"],"docker_compose_apps":{"app3":{"uri":"z"}}}}
+	}}}`
+	require.Nil(t, tc.fs.Updates.Ci.Tuf.WriteFile("tag1", "update1", storage.TufTargetsFile, targets))
+	for _, uuid := range []string{"dev1", "dev2", "dev3"} {
+		d, err := tc.gw.DeviceCreate(uuid, "pubkey", false)
+		require.Nil(t, err)
+		require.Nil(t, d.CheckIn("", "tag1", "", "app1,app3"))
+	}
+	grp1 := "grp1"
+	require.Nil(t, tc.api.PatchDeviceLabels(map[string]*string{"group": &grp1}, []string{"dev2"}))
+	_, err := tc.api.SetUpdateName("tag1", "update1", false, []string{"dev1", "dev2"}, nil, DeviceFilter{})
+	require.Nil(t, err)
+
+	getApps := func(uuid string) (res DeviceApps) {
+		require.Nil(t, json.Unmarshal(tc.GET("/devices/"+uuid+"/apps", 200), &res))
+		return
+	}
+	ct := []string{"content-type", "application/json"}
+
+	// No compose_apps configured - all apps in the target are enabled.
+	apps := getApps("dev1")
+	assert.False(t, apps.Configured)
+	assert.Equal(t, []string{"app1", "app2"}, apps.Available)
+	assert.Equal(t, []string{"app1", "app2"}, apps.Enabled)
+	assert.Equal(t, []string{"app1", "app3"}, apps.Reported)
+	assert.Equal(t, []string{"app2"}, apps.Missing)
+	assert.Equal(t, []string{"app3"}, apps.Unexpected)
+
+	tc.PUT("/devices/no-such-device/apps", 404, `{"apps":["app1"]}`, ct...)
+	tc.PUT("/devices/dev1/apps", 400, `{}`, ct...)
+	tc.PUT("/devices/dev1/apps", 400, `{"apps":["app3"]}`, ct...)
+	tc.PUT("/devices/dev3/apps", 409, `{"apps":["app1"]}`, ct...)
+	tc.PUT("/devices/dev1/apps", 200, `{"apps":["app1","app1"]}`, ct...)
+	apps = getApps("dev1")
+	assert.True(t, apps.Configured)
+	assert.Equal(t, []string{"app1"}, apps.Enabled)
+	assert.Nil(t, apps.Missing)
+	assert.Equal(t, []string{"app3"}, apps.Unexpected)
+	assert.False(t, apps.InSync())
+
+	tc.PUT("/device-groups/no-such-group/apps", 409, `{"apps":["app1"]}`, ct...)
+	tc.PUT("/device-groups/grp1/apps", 400, `{"apps":["app3"]}`, ct...)
+	tc.PUT("/device-groups/grp1/apps", 200, `{"apps":[]}`, ct...)
+	cfg, _, err := tc.fs.Configs.ReadGroupConfig("grp1")
+	require.Nil(t, err)
+	assert.Contains(t, cfg, `compose_apps = \"\"`)
+	apps = getApps("dev2")
+	assert.True(t, apps.Configured)
+	assert.Nil(t, apps.Enabled)
+	assert.Equal(t, []string{"app1", "app3"}, apps.Unexpected)
+
+	// Device config overrides group config.
+	tc.PUT("/devices/dev2/apps", 200, `{"apps":["app2","app1"]}`, ct...)
+	apps = getApps("dev2")
+	assert.Equal(t, []string{"app1", "app2"}, apps.Enabled)
+	assert.Equal(t, []string{"app2"}, apps.Missing)
+}
+
+func TestApiDeviceConfigGet(t *testing.T) {
+	tc := NewTestClient(t)
+	tc.GET("/devices/dev1/config", 403)
+	tc.u.AllowedScopes = users.ScopeDevicesR
+	tc.GET("/devices/dev1/config", 403)
+	tc.u.AllowedScopes = users.ScopeConfigsR
+
+	d, err := tc.gw.DeviceCreate("dev1", "pubkey", false)
+	require.Nil(t, err)
+	grp1 := "grp1"
+	require.Nil(t, tc.api.PatchDeviceLabels(map[string]*string{"group": &grp1}, []string{"dev1"}))
+	sota := func(value string) string {
+		return fmt.Sprintf(`"%s":{"Value":%q}`, storage.SotaOverrideFile, value)
+	}
+	require.Nil(t, tc.fs.Configs.WriteFactoryConfig(`{"a":{"Value":"1"},"b":{"Value":"2"},`+
+		sota("[pacman]\ntags = \"main\"\n")+`}`))
+	require.Nil(t, tc.fs.Configs.WriteGroupConfig("grp1", `{"b":{"Value":"group"},`+
+		sota("[pacman]\ncompose_apps = \"app1\"\n")+`}`))
+	require.Nil(t, tc.fs.Configs.WriteDeviceConfig("dev1", `{"c":{"Value":"3","OnChanged":["/bin/true"]}}`))
+
+	getConfig := func() (res EffectiveConfig) {
+		require.Nil(t, json.Unmarshal(tc.GET("/devices/dev1/config", 200), &res))
+		return
+	}
+	tc.GET("/devices/no-such-device/config", 404)
+
+	cfg := getConfig()
+	assert.NotZero(t, cfg.Timestamp)
+	assert.Equal(t, []string{"a", "b", "c", storage.SotaOverrideFile}, slices.Sorted(maps.Keys(cfg.Files)))
+	assert.Equal(t, []string{"factory"}, cfg.Files["a"].Layers)
+	assert.Equal(t, "group", cfg.Files["b"].Value)
+	assert.Equal(t, []string{"factory", "group"}, cfg.Files["b"].Layers)
+	assert.Equal(t, []string{"device"}, cfg.Files["c"].Layers)
+	assert.Equal(t, []string{"/bin/true"}, cfg.Files["c"].OnChanged)
+	sotaCfg := cfg.Files[storage.SotaOverrideFile]
+	assert.Equal(t, []string{"factory", "group"}, sotaCfg.Layers)
+	assert.Contains(t, sotaCfg.Value, `tags = "main"`)
+	assert.Contains(t, sotaCfg.Value, `compose_apps = "app1"`)
+	// Never fetched - all files are pending.
+	assert.Nil(t, cfg.Fetched)
+	assert.True(t, cfg.Pending())
+	assert.Len(t, cfg.Changes, 4)
+
+	// Simulate a config fetch the same way as the device gateway does it.
+	fetch := func() {
+		d, err = tc.gw.DeviceGet("dev1")
+		require.Nil(t, err)
+		configs, ts, err := d.GetConfigs()
+		require.Nil(t, err)
+		files, _, err := gatewayStorage.MergeConfigs(configs, d.ConfigTemplateData())
+		require.Nil(t, err)
+		require.Nil(t, d.SaveConfigFetched(ts, files))
+	}
+	fetch()
+	cfg = getConfig()
+	require.NotNil(t, cfg.Fetched)
+	assert.Equal(t, cfg.Timestamp, cfg.Fetched.Timestamp)
+	assert.False(t, cfg.Pending())
+	assert.Empty(t, cfg.Changes)
+
+	require.Nil(t, tc.fs.Configs.WriteDeviceConfig("dev1", `{"c":{"Value":"3"},"d":{"Value":"4"}}`))
+	require.Nil(t, tc.fs.Configs.WriteGroupConfig("grp1", `{"b":{"Value":"group"}}`))
+	cfg = getConfig()
+	assert.Equal(t, []ConfigFileChange{
+		{Name: "c", Change: "modified"},
+		{Name: "d", Change: "added"},
+		{Name: storage.SotaOverrideFile, Change: "modified"},
+	}, cfg.Changes)
+
+	fetch()
+	assert.False(t, getConfig().Pending())
+	grp2 := "grp2"
+	require.Nil(t, tc.api.PatchDeviceLabels(map[string]*string{"group": &grp2}, []string{"dev1"}))
+	assert.Equal(t, []ConfigFileChange{{Name: "b", Change: "modified"}}, getConfig().Changes)
+}
+
+func TestApiConfigStatus(t *testing.T) {
+	tc := NewTestClient(t)
+	now := time.Now().Truncate(time.Second)
+	clock.Now = func() time.Time { return now }
+	defer func() { clock.Now = time.Now }()
+
+	tc.GET("/config-status", 403)
+	tc.u.AllowedScopes = users.ScopeDevicesR
+	tc.GET("/config-status", 403)
+	tc.u.AllowedScopes = users.ScopeDevicesR | users.ScopeConfigsR
+
+	getStatus := func(query string) (res ConfigPropagation) {
+		require.Nil(t, json.Unmarshal(tc.GET("/config-status"+query, 200), &res))
+		return
+	}
+	assert.Equal(t, ConfigPropagation{Devices: []apiStorage.DeviceConfigStatus{}}, getStatus(""))
+	tc.GET("/config-status?group=bad%20group", 400)
+
+	grp := "grp"
+	for _, uuid := range []string{"dev1", "dev2", "dev3"} {
+		_, err := tc.gw.DeviceCreate(uuid, "pubkey", false)
+		require.Nil(t, err)
+	}
+	report := getStatus("")
+	assert.Equal(t, 0, report.Applied+report.Pending)
+	for _, d := range report.Devices {
+		assert.Equal(t, "none", d.Status, d.Uuid)
+	}
+	// A group change also changes a device config.
+	require.Nil(t, tc.api.PatchDeviceLabels(map[string]*string{"group": &grp}, []string{"dev1", "dev2"}))
+	assert.Equal(t, 2, getStatus("").Pending)
+
+	// Simulate a config fetch the same way as the device gateway does it.
+	fetch := func(uuid string) {
+		d, err := tc.gw.DeviceGet(uuid)
+		require.Nil(t, err)
+		configs, ts, err := d.GetConfigs()
+		require.Nil(t, err)
+		files, _, err := gatewayStorage.MergeConfigs(configs, d.ConfigTemplateData())
+		require.Nil(t, err)
+		require.Nil(t, d.SaveConfigFetched(ts, files))
+	}
+
+	now = now.Add(time.Minute)
+	require.Nil(t, tc.fs.Configs.WriteGroupConfig(grp, `{"a":{"Value":"1"}}`))
+	fetch("dev1")
+	report = getStatus("?group=grp")
+	assert.Equal(t, 1, report.Applied)
+	assert.Equal(t, 1, report.Pending)
+	require.Len(t, report.Devices, 2)
+	assert.Equal(t, "dev1", report.Devices[0].Uuid)
+	assert.Equal(t, "applied", report.Devices[0].Status)
+	assert.Equal(t, now.Unix(), report.Devices[0].Timestamp)
+	assert.Equal(t, now.Unix(), report.Devices[0].Fetch.Timestamp)
+	assert.Len(t, report.Devices[0].Fetch.Hash, 64)
+	assert.Equal(t, "pending", report.Devices[1].Status)
+	assert.Zero(t, report.Devices[1].Fetch.FetchedAt)
+
+	var device Device
+	require.Nil(t, json.Unmarshal(tc.GET("/devices/dev1", 200), &device))
+	assert.Equal(t, report.Devices[0].Fetch, device.ConfigFetch)
+	var cfg EffectiveConfig
+	require.Nil(t, json.Unmarshal(tc.GET("/devices/dev1/config", 200), &cfg))
+	assert.Equal(t, "applied", cfg.Status)
+
+	// A group config change makes all group devices pending, until they fetch it.
+	now = now.Add(time.Minute)
+	require.Nil(t, tc.fs.Configs.WriteGroupConfig(grp, `{"a":{"Value":"2"}}`))
+	report = getStatus("?group=grp")
+	assert.Equal(t, 0, report.Applied)
+	assert.Equal(t, 2, report.Pending)
+	fetch("dev2")
+	report = getStatus("")
+	assert.Equal(t, 1, report.Applied)
+	assert.Equal(t, 1, report.Pending)
+	require.Len(t, report.Devices, 3)
+	assert.Equal(t, "pending", report.Devices[0].Status)
+	assert.Equal(t, "applied", report.Devices[1].Status)
+	assert.Equal(t, "none", report.Devices[2].Status)
+}
+
+func TestApiConfigs(t *testing.T) {
+	tc := NewTestClient(t)
+	tc.GET("/configs/factory", 403)
+	tc.PUT("/configs/factory", 403, `{}`)
+	tc.u.AllowedScopes = users.ScopeConfigsR
+	tc.PUT("/configs/factory", 403, `{}`)
+	tc.u.AllowedScopes = users.ScopeDevicesRU | users.ScopeUpdatesRU
+	tc.PUT("/configs/factory", 403, `{}`)
+	tc.u.AllowedScopes = users.ScopeConfigsRU
+
+	_, err := tc.gw.DeviceCreate("dev1", "pubkey", false)
+	require.Nil(t, err)
+	ct := []string{"content-type", "application/json"}
+
+	getConfig := func(resource string) (res ConfigVersion) {
+		require.Nil(t, json.Unmarshal(tc.GET(resource, 200), &res))
+		return
+	}
+	getHistory := func(resource string) (res []ConfigVersion) {
+		require.Nil(t, json.Unmarshal(tc.GET(resource, 200), &res))
+		return
+	}
+
+	tc.GET("/configs/device/no-such-device", 404)
+	tc.GET("/configs/group/bad%20group", 400)
+	// Group names must not escape a group config directory.
+	tc.GET("/configs/group/..", 400)
+	tc.GET("/configs/group/%2E%2E", 400)
+	tc.GET("/configs/group/./history", 400)
+	cfg := getConfig("/configs/device/dev1")
+	assert.Empty(t, cfg.Hash)
+	assert.Empty(t, cfg.Files)
+	assert.Empty(t, getHistory("/configs/device/dev1/history"))
+
+	for _, prefix := range []string{"/configs/factory", "/configs/group/grp1", "/configs/device/dev1"} {
+		tc.PUT(prefix, 400, `{"../x":{"Value":"x"}}`, ct...)
+		tc.PUT(prefix, 200, `{"a":{"Value":"1"},"b":{"Value":"2","Unencrypted":true}}`, ct...)
+		tc.PUT(prefix+"/files/c", 200, `{"Value":"3","OnChanged":["/bin/true"]}`, ct...)
+		tc.PUT(prefix+"/files/.hidden", 404, `{"Value":"3"}`, ct...)
+		tc.PUT(prefix+"/files/t", 400, `{"Value":"{{ .Labels.site ","Template":true}`, ct...)
+		tc.PUT(prefix, 400, `{"t":{"Value":"{{ .Hostname }}","Template":true}}`, ct...)
+		tc.DELETE(prefix+"/files/a", 200)
+		tc.DELETE(prefix+"/files/a", 404)
+
+		cfg = getConfig(prefix)
+		assert.NotEmpty(t, cfg.Hash)
+		assert.Equal(t, []string{"b", "c"}, slices.Sorted(maps.Keys(cfg.Files)))
+		assert.True(t, *cfg.Files["b"].Unencrypted)
+		assert.Equal(t, []string{"/bin/true"}, cfg.Files["c"].OnChanged)
+
+		history := getHistory(prefix + "/history")
+		require.Len(t, history, 3)
+		assert.Equal(t, cfg, history[0])
+		assert.Len(t, getHistory(prefix+"/history?limit=1"), 1)
+		tc.GET(prefix+"/history?limit=0", 400)
+
+		tc.POST(prefix+"/rollback", 400, strings.NewReader(`{}`), ct...)
+		tc.POST(prefix+"/rollback", 404, strings.NewReader(`{"hash":"deadbeef"}`), ct...)
+		tc.POST(prefix+"/rollback", 200, strings.NewReader(`{"hash":"`+history[2].Hash+`"}`), ct...)
+		cfg = getConfig(prefix)
+		assert.Equal(t, history[2].Files, cfg.Files)
+		assert.Equal(t, []string{"a", "b"}, slices.Sorted(maps.Keys(cfg.Files)))
+
+		tc.DELETE(prefix+"/history?keep=1", 200)
+		history = getHistory(prefix + "/history")
+		require.Len(t, history, 1)
+		tc.POST(prefix+"/rollback", 404, strings.NewReader(`{"hash":"`+history[0].Hash+`x"}`), ct...)
+	}
+
+	// Scoped edits do not clobber files managed by other APIs.
+	tc.u.AllowedScopes = users.ScopeConfigsR | users.ScopeDevicesRU | users.ScopeUpdatesRU
+	tc.PUT("/devices/dev1/tag", 200, `{"tag":"tag2"}`, ct...)
+	cfg = getConfig("/configs/device/dev1")
+	assert.Equal(t, []string{"a", "b", storage.SotaOverrideFile}, slices.Sorted(maps.Keys(cfg.Files)))
+}
+
 func TestApiUploadConfigs(t *testing.T) {
 	tc := NewTestClient(t)
+	_, err := tc.gw.DeviceCreate("uuid", "pubkey", false)
+	require.Nil(t, err)
 
 	// Extensive testing of the upload logic is a part of the storage/api tests.
 	// Here we only need to test the Web part: handlers/transport/auth.
@@ -983,12 +1451,18 @@ func TestApiUploadConfigs(t *testing.T) {
 	})
 
 	tc.u.AllowedScopes = users.ScopeDevicesRU | users.ScopeUpdatesRU
-	t.Run("Success on devices and updates read-write and tar transport", func(t *testing.T) {
+	t.Run("Failure on devices and updates read-write", func(t *testing.T) {
+		r := tarBuffer(t, validTarFiles)
+		tc.PUT("/configs", 403, r, "Content-Type", "application/x-tar")
+	})
+
+	tc.u.AllowedScopes = users.ScopeConfigsRU
+	t.Run("Success on configs read-write and tar transport", func(t *testing.T) {
 		r := tarBuffer(t, validTarFiles)
 		tc.PUT("/configs", 200, r, "Content-Type", "application/x-tar")
 	})
 
-	t.Run("Success on devices and updates read-write and tar.gz transport", func(t *testing.T) {
+	t.Run("Success on configs read-write and tar.gz transport", func(t *testing.T) {
 		r := gzipBuffer(t, tarBuffer(t, validTarFiles))
 		tc.PUT("/configs", 200, r, "Content-Type", "application/x-tar", "Content-Encoding", "gzip")
 	})
@@ -997,6 +1471,47 @@ func TestApiUploadConfigs(t *testing.T) {
 		r := gzipBuffer(t, tarBuffer(t, validTarFiles))
 		tc.PUT("/configs", 200, r, "Content-Type", "application/gzip")
 	})
+
+	t.Run("Failure on invalid configs", func(t *testing.T) {
+		for name, files := range map[string]map[string]string{
+			"bad json":       {"factory/.journal": "a:1\n", "factory/a": `{"test":"not a config file"}`},
+			"bad sota toml":  {"factory/.journal": "a:1\n", "factory/a": `{"z-50-fioctl.toml":{"Value":"[pacman"}}`},
+			"bad group name": {"group/bad name/.journal": ""},
+			"unknown device": {"device/unknown/.journal": ""},
+			"missing config": {"factory/.journal": "a:1\n"},
+			"unexpected dir": {"other/.journal": ""},
+		} {
+			t.Run(name, func(t *testing.T) {
+				tc.PUT("/configs", 400, tarBuffer(t, files), "Content-Type", "application/x-tar")
+				tc.PUT("/configs?dry-run=true", 400, tarBuffer(t, files), "Content-Type", "application/x-tar")
+			})
+		}
+		tc.PUT("/configs?dry-run=maybe", 400, tarBuffer(t, validTarFiles), "Content-Type", "application/x-tar")
+	})
+
+	t.Run("Success on dry run", func(t *testing.T) {
+		r := tarBuffer(t, map[string]string{
+			"factory/.journal":     "deadbeef:123456\n",
+			"factory/deadbeef":     `{"test":{"Value":"test factory config"},"new":{"Value":"new"}}`,
+			"device/uuid/.journal": "cafe:2003\n",
+			"device/uuid/cafe":     `{"device":{"Value":"device config"}}`,
+		})
+		var diff []ConfigScopeDiff
+		require.Nil(t, json.Unmarshal(tc.PUT("/configs?dry-run=true", 200, r, "Content-Type", "application/x-tar"), &diff))
+		assert.Equal(t, []ConfigScopeDiff{
+			{Scope: "device/uuid", Changes: []ConfigFileChange{{Name: "device", Change: "added"}}},
+			{Scope: "factory", Changes: []ConfigFileChange{
+				{Name: "new", Change: "added"},
+				{Name: "test", Change: "modified"},
+			}},
+			{Scope: "group/beta", Changes: []ConfigFileChange{{Name: "samurai", Change: "removed"}}},
+		}, diff)
+
+		// Nothing is saved on a dry run.
+		var cfg ConfigVersion
+		require.Nil(t, json.Unmarshal(tc.GET("/configs/factory", 200), &cfg))
+		assert.Equal(t, "test factory config latest version", cfg.Files["test"].Value)
+	})
 }
 
 func TestApiUpdateCreate(t *testing.T) {
@@ -1124,3 +1639,634 @@ func gzipBuffer(t *testing.T, data *bytes.Buffer) *bytes.Buffer {
 	require.NoError(t, err)
 	return &buf
 }
+
+func TestApiWebhooks(t *testing.T) {
+	tc := NewTestClient(t)
+	ct := []string{"content-type", "application/json"}
+
+	type received struct {
+		path, event, delivery, signature string
+		body                             []byte
+	}
+	var (
+		lock      sync.Mutex
+		requests  []received
+		failFirst = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, received{
+			path:      r.URL.Path,
+			event:     r.Header.Get("X-Satellite-Event"),
+			delivery:  r.Header.Get("X-Satellite-Delivery"),
+			signature: r.Header.Get("X-Satellite-Signature"),
+			body:      body,
+		})
+		if r.URL.Path == "/flaky" && failFirst {
+			failFirst = false
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	receivedAt := func(path string) (res []received) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, r := range requests {
+			if r.path == path {
+				res = append(res, r)
+			}
+		}
+		return
+	}
+
+	tc.GET("/webhooks", 403)
+	tc.u.AllowedScopes = users.ScopeDevicesR | users.ScopeUpdatesR
+	assert.Equal(t, "[]", strings.TrimSpace(string(tc.GET("/webhooks", 200))))
+	tc.POST("/webhooks", 403, strings.NewReader(`{"url":"http://localhost"}`), ct...)
+
+	tc.u.AllowedScopes = users.ScopeDevicesRU | users.ScopeUpdatesRU
+	data := tc.POST("/webhooks", 400, strings.NewReader(`{"url":"ftp://localhost"}`), ct...)
+	assert.Contains(t, string(data), "url must be an absolute http or https URL")
+	data = tc.POST("/webhooks", 400, strings.NewReader(`{"url":"http://localhost","events":["bogus"]}`), ct...)
+	assert.Contains(t, string(data), "unknown event 'bogus'")
+
+	var hook1, hook2 apiStorage.Webhook
+	data = tc.POST("/webhooks", 201, strings.NewReader(fmt.Sprintf(
+		`{"url":"%s/ok","events":["device-created","installation-failed","apps-unhealthy"],"description":"alerts"}`,
+		srv.URL)), ct...)
+	require.Nil(t, json.Unmarshal(data, &hook1))
+	assert.NotEmpty(t, hook1.Secret)
+	data = tc.POST("/webhooks", 201, strings.NewReader(fmt.Sprintf(`{"url":"%s/flaky"}`, srv.URL)), ct...)
+	require.Nil(t, json.Unmarshal(data, &hook2))
+	assert.NotEqual(t, hook1.Id, hook2.Id)
+
+	// A secret is never returned after creation.
+	var hooks []apiStorage.Webhook
+	require.Nil(t, json.Unmarshal(tc.GET("/webhooks", 200), &hooks))
+	require.Equal(t, 2, len(hooks))
+	assert.Equal(t, "alerts", hooks[0].Description)
+	assert.Equal(t, []string{"device-created", "installation-failed", "apps-unhealthy"}, hooks[0].Events)
+	assert.Empty(t, hooks[0].Secret)
+	assert.Empty(t, hooks[1].Secret)
+	assert.Equal(t, []string{}, hooks[1].Events)
+
+	// Events emitted while the daemon is not running are delivered once it starts.
+	_, err := tc.gw.DeviceCreate("wh-dev", "pubkey", false)
+	require.Nil(t, err)
+
+	daemons := daemons.New(tc.ctx, tc.api, tc.users,
+		daemons.WithWebhooksInterval(10*time.Millisecond), daemons.WithWebhooksRetryDelay(time.Millisecond))
+	daemons.Start()
+	defer daemons.Shutdown()
+
+	d, err := tc.gw.DeviceGet("wh-dev")
+	require.Nil(t, err)
+	failed := false
+	events := generateUpdateEvents("wh-corr", "", 1)
+	events[0].EventType.Id = "EcuInstallationCompleted"
+	events[0].Event.Success = &failed
+	require.Nil(t, d.ProcessEvents(events))
+	unhealthy := `{"deviceTime":"2023-12-12T12:00:00Z","apps":{"app1":{"state":"unhealthy","services":[]}}}`
+	require.Nil(t, d.SaveAppsStates(unhealthy))
+	// Apps which stay unhealthy are only reported once.
+	require.Nil(t, d.SaveAppsStates(unhealthy))
+	dev, err := tc.api.DeviceGet("wh-dev")
+	require.Nil(t, err)
+	require.Nil(t, dev.Delete())
+
+	require.Eventually(t, func() bool {
+		return len(receivedAt("/ok")) == 3 && len(receivedAt("/flaky")) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ok := receivedAt("/ok")
+	assert.Equal(t, "device-created", ok[0].event)
+	assert.Equal(t, "installation-failed", ok[1].event)
+	assert.Equal(t, "apps-unhealthy", ok[2].event)
+	mac := hmac.New(sha256.New, []byte(hook1.Secret))
+	mac.Write(ok[0].body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), ok[0].signature)
+	var evt apiStorage.WebhookEvent
+	require.Nil(t, json.Unmarshal(ok[2].body, &evt))
+	assert.Equal(t, fmt.Sprintf("%d-%s", hook1.Id, evt.Id), ok[2].delivery)
+	assert.JSONEq(t, `{"uuid":"wh-dev","apps":["app1"]}`, string(evt.Data))
+
+	flaky := receivedAt("/flaky")
+	// The first delivery failed and was retried with the same delivery ID.
+	assert.Equal(t, "device-created", flaky[0].event)
+	retries := slices.DeleteFunc(slices.Clone(flaky), func(r received) bool {
+		return r.delivery != flaky[0].delivery
+	})
+	assert.Equal(t, 2, len(retries))
+
+	var attempts []apiStorage.WebhookAttempt
+	require.Nil(t, json.Unmarshal(tc.GET(fmt.Sprintf("/webhooks/%d/deliveries", hook2.Id), 200), &attempts))
+	require.Equal(t, 5, len(attempts))
+	assert.Equal(t, apiStorage.WebhookAttempt{
+		DeliveryId: flaky[0].delivery,
+		Event:      "device-created",
+		Attempt:    1,
+		Timestamp:  attempts[4].Timestamp,
+		StatusCode: 500,
+	}, attempts[4])
+	for _, a := range attempts[:4] {
+		assert.True(t, a.Success)
+		assert.True(t, a.Final)
+		if a.DeliveryId == flaky[0].delivery {
+			assert.Equal(t, 2, a.Attempt)
+		} else {
+			assert.Equal(t, 1, a.Attempt)
+		}
+	}
+	require.Nil(t, json.Unmarshal(tc.GET(fmt.Sprintf("/webhooks/%d/deliveries?limit=1", hook2.Id), 200), &attempts))
+	assert.Equal(t, 1, len(attempts))
+	tc.GET(fmt.Sprintf("/webhooks/%d/deliveries?limit=0", hook2.Id), 400)
+
+	// Update and delete
+	path := fmt.Sprintf("/webhooks/%d", hook1.Id)
+	tc.PUT(path, 400, `{"url":"not a url"}`, ct...)
+	data = tc.PUT(path, 200, fmt.Sprintf(`{"url":"%s/ok","events":["update-uploaded"]}`, srv.URL), ct...)
+	var updated apiStorage.Webhook
+	require.Nil(t, json.Unmarshal(data, &updated))
+	assert.Equal(t, []string{"update-uploaded"}, updated.Events)
+	assert.Empty(t, updated.Secret)
+	tc.DELETE(path, 204)
+	tc.GET(path, 404)
+	tc.GET(path+"/deliveries", 404)
+	tc.GET("/webhooks/not-a-number", 404)
+	require.Nil(t, json.Unmarshal(tc.GET("/webhooks", 200), &hooks))
+	require.Equal(t, 1, len(hooks))
+	assert.Equal(t, hook2.Id, hooks[0].Id)
+}
+
+func TestApiEventsStream(t *testing.T) {
+	tc := NewTestClient(t)
+	tc.GET("/events/stream", 403)
+	tc.u.AllowedScopes = users.ScopeDevicesR
+	tc.GET("/events/stream?type=bogus", 400)
+	tc.GET("/events/stream?group=bad/group", 400)
+
+	type sse struct {
+		name string
+		evt  LiveEvent
+	}
+	parse := func(body string) (res []sse) {
+		for _, chunk := range strings.Split(body, "\n\n") {
+			var e sse
+			for _, line := range strings.Split(chunk, "\n") {
+				if name, ok := strings.CutPrefix(line, "event: "); ok {
+					e.name = name
+				} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+					require.Nil(t, json.Unmarshal([]byte(data), &e.evt))
+				}
+			}
+			if len(e.name) > 0 {
+				res = append(res, e)
+			}
+		}
+		return
+	}
+
+	// Emulate a real HTTP client holding connection.
+	ctx, cancel := context.WithCancel(tc.ctx)
+	tc.ctx = ctx
+
+	done1 := make(chan bool)
+	rec1 := tc.DoAsync(httptest.NewRequest(http.MethodGet, "/v1/events/stream", nil), done1)
+	done2 := make(chan bool)
+	rec2 := tc.DoAsync(httptest.NewRequest(http.MethodGet,
+		"/v1/events/stream?uuid=dev-1&type=update-event,apps-states", nil), done2)
+	time.Sleep(10 * time.Millisecond)
+
+	d1, err := tc.gw.DeviceCreate("dev-1", "pubkey1", false)
+	require.Nil(t, err)
+	require.Nil(t, d1.CheckIn("target-1", "tag1", "hash1", ""))
+	d2, err := tc.gw.DeviceCreate("dev-2", "pubkey2", false)
+	require.Nil(t, err)
+	require.Nil(t, d1.ProcessEvents(generateUpdateEvents("corr-1", "first", 1)))
+	states := `{"deviceTime":"2023-12-12T12:00:00Z","apps":{}}`
+	require.Nil(t, d2.SaveAppsStates(states))
+	require.Nil(t, d1.SaveAppsStates(states))
+	time.Sleep(10 * time.Millisecond)
+
+	all := parse(rec1.Body.String())
+	require.Equal(t, 200, rec1.Code)
+	require.Equal(t, 6, len(all))
+	for i, expected := range [][2]string{
+		{"device-created", "dev-1"},
+		{"check-in", "dev-1"},
+		{"device-created", "dev-2"},
+		{"update-event", "dev-1"},
+		{"apps-states", "dev-2"},
+		{"apps-states", "dev-1"},
+	} {
+		assert.Equal(t, expected[0], all[i].name)
+		assert.Equal(t, expected[0], all[i].evt.Type)
+		assert.Equal(t, expected[1], all[i].evt.Uuid)
+		if i > 0 {
+			assert.Greater(t, all[i].evt.Id, all[i-1].evt.Id)
+		}
+	}
+	assert.Equal(t, "tag1", all[3].evt.Tag)
+	assert.Equal(t, map[string]any{"target-name": "target-1", "ostree-hash": "hash1", "apps": ""}, all[1].evt.Data)
+
+	filtered := parse(rec2.Body.String())
+	require.Equal(t, 2, len(filtered))
+	assert.Equal(t, all[3].evt.Id, filtered[0].evt.Id)
+	assert.Equal(t, all[5].evt.Id, filtered[1].evt.Id)
+
+	// Resume a filtered stream after its first event.
+	done3 := make(chan bool)
+	req3 := httptest.NewRequest(http.MethodGet, "/v1/events/stream?uuid=dev-1&type=update-event&type=apps-states", nil)
+	req3.Header.Add("Last-Event-ID", strconv.FormatUint(filtered[0].evt.Id, 10))
+	rec3 := tc.DoAsync(req3, done3)
+	// Filter by tag
+	done4 := make(chan bool)
+	rec4 := tc.DoAsync(httptest.NewRequest(http.MethodGet, "/v1/events/stream?tag=tag1", nil), done4)
+	time.Sleep(10 * time.Millisecond)
+	resumed := parse(rec3.Body.String())
+	require.Equal(t, 1, len(resumed))
+	assert.Equal(t, all[5].evt.Id, resumed[0].evt.Id)
+
+	// New events are streamed within the same connections.
+	require.Nil(t, d1.CheckIn("target-2", "tag1", "hash2", ""))
+	time.Sleep(10 * time.Millisecond)
+	all = parse(rec1.Body.String())
+	require.Equal(t, 7, len(all))
+	assert.Equal(t, "check-in", all[6].name)
+	assert.Equal(t, 2, len(parse(rec2.Body.String())))
+	byTag := parse(rec4.Body.String())
+	require.Equal(t, 1, len(byTag))
+	assert.Equal(t, all[6].evt.Id, byTag[0].evt.Id)
+	tc.assertNotDone(done1)
+	tc.assertNotDone(done2)
+	tc.assertNotDone(done3)
+	tc.assertNotDone(done4)
+
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	tc.assertDone(done1)
+	tc.assertDone(done2)
+	tc.assertDone(done3)
+	tc.assertDone(done4)
+}
+
+func TestApiAudit(t *testing.T) {
+	tc := NewTestClient(t)
+	_, err := tc.gw.DeviceCreate("test-device-1", "pubkey1", true)
+	require.Nil(t, err)
+	_, err = tc.gw.DeviceCreate("test-device-2", "pubkey2", true)
+	require.Nil(t, err)
+
+	tc.GET("/audit", 403)
+	tc.GET("/audit/export", 403)
+
+	headers := []string{"content-type", "application/json"}
+	data := `{"upserts":{"name":"test"}}`
+	tc.PATCH("/devices/test-device-1/labels", 403, data, headers...)
+	tc.u.AllowedScopes = users.ScopeDevicesRU | users.ScopeDevicesD | users.ScopeLabelsRU | users.ScopeAuditR
+	tc.PATCH("/devices/test-device-1/labels", 200, data, headers...)
+	tc.DELETE("/devices/test-device-2", 204)
+	tc.DELETE("/devices/test-device-2", 404)
+	tc.DELETE("/no-such-route", 404)
+	tc.GET("/devices", 200)
+
+	var entries []AuditEntry
+	require.Nil(t, json.Unmarshal(tc.GET("/audit", 200), &entries))
+	require.Equal(t, 4, len(entries))
+	assert.Equal(t, "DELETE", entries[0].Method)
+	assert.Equal(t, 404, entries[0].Status)
+	assert.False(t, entries[0].Success)
+	assert.Equal(t, "/v1/devices/:uuid", entries[0].Route)
+	assert.Equal(t, "/v1/devices/test-device-2", entries[0].Resource)
+	assert.Equal(t, 204, entries[1].Status)
+	assert.True(t, entries[1].Success)
+	assert.Equal(t, "PATCH", entries[2].Method)
+	assert.Equal(t, "/v1/devices/test-device-1/labels", entries[2].Resource)
+	assert.True(t, entries[2].Success)
+	assert.Equal(t, 403, entries[3].Status)
+	for _, e := range entries {
+		assert.Equal(t, "root", e.Actor)
+		assert.NotEmpty(t, e.RemoteIp)
+	}
+
+	require.Nil(t, json.Unmarshal(tc.GET("/audit?limit=1", 200), &entries))
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, 404, entries[0].Status)
+	require.Nil(t, json.Unmarshal(tc.GET("/audit?outcome=failure", 200), &entries))
+	require.Equal(t, 2, len(entries))
+	require.Nil(t, json.Unmarshal(tc.GET("/audit?method=patch", 200), &entries))
+	require.Equal(t, 2, len(entries))
+	require.Nil(t, json.Unmarshal(tc.GET("/audit?resource=/v1/devices/test-device-2", 200), &entries))
+	require.Equal(t, 2, len(entries))
+	require.Nil(t, json.Unmarshal(tc.GET("/audit?actor=nobody", 200), &entries))
+	require.Equal(t, 0, len(entries))
+	now := time.Now().Unix()
+	require.Nil(t, json.Unmarshal(tc.GET(fmt.Sprintf("/audit?since=%d", now+10), 200), &entries))
+	require.Equal(t, 0, len(entries))
+	require.Nil(t, json.Unmarshal(tc.GET(fmt.Sprintf("/audit?since=%d&until=%d", now-10, now+10), 200), &entries))
+	require.Equal(t, 4, len(entries))
+	tc.GET("/audit?outcome=maybe", 400)
+	tc.GET("/audit?since=yesterday", 400)
+	tc.GET("/audit?limit=0", 400)
+
+	// Export is oldest first, one JSON entry per line.
+	lines := strings.Split(strings.TrimSpace(string(tc.GET("/audit/export?outcome=success", 200))), "\n")
+	require.Equal(t, 2, len(lines))
+	var entry AuditEntry
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "PATCH", entry.Method)
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "DELETE", entry.Method)
+
+	// The trail covers the whole fleet, so it is off limits to users limited to some devices.
+	tc.u.AllowedGroups = []string{"grp1"}
+	tc.GET("/audit", 403)
+	tc.GET("/audit/export", 403)
+	tc.u.AllowedGroups = nil
+	tc.u.AllowedTags = []string{"tag1"}
+	tc.GET("/audit", 403)
+	tc.GET("/audit/export", 403)
+}
+
+func TestApiUsers(t *testing.T) {
+	tc := NewTestClient(t)
+	headers := []string{"content-type", "application/json"}
+	tc.GET("/users", 403)
+	tc.POST("/users", 403, strings.NewReader(`{"username":"alice","password":"secret","scopes":["devices:read"]}`), headers...)
+
+	tc.u.AllowedScopes = users.ScopeUsersC | users.ScopeUsersR
+	var u User
+	require.Nil(t, json.Unmarshal(tc.POST("/users", 201,
+		strings.NewReader(`{"username":"alice","password":"secret","scopes":["devices:read"]}`), headers...), &u))
+	assert.Equal(t, "alice", u.Username)
+	assert.Equal(t, users.ScopeDevicesR, u.AllowedScopes)
+	tc.POST("/users", 400, strings.NewReader(`{"username":"bob","scopes":["devices:nope"]}`), headers...)
+
+	var list []User
+	require.Nil(t, json.Unmarshal(tc.GET("/users", 200), &list))
+	require.Equal(t, 1, len(list))
+	assert.Equal(t, "alice", list[0].Username)
+	assert.NotZero(t, list[0].CreatedAt)
+	assert.Empty(t, list[0].Password)
+	body := string(tc.GET("/users/alice", 200))
+	assert.Contains(t, body, `"scopes":["devices:read"]`)
+	assert.NotContains(t, body, "secret")
+	tc.GET("/users/bob", 404)
+
+	// Scopes
+	scopes := `{"scopes":["devices:read-update","updates:read"]}`
+	tc.PUT("/users/alice/scopes", 403, scopes, headers...)
+	tc.u.AllowedScopes |= users.ScopeUsersRU
+	tc.PUT("/users/alice/scopes", 400, `{"scopes":[]}`, headers...)
+	tc.PUT("/users/alice/scopes", 400, `{"scopes":["devices:nope"]}`, headers...)
+	tc.PUT("/users/bob/scopes", 404, scopes, headers...)
+	alice, err := tc.users.Get("alice")
+	require.Nil(t, err)
+	staleSession, err := alice.CreateSession("10.0.0.1", time.Now().Add(time.Hour).Unix(), users.ScopeDevicesR)
+	require.Nil(t, err)
+	_, err = alice.GenerateToken("stale", time.Now().Add(time.Hour).Unix(), users.ScopeDevicesR)
+	require.Nil(t, err)
+	tc.PUT("/users/alice/scopes", 204, scopes, headers...)
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice", 200), &u))
+	assert.Equal(t, users.ScopeDevicesRU|users.ScopeUpdatesR, u.AllowedScopes)
+	// Changing scopes revokes all sessions and tokens, setting the same ones does not.
+	loggedOut, err := tc.users.GetBySession(staleSession)
+	require.Nil(t, err)
+	assert.Nil(t, loggedOut)
+	var tokens []Token
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice/tokens", 200), &tokens))
+	assert.Equal(t, 0, len(tokens))
+	alice, err = tc.users.Get("alice")
+	require.Nil(t, err)
+	staleSession, err = alice.CreateSession("10.0.0.1", time.Now().Add(time.Hour).Unix(), users.ScopeDevicesR)
+	require.Nil(t, err)
+	tc.PUT("/users/alice/scopes", 204, scopes, headers...)
+	loggedIn, err := tc.users.GetBySession(staleSession)
+	require.Nil(t, err)
+	assert.NotNil(t, loggedIn)
+
+	// Sessions
+	_, err = alice.CreateSession("10.0.0.2", time.Now().Add(time.Hour).Unix(), users.ScopeDevicesR)
+	require.Nil(t, err)
+	var sessions []Session
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice/sessions", 200), &sessions))
+	require.Equal(t, 2, len(sessions))
+	slices.SortFunc(sessions, func(a, b Session) int { return strings.Compare(a.RemoteIP, b.RemoteIP) })
+	assert.Equal(t, loggedIn.AuthId, sessions[0].ID)
+	assert.Equal(t, "10.0.0.1", sessions[0].RemoteIP)
+	assert.Equal(t, "10.0.0.2", sessions[1].RemoteIP)
+	assert.Equal(t, users.ScopeDevicesR, sessions[0].Scopes)
+	assert.NotContains(t, string(tc.GET("/users/alice/sessions", 200)), staleSession)
+	tc.GET("/users/bob/sessions", 404)
+	tc.DELETE("/users/alice/sessions/nope", 404)
+	tc.DELETE("/users/alice/sessions/"+sessions[0].ID, 204)
+	tc.DELETE("/users/alice/sessions/"+sessions[0].ID, 404)
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice/sessions", 200), &sessions))
+	require.Equal(t, 1, len(sessions))
+	assert.Equal(t, "10.0.0.2", sessions[0].RemoteIP)
+	tc.DELETE("/users/alice/sessions", 204)
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice/sessions", 200), &sessions))
+	assert.Equal(t, 0, len(sessions))
+
+	// Tokens
+	token, err := alice.GenerateToken("ci", time.Now().Add(time.Hour).Unix(), users.ScopeDevicesR)
+	require.Nil(t, err)
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice/tokens", 200), &tokens))
+	require.Equal(t, 1, len(tokens))
+	assert.Equal(t, token.PublicID, tokens[0].PublicID)
+	assert.Equal(t, "ci", tokens[0].Description)
+	assert.Empty(t, tokens[0].Value)
+
+	// Users can only rotate their own tokens, which requires no admin scope.
+	rotate := fmt.Sprintf("/users/alice/tokens/%d/rotate", token.PublicID)
+	tc.POST(rotate, 403, nil)
+	root := *tc.u
+	*tc.u = *alice
+	require.False(t, tc.u.AllowedScopes.Has(users.ScopeUsersRU))
+	tc.POST(rotate+"?grace=nope", 400, nil)
+	tc.POST(fmt.Sprintf("/users/alice/tokens/%d/rotate", token.PublicID+100), 404, nil)
+	// A token cannot keep scopes which its user lost.
+	tc.u.AllowedScopes = users.ScopeUpdatesR
+	assert.Contains(t, string(tc.POST(rotate, 403, nil)), "requested scopes exceed allowed scopes")
+	tc.u.AllowedScopes = alice.AllowedScopes
+	var rotated Token
+	require.Nil(t, json.Unmarshal(tc.POST(rotate+"?grace=30m", 201, nil), &rotated))
+	*tc.u = root
+	assert.Equal(t, "ci", rotated.Description)
+	assert.NotEmpty(t, rotated.Value)
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice/tokens", 200), &tokens))
+	require.Equal(t, 2, len(tokens))
+	assert.InDelta(t, time.Now().Add(30*time.Minute).Unix(), tokens[0].ExpiresAt, 5)
+	tc.DELETE(fmt.Sprintf("/users/alice/tokens/%d", rotated.PublicID), 204)
+
+	tc.DELETE(fmt.Sprintf("/users/alice/tokens/%d", token.PublicID+1), 404)
+	tc.DELETE("/users/alice/tokens/nope", 404)
+	tc.DELETE(fmt.Sprintf("/users/alice/tokens/%d", token.PublicID), 204)
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice/tokens", 200), &tokens))
+	assert.Equal(t, 0, len(tokens))
+
+	// Two-factor authentication
+	tc.DELETE("/users/bob/totp", 404)
+	tc.DELETE("/users/alice/totp", 204)
+
+	log := string(tc.GET("/users/alice/audit-log", 200))
+	assert.Contains(t, log, "User created")
+	assert.Contains(t, log, "Scopes changed by root")
+	assert.Contains(t, log, "Two-factor authentication reset by root")
+	assert.Contains(t, log, "All sessions revoked by root")
+	assert.Contains(t, log, "All tokens revoked by root")
+	assert.Contains(t, log, fmt.Sprintf("Session revoked id=%s by root", loggedIn.AuthId))
+	assert.Contains(t, log, fmt.Sprintf("Token deleted id=%d", token.PublicID))
+
+	// Delete
+	tc.DELETE("/users/alice", 403)
+	tc.u.AllowedScopes |= users.ScopeUsersD
+	tc.DELETE("/users/bob", 404)
+	require.Nil(t, tc.users.Create(&users.User{Username: "root", AllowedScopes: users.ScopeUsersD}))
+	tc.DELETE("/users/root", 400)
+	tc.DELETE("/users/alice", 204)
+	tc.GET("/users/alice", 404)
+	require.Nil(t, json.Unmarshal(tc.GET("/users", 200), &list))
+	require.Equal(t, 1, len(list))
+	assert.Equal(t, "root", list[0].Username)
+}
+
+func TestApiServiceAccounts(t *testing.T) {
+	tc := NewTestClient(t)
+	headers := []string{"content-type", "application/json"}
+	create := `{"name":"ci","scopes":["devices:read"]}`
+	tc.POST("/service-accounts", 403, strings.NewReader(create), headers...)
+	tc.u.AllowedScopes = users.ScopeUsersC | users.ScopeUsersR | users.ScopeUsersRU
+
+	tc.POST("/service-accounts", 400, strings.NewReader(`{"scopes":["devices:read"]}`), headers...)
+	tc.POST("/service-accounts", 400, strings.NewReader(`{"name":"ci"}`), headers...)
+	tc.POST("/service-accounts", 400, strings.NewReader(`{"name":"ci","scopes":["devices:nope"]}`), headers...)
+	var sa User
+	require.Nil(t, json.Unmarshal(tc.POST("/service-accounts", 201, strings.NewReader(create), headers...), &sa))
+	assert.Equal(t, "ci", sa.Username)
+	assert.Equal(t, "root", sa.Owner)
+	assert.True(t, sa.ServiceAccount)
+	assert.Equal(t, users.ScopeDevicesR, sa.AllowedScopes)
+	tc.POST("/service-accounts", 409, strings.NewReader(create), headers...)
+
+	// Service accounts are listed separately from users.
+	require.Nil(t, tc.users.Create(&users.User{Username: "alice", AllowedScopes: users.ScopeDevicesR}))
+	var list []User
+	require.Nil(t, json.Unmarshal(tc.GET("/users", 200), &list))
+	require.Equal(t, 1, len(list))
+	assert.Equal(t, "alice", list[0].Username)
+	require.Nil(t, json.Unmarshal(tc.GET("/service-accounts", 200), &list))
+	require.Equal(t, 1, len(list))
+	assert.Equal(t, "ci", list[0].Username)
+
+	tc.PUT("/service-accounts/ci/owner", 400, `{}`, headers...)
+	tc.PUT("/service-accounts/alice/owner", 404, `{"owner":"platform-team"}`, headers...)
+	tc.PUT("/service-accounts/ci/owner", 204, `{"owner":"platform-team"}`, headers...)
+	require.Nil(t, json.Unmarshal(tc.GET("/users/ci", 200), &sa))
+	assert.Equal(t, "platform-team", sa.Owner)
+
+	// Tokens
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	token := fmt.Sprintf(`{"description":"pipeline","expires":"%s","scopes":["devices:read"]}`, expires)
+	tc.POST("/service-accounts/alice/tokens", 404, strings.NewReader(token), headers...)
+	tc.POST("/service-accounts/ci/tokens", 400, strings.NewReader(`{"description":"pipeline","scopes":["devices:read"]}`), headers...)
+	tc.POST("/service-accounts/ci/tokens", 400,
+		strings.NewReader(fmt.Sprintf(`{"description":"pipeline","expires":"%s","scopes":["devices:read-update"]}`, expires)), headers...)
+	var created Token
+	require.Nil(t, json.Unmarshal(tc.POST("/service-accounts/ci/tokens", 201, strings.NewReader(token), headers...), &created))
+	assert.NotEmpty(t, created.Value)
+	u, err := tc.users.GetByToken(created.Value, "127.0.0.1")
+	require.Nil(t, err)
+	require.NotNil(t, u)
+	assert.Equal(t, "ci", u.Username)
+	var tokens []Token
+	require.Nil(t, json.Unmarshal(tc.GET("/users/ci/tokens", 200), &tokens))
+	require.Equal(t, 1, len(tokens))
+
+	log := string(tc.GET("/users/ci/audit-log", 200))
+	assert.Contains(t, log, "Service account created by root (owner=root)")
+	assert.Contains(t, log, "Owner changed to platform-team by root")
+	assert.Contains(t, log, "Token created")
+}
+
+func TestApiDeviceAccessLimits(t *testing.T) {
+	tc := NewTestClient(t)
+	headers := []string{"content-type", "application/json"}
+	require.Nil(t, tc.fs.Updates.Prod.Ostree.WriteFile("tag1", "update1", "foo", "bar"))
+	require.Nil(t, tc.fs.Updates.Prod.Ostree.WriteFile("tag2", "update2", "foo", "bar"))
+	for _, uuid := range []string{"dev1", "dev2", "dev3"} {
+		d, err := tc.gw.DeviceCreate(uuid, "pubkey", true)
+		require.Nil(t, err)
+		require.Nil(t, d.CheckIn("", "tag1", "", ""))
+	}
+	d, err := tc.gw.DeviceCreate("dev4", "pubkey", true)
+	require.Nil(t, err)
+	require.Nil(t, d.CheckIn("", "tag2", "", ""))
+	grp1, grp2 := "grp1", "grp2"
+	require.Nil(t, tc.api.PatchDeviceLabels(map[string]*string{"group": &grp1}, []string{"dev1", "dev4"}))
+	require.Nil(t, tc.api.PatchDeviceLabels(map[string]*string{"group": &grp2}, []string{"dev2"}))
+
+	tc.u.AllowedScopes = users.ScopeDevicesRU | users.ScopeUpdatesRU | users.ScopeLabelsRU |
+		users.ScopeRolloutsR | users.ScopeRolloutsC | users.ScopeRolloutsApprove
+	tc.u.AllowedTags = []string{"tag1"}
+	tc.u.AllowedGroups = []string{"grp1"}
+
+	var devices []apiStorage.DeviceListItem
+	require.Nil(t, json.Unmarshal(tc.GET("/devices", 200), &devices))
+	require.Len(t, devices, 1)
+	assert.Equal(t, "dev1", devices[0].Uuid)
+	tc.GET("/devices/dev1", 200)
+	tc.GET("/devices/dev2", 404)
+	tc.GET("/devices/dev4", 404)
+
+	var groups []string
+	require.Nil(t, json.Unmarshal(tc.GET("/known-labels/device-groups", 200), &groups))
+	assert.Equal(t, []string{"grp1"}, groups)
+
+	// Devices can't be moved out of the groups a user is limited to.
+	tc.PATCH("/devices/dev1/labels", 403, `{"upserts":{"group":"grp2"}}`, headers...)
+	tc.PATCH("/devices/dev1/labels", 403, `{"deletes":["group"]}`, headers...)
+	tc.PATCH("/devices/dev1/labels", 200, `{"upserts":{"name":"first"}}`, headers...)
+
+	tc.GET("/updates/prod/tag1", 200)
+	tc.GET("/updates/prod/tag2", 403)
+	tc.PUT("/updates/prod/tag2/update2/rollouts/rocks", 403, `{"groups":["grp1"]}`, headers...)
+	tc.PUT("/updates/prod/tag1/update1/rollouts/rocks", 403, `{"groups":["grp2"]}`, headers...)
+	tc.PUT("/updates/prod/tag1/update1/rollouts/rocks", 202, `{"groups":["grp1"]}`, headers...)
+	time.Sleep(50 * time.Millisecond) // Allow async database updates to finish
+
+	// Fleet-wide APIs are off limits.
+	tc.GET("/webhooks", 403)
+	tc.GET("/events/stream", 403)
+
+	// Limited users cannot lift limits, nor read user audit logs, which name devices outside of their limits.
+	tc.u.AllowedScopes |= users.ScopeUsersR | users.ScopeUsersRU
+	tc.PUT("/users/root/device-access", 403, `{}`, headers...)
+	tc.GET("/users/root/audit-log", 403)
+	require.Equal(t, []string{"grp1"}, tc.u.AllowedGroups)
+
+	// Admins manage the limits.
+	tc.u.AllowedTags = nil
+	tc.u.AllowedGroups = nil
+	tc.u.AllowedScopes = users.ScopeUsersR | users.ScopeUsersRU
+	require.Nil(t, tc.users.Create(&users.User{Username: "alice", AllowedScopes: users.ScopeDevicesR}))
+	tc.PUT("/users/bob/device-access", 404, `{"tags":["tag1"]}`, headers...)
+	tc.PUT("/users/alice/device-access", 400, `{"tags":["bad tag"]}`, headers...)
+	tc.PUT("/users/alice/device-access", 204, `{"tags":["tag1"],"groups":["grp1","grp2"]}`, headers...)
+	var alice User
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice", 200), &alice))
+	assert.Equal(t, []string{"tag1"}, alice.AllowedTags)
+	assert.Equal(t, []string{"grp1", "grp2"}, alice.AllowedGroups)
+	tc.PUT("/users/alice/device-access", 204, `{}`, headers...)
+	alice = User{}
+	require.Nil(t, json.Unmarshal(tc.GET("/users/alice", 200), &alice))
+	assert.Empty(t, alice.AllowedTags)
+	assert.Empty(t, alice.AllowedGroups)
+
+	log := string(tc.GET("/users/alice/audit-log", 200))
+	assert.Contains(t, log, "Device access limited to tags=[tag1] groups=[grp1,grp2] by root")
+	assert.Contains(t, log, "Device access limits removed by root")
+}
@@ -6,6 +6,7 @@ package api
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
@@ -23,7 +24,8 @@ type UpdateTufResp map[string]map[string]any
 // @Param   tag path string true "Update tag"
 // @Param   update path string true "Update name"
 // @Router  /updates/{prod}/{tag}/{update} [post]
-func (h handlers) updateCreate(c echo.Context) error {
+func (h handlers) updateCreate(c echo.Context) (err error) {
+	defer func(start time.Time) { observeUpload(c, "update", start, err) }(time.Now())
 	tag := c.Param("tag")
 	update := c.Param("update")
 	isProd := CtxGetIsProd(c.Request().Context())
@@ -31,7 +33,7 @@ func (h handlers) updateCreate(c echo.Context) error {
 	payload := c.Request().Body
 	defer payload.Close() //nolint:errcheck
 
-	if err := h.storage.CreateUpdate(tag, update, isProd, payload); err != nil {
+	if err = h.storage.CreateUpdate(tag, update, isProd, payload); err != nil {
 		if errors.Is(err, storage.ErrInvalidUpdate) {
 			return EchoError(c, err, http.StatusBadRequest, err.Error())
 		}
@@ -0,0 +1,368 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/foundriesio/dg-satellite/auth"
+	"github.com/foundriesio/dg-satellite/storage/users"
+)
+
+type (
+	User    = users.User
+	Token   = users.Token
+	Session = users.Session
+)
+
+type UserCreateReq struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Scopes   []string `json:"scopes"`
+}
+
+type UserScopesReq struct {
+	Scopes []string `json:"scopes"`
+}
+
+// @Summary List users
+// @Description Service accounts are listed separately.
+// @Description Requires scope: users:read
+// @Tags    Users
+// @Produce json
+// @Success 200 {array} User
+// @Router  /users [get]
+func (h *handlers) userList(c echo.Context) error {
+	if list, err := h.users.List(); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to list users")
+	} else {
+		list = slices.DeleteFunc(list, func(u User) bool { return u.ServiceAccount })
+		if list == nil {
+			list = []User{}
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// @Summary Create a user
+// @Description Only supported with the local authentication, other providers create users on their first login.
+// @Description Configured default scopes are granted if none are requested.
+// @Description Requires scope: users:create
+// @Tags    Users
+// @Accept  json
+// @Param   data body UserCreateReq true "User definition"
+// @Produce json
+// @Success 201 {object} User
+// @Router  /users [post]
+func (h *handlers) userCreate(c echo.Context) error {
+	creator, ok := h.provider.(auth.UserCreator)
+	if !ok {
+		err := fmt.Errorf("users cannot be created with the %s authentication provider", h.provider.Name())
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	var req UserCreateReq
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	}
+	if u, rc, err := creator.CreateUser(req.Username, req.Password, req.Scopes); err != nil {
+		return EchoError(c, err, rc, err.Error())
+	} else {
+		return c.JSON(http.StatusCreated, u)
+	}
+}
+
+// @Summary Get a user
+// @Description Requires scope: users:read
+// @Tags    Users
+// @Produce json
+// @Success 200 {object} User
+// @Param   username path string true "Username"
+// @Router  /users/{username} [get]
+func (h *handlers) userGet(c echo.Context) error {
+	return h.handleUser(c, func(u *User) error {
+		return c.JSON(http.StatusOK, u)
+	})
+}
+
+// @Summary Delete a user along with their sessions and API tokens
+// @Description Requires scope: users:delete
+// @Tags    Users
+// @Success 204
+// @Param   username path string true "Username"
+// @Router  /users/{username} [delete]
+func (h *handlers) userDelete(c echo.Context) error {
+	return h.handleUser(c, func(u *User) error {
+		if c.Get("user").(*User).Username == u.Username {
+			err := errors.New("users cannot delete themselves")
+			return EchoError(c, err, http.StatusBadRequest, err.Error())
+		}
+		if err := u.Delete(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to delete user")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary Replace scopes allowed for a user
+// @Description All sessions and API tokens of a user are revoked if scopes change, so that the user must log in again.
+// @Description Requires scope: users:read-update
+// @Tags    Users
+// @Accept  json
+// @Param   data body UserScopesReq true "Allowed scopes"
+// @Success 204
+// @Param   username path string true "Username"
+// @Router  /users/{username}/scopes [put]
+func (h *handlers) userScopesPut(c echo.Context) error {
+	var req UserScopesReq
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	} else if len(req.Scopes) == 0 {
+		err := errors.New("at least one scope is required")
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	scopes, err := users.ScopesFromSlice(req.Scopes)
+	if err != nil {
+		return EchoError(c, err, http.StatusBadRequest, fmt.Sprintf("Invalid scope: %s", err))
+	}
+	return h.handleUser(c, func(u *User) error {
+		if err := u.SetScopes(scopes, c.Get("user").(*User).Username); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to update user")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary Limit a user to devices on some tags and in some groups
+// @Description A user limited to some tags and groups cannot see or change other devices, updates of other tags, or fleet-wide resources.
+// @Description Empty lists remove limits.
+// @Description Requires scope: users:read-update, and is not available to users limited to some tags or groups.
+// @Tags    Users
+// @Accept  json
+// @Param   data body DeviceFilter true "Allowed device tags and groups"
+// @Success 204
+// @Param   username path string true "Username"
+// @Router  /users/{username}/device-access [put]
+func (h *handlers) userDeviceAccessPut(c echo.Context) error {
+	var req DeviceFilter
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	}
+	for _, tag := range req.Tags {
+		if !validateTag(tag) {
+			return c.String(http.StatusBadRequest, "Tags must match a given regexp: "+validTagRegex)
+		}
+	}
+	for _, group := range req.Groups {
+		if !validateGroupName(group) {
+			return c.String(http.StatusBadRequest, invalidGroupNameMsg)
+		}
+	}
+	return h.handleUser(c, func(u *User) error {
+		if err := u.SetDeviceFilter(req, c.Get("user").(*User).Username); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to update user")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary List API tokens of a user
+// @Description Token values are never returned.
+// @Description Requires scope: users:read
+// @Tags    Users
+// @Produce json
+// @Success 200 {array} Token
+// @Param   username path string true "Username"
+// @Router  /users/{username}/tokens [get]
+func (h *handlers) userTokenList(c echo.Context) error {
+	return h.handleUser(c, func(u *User) error {
+		if tokens, err := u.ListTokens(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to list tokens")
+		} else {
+			if tokens == nil {
+				tokens = []Token{}
+			}
+			return c.JSON(http.StatusOK, tokens)
+		}
+	})
+}
+
+// @Summary Revoke an API token of a user
+// @Description Requires scope: users:read-update
+// @Tags    Users
+// @Success 204
+// @Param   username path string true "Username"
+// @Param   id path int true "Token ID"
+// @Router  /users/{username}/tokens/{id} [delete]
+func (h *handlers) userTokenDelete(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+	return h.handleUser(c, func(u *User) error {
+		if tokens, err := u.ListTokens(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to list tokens")
+		} else if !slices.ContainsFunc(tokens, func(t Token) bool { return t.PublicID == id }) {
+			return c.NoContent(http.StatusNotFound)
+		} else if err = u.DeleteToken(id); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to delete token")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary Rotate an API token
+// @Description Creates a replacement token with the same description, scopes, and lifetime, and returns its value.
+// @Description The old token stays valid for a grace period, one hour by default, so that clients can switch to the new one.
+// @Description Users can only rotate their own tokens, like they create and revoke them on the settings page, so no scope is required.
+// @Description A caller authenticated with a token can only rotate tokens which have no more scopes than its own.
+// @Tags    Users
+// @Produce json
+// @Success 201 {object} Token
+// @Param   username path string true "Username"
+// @Param   id path int true "Token ID"
+// @Param   grace query string false "Grace period of the old token, e.g. 30m or 24h"
+// @Router  /users/{username}/tokens/{id}/rotate [post]
+func (h *handlers) userTokenRotate(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+	grace := time.Hour
+	if param := c.QueryParam("grace"); len(param) > 0 {
+		if grace, err = time.ParseDuration(param); err != nil || grace < 0 {
+			err = fmt.Errorf("invalid grace period: %s", param)
+			return EchoError(c, err, http.StatusBadRequest, err.Error())
+		}
+	}
+	u := c.Get("user").(*User)
+	if u.Username != c.Param("username") {
+		err := errors.New("users can only rotate their own tokens")
+		return EchoError(c, err, http.StatusForbidden, err.Error())
+	}
+	if token, err := u.RotateToken(id, grace); errors.Is(err, users.ErrTokenNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	} else if errors.Is(err, users.ErrScopesExceeded) {
+		return EchoError(c, err, http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	} else {
+		return c.JSON(http.StatusCreated, token)
+	}
+}
+
+// @Summary List active sessions of a user
+// @Description A session which made this request is marked as current.
+// @Description Requires scope: users:read
+// @Tags    Users
+// @Produce json
+// @Success 200 {array} Session
+// @Param   username path string true "Username"
+// @Router  /users/{username}/sessions [get]
+func (h *handlers) userSessionList(c echo.Context) error {
+	caller := c.Get("user").(*User)
+	return h.handleUser(c, func(u *User) error {
+		if sessions, err := u.ListSessions(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to list sessions")
+		} else {
+			if sessions == nil {
+				sessions = []Session{}
+			}
+			for i := range sessions {
+				sessions[i].Current = caller.AuthMethod == users.AuthMethodSession && caller.AuthId == sessions[i].ID
+			}
+			return c.JSON(http.StatusOK, sessions)
+		}
+	})
+}
+
+// @Summary Revoke a session of a user
+// @Description Requires scope: users:read-update
+// @Tags    Users
+// @Success 204
+// @Param   username path string true "Username"
+// @Param   id path string true "Session ID"
+// @Router  /users/{username}/sessions/{id} [delete]
+func (h *handlers) userSessionDelete(c echo.Context) error {
+	return h.handleUser(c, func(u *User) error {
+		if found, err := u.RevokeSession(c.Param("id"), c.Get("user").(*User).Username); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to revoke session")
+		} else if !found {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary Revoke all sessions of a user
+// @Description Logs a user out everywhere, API tokens are kept.
+// @Description Requires scope: users:read-update
+// @Tags    Users
+// @Success 204
+// @Param   username path string true "Username"
+// @Router  /users/{username}/sessions [delete]
+func (h *handlers) userSessionDeleteAll(c echo.Context) error {
+	return h.handleUser(c, func(u *User) error {
+		if err := u.RevokeAllSessions(c.Get("user").(*User).Username); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to revoke sessions")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary Reset two-factor authentication of a user
+// @Description A user must enroll again when two-factor authentication is required, e.g. after losing their device.
+// @Description Only supported with the local authentication.
+// @Description Requires scope: users:read-update
+// @Tags    Users
+// @Success 204
+// @Param   username path string true "Username"
+// @Router  /users/{username}/totp [delete]
+func (h *handlers) userTotpDelete(c echo.Context) error {
+	resetter, ok := h.provider.(auth.TotpResetter)
+	if !ok {
+		err := fmt.Errorf("two-factor authentication is not supported by the %s authentication provider", h.provider.Name())
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	return h.handleUser(c, func(u *User) error {
+		if err := resetter.ResetTotp(u, c.Get("user").(*User).Username); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to reset two-factor authentication")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary Get the audit log of a user
+// @Description The log holds changes of a user account, like scope changes, token creation and deletion.
+// @Description Requires scope: users:read, and is not available to users limited to some tags or groups.
+// @Tags    Users
+// @Produce plain
+// @Success 200 {string} string
+// @Param   username path string true "Username"
+// @Router  /users/{username}/audit-log [get]
+func (h *handlers) userAuditLog(c echo.Context) error {
+	return h.handleUser(c, func(u *User) error {
+		if log, err := u.GetAuditLog(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to read audit log")
+		} else {
+			return c.String(http.StatusOK, log)
+		}
+	})
+}
+
+func (h *handlers) handleUser(c echo.Context, next func(*User) error) error {
+	if u, err := h.users.Get(c.Param("username")); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to lookup user")
+	} else if u == nil {
+		return c.NoContent(http.StatusNotFound)
+	} else {
+		return next(u)
+	}
+}
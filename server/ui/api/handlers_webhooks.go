@@ -0,0 +1,158 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	storage "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+type (
+	Webhook        = storage.Webhook
+	WebhookAttempt = storage.WebhookAttempt
+	WebhookReq     = storage.WebhookReq
+)
+
+const defaultWebhookDeliveriesLimit = 50
+
+// @Summary List webhooks
+// @Description Requires scopes: devices:read, updates:read
+// @Tags    Webhooks
+// @Produce json
+// @Success 200 {array} Webhook
+// @Router  /webhooks [get]
+func (h *handlers) webhookList(c echo.Context) error {
+	if webhooks, err := h.storage.ListWebhooks(); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to list webhooks")
+	} else {
+		if webhooks == nil {
+			webhooks = []Webhook{}
+		}
+		return c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// @Summary Create a webhook
+// @Description A webhook receives a signed POST request for each fleet event it subscribes to.
+// @Description An empty events list subscribes to all events.
+// @Description A webhook secret is only returned by this call.
+// @Description Requires scopes: devices:read-update, updates:read-update
+// @Tags    Webhooks
+// @Accept  json
+// @Param   data body WebhookReq true "Webhook definition"
+// @Produce json
+// @Success 201 {object} Webhook
+// @Router  /webhooks [post]
+func (h *handlers) webhookCreate(c echo.Context) error {
+	var req WebhookReq
+	if err := c.Bind(&req); err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+	}
+	if w, err := h.storage.CreateWebhook(req); err != nil {
+		if errors.Is(err, storage.ErrInvalidWebhook) {
+			return EchoError(c, err, http.StatusBadRequest, err.Error())
+		}
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to create webhook")
+	} else {
+		return c.JSON(http.StatusCreated, w)
+	}
+}
+
+// @Summary Get a webhook
+// @Description Requires scopes: devices:read, updates:read
+// @Tags    Webhooks
+// @Produce json
+// @Success 200 {object} Webhook
+// @Param   id path int true "Webhook ID"
+// @Router  /webhooks/{id} [get]
+func (h *handlers) webhookGet(c echo.Context) error {
+	return h.handleWebhook(c, func(w *Webhook) error {
+		return c.JSON(http.StatusOK, w)
+	})
+}
+
+// @Summary Update a webhook
+// @Description Requires scopes: devices:read-update, updates:read-update
+// @Tags    Webhooks
+// @Accept  json
+// @Param   data body WebhookReq true "Webhook definition"
+// @Produce json
+// @Success 200 {object} Webhook
+// @Param   id path int true "Webhook ID"
+// @Router  /webhooks/{id} [put]
+func (h *handlers) webhookPut(c echo.Context) error {
+	return h.handleWebhook(c, func(w *Webhook) error {
+		var req WebhookReq
+		if err := c.Bind(&req); err != nil {
+			return EchoError(c, err, http.StatusBadRequest, "Bad JSON body")
+		}
+		if err := w.Update(req); err != nil {
+			if errors.Is(err, storage.ErrInvalidWebhook) {
+				return EchoError(c, err, http.StatusBadRequest, err.Error())
+			}
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to update webhook")
+		}
+		return c.JSON(http.StatusOK, w)
+	})
+}
+
+// @Summary Delete a webhook
+// @Description Pending deliveries and delivery history of a webhook are deleted as well.
+// @Description Requires scopes: devices:read-update, updates:read-update
+// @Tags    Webhooks
+// @Success 204
+// @Param   id path int true "Webhook ID"
+// @Router  /webhooks/{id} [delete]
+func (h *handlers) webhookDelete(c echo.Context) error {
+	return h.handleWebhook(c, func(w *Webhook) error {
+		if err := w.Delete(); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to delete webhook")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// @Summary List delivery attempts of a webhook, newest first
+// @Description Requires scopes: devices:read, updates:read
+// @Tags    Webhooks
+// @Produce json
+// @Success 200 {array} WebhookAttempt
+// @Param   id path int true "Webhook ID"
+// @Param   limit query int false "Maximum number of attempts to return, 50 by default"
+// @Router  /webhooks/{id}/deliveries [get]
+func (h *handlers) webhookDeliveriesList(c echo.Context) error {
+	return h.handleWebhook(c, func(w *Webhook) error {
+		limit, err := parsePositiveIntParam(c, "limit", defaultWebhookDeliveriesLimit)
+		if err != nil {
+			return err
+		}
+		if attempts, err := w.Deliveries(limit); err != nil {
+			return EchoError(c, err, http.StatusInternalServerError, "Failed to read webhook deliveries")
+		} else {
+			if attempts == nil {
+				attempts = []WebhookAttempt{}
+			}
+			return c.JSON(http.StatusOK, attempts)
+		}
+	})
+}
+
+func (h *handlers) handleWebhook(c echo.Context, next func(*Webhook) error) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if w, err := h.storage.GetWebhook(id); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to lookup webhook")
+	} else if w == nil {
+		return c.NoContent(http.StatusNotFound)
+	} else {
+		return next(w)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/foundriesio/dg-satellite/metrics"
+	storage "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+var (
+	sseStreams = metrics.NewGauge("dg_sse_streams_active",
+		"Number of server-sent event streams currently open, by stream kind.",
+		"stream")
+	uploadDuration = metrics.NewHistogram("dg_upload_duration_seconds",
+		"Duration of update and configs uploads, by kind and result.",
+		metrics.UploadBuckets, "kind", "result")
+)
+
+func registerDeviceMetrics(s *storage.Storage) {
+	metrics.NewGaugeFunc("dg_devices",
+		"Number of devices, by target, tag, and whether a device is online.",
+		[]string{"target", "tag", "online"},
+		func() ([]metrics.Sample, error) {
+			counts, err := s.CountDevices()
+			if err != nil {
+				return nil, err
+			}
+			samples := make([]metrics.Sample, len(counts))
+			for i, c := range counts {
+				samples[i] = metrics.Sample{
+					LabelValues: []string{c.Target, c.Tag, strconv.FormatBool(c.Online)},
+					Value:       float64(c.Count),
+				}
+			}
+			return samples, nil
+		},
+	)
+}
+
+// observeUpload records a duration of an upload handled since start, given an error returned by its handler.
+func observeUpload(c echo.Context, kind string, start time.Time, err error) {
+	result := "success"
+	if err != nil || c.Response().Status >= http.StatusBadRequest {
+		result = "failure"
+	}
+	uploadDuration.Observe(time.Since(start).Seconds(), kind, result)
+}
@@ -4,9 +4,12 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/foundriesio/dg-satellite/auth"
+	storage "github.com/foundriesio/dg-satellite/storage/api"
 	"github.com/foundriesio/dg-satellite/storage/users"
 	"github.com/labstack/echo/v4"
 )
@@ -19,11 +22,27 @@ func requireScope(scope users.Scopes) echo.MiddlewareFunc {
 				msg := "User missing required scope(s): " + scope.String()
 				return c.String(http.StatusForbidden, msg)
 			}
+			filter := user.DeviceFilter()
+			if tag := c.Param("tag"); len(tag) > 0 && !filter.AllowsTag(tag) {
+				return c.String(http.StatusForbidden, "User is not allowed to access tag: "+tag)
+			} else if group := c.Param("group"); len(group) > 0 && !filter.AllowsGroup(group) {
+				return c.String(http.StatusForbidden, "User is not allowed to access group: "+group)
+			}
 			return next(c)
 		}
 	}
 }
 
+// requireFleetAccess denies users limited to some device tags or groups, for APIs which act on the whole fleet.
+func requireFleetAccess(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !c.Get("user").(*users.User).DeviceFilter().Unrestricted() {
+			return c.String(http.StatusForbidden, "User is limited to some device tags or groups")
+		}
+		return next(c)
+	}
+}
+
 func authUser(provider auth.Provider) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -56,3 +75,49 @@ func gzipContentTypeAsContentEncoding(next echo.HandlerFunc) echo.HandlerFunc {
 		return next(c)
 	}
 }
+
+// AuditTrail records each API or web call which may change server data, whether it succeeds or fails.
+// It runs before authentication, and finds a user set by it once a call is handled.
+func AuditTrail(storage *storage.Storage) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+				return next(c)
+			}
+			start := time.Now()
+			err := next(c)
+			if len(c.Path()) == 0 || errors.Is(err, echo.ErrNotFound) || errors.Is(err, echo.ErrMethodNotAllowed) {
+				// Calls to unknown routes change nothing; do not let them flood the audit trail.
+				return err
+			}
+
+			status := c.Response().Status
+			if err != nil {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+			entry := AuditEntry{
+				Timestamp: start.Unix(),
+				RemoteIp:  c.RealIP(),
+				RequestId: c.Response().Header().Get(echo.HeaderXRequestID),
+				Method:    req.Method,
+				Route:     c.Path(),
+				Resource:  req.URL.Path,
+				Status:    status,
+				Success:   status < http.StatusBadRequest,
+			}
+			if user, ok := c.Get("user").(*users.User); ok && user != nil {
+				entry.Actor = user.Username
+				entry.AuthMethod = user.AuthMethod
+				entry.AuthId = user.AuthId
+			}
+			storage.AddAuditEntry(entry)
+			return err
+		}
+	}
+}
@@ -5,6 +5,7 @@ package daemons
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	storage "github.com/foundriesio/dg-satellite/storage/api"
@@ -21,18 +22,32 @@ type daemons struct {
 	daemons []daemonFunc
 	stops   []chan bool
 
-	rolloutOptions rolloutOptions
+	heartbeatOptions heartbeatOptions
+	rolloutOptions   rolloutOptions
+	webhooksOptions  webhooksOptions
 }
 
 func New(context context.Context, storage *storage.Storage, users *users.Storage, opts ...Option) *daemons {
 	d := &daemons{context: context, storage: storage}
+	d.heartbeatOptions = heartbeatOptions{
+		interval:        time.Minute,
+		pollingInterval: 5 * time.Minute,
+	}
 	d.rolloutOptions = rolloutOptions{
 		interval: 5 * time.Minute,
 	}
+	d.webhooksOptions = webhooksOptions{
+		interval:    10 * time.Second,
+		retryDelay:  10 * time.Second,
+		maxAttempts: 10,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
 	d.daemons = []daemonFunc{
 		d.rolloutWatchdog(true),
 		d.rolloutWatchdog(false),
 		userGcDaemonFunc(users),
+		d.webhooksDeliverer(),
+		d.heartbeatMonitor(),
 	}
 
 	for _, opt := range opts {
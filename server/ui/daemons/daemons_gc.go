@@ -17,6 +17,7 @@ func userGcDaemonFunc(users *users.Storage) daemonFunc {
 				return
 			case <-time.After(time.Minute * 5):
 				users.RunGc()
+				userGcRuns.Inc()
 			}
 		}
 	}
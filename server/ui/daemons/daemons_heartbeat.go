@@ -0,0 +1,50 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package daemons
+
+import (
+	"time"
+
+	"github.com/foundriesio/dg-satellite/context"
+)
+
+// WithHeartbeatInterval sets how often device connectivity states are updated
+func WithHeartbeatInterval(interval time.Duration) Option {
+	return func(d *daemons) {
+		d.heartbeatOptions.interval = interval
+	}
+}
+
+// WithPollingInterval sets an expected interval between device check-ins.
+// It applies to devices which do not report their own polling interval in aktoml.
+func WithPollingInterval(interval time.Duration) Option {
+	return func(d *daemons) {
+		d.heartbeatOptions.pollingInterval = interval
+	}
+}
+
+type heartbeatOptions struct {
+	interval        time.Duration
+	pollingInterval time.Duration
+}
+
+func (d *daemons) heartbeatMonitor() daemonFunc {
+	return func(stop chan bool) {
+		log := context.CtxGetLog(d.context)
+		for {
+			if changes, err := d.storage.UpdateDevicesConnectivity(d.heartbeatOptions.pollingInterval); err != nil {
+				log.Error("failed to update device connectivity states", "error", err)
+			} else {
+				for _, c := range changes {
+					log.Info("device connectivity changed", "uuid", c.Uuid, "online", c.Online, "last-seen", c.LastSeen)
+				}
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(d.heartbeatOptions.interval):
+			}
+		}
+	}
+}
@@ -6,6 +6,7 @@ package daemons
 import (
 	"errors"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/foundriesio/dg-satellite/context"
@@ -31,6 +32,11 @@ func (d *daemons) rolloutWatchdog(isProd bool) daemonFunc {
 		firstRun := true
 		for {
 			processed := d.processJournal(isProd)
+			result := "success"
+			if !processed {
+				result = "failure"
+			}
+			rolloutJournalRuns.Inc(strconv.FormatBool(isProd), result)
 			if firstRun {
 				// Do not rollover the journal on application startup - it may have new entries after being processed.
 				firstRun = false
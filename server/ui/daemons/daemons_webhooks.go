@@ -0,0 +1,140 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package daemons
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/foundriesio/dg-satellite/context"
+	storage "github.com/foundriesio/dg-satellite/storage/api"
+)
+
+// WithWebhooksInterval sets how often queued webhook deliveries are processed
+func WithWebhooksInterval(interval time.Duration) Option {
+	return func(d *daemons) {
+		d.webhooksOptions.interval = interval
+	}
+}
+
+// WithWebhooksRetryDelay sets a delay before the first retry of a failed webhook delivery.
+// Each next retry waits twice as long, up to an hour.
+func WithWebhooksRetryDelay(delay time.Duration) Option {
+	return func(d *daemons) {
+		d.webhooksOptions.retryDelay = delay
+	}
+}
+
+type webhooksOptions struct {
+	interval    time.Duration
+	retryDelay  time.Duration
+	maxAttempts int
+	client      *http.Client
+}
+
+func (d *daemons) webhooksDeliverer() daemonFunc {
+	return func(stop chan bool) {
+		for {
+			d.deliverWebhooks(stop)
+			select {
+			case <-stop:
+				return
+			case <-time.After(d.webhooksOptions.interval):
+			}
+		}
+	}
+}
+
+func (d *daemons) deliverWebhooks(stop chan bool) {
+	log := context.CtxGetLog(d.context)
+	if err := d.storage.DispatchWebhookEvents(); err != nil {
+		// Events remain on disk, and are dispatched again on the next run.
+		log.Error("failed to dispatch webhook events", "error", err)
+	}
+	deliveries, err := d.storage.ListWebhookDeliveries()
+	if err != nil {
+		log.Error("failed to list webhook deliveries", "error", err)
+		return
+	}
+	webhooks := make(map[int64]*storage.Webhook)
+	for _, delivery := range deliveries {
+		select {
+		case <-stop:
+			// Let a shutdown interrupt a long queue; remaining deliveries are kept for the next start.
+			return
+		default:
+		}
+		now := time.Now()
+		if delivery.NextAttempt > now.Unix() {
+			continue
+		}
+		w, ok := webhooks[delivery.WebhookId]
+		if !ok {
+			if w, err = d.storage.GetWebhook(delivery.WebhookId); err != nil {
+				log.Error("failed to look up webhook", "id", delivery.WebhookId, "error", err)
+				continue
+			}
+			webhooks[delivery.WebhookId] = w
+		}
+		if w == nil {
+			if err = d.storage.DropWebhookDelivery(delivery); err != nil {
+				log.Error("failed to drop delivery of a deleted webhook", "delivery", delivery.Id(), "error", err)
+			}
+			continue
+		}
+
+		attempt := d.sendWebhook(w, delivery)
+		var retryAt int64
+		if !attempt.Success && attempt.Attempt < d.webhooksOptions.maxAttempts {
+			delay := min(d.webhooksOptions.retryDelay<<(attempt.Attempt-1), time.Hour)
+			retryAt = now.Add(delay).Unix()
+		}
+		if !attempt.Success {
+			log.Warn("failed to deliver webhook", "delivery", delivery.Id(), "url", w.Url,
+				"attempt", attempt.Attempt, "status", attempt.StatusCode, "error", attempt.Error)
+		}
+		if err = d.storage.SaveWebhookAttempt(delivery, attempt, retryAt); err != nil {
+			log.Error("failed to save webhook delivery attempt", "delivery", delivery.Id(), "error", err)
+		}
+	}
+}
+
+func (d *daemons) sendWebhook(w *storage.Webhook, delivery storage.WebhookDelivery) storage.WebhookAttempt {
+	attempt := storage.WebhookAttempt{
+		DeliveryId: delivery.Id(),
+		Event:      delivery.Event.Type,
+		Attempt:    delivery.Attempts + 1,
+		Timestamp:  time.Now().Unix(),
+	}
+	payload, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("unexpected error marshalling event to JSON: %s", err)
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(d.context, http.MethodPost, w.Url, bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dg-satellite-webhooks")
+	req.Header.Set("X-Satellite-Event", delivery.Event.Type)
+	req.Header.Set("X-Satellite-Delivery", delivery.Id())
+	req.Header.Set("X-Satellite-Signature", w.Sign(payload))
+	res, err := d.webhooksOptions.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close() //nolint:errcheck
+	// Drain a small part of the body, so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	attempt.StatusCode = res.StatusCode
+	attempt.Success = res.StatusCode >= 200 && res.StatusCode < 300
+	return attempt
+}
@@ -0,0 +1,16 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package daemons
+
+import (
+	"github.com/foundriesio/dg-satellite/metrics"
+)
+
+var (
+	rolloutJournalRuns = metrics.NewCounter("dg_rollout_journal_runs_total",
+		"Number of rollout journal processing runs, by production flag and result.",
+		"prod", "result")
+	userGcRuns = metrics.NewCounter("dg_user_gc_runs_total",
+		"Number of user session and token garbage collection runs.")
+)
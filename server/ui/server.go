@@ -26,7 +26,9 @@ type daemon interface {
 	Shutdown()
 }
 
-func NewServer(ctx context.Context, db *storage.DbHandle, fs *storage.FsHandle, bindAddr string) (server.Server, error) {
+func NewServer(
+	ctx context.Context, db *storage.DbHandle, fs *storage.FsHandle, bindAddr string, opts ...daemons.Option,
+) (server.Server, error) {
 	strg, err := api.NewStorage(db, fs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load %s storage: %w", serverName, err)
@@ -43,11 +45,12 @@ func NewServer(ctx context.Context, db *storage.DbHandle, fs *storage.FsHandle,
 	}
 	slog.Info("Using authentication provider", "name", provider.Name())
 
-	daemons := daemons.New(ctx, strg, users)
+	daemons := daemons.New(ctx, strg, users, opts...)
 
 	srv := server.NewServer(ctx, e, serverName, bindAddr, nil)
+	e.Use(apiHandlers.AuditTrail(strg))
 	e.Use(auth.CsrfCheck)
-	apiHandlers.RegisterHandlers(e, strg, provider)
+	apiHandlers.RegisterHandlers(e, strg, users, provider)
 	webHandlers.RegisterHandlers(e, users, provider)
 	return &apiServer{server: srv, daemons: daemons}, nil
 }
@@ -52,14 +52,17 @@ func RegisterHandlers(e *echo.Echo, storage *users.Storage, authProvider auth.Pr
 	e.GET("/updates", h.updatesList, h.requireSession, h.requireScope(users.ScopeUpdatesR))
 	e.GET("/updates/:prod/:tag/:name", h.updatesGet, h.requireSession, h.requireScope(users.ScopeUpdatesR))
 	e.GET("/updates/:prod/:tag/:name/tail", h.updatesTail, h.requireSession, h.requireScope(users.ScopeUpdatesR))
-	e.GET("/updates/:prod/:tag/:name/rollouts/:rollout", h.updatesRollout, h.requireSession, h.requireScope(users.ScopeUpdatesR))
-	e.GET("/updates/:prod/:tag/:name/rollouts/:rollout/tail", h.updatesRolloutTail, h.requireSession, h.requireScope(users.ScopeUpdatesR))
+	e.GET("/updates/:prod/:tag/:name/rollouts/:rollout", h.updatesRollout, h.requireSession, h.requireScope(users.ScopeRolloutsR))
+	e.GET("/updates/:prod/:tag/:name/rollouts/:rollout/tail", h.updatesRolloutTail, h.requireSession, h.requireScope(users.ScopeRolloutsR))
 	e.GET("/users", h.usersList, h.requireSession, h.requireScope(users.ScopeUsersR))
 	e.DELETE("/users/:username", h.userDelete, h.requireSession, h.requireScope(users.ScopeUsersD))
-	e.GET("/users/:username/audit-log", h.usersAuditLog, h.requireSession, h.requireScope(users.ScopeUsersR))
+	e.GET("/users/:username/audit-log", h.usersAuditLog, h.requireSession, h.requireScope(users.ScopeUsersR), h.requireFleetAccess)
 	e.POST("/users/:username/tokens", h.userTokenCreate, h.requireSession)
 	e.PUT("/users/:username/scopes", h.userScopesUpdate, h.requireSession)
 	e.DELETE("/users/:username/tokens/:tokenID", h.userTokenDelete, h.requireSession)
+	e.POST("/users/:username/tokens/:tokenID/rotate", h.userTokenRotate, h.requireSession)
+	e.DELETE("/users/:username/sessions", h.userSessionDeleteAll, h.requireSession)
+	e.DELETE("/users/:username/sessions/:sessionID", h.userSessionDelete, h.requireSession)
 }
 
 type baseCtx struct {
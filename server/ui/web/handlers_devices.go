@@ -137,18 +137,26 @@ func (h handlers) devicesGet(c echo.Context) error {
 		return h.handleUnexpected(c, err)
 	}
 
+	var config api.EffectiveConfig
+	if err := getJson(c.Request().Context(), "/v1/devices/"+c.Param("uuid")+"/config", &config); err != nil {
+		// A broken config must not prevent operators from seeing other device details.
+		context.CtxGetLog(c.Request().Context()).Warn("failed to get device config status", "err", err)
+	}
+
 	ctx := struct {
 		baseCtx
-		Device  api.Device
-		IpInfo  *ipInfo
-		HwInfo  map[string]any
-		Updates []string
+		Device       api.Device
+		IpInfo       *ipInfo
+		HwInfo       map[string]any
+		Updates      []string
+		ConfigStatus string
 	}{
-		baseCtx: h.baseCtx(c, "Device - "+device.Uuid, "devices"),
-		Device:  device,
-		IpInfo:  infoPtr,
-		HwInfo:  hw,
-		Updates: updates,
+		baseCtx:      h.baseCtx(c, "Device - "+device.Uuid, "devices"),
+		Device:       device,
+		IpInfo:       infoPtr,
+		HwInfo:       hw,
+		Updates:      updates,
+		ConfigStatus: config.Status,
 	}
 	return h.templates.ExecuteTemplate(c.Response(), "device.html", ctx)
 }
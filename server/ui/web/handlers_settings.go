@@ -16,15 +16,24 @@ func (h handlers) settings(c echo.Context) error {
 	if err != nil {
 		return h.handleUnexpected(c, err)
 	}
+	sessions, err := session.User.ListSessions()
+	if err != nil {
+		return h.handleUnexpected(c, err)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == session.User.AuthId
+	}
 
 	ctx := struct {
 		baseCtx
 		Tokens     []users.Token
+		Sessions   []users.Session
 		ScopesList []string
 		LocalAuth  bool
 	}{
 		baseCtx:    h.baseCtx(c, "Settings", "settings"),
 		Tokens:     tokens,
+		Sessions:   sessions,
 		ScopesList: session.User.AllowedScopes.ToSlice(),
 		LocalAuth:  h.provider.Name() == "local",
 	}
@@ -15,26 +15,36 @@ import (
 )
 
 func (h handlers) usersList(c echo.Context) error {
-	user, err := h.users.List()
+	list, err := h.users.List()
 	if err != nil {
 		return h.handleUnexpected(c, err)
 	}
+	var user, serviceAccounts []users.User
+	for _, u := range list {
+		if u.ServiceAccount {
+			serviceAccounts = append(serviceAccounts, u)
+		} else {
+			user = append(user, u)
+		}
+	}
 	ctx := struct {
 		baseCtx
-		Users      []users.User
-		ScopesList []string
-		CanDelete  bool
-		CanUpdate  bool
-		CanCreate  bool
-		LocalAuth  bool
+		Users           []users.User
+		ServiceAccounts []users.User
+		ScopesList      []string
+		CanDelete       bool
+		CanUpdate       bool
+		CanCreate       bool
+		LocalAuth       bool
 	}{
-		baseCtx:    h.baseCtx(c, "Users", "users"),
-		Users:      user,
-		ScopesList: users.ScopesAvailable(),
-		CanDelete:  CtxGetSession(c.Request().Context()).User.AllowedScopes.Has(users.ScopeUsersD),
-		CanUpdate:  CtxGetSession(c.Request().Context()).User.AllowedScopes.Has(users.ScopeUsersRU),
-		CanCreate:  CtxGetSession(c.Request().Context()).User.AllowedScopes.Has(users.ScopeUsersC),
-		LocalAuth:  h.provider.Name() == "local",
+		baseCtx:         h.baseCtx(c, "Users", "users"),
+		Users:           user,
+		ServiceAccounts: serviceAccounts,
+		ScopesList:      users.ScopesAvailable(),
+		CanDelete:       CtxGetSession(c.Request().Context()).User.AllowedScopes.Has(users.ScopeUsersD),
+		CanUpdate:       CtxGetSession(c.Request().Context()).User.AllowedScopes.Has(users.ScopeUsersRU),
+		CanCreate:       CtxGetSession(c.Request().Context()).User.AllowedScopes.Has(users.ScopeUsersC),
+		LocalAuth:       h.provider.Name() == "local",
 	}
 	return h.templates.ExecuteTemplate(c.Response(), "users.html", ctx)
 }
@@ -102,10 +112,11 @@ func (h *handlers) userScopesUpdate(c echo.Context) error {
 	user, err := h.users.Get(username)
 	if err != nil {
 		return h.handleError(c, http.StatusNotFound, err)
+	} else if user == nil {
+		return c.NoContent(http.StatusNotFound)
 	}
 
-	user.AllowedScopes = scopes
-	if err := user.Update("Scopes changed by " + session.User.Username); err != nil {
+	if err := user.SetScopes(scopes, session.User.Username); err != nil {
 		return h.handleUnexpected(c, err)
 	}
 	return c.NoContent(http.StatusNoContent)
@@ -168,3 +179,40 @@ func (h *handlers) userTokenDelete(c echo.Context) error {
 	}
 	return c.NoContent(http.StatusNoContent)
 }
+
+// userTokenRotate replaces a token of a current user, keeping the old one valid for an hour.
+func (h *handlers) userTokenRotate(c echo.Context) error {
+	session := CtxGetSession(c.Request().Context())
+	tokenID, err := strconv.ParseInt(c.Param("tokenID"), 10, 64)
+	if err != nil {
+		return EchoError(c, err, http.StatusBadRequest, "Invalid token ID format")
+	}
+	tok, err := session.User.RotateToken(tokenID, time.Hour)
+	if errors.Is(err, users.ErrTokenNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	} else if errors.Is(err, users.ErrScopesExceeded) {
+		return EchoError(c, err, http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return EchoError(c, err, http.StatusBadRequest, err.Error())
+	}
+	return c.String(http.StatusCreated, tok.Value)
+}
+
+func (h *handlers) userSessionDelete(c echo.Context) error {
+	session := CtxGetSession(c.Request().Context())
+	if found, err := session.User.RevokeSession(c.Param("sessionID"), session.User.Username); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to revoke session")
+	} else if !found {
+		return c.NoContent(http.StatusNotFound)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// userSessionDeleteAll logs a user out everywhere, including the session making this request.
+func (h *handlers) userSessionDeleteAll(c echo.Context) error {
+	session := CtxGetSession(c.Request().Context())
+	if err := session.User.RevokeAllSessions(session.User.Username); err != nil {
+		return EchoError(c, err, http.StatusInternalServerError, "Failed to revoke sessions")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
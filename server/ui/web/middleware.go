@@ -4,6 +4,7 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -27,6 +28,8 @@ func (h handlers) requireSession(next echo.HandlerFunc) echo.HandlerFunc {
 		ctx = context.CtxWithLog(ctx, log)
 		ctx = CtxWithSession(ctx, session)
 		c.SetRequest(c.Request().WithContext(ctx))
+		// Let server-wide middlewares, like the audit trail, see who made a request.
+		c.Set("user", session.User)
 		return next(c)
 	}
 }
@@ -43,3 +46,15 @@ func (h handlers) requireScope(scope users.Scopes) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// requireFleetAccess denies users limited to some device tags or groups, for pages which show the whole fleet.
+func (h handlers) requireFleetAccess(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		session := CtxGetSession(c.Request().Context())
+		if !session.User.DeviceFilter().Unrestricted() {
+			err := errors.New("user is limited to some device tags or groups")
+			return h.handleError(c, http.StatusForbidden, err)
+		}
+		return next(c)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"log/slog"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/foundriesio/dg-satellite/storage"
 )
@@ -24,8 +25,10 @@ type (
 	FsHandle = storage.FsHandle
 
 	AppsStates        = storage.AppsStates
+	DeviceFilter      = storage.DeviceFilter
 	DeviceStatus      = storage.DeviceStatus
 	DeviceUpdateEvent = storage.DeviceUpdateEvent
+	LiveEvent         = storage.LiveEvent
 
 	ErrConfigUploadBroken = storage.ErrConfigUploadBroken
 )
@@ -39,6 +42,14 @@ const (
 	OrderByDeviceNameDesc    OrderBy = "name-desc"
 	OrderByDeviceUuidAsc     OrderBy = "uuid-asc"
 	OrderByDeviceUuidDesc    OrderBy = "uuid-desc"
+	OrderByDeviceOnlineAsc   OrderBy = "online-asc"
+	OrderByDeviceOnlineDesc  OrderBy = "online-desc"
+)
+
+// Device connectivity states which a device list can be filtered by.
+const (
+	DeviceStateOnline  = "online"
+	DeviceStateOffline = "offline"
 )
 
 var orderByDeviceMap = map[OrderBy]string{
@@ -51,19 +62,29 @@ var orderByDeviceMap = map[OrderBy]string{
 	OrderByDeviceNameDesc: "name = '', name DESC NULLS LAST, uuid DESC",
 	OrderByDeviceUuidAsc:  "uuid ASC",
 	OrderByDeviceUuidDesc: "uuid DESC",
+	// Within the same state, devices seen most recently come first
+	OrderByDeviceOnlineAsc:  "online ASC, last_seen DESC",
+	OrderByDeviceOnlineDesc: "online DESC, last_seen DESC",
 }
 
+const ValidLabelValueRegex = storage.ValidLabelValueRegex
+
 var (
 	NewDb = storage.NewDb
 	NewFs = storage.NewFs
 
 	DbFile = storage.DbFile
 
+	LiveEventTypes     = storage.LiveEventTypes
 	ValidCorrelationId = storage.ValidCorrelationId
+	ValidLabelValue    = storage.ValidLabelValue
+	ValidGroupName     = storage.ValidGroupName
+	ValidateConfigFile = storage.ValidateConfigFile
 	TestIdRegex        = storage.TestIdRegex
 
 	IsDbError             = storage.IsDbError
 	ErrDbConstraintUnique = storage.ErrDbConstraintUnique
+	ErrInvalidConfig      = storage.ErrInvalidConfig
 	ErrInvalidUpdate      = storage.ErrInvalidUpdate
 )
 
@@ -73,12 +94,23 @@ type DeviceListOpts struct {
 	OrderBy OrderBy `query:"order-by" default:"last-seen-desc"`
 	Limit   int     `query:"limit"    default:"1000"`
 	Offset  int     `query:"offset"   default:"0"`
+	State   string  `query:"state"`
+	// Filter limits devices to those a user is allowed to access; it is not a query parameter.
+	Filter DeviceFilter `swaggerignore:"true"`
+}
+
+type DeviceCount struct {
+	Target string
+	Tag    string
+	Online bool
+	Count  int
 }
 
 type DeviceListItem struct {
 	Uuid      string `json:"uuid"`
 	CreatedAt int64  `json:"created-at"`
 	LastSeen  int64  `json:"last-seen"`
+	Online    bool   `json:"online"`
 	Target    string `json:"target"`
 	Tag       string `json:"tag"`
 	IsProd    bool   `json:"is-prod"`
@@ -92,6 +124,10 @@ type Device struct {
 	OstreeHash string   `json:"ostree-hash"`
 	PubKey     string   `json:"pubkey"`
 	UpdateName string   `json:"update-name"`
+	UpdateTag  string   `json:"update-tag,omitempty"`
+
+	// PollingInterval is in seconds, as reported in aktoml; zero means a device did not report it.
+	PollingInterval int64 `json:"polling-interval,omitempty"`
 
 	Aktoml  string `json:"aktualizr-toml"`
 	HwInfo  string `json:"hardware-info"`
@@ -99,33 +135,61 @@ type Device struct {
 
 	Status *DeviceStatus `json:"status,omitempty"`
 
-	storage Storage
+	ConfigFetch DeviceConfigFetch `json:"config-fetch"`
+
+	// labelsModifiedAt is a latest change of device labels, which select a group config and fill config templates.
+	labelsModifiedAt int64
+	storage          Storage
 }
 
 type Rollout struct {
 	Uuids  []string `json:"uuids,omitempty"`
 	Groups []string `json:"groups,omitempty"`
-	Effect []string `json:"effective-uuids,omitempty"`
-	Commit bool     `json:"committed"`
+	// Tags lists device tags which this rollout applies to; the update tag is used when empty.
+	Tags []string `json:"tags,omitempty"`
+	// Filter limits a rollout to devices which its author is allowed to access.
+	Filter      DeviceFilter        `json:"filter,omitzero"`
+	Effect      []string            `json:"effective-uuids,omitempty"`
+	EffectByTag map[string][]string `json:"effective-uuids-by-tag,omitempty"`
+	Commit      bool                `json:"committed"`
 }
 
 type Storage struct {
 	db *storage.DbHandle
 	fs *storage.FsHandle
 
+	// configsLock serializes read-modify-write updates of configs.
+	configsLock *sync.Mutex
+
 	stmtDeviceCount     stmtDeviceCount
+	stmtDeviceCountBy   stmtDeviceCountBy
 	stmtDeviceDelete    stmtDeviceDelete
 	stmtDeviceGet       stmtDeviceGet
 	stmtDeviceGetGroups stmtDeviceGetGroups
 	stmtDeviceGetLabels stmtDeviceGetLabels
 	stmtDeviceList      map[OrderBy]stmtDeviceList
 	stmtDeviceSetLabels stmtDeviceSetLabels
+	stmtDeviceSetOnline stmtDeviceSetOnline
 	stmtDeviceSetUpdate stmtDeviceSetUpdate
+
+	stmtDeviceGroupUpdates      stmtDeviceGroupUpdates
+	stmtDeviceListConfigStatus  stmtDeviceListConfigStatus
+	stmtDeviceListTagMigrations stmtDeviceListTagMigrations
+	stmtDeviceSetTagTarget      stmtDeviceSetTagTarget
+
+	stmtWebhookCreate stmtWebhookCreate
+	stmtWebhookDelete stmtWebhookDelete
+	stmtWebhookGet    stmtWebhookGet
+	stmtWebhookList   stmtWebhookList
+	stmtWebhookUpdate stmtWebhookUpdate
 }
 
 func (d Device) Delete() error {
 	err1 := d.storage.stmtDeviceDelete.run(d.Uuid)
 	err2 := d.storage.fs.Devices.Delete(d.Uuid)
+	if err1 == nil {
+		d.storage.addWebhookEvent(storage.WebhookEventDeviceDeleted, map[string]any{"uuid": d.Uuid})
+	}
 	return errors.Join(err1, err2)
 }
 
@@ -184,16 +248,27 @@ func (d Device) AppsStates() ([]AppsStates, error) {
 }
 
 func NewStorage(db *storage.DbHandle, fs *storage.FsHandle) (*Storage, error) {
-	handle := Storage{db: db, fs: fs}
+	handle := Storage{db: db, fs: fs, configsLock: &sync.Mutex{}}
 
 	if err := db.InitStmt(
 		&handle.stmtDeviceCount,
+		&handle.stmtDeviceCountBy,
 		&handle.stmtDeviceDelete,
 		&handle.stmtDeviceGet,
 		&handle.stmtDeviceGetGroups,
 		&handle.stmtDeviceGetLabels,
 		&handle.stmtDeviceSetLabels,
+		&handle.stmtDeviceSetOnline,
 		&handle.stmtDeviceSetUpdate,
+		&handle.stmtDeviceGroupUpdates,
+		&handle.stmtDeviceListConfigStatus,
+		&handle.stmtDeviceListTagMigrations,
+		&handle.stmtDeviceSetTagTarget,
+		&handle.stmtWebhookCreate,
+		&handle.stmtWebhookDelete,
+		&handle.stmtWebhookGet,
+		&handle.stmtWebhookList,
+		&handle.stmtWebhookUpdate,
 	); err != nil {
 		return nil, err
 	}
@@ -220,19 +295,39 @@ func (s Storage) DevicesList(opts DeviceListOpts) ([]DeviceListItem, int, error)
 		return nil, 0, fmt.Errorf("invalid order by arg: %s", opts.OrderBy)
 	}
 
-	total, err := s.stmtDeviceCount.run()
+	var online any
+	switch opts.State {
+	case "":
+	case DeviceStateOnline:
+		online = true
+	case DeviceStateOffline:
+		online = false
+	default:
+		return nil, 0, fmt.Errorf("invalid state arg: %s", opts.State)
+	}
+
+	tags, groups, err := deviceFilterArgs(opts.Filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.stmtDeviceCount.run(online, tags, groups)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	devices := make([]DeviceListItem, 0, opts.Limit)
-	if err := stmt.run(opts.Limit, opts.Offset, &devices); err != nil {
+	if err := stmt.run(online, tags, groups, opts.Limit, opts.Offset, &devices); err != nil {
 		return nil, 0, err
 	}
 
 	return devices, total, nil
 }
 
+// CountDevices returns a number of devices per target, tag, and connectivity state.
+func (s Storage) CountDevices() ([]DeviceCount, error) {
+	return s.stmtDeviceCountBy.run()
+}
+
 func (s Storage) DeviceGet(uuid string) (*Device, error) {
 	d := Device{storage: s, DeviceListItem: DeviceListItem{Uuid: uuid}}
 	var (
@@ -242,9 +337,9 @@ func (s Storage) DeviceGet(uuid string) (*Device, error) {
 	)
 	if err := s.stmtDeviceGet.run(
 		uuid,
-		&d.CreatedAt, &d.LastSeen,
-		&d.PubKey, &d.UpdateName, &d.Tag, &d.Target, &d.OstreeHash,
-		&apps, &labels, &d.IsProd,
+		&d.CreatedAt, &d.LastSeen, &d.Online, &d.PollingInterval,
+		&d.PubKey, &d.UpdateName, &d.UpdateTag, &d.Tag, &d.Target, &d.OstreeHash,
+		&apps, &labels, &d.IsProd, &d.labelsModifiedAt, &d.ConfigFetch,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			err = nil
@@ -361,17 +456,44 @@ func (s Storage) CreateRollout(tag, updateName, rolloutName string, isProd bool,
 		return err
 	} else if err := h.AppendJournal(log); err != nil {
 		return err
-	} else {
-		return h.WriteFile(tag, updateName, rolloutName, string(data))
+	} else if err = h.WriteFile(tag, updateName, rolloutName, string(data)); err != nil {
+		return err
 	}
+	s.addWebhookEvent(storage.WebhookEventRolloutCreated, rolloutEventData(tag, updateName, rolloutName, isProd, rollout))
+	return nil
 }
 
 func (s Storage) CommitRollout(tag, updateName, rolloutName string, isProd bool, rollout Rollout) (err error) {
-	if rollout.Effect, err = s.SetUpdateName(tag, updateName, isProd, rollout.Uuids, rollout.Groups); err != nil {
+	deviceTags := rollout.Tags
+	if len(deviceTags) == 0 {
+		deviceTags = []string{tag}
+	}
+	var effectByTag map[string][]string
+	if len(rollout.Tags) > 0 {
+		effectByTag = make(map[string][]string, len(rollout.Tags))
+	}
+	if err = s.stmtDeviceSetUpdate.run(
+		tag, updateName, isProd, deviceTags, rollout.Uuids, rollout.Groups, rollout.Filter, &rollout.Effect, effectByTag,
+	); err != nil {
 		return err
 	} else {
+		rollout.EffectByTag = effectByTag
 		rollout.Commit = true
-		return s.SaveRollout(tag, updateName, rolloutName, isProd, rollout)
+		if err = s.SaveRollout(tag, updateName, rolloutName, isProd, rollout); err == nil {
+			s.addWebhookEvent(storage.WebhookEventRolloutCommitted,
+				rolloutEventData(tag, updateName, rolloutName, isProd, rollout))
+		}
+		return err
+	}
+}
+
+func rolloutEventData(tag, updateName, rolloutName string, isProd bool, rollout Rollout) map[string]any {
+	return map[string]any{
+		"tag":     tag,
+		"update":  updateName,
+		"rollout": rolloutName,
+		"is-prod": isProd,
+		"details": rollout,
 	}
 }
 
@@ -415,11 +537,23 @@ func (s Storage) PatchDeviceLabels(labels map[string]*string, uuids []string) er
 	return s.stmtDeviceSetLabels.run(labels, uuids)
 }
 
-func (s Storage) SetUpdateName(tag, updateName string, isProd bool, uuids, groups []string) (effectiveUuids []string, err error) {
-	err = s.stmtDeviceSetUpdate.run(tag, updateName, isProd, uuids, groups, &effectiveUuids)
+// SetUpdateName assigns an update to given devices and devices in given groups, which pass a filter.
+func (s Storage) SetUpdateName(
+	tag, updateName string, isProd bool, uuids, groups []string, filter DeviceFilter,
+) (effectiveUuids []string, err error) {
+	err = s.stmtDeviceSetUpdate.run(tag, updateName, isProd, []string{tag}, uuids, groups, filter, &effectiveUuids, nil)
 	return
 }
 
+// CheckUpdateTags verifies that an update has targets for each of the given device tags.
+func (s Storage) CheckUpdateTags(tag, updateName string, isProd bool, deviceTags []string) error {
+	if isProd {
+		return s.fs.Updates.Prod.CheckTargetsTags(tag, updateName, deviceTags)
+	} else {
+		return s.fs.Updates.Ci.CheckTargetsTags(tag, updateName, deviceTags)
+	}
+}
+
 func (s Storage) TailRolloutsLog(tag, updateName string, isProd bool, stop storage.DoneChan) iter.Seq2[string, error] {
 	fs := s.fs.Updates.Ci.Logs
 	if isProd {
@@ -429,7 +563,9 @@ func (s Storage) TailRolloutsLog(tag, updateName string, isProd bool, stop stora
 }
 
 func (s Storage) UploadConfigs(payload io.Reader) (err error) {
-	return s.fs.Configs.SaveUpload(payload, func(cleanupErr error) {
+	s.configsLock.Lock()
+	defer s.configsLock.Unlock()
+	return s.fs.Configs.SaveUpload(payload, s.validateConfigsUpload, func(cleanupErr error) {
 		// This is not critical - log and let the "real" error/success return below.
 		slog.Error("Failed to clean upload directory", "error", cleanupErr)
 	})
@@ -440,11 +576,17 @@ func (s Storage) CreateUpdate(tag, updateName string, isProd bool, payload io.Re
 		// This is not critical - log and let the "real" error/success return below.
 		slog.Error("Failed to clean upload directory", "error", cleanupErr)
 	}
+	var err error
 	if isProd {
-		return s.fs.Updates.Prod.SaveUpload(tag, updateName, payload, cleanup)
+		err = s.fs.Updates.Prod.SaveUpload(tag, updateName, payload, cleanup)
 	} else {
-		return s.fs.Updates.Ci.SaveUpload(tag, updateName, payload, cleanup)
+		err = s.fs.Updates.Ci.SaveUpload(tag, updateName, payload, cleanup)
 	}
+	if err == nil {
+		s.addWebhookEvent(storage.WebhookEventUpdateUploaded,
+			map[string]any{"tag": tag, "update": updateName, "is-prod": isProd})
+	}
+	return err
 }
 
 func (s Storage) getRolloutsFsHandle(isProd bool) storage.RolloutsFsHandle {
@@ -460,7 +602,8 @@ type stmtDeviceGet storage.DbStmt
 func (s *stmtDeviceGet) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("apiDeviceGet", `
 		SELECT
-			created_at, last_seen, pubkey, update_name, tag, target_name, ostree_hash, apps, json(labels), is_prod
+			created_at, last_seen, online, polling_interval, pubkey, update_name, update_tag, tag, target_name, ostree_hash, apps, json(labels),
+			is_prod, MAX(group_name_modified_at, labels_modified_at), config_timestamp, config_hash, config_fetched_at, config_checked_at
 		FROM devices
 		WHERE uuid = ? AND deleted=false`,
 	)
@@ -469,12 +612,16 @@ func (s *stmtDeviceGet) Init(db storage.DbHandle) (err error) {
 
 func (s *stmtDeviceGet) run(
 	uuid string,
-	createdAt, lastSeen *int64,
-	pubkey, updateName, tag, targetName, ostreeHash, apps, labels *string,
+	createdAt, lastSeen *int64, online *bool, pollingInterval *int64,
+	pubkey, updateName, updateTag, tag, targetName, ostreeHash, apps, labels *string,
 	isProd *bool,
+	labelsModifiedAt *int64,
+	configFetch *DeviceConfigFetch,
 ) error {
 	return s.Stmt.QueryRow(uuid).Scan(
-		createdAt, lastSeen, pubkey, updateName, tag, targetName, ostreeHash, apps, labels, isProd)
+		createdAt, lastSeen, online, pollingInterval, pubkey, updateName, updateTag, tag, targetName, ostreeHash, apps, labels, isProd,
+		labelsModifiedAt,
+		&configFetch.Timestamp, &configFetch.Hash, &configFetch.FetchedAt, &configFetch.CheckedAt)
 }
 
 type stmtDeviceList storage.DbStmt
@@ -482,16 +629,20 @@ type stmtDeviceList storage.DbStmt
 func (s *stmtDeviceList) Init(db storage.DbHandle, orderBy string) (err error) {
 	s.Stmt, err = db.Prepare("apiDeviceList", fmt.Sprintf(`
 		SELECT
-			uuid, created_at, last_seen, target_name, tag, is_prod, json(labels)
+			uuid, created_at, last_seen, online, target_name, tag, is_prod, json(labels)
 		FROM devices
-		WHERE deleted=false
-		ORDER BY %s LIMIT ? OFFSET ?`, orderBy),
+		WHERE deleted=false AND (?1 IS NULL OR online = ?1)
+			AND (?2 IS NULL OR tag IN (SELECT value FROM json_each(?2)))
+			AND (?3 IS NULL OR group_name IN (SELECT value FROM json_each(?3)))
+		ORDER BY %s LIMIT ?4 OFFSET ?5`, orderBy),
 	)
 	return
 }
 
-func (s *stmtDeviceList) run(limit, offset int, dl *[]DeviceListItem) error {
-	if rows, err := s.Stmt.Query(limit, offset); err != nil {
+// run lists devices, only those in a given connectivity state unless online is nil,
+// and only those on given tags and in given groups unless they are nil.
+func (s *stmtDeviceList) run(online, tags, groups any, limit, offset int, dl *[]DeviceListItem) error {
+	if rows, err := s.Stmt.Query(online, tags, groups, limit, offset); err != nil {
 		return err
 	} else {
 		defer func() {
@@ -505,7 +656,7 @@ func (s *stmtDeviceList) run(limit, offset int, dl *[]DeviceListItem) error {
 				labels []byte
 			)
 			if err = rows.Scan(
-				&d.Uuid, &d.CreatedAt, &d.LastSeen, &d.Target, &d.Tag, &d.IsProd, &labels,
+				&d.Uuid, &d.CreatedAt, &d.LastSeen, &d.Online, &d.Target, &d.Tag, &d.IsProd, &labels,
 			); err != nil {
 				return err
 			}
@@ -521,17 +672,67 @@ func (s *stmtDeviceList) run(limit, offset int, dl *[]DeviceListItem) error {
 	return nil
 }
 
+// deviceFilterArgs returns SQL arguments for tags and groups of a device filter; a NULL argument does not limit devices.
+func deviceFilterArgs(filter DeviceFilter) (tags, groups any, err error) {
+	if len(filter.Tags) > 0 {
+		if tags, err = json.Marshal(filter.Tags); err != nil {
+			return nil, nil, fmt.Errorf("unexpected error marshalling tags to JSON: %w", err)
+		}
+	}
+	if len(filter.Groups) > 0 {
+		if groups, err = json.Marshal(filter.Groups); err != nil {
+			return nil, nil, fmt.Errorf("unexpected error marshalling groups to JSON: %w", err)
+		}
+	}
+	return
+}
+
 type stmtDeviceCount storage.DbStmt
 
 func (s *stmtDeviceCount) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("apiDeviceCount", `
-		SELECT COUNT(*) FROM devices WHERE deleted=false`,
+		SELECT COUNT(*) FROM devices
+		WHERE deleted=false AND (?1 IS NULL OR online = ?1)
+			AND (?2 IS NULL OR tag IN (SELECT value FROM json_each(?2)))
+			AND (?3 IS NULL OR group_name IN (SELECT value FROM json_each(?3)))`,
 	)
 	return
 }
 
-func (s *stmtDeviceCount) run() (count int, err error) {
-	err = s.Stmt.QueryRow().Scan(&count)
+func (s *stmtDeviceCount) run(online, tags, groups any) (count int, err error) {
+	err = s.Stmt.QueryRow(online, tags, groups).Scan(&count)
+	return
+}
+
+type stmtDeviceCountBy storage.DbStmt
+
+func (s *stmtDeviceCountBy) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiDeviceCountBy", `
+		SELECT target_name, tag, online, COUNT(*) FROM devices
+		WHERE deleted=false
+		GROUP BY 1, 2, 3`,
+	)
+	return
+}
+
+func (s *stmtDeviceCountBy) run() (counts []DeviceCount, err error) {
+	rows, err := s.Stmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows in stmtDeviceCountBy", "error", err)
+		}
+	}()
+	for rows.Next() {
+		var c DeviceCount
+		if err = rows.Scan(&c.Target, &c.Tag, &c.Online, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	err = rows.Err()
 	return
 }
 
@@ -597,17 +798,27 @@ type stmtDeviceSetUpdate storage.DbStmt
 func (s *stmtDeviceSetUpdate) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("apiDeviceSetUpdateName", `
 		UPDATE devices
-		SET update_name=?
-		WHERE tag=? AND is_prod=? AND (
+		SET update_name=?, update_tag=?
+		WHERE tag IN (SELECT value from json_each(?)) AND is_prod=? AND (
 			uuid IN (SELECT value from json_each(?))
 			OR
 			group_name IN (SELECT value from json_each(?))
-		) RETURNING uuid`,
+		)
+		AND (?7 IS NULL OR tag IN (SELECT value FROM json_each(?7)))
+		AND (?8 IS NULL OR group_name IN (SELECT value FROM json_each(?8)))
+		RETURNING uuid, tag`,
 	)
 	return
 }
 
-func (s *stmtDeviceSetUpdate) run(tag, updateName string, isProd bool, uuids, groups []string, effectiveUuids *[]string) error {
+func (s *stmtDeviceSetUpdate) run(
+	tag, updateName string, isProd bool, deviceTags, uuids, groups []string, filter DeviceFilter,
+	effectiveUuids *[]string, effectByTag map[string][]string,
+) error {
+	tagsStr, err := json.Marshal(deviceTags)
+	if err != nil {
+		return fmt.Errorf("unexpected error marshalling tags to JSON: %w", err)
+	}
 	uuidsStr, err := json.Marshal(uuids)
 	if err != nil {
 		return fmt.Errorf("unexpected error marshalling UUIDs to JSON: %w", err)
@@ -616,15 +827,22 @@ func (s *stmtDeviceSetUpdate) run(tag, updateName string, isProd bool, uuids, gr
 	if err != nil {
 		return fmt.Errorf("unexpected error marshalling groups to JSON: %w", err)
 	}
-	if rows, err := s.Stmt.Query(updateName, tag, isProd, uuidsStr, groupsStr); err != nil {
+	filterTags, filterGroups, err := deviceFilterArgs(filter)
+	if err != nil {
+		return err
+	}
+	if rows, err := s.Stmt.Query(updateName, tag, tagsStr, isProd, uuidsStr, groupsStr, filterTags, filterGroups); err != nil {
 		return err
 	} else {
-		var resUuid string
+		var resUuid, resTag string
 		for rows.Next() {
-			if err = rows.Scan(&resUuid); err != nil {
+			if err = rows.Scan(&resUuid, &resTag); err != nil {
 				return err
 			}
 			*effectiveUuids = append(*effectiveUuids, resUuid)
+			if effectByTag != nil {
+				effectByTag[resTag] = append(effectByTag[resTag], resUuid)
+			}
 		}
 		if err = rows.Err(); err != nil {
 			return err
@@ -645,3 +863,8 @@ func (s *stmtDeviceDelete) run(uuid string) error {
 	_, err := s.Stmt.Exec(uuid)
 	return err
 }
+
+// SubscribeEvents returns a channel of live device events matching a filter, see EventBus.Subscribe.
+func (s Storage) SubscribeEvents(lastId uint64, filter func(LiveEvent) bool) (<-chan LiveEvent, func()) {
+	return s.fs.Events.Subscribe(lastId, filter)
+}
@@ -0,0 +1,174 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+type AppsReq struct {
+	Apps []string `json:"apps"`
+}
+
+// DeviceApps compares compose apps a device should run with compose apps it reports running.
+type DeviceApps struct {
+	// Configured is false when compose_apps is not set, and a device runs all apps available in its target.
+	Configured bool     `json:"configured"`
+	Enabled    []string `json:"enabled"`
+	Reported   []string `json:"reported"`
+	Available  []string `json:"available"`
+	// Missing apps are enabled but not reported by a device; unexpected apps are reported but not enabled.
+	Missing    []string `json:"missing"`
+	Unexpected []string `json:"unexpected"`
+}
+
+func (a DeviceApps) InSync() bool {
+	return len(a.Missing) == 0 && len(a.Unexpected) == 0
+}
+
+// AvailableApps returns compose apps contained in the update assigned to a device.
+// It returns nil when a device has no update assigned.
+func (d Device) AvailableApps() ([]string, error) {
+	if len(d.UpdateName) == 0 {
+		return nil, nil
+	}
+	return d.storage.listUpdateApps(d.UpdateTag, d.UpdateName, d.Tag, d.IsProd)
+}
+
+// ComposeApps returns enabled, reported, and available compose apps for a device.
+func (d Device) ComposeApps() (res DeviceApps, err error) {
+	if res.Available, err = d.AvailableApps(); err != nil {
+		return
+	}
+	sotaCfg, err := d.sotaConfig()
+	if err != nil {
+		return
+	}
+	if value, ok := sotaCfg["pacman"]["compose_apps"]; ok {
+		res.Configured = true
+		res.Enabled = parseComposeApps(value)
+	} else {
+		res.Enabled = res.Available
+	}
+	res.Reported = d.Apps
+	for _, app := range res.Enabled {
+		if !slices.Contains(res.Reported, app) {
+			res.Missing = append(res.Missing, app)
+		}
+	}
+	for _, app := range res.Reported {
+		if !slices.Contains(res.Enabled, app) {
+			res.Unexpected = append(res.Unexpected, app)
+		}
+	}
+	return
+}
+
+// SetDeviceApps sets compose apps a device should run via its sota toml override config.
+func (s Storage) SetDeviceApps(uuid string, apps []string) error {
+	return s.updateSotaValue(DeviceConfigScope(uuid), "compose_apps", strings.Join(apps, ","))
+}
+
+// SetGroupApps sets compose apps devices in a group should run via the group sota toml override config.
+func (s Storage) SetGroupApps(group string, apps []string) error {
+	return s.updateSotaValue(GroupConfigScope(group), "compose_apps", strings.Join(apps, ","))
+}
+
+// GroupAvailableApps returns compose apps contained in any update assigned to devices in a group.
+// It returns nil when no device in a group has an update assigned.
+func (s Storage) GroupAvailableApps(group string) (res []string, err error) {
+	updates, err := s.stmtDeviceGroupUpdates.run(group)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range updates {
+		apps, err := s.listUpdateApps(u.updateTag, u.updateName, u.tag, u.isProd)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			res = []string{}
+		}
+		for _, app := range apps {
+			if !slices.Contains(res, app) {
+				res = append(res, app)
+			}
+		}
+	}
+	slices.Sort(res)
+	return
+}
+
+func (s Storage) listUpdateApps(updateTag, updateName, deviceTag string, isProd bool) ([]string, error) {
+	if len(updateTag) == 0 {
+		updateTag = deviceTag
+	}
+	h := s.fs.Updates.Ci
+	if isProd {
+		h = s.fs.Updates.Prod
+	}
+	return h.ListTargetsApps(updateTag, updateName, deviceTag)
+}
+
+// parseComposeApps accepts both a comma separated string (which aktualizr-lite uses) and a TOML array.
+func parseComposeApps(value any) []string {
+	var apps []string
+	add := func(app string) {
+		if app = strings.TrimSpace(app); len(app) > 0 {
+			apps = append(apps, app)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		for app := range strings.SplitSeq(v, ",") {
+			add(app)
+		}
+	case []any:
+		for _, app := range v {
+			add(fmt.Sprint(app))
+		}
+	}
+	return apps
+}
+
+type deviceGroupUpdate struct {
+	updateTag, updateName, tag string
+	isProd                     bool
+}
+
+type stmtDeviceGroupUpdates storage.DbStmt
+
+func (s *stmtDeviceGroupUpdates) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiDeviceGroupUpdates", `
+		SELECT DISTINCT update_tag, update_name, tag, is_prod
+		FROM devices
+		WHERE deleted=false AND group_name=? AND update_name != ""`,
+	)
+	return
+}
+
+func (s *stmtDeviceGroupUpdates) run(group string) (res []deviceGroupUpdate, err error) {
+	rows, err := s.Stmt.Query(group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows in device group updates", "error", err)
+		}
+	}()
+	for rows.Next() {
+		var u deviceGroupUpdate
+		if err = rows.Scan(&u.updateTag, &u.updateName, &u.tag, &u.isProd); err != nil {
+			return nil, err
+		}
+		res = append(res, u)
+	}
+	return res, rows.Err()
+}
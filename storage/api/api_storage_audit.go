@@ -0,0 +1,89 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"iter"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+type AuditEntry = storage.AuditEntry
+
+// Outcomes which audit entries can be filtered by.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditFilter selects audit entries; empty fields match any entry.
+type AuditFilter struct {
+	Actor    string
+	Method   string
+	Resource string // A prefix of a resource path
+	Outcome  string
+	Since    int64
+	Until    int64
+}
+
+func (f AuditFilter) Match(e AuditEntry) bool {
+	switch {
+	case len(f.Actor) > 0 && e.Actor != f.Actor:
+		return false
+	case len(f.Method) > 0 && !strings.EqualFold(e.Method, f.Method):
+		return false
+	case len(f.Resource) > 0 && !strings.HasPrefix(e.Resource, f.Resource):
+		return false
+	case f.Outcome == AuditOutcomeSuccess && !e.Success:
+		return false
+	case f.Outcome == AuditOutcomeFailure && e.Success:
+		return false
+	case f.Since > 0 && e.Timestamp < f.Since:
+		return false
+	case f.Until > 0 && e.Timestamp > f.Until:
+		return false
+	}
+	return true
+}
+
+// AddAuditEntry appends an entry to the audit trail; a failure is logged, as an audited call is already done.
+func (s Storage) AddAuditEntry(entry AuditEntry) {
+	if err := s.fs.Audit.AppendEntry(entry); err != nil {
+		slog.Error("Failed to append audit entry", "entry", entry, "error", err)
+	}
+}
+
+// ListAuditEntries returns up to limit latest audit entries matching a filter, newest first.
+func (s Storage) ListAuditEntries(filter AuditFilter, limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for entry, err := range s.ExportAuditEntries(filter) {
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 && len(entries) == limit {
+			entries = append(entries[:0], entries[1:]...)
+		}
+		entries = append(entries, entry)
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// ExportAuditEntries iterates over all audit entries matching a filter, oldest first.
+func (s Storage) ExportAuditEntries(filter AuditFilter) iter.Seq2[AuditEntry, error] {
+	return func(yield func(AuditEntry, error) bool) {
+		for entry, err := range s.fs.Audit.ReadEntries(filter.Since, filter.Until) {
+			if err != nil {
+				yield(entry, err)
+				return
+			}
+			if filter.Match(entry) && !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"log/slog"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+const (
+	// ConfigStatusNone means that no configs apply to a device.
+	ConfigStatusNone = "none"
+	// ConfigStatusPending means that a device did not fetch its latest config yet.
+	ConfigStatusPending = "pending"
+	// ConfigStatusApplied means that a device fetched its latest config.
+	ConfigStatusApplied = "applied"
+)
+
+// DeviceConfigFetch tells which config a device received with its last config fetch,
+// and when the device last found its config unchanged.
+type DeviceConfigFetch struct {
+	Timestamp int64  `json:"timestamp"`
+	Hash      string `json:"hash"`
+	FetchedAt int64  `json:"fetched-at"`
+	CheckedAt int64  `json:"checked-at"`
+}
+
+// Status compares a config a device has to a latest config modification time.
+func (f DeviceConfigFetch) Status(latest int64) string {
+	if latest == 0 {
+		return ConfigStatusNone
+	}
+	// A device which found its config unchanged after the latest modification has it, even if fetched it earlier.
+	// This also covers devices which fetched their config before the server started tracking config fetches.
+	if f.Timestamp >= latest || f.CheckedAt > latest {
+		return ConfigStatusApplied
+	}
+	return ConfigStatusPending
+}
+
+// DeviceConfigStatus tells if a device fetched its latest config.
+type DeviceConfigStatus struct {
+	Uuid      string `json:"uuid"`
+	Name      string `json:"name"`
+	GroupName string `json:"group"`
+	LastSeen  int64  `json:"last-seen"`
+	Status    string `json:"status"`
+	// Timestamp is a modification time of the latest config which a device receives.
+	Timestamp int64             `json:"timestamp"`
+	Fetch     DeviceConfigFetch `json:"fetch"`
+}
+
+// ConfigPropagation is a report of how many devices fetched their latest config.
+type ConfigPropagation struct {
+	Applied int                  `json:"applied"`
+	Pending int                  `json:"pending"`
+	Devices []DeviceConfigStatus `json:"devices"`
+}
+
+// GetConfigPropagation reports which devices fetched their latest config.
+// When a group is not empty, only devices in that group are reported.
+func (s Storage) GetConfigPropagation(group string) (*ConfigPropagation, error) {
+	timestamps, err := s.fs.Configs.ReadConfigTimestamps()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.stmtDeviceListConfigStatus.run(group, timestamps)
+	if err != nil {
+		return nil, err
+	}
+	res := ConfigPropagation{Devices: devices}
+	if res.Devices == nil {
+		res.Devices = []DeviceConfigStatus{}
+	}
+	for _, d := range res.Devices {
+		switch d.Status {
+		case ConfigStatusApplied:
+			res.Applied++
+		case ConfigStatusPending:
+			res.Pending++
+		}
+	}
+	return &res, nil
+}
+
+type stmtDeviceListConfigStatus storage.DbStmt
+
+func (s *stmtDeviceListConfigStatus) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiDeviceListConfigStatus", `
+		SELECT
+			uuid, name, group_name, last_seen, MAX(group_name_modified_at, labels_modified_at),
+			config_timestamp, config_hash, config_fetched_at, config_checked_at
+		FROM devices
+		WHERE deleted=false AND (?1 = "" OR group_name = ?1)
+		ORDER BY uuid`,
+	)
+	return
+}
+
+func (s *stmtDeviceListConfigStatus) run(
+	group string, timestamps storage.ConfigTimestamps,
+) (res []DeviceConfigStatus, err error) {
+	rows, err := s.Stmt.Query(group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows in device config status list", "error", err)
+		}
+	}()
+	for rows.Next() {
+		var (
+			d                DeviceConfigStatus
+			labelsModifiedAt int64
+		)
+		if err = rows.Scan(
+			&d.Uuid, &d.Name, &d.GroupName, &d.LastSeen, &labelsModifiedAt,
+			&d.Fetch.Timestamp, &d.Fetch.Hash, &d.Fetch.FetchedAt, &d.Fetch.CheckedAt,
+		); err != nil {
+			return nil, err
+		}
+		d.Timestamp = max(timestamps.Device(d.Uuid, d.GroupName), labelsModifiedAt)
+		d.Status = d.Fetch.Status(d.Timestamp)
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
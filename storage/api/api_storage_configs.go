@@ -0,0 +1,427 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+type ConfigFile = storage.ConfigFile
+
+var (
+	ErrConfigFileNotFound    = errors.New("config file not found")
+	ErrConfigVersionNotFound = errors.New("config version not found")
+)
+
+// ConfigScope selects one of configs layers: factory, group, or device.
+type ConfigScope struct {
+	Type string
+	Name string
+}
+
+var FactoryConfigScope = ConfigScope{Type: storage.ConfigsFactoryDir}
+
+func GroupConfigScope(name string) ConfigScope {
+	return ConfigScope{Type: storage.ConfigsGroupDir, Name: name}
+}
+
+func DeviceConfigScope(uuid string) ConfigScope {
+	return ConfigScope{Type: storage.ConfigsDeviceDir, Name: uuid}
+}
+
+func (c ConfigScope) String() string {
+	if c.Type == storage.ConfigsFactoryDir {
+		return c.Type
+	}
+	return c.Type + "/" + c.Name
+}
+
+type ConfigVersion struct {
+	Hash      string                `json:"hash,omitempty"`
+	Timestamp int64                 `json:"timestamp,omitempty"`
+	Files     map[string]ConfigFile `json:"files"`
+}
+
+type ConfigRollbackReq struct {
+	Hash string `json:"hash"`
+}
+
+// GetConfig returns the latest config version; it has no hash when a config was never set.
+func (s Storage) GetConfig(scope ConfigScope) (res ConfigVersion, err error) {
+	var versions []storage.ConfigVersion
+	if versions, err = s.readConfigVersions(scope, 1); err != nil {
+		return
+	} else if len(versions) == 0 {
+		res.Files = map[string]ConfigFile{}
+		return
+	}
+	return parseConfigVersion(versions[0])
+}
+
+// GetConfigHistory returns up to limit latest config versions, the latest version first.
+func (s Storage) GetConfigHistory(scope ConfigScope, limit int) ([]ConfigVersion, error) {
+	versions, err := s.readConfigVersions(scope, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ConfigVersion, 0, len(versions))
+	for _, v := range versions {
+		if cfg, err := parseConfigVersion(v); err != nil {
+			return nil, err
+		} else {
+			res = append(res, cfg)
+		}
+	}
+	return res, nil
+}
+
+// SetConfig replaces all config files.
+func (s Storage) SetConfig(scope ConfigScope, files map[string]ConfigFile) error {
+	return s.updateConfig(scope, func(current map[string]*ConfigFile) error {
+		clear(current)
+		for name, file := range files {
+			current[name] = &file
+		}
+		return nil
+	})
+}
+
+// SetConfigFile adds or replaces a single config file.
+func (s Storage) SetConfigFile(scope ConfigScope, name string, file ConfigFile) error {
+	return s.updateConfig(scope, func(files map[string]*ConfigFile) error {
+		files[name] = &file
+		return nil
+	})
+}
+
+// DeleteConfigFile removes a single config file.
+func (s Storage) DeleteConfigFile(scope ConfigScope, name string) error {
+	return s.updateConfig(scope, func(files map[string]*ConfigFile) error {
+		if _, ok := files[name]; !ok {
+			return ErrConfigFileNotFound
+		}
+		delete(files, name)
+		return nil
+	})
+}
+
+// RollbackConfig makes one of previous config versions the latest config version.
+// Only config versions not yet purged from disk can be restored.
+func (s Storage) RollbackConfig(scope ConfigScope, hash string) error {
+	s.configsLock.Lock()
+	defer s.configsLock.Unlock()
+	versions, err := s.readConfigVersions(scope, math.MaxInt)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if v.Hash == hash {
+			return s.writeConfig(scope, v.Content)
+		}
+	}
+	return ErrConfigVersionNotFound
+}
+
+// PurgeConfigHistory removes all but keepLatest config versions from disk.
+func (s Storage) PurgeConfigHistory(scope ConfigScope, keepLatest int) error {
+	s.configsLock.Lock()
+	defer s.configsLock.Unlock()
+	switch scope.Type {
+	case storage.ConfigsFactoryDir:
+		return s.fs.Configs.PurgeFactoryConfigHistory(keepLatest)
+	case storage.ConfigsGroupDir:
+		return s.fs.Configs.PurgeGroupConfigHistory(scope.Name, keepLatest)
+	default:
+		return s.fs.Configs.PurgeDeviceConfigHistory(scope.Name, keepLatest)
+	}
+}
+
+// ConfigScopeDiff lists config files which a configs upload changes in a single config scope.
+type ConfigScopeDiff struct {
+	Scope   string             `json:"scope"`
+	Changes []ConfigFileChange `json:"changes"`
+}
+
+var errConfigsDryRun = errors.New("configs upload dry run")
+
+// DiffConfigsUpload validates configs from a tarball the same way as UploadConfigs does, but does not save them.
+// Instead, it returns changes which the upload would make to the latest config of each scope.
+func (s Storage) DiffConfigsUpload(payload io.Reader) (diff []ConfigScopeDiff, err error) {
+	s.configsLock.Lock()
+	defer s.configsLock.Unlock()
+	err = s.fs.Configs.SaveUpload(payload, func(upload storage.ConfigsFsHandle) (err error) {
+		if err = s.validateConfigsUpload(upload); err != nil {
+			return
+		} else if diff, err = diffConfigs(s.fs.Configs, upload); err != nil {
+			return
+		}
+		return errConfigsDryRun
+	}, func(cleanupErr error) {
+		slog.Error("Failed to clean upload directory", "error", cleanupErr)
+	})
+	if errors.Is(err, errConfigsDryRun) {
+		err = nil
+	}
+	return
+}
+
+// validateConfigsUpload verifies those parts of uploaded configs which depend on the database.
+func (s Storage) validateConfigsUpload(upload storage.ConfigsFsHandle) error {
+	uuids, err := upload.ListDevices()
+	if err != nil {
+		return fmt.Errorf("failed to list uploaded device configs: %w", err)
+	}
+	for _, uuid := range uuids {
+		if device, err := s.DeviceGet(uuid); err != nil {
+			return err
+		} else if device == nil {
+			return fmt.Errorf("%w: device '%s' does not exist", ErrInvalidConfig, uuid)
+		}
+	}
+	return nil
+}
+
+func diffConfigs(current, upload storage.ConfigsFsHandle) ([]ConfigScopeDiff, error) {
+	scopes := []ConfigScope{FactoryConfigScope}
+	for _, h := range []storage.ConfigsFsHandle{current, upload} {
+		if groups, err := h.ListGroups(); err != nil {
+			return nil, fmt.Errorf("failed to list group configs: %w", err)
+		} else {
+			for _, group := range groups {
+				scopes = append(scopes, GroupConfigScope(group))
+			}
+		}
+		if uuids, err := h.ListDevices(); err != nil {
+			return nil, fmt.Errorf("failed to list device configs: %w", err)
+		} else {
+			for _, uuid := range uuids {
+				scopes = append(scopes, DeviceConfigScope(uuid))
+			}
+		}
+	}
+	slices.SortFunc(scopes, func(a, b ConfigScope) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	scopes = slices.Compact(scopes)
+
+	diff := []ConfigScopeDiff{}
+	for _, scope := range scopes {
+		before, err := readConfigFilesFrom(current, scope)
+		if err != nil {
+			return nil, err
+		}
+		after, err := readConfigFilesFrom(upload, scope)
+		if err != nil {
+			return nil, err
+		}
+		if changes := diffConfigFiles(before, after); len(changes) > 0 {
+			diff = append(diff, ConfigScopeDiff{Scope: scope.String(), Changes: changes})
+		}
+	}
+	return diff, nil
+}
+
+func readConfigFilesFrom(h storage.ConfigsFsHandle, scope ConfigScope) (map[string]ConfigFile, error) {
+	files := map[string]ConfigFile{}
+	if content, err := readConfigFrom(h, scope); err != nil {
+		return nil, err
+	} else if len(content) > 0 {
+		if err = json.Unmarshal([]byte(content), &files); err != nil {
+			return nil, fmt.Errorf("failed to parse %s config JSON: %w", scope, err)
+		}
+	}
+	return files, nil
+}
+
+func diffConfigFiles(before, after map[string]ConfigFile) []ConfigFileChange {
+	var changes []ConfigFileChange
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		if file, ok := before[name]; !ok {
+			changes = append(changes, ConfigFileChange{Name: name, Change: ConfigFileAdded})
+		} else if file.Template != after[name].Template ||
+			!storage.NewConfigFileDigest(file).Equal(storage.NewConfigFileDigest(after[name])) {
+			changes = append(changes, ConfigFileChange{Name: name, Change: ConfigFileModified})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(before)) {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, ConfigFileChange{Name: name, Change: ConfigFileRemoved})
+		}
+	}
+	return changes
+}
+
+// updateConfig applies a modification to the latest config version, and saves it as a new version if changed.
+func (s Storage) updateConfig(scope ConfigScope, update func(map[string]*ConfigFile) error) error {
+	s.configsLock.Lock()
+	defer s.configsLock.Unlock()
+	content, err := s.readConfig(scope)
+	if err != nil {
+		return err
+	}
+	files := make(map[string]*ConfigFile)
+	if len(content) > 0 {
+		if err = json.Unmarshal([]byte(content), &files); err != nil {
+			return fmt.Errorf("failed to parse %s config JSON: %w", scope, err)
+		}
+	}
+	if err = update(files); err != nil {
+		return err
+	}
+	if data, err := json.Marshal(files); err != nil {
+		return fmt.Errorf("unexpected error marshalling %s config to JSON: %w", scope, err)
+	} else if string(data) == content {
+		return nil
+	} else {
+		return s.writeConfig(scope, string(data))
+	}
+}
+
+func (s Storage) readConfig(scope ConfigScope) (content string, err error) {
+	return readConfigFrom(s.fs.Configs, scope)
+}
+
+func readConfigFrom(h storage.ConfigsFsHandle, scope ConfigScope) (content string, err error) {
+	switch scope.Type {
+	case storage.ConfigsFactoryDir:
+		content, _, err = h.ReadFactoryConfig()
+	case storage.ConfigsGroupDir:
+		content, _, err = h.ReadGroupConfig(scope.Name)
+	default:
+		content, _, err = h.ReadDeviceConfig(scope.Name)
+	}
+	return
+}
+
+func (s Storage) readConfigVersions(scope ConfigScope, latest int) ([]storage.ConfigVersion, error) {
+	switch scope.Type {
+	case storage.ConfigsFactoryDir:
+		return s.fs.Configs.ReadFactoryConfigVersions(latest)
+	case storage.ConfigsGroupDir:
+		return s.fs.Configs.ReadGroupConfigVersions(scope.Name, latest)
+	default:
+		return s.fs.Configs.ReadDeviceConfigVersions(scope.Name, latest)
+	}
+}
+
+func (s Storage) writeConfig(scope ConfigScope, content string) error {
+	switch scope.Type {
+	case storage.ConfigsFactoryDir:
+		return s.fs.Configs.WriteFactoryConfig(content)
+	case storage.ConfigsGroupDir:
+		return s.fs.Configs.WriteGroupConfig(scope.Name, content)
+	default:
+		return s.fs.Configs.WriteDeviceConfig(scope.Name, content)
+	}
+}
+
+func parseConfigVersion(v storage.ConfigVersion) (res ConfigVersion, err error) {
+	res.Hash = v.Hash
+	res.Timestamp = v.Timestamp
+	res.Files = map[string]ConfigFile{}
+	if len(v.Content) > 0 {
+		if err = json.Unmarshal([]byte(v.Content), &res.Files); err != nil {
+			err = fmt.Errorf("failed to parse config version %s: %w", v.Hash, err)
+		}
+	}
+	return
+}
+
+// EffectiveConfigFile is a config file which a device receives, annotated with config layers defining it.
+// Usually the last layer wins; but the sota toml override file is merged from all layers.
+type EffectiveConfigFile struct {
+	ConfigFile
+	Layers []string `json:"layers"`
+}
+
+const (
+	ConfigFileAdded    = "added"
+	ConfigFileModified = "modified"
+	ConfigFileRemoved  = "removed"
+)
+
+type ConfigFileChange struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+// EffectiveConfig is a config which a device receives on its next fetch,
+// compared to a config the device fetched last time.
+type EffectiveConfig struct {
+	Timestamp int64                          `json:"timestamp"`
+	Files     map[string]EffectiveConfigFile `json:"files"`
+	// Status tells if a device fetched this config: applied, pending, or none when no configs apply to it.
+	Status string `json:"status"`
+	// Fetched is nil when a device never fetched its config.
+	Fetched *storage.ConfigFetched `json:"fetched"`
+	// Changes lists config files which differ from those a device fetched.
+	Changes []ConfigFileChange `json:"changes"`
+}
+
+func (c EffectiveConfig) Pending() bool {
+	return len(c.Changes) > 0
+}
+
+// EffectiveConfig runs the same config merge as the device gateway does when a device fetches its config.
+func (d Device) EffectiveConfig() (*EffectiveConfig, error) {
+	files, layers, timestamp, err := d.mergeConfigs()
+	if err != nil {
+		return nil, err
+	}
+	res := EffectiveConfig{
+		Timestamp: max(timestamp, d.labelsModifiedAt),
+		Files:     make(map[string]EffectiveConfigFile, len(files)),
+		Changes:   []ConfigFileChange{},
+	}
+	res.Status = d.ConfigFetch.Status(res.Timestamp)
+	for name, file := range files {
+		res.Files[name] = EffectiveConfigFile{ConfigFile: *file, Layers: layers[name]}
+	}
+	if content, err := d.storage.fs.Devices.ReadFile(d.Uuid, storage.ConfigFetchedFile); err != nil {
+		return nil, err
+	} else if len(content) > 0 {
+		res.Fetched = new(storage.ConfigFetched)
+		if err = json.Unmarshal([]byte(content), res.Fetched); err != nil {
+			return nil, fmt.Errorf("failed to parse fetched config: %w", err)
+		}
+	}
+
+	var fetched map[string]storage.ConfigFileDigest
+	if res.Fetched != nil {
+		fetched = res.Fetched.Files
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if digest, ok := fetched[name]; !ok {
+			res.Changes = append(res.Changes, ConfigFileChange{Name: name, Change: ConfigFileAdded})
+		} else if !digest.Equal(storage.NewConfigFileDigest(*files[name])) {
+			res.Changes = append(res.Changes, ConfigFileChange{Name: name, Change: ConfigFileModified})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(fetched)) {
+		if _, ok := files[name]; !ok {
+			res.Changes = append(res.Changes, ConfigFileChange{Name: name, Change: ConfigFileRemoved})
+		}
+	}
+	return &res, nil
+}
+
+func (d Device) mergeConfigs() (files map[string]*ConfigFile, layers map[string][]string, timestamp int64, err error) {
+	var configs [3]string
+	if configs, timestamp, err = d.storage.fs.Configs.ReadConfigLayers(d.Uuid, d.Labels["group"]); err != nil {
+		return
+	}
+	data := storage.ConfigTemplateData{Uuid: d.Uuid, Name: d.Labels["name"], Labels: d.Labels}
+	files, layers, err = storage.MergeConfigs(configs, data)
+	return
+}
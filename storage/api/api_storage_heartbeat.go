@@ -0,0 +1,75 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+const (
+	// A device is offline after it missed this many polling intervals.
+	heartbeatMissedPolls = 2
+	// The gateway persists check-ins of unchanged devices at most once a minute, so last-seen can lag that long.
+	heartbeatGracePeriod = 60
+)
+
+// DeviceConnectivity is a change of a device connectivity state.
+type DeviceConnectivity struct {
+	Uuid     string `json:"uuid"`
+	Group    string `json:"group,omitempty"`
+	Tag      string `json:"tag"`
+	LastSeen int64  `json:"last-seen"`
+	Online   bool   `json:"online"`
+}
+
+// UpdateDevicesConnectivity marks devices online or offline, and returns devices which state has changed.
+// Each device is expected to check in once in its reported polling interval, or in a default interval if not reported.
+// A webhook event is emitted for each change.
+func (s Storage) UpdateDevicesConnectivity(defaultInterval time.Duration) ([]DeviceConnectivity, error) {
+	changes, err := s.stmtDeviceSetOnline.run(int64(defaultInterval.Seconds()), time.Now().Unix())
+	for _, c := range changes {
+		eventType := storage.WebhookEventDeviceOffline
+		if c.Online {
+			eventType = storage.WebhookEventDeviceOnline
+		}
+		s.addWebhookEvent(eventType, c)
+	}
+	return changes, err
+}
+
+type stmtDeviceSetOnline storage.DbStmt
+
+func (s *stmtDeviceSetOnline) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiDeviceSetOnline", `
+		UPDATE devices SET online = NOT online
+		WHERE deleted=false AND online != (
+			last_seen + ?1 * IIF(polling_interval > 0, polling_interval, ?2) + ?3 >= ?4
+		)
+		RETURNING uuid, group_name, tag, last_seen, online`,
+	)
+	return
+}
+
+func (s *stmtDeviceSetOnline) run(defaultInterval, now int64) (res []DeviceConnectivity, err error) {
+	rows, err := s.Stmt.Query(heartbeatMissedPolls, defaultInterval, heartbeatGracePeriod, now)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows in device set online", "error", err)
+		}
+	}()
+	for rows.Next() {
+		var c DeviceConnectivity
+		if err = rows.Scan(&c.Uuid, &c.Group, &c.Tag, &c.LastSeen, &c.Online); err != nil {
+			return res, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
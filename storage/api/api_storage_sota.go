@@ -0,0 +1,53 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+// sotaConfig returns a sota toml override as a device sees it: factory, group, and device configs merged.
+func (d Device) sotaConfig() (storage.PacmanConfig, error) {
+	files, _, _, err := d.mergeConfigs()
+	if err != nil {
+		return nil, err
+	}
+	pacmanCfg := make(storage.PacmanConfig)
+	if file := files[storage.SotaOverrideFile]; file != nil {
+		if err = pacmanCfg.Merge(file.Value); err != nil {
+			return nil, fmt.Errorf("failed to parse sota toml config: %w", err)
+		}
+	}
+	return pacmanCfg, nil
+}
+
+// setSotaValue sets a [pacman] section value inside the sota toml override file of given config files.
+func setSotaValue(files map[string]*storage.ConfigFile, key, value string) error {
+	file := files[storage.SotaOverrideFile]
+	if file == nil {
+		file = &storage.ConfigFile{OnChanged: storage.SotaOverrideOnChanged}
+		files[storage.SotaOverrideFile] = file
+	}
+	pacmanCfg := make(storage.PacmanConfig)
+	if err := pacmanCfg.Merge(file.Value); err != nil {
+		return fmt.Errorf("failed to parse sota toml config: %w", err)
+	}
+	if pacmanCfg["pacman"] == nil {
+		pacmanCfg["pacman"] = make(map[string]interface{})
+	}
+	pacmanCfg["pacman"][key] = value
+	var err error
+	if file.Value, err = pacmanCfg.Encode(); err != nil {
+		return fmt.Errorf("failed to encode sota toml config: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) updateSotaValue(scope ConfigScope, key, value string) error {
+	return s.updateConfig(scope, func(files map[string]*storage.ConfigFile) error {
+		return setSotaValue(files, key, value)
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+type TagReq struct {
+	Tag string `json:"tag"`
+}
+
+// TagMigration describes a progress of moving a device to a new tag.
+// A device is migrated once it reports the target tag in its x-ats-tags header.
+type TagMigration struct {
+	Uuid       string `json:"uuid"`
+	Name       string `json:"name"`
+	GroupName  string `json:"group"`
+	Tag        string `json:"tag"`
+	TargetTag  string `json:"target-tag"`
+	MigratedAt int64  `json:"migrated-at"`
+	LastSeen   int64  `json:"last-seen"`
+}
+
+func (m TagMigration) Migrated() bool {
+	return m.Tag == m.TargetTag
+}
+
+// SetDeviceTag asks a device to move to a new tag via its sota toml override config.
+func (s Storage) SetDeviceTag(uuid, tag string) error {
+	if err := s.updateSotaValue(DeviceConfigScope(uuid), "tags", tag); err != nil {
+		return err
+	}
+	_, err := s.stmtDeviceSetTagTarget.run(tag, time.Now().Unix(), []string{uuid}, nil)
+	return err
+}
+
+// SetGroupTag asks all devices in a group to move to a new tag via the group sota toml override config.
+// It returns UUIDs of devices which are being migrated.
+func (s Storage) SetGroupTag(group, tag string) ([]string, error) {
+	if err := s.updateSotaValue(GroupConfigScope(group), "tags", tag); err != nil {
+		return nil, err
+	}
+	return s.stmtDeviceSetTagTarget.run(tag, time.Now().Unix(), nil, []string{group})
+}
+
+// ListTagMigrations returns devices which were asked to move to a new tag.
+// When targetTag is empty, migrations to all tags are returned.
+func (s Storage) ListTagMigrations(targetTag string) ([]TagMigration, error) {
+	return s.stmtDeviceListTagMigrations.run(targetTag)
+}
+
+type stmtDeviceSetTagTarget storage.DbStmt
+
+func (s *stmtDeviceSetTagTarget) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiDeviceSetTagTarget", `
+		UPDATE devices
+		SET tag_target=?1, tag_migrated_at=IIF(tag = ?1, ?2, 0)
+		WHERE deleted=false AND (
+			uuid IN (SELECT value from json_each(?3))
+			OR
+			group_name IN (SELECT value from json_each(?4))
+		) RETURNING uuid`,
+	)
+	return
+}
+
+func (s *stmtDeviceSetTagTarget) run(tag string, now int64, uuids, groups []string) (res []string, err error) {
+	uuidsStr, err := json.Marshal(uuids)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error marshalling UUIDs to JSON: %w", err)
+	}
+	groupsStr, err := json.Marshal(groups)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error marshalling groups to JSON: %w", err)
+	}
+	rows, err := s.Stmt.Query(tag, now, uuidsStr, groupsStr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows in device tag update", "error", err)
+		}
+	}()
+	var uuid string
+	for rows.Next() {
+		if err = rows.Scan(&uuid); err != nil {
+			return nil, err
+		}
+		res = append(res, uuid)
+	}
+	return res, rows.Err()
+}
+
+type stmtDeviceListTagMigrations storage.DbStmt
+
+func (s *stmtDeviceListTagMigrations) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiDeviceListTagMigrations", `
+		SELECT
+			uuid, name, group_name, tag, tag_target, tag_migrated_at, last_seen
+		FROM devices
+		WHERE deleted=false AND tag_target != "" AND (?1 = "" OR tag_target = ?1)
+		ORDER BY uuid`,
+	)
+	return
+}
+
+func (s *stmtDeviceListTagMigrations) run(targetTag string) (res []TagMigration, err error) {
+	rows, err := s.Stmt.Query(targetTag)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows in tag migrations list", "error", err)
+		}
+	}()
+	for rows.Next() {
+		var m TagMigration
+		if err = rows.Scan(
+			&m.Uuid, &m.Name, &m.GroupName, &m.Tag, &m.TargetTag, &m.MigratedAt, &m.LastSeen,
+		); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
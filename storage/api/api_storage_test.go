@@ -5,6 +5,7 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"path/filepath"
@@ -54,7 +55,7 @@ func TestStorage(t *testing.T) {
 	_, err = dg.DeviceCreate("uuid-2", "pubkey-value-2", false)
 	require.Nil(t, err)
 
-	uuids, err := s.SetUpdateName("tag", "update42", false, []string{"uuid-1", "uuid-2"}, nil)
+	uuids, err := s.SetUpdateName("tag", "update42", false, []string{"uuid-1", "uuid-2"}, nil, DeviceFilter{})
 	require.Nil(t, err)
 	require.Equal(t, 1, len(uuids))
 	assert.Equal(t, "uuid-1", uuids[0])
@@ -85,6 +86,54 @@ func TestStorage(t *testing.T) {
 	assert.Equal(t, "aktoml content", d.Aktoml)
 }
 
+func TestDeviceFilter(t *testing.T) {
+	tmpdir := t.TempDir()
+	db, err := storage.NewDb(filepath.Join(tmpdir, "sql.db"))
+	require.Nil(t, err)
+	fs, err := storage.NewFs(tmpdir)
+	require.Nil(t, err)
+	s, err := NewStorage(db, fs)
+	require.Nil(t, err)
+	dg, err := gateway.NewStorage(db, fs)
+	require.Nil(t, err)
+
+	for uuid, tag := range map[string]string{"line3-a": "stable", "line4-a": "stable", "line4-b": "beta", "loose": "stable"} {
+		d, err := dg.DeviceCreate(uuid, "pubkey", false)
+		require.Nil(t, err)
+		require.Nil(t, d.CheckIn("target", tag, "hash", ""))
+	}
+	line3, line4 := "line-3", "line-4"
+	require.Nil(t, s.PatchDeviceLabels(map[string]*string{"group": &line3}, []string{"line3-a"}))
+	require.Nil(t, s.PatchDeviceLabels(map[string]*string{"group": &line4}, []string{"line4-a", "line4-b"}))
+
+	list := func(filter DeviceFilter) (uuids []string) {
+		devices, count, err := s.DevicesList(DeviceListOpts{Limit: 10, OrderBy: OrderByDeviceUuidAsc, Filter: filter})
+		require.Nil(t, err)
+		require.Equal(t, len(devices), count)
+		for _, d := range devices {
+			uuids = append(uuids, d.Uuid)
+		}
+		return
+	}
+	assert.Equal(t, []string{"line3-a", "line4-a", "line4-b", "loose"}, list(DeviceFilter{}))
+	assert.Equal(t, []string{"line4-a", "line4-b"}, list(DeviceFilter{Groups: []string{"line-4"}}))
+	assert.Equal(t, []string{"line3-a", "line4-a", "loose"}, list(DeviceFilter{Tags: []string{"stable"}}))
+	assert.Equal(t, []string{"line4-a"}, list(DeviceFilter{Tags: []string{"stable"}, Groups: []string{"line-4"}}))
+
+	// Devices which do not pass a filter are left intact, even when listed by their UUIDs.
+	filter := DeviceFilter{Groups: []string{"line-4"}}
+	uuids, err := s.SetUpdateName("stable", "update1", false, []string{"line3-a", "loose"}, []string{"line-4"}, filter)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"line4-a"}, uuids)
+	d, err := s.DeviceGet("line3-a")
+	require.Nil(t, err)
+	assert.Empty(t, d.UpdateName)
+
+	assert.True(t, DeviceFilter{}.Allows("any", ""))
+	assert.False(t, filter.Allows("stable", ""))
+	assert.True(t, filter.Allows("stable", "line-4"))
+}
+
 func TestDeviceDelete(t *testing.T) {
 	tmpdir := t.TempDir()
 	dbFile := filepath.Join(tmpdir, "sql.db")
@@ -124,6 +173,101 @@ func TestDeviceDelete(t *testing.T) {
 	}
 }
 
+func TestDevicesConnectivity(t *testing.T) {
+	tmpdir := t.TempDir()
+	dbFile := filepath.Join(tmpdir, "sql.db")
+	db, err := storage.NewDb(dbFile)
+	require.Nil(t, err)
+	fs, err := storage.NewFs(tmpdir)
+	require.Nil(t, err)
+
+	s, err := NewStorage(db, fs)
+	require.Nil(t, err)
+	dg, err := gateway.NewStorage(db, fs)
+	require.Nil(t, err)
+
+	for _, uuid := range []string{"uuid-1", "uuid-2", "uuid-3"} {
+		_, err = dg.DeviceCreate(uuid, "pubkey-"+uuid, false)
+		require.Nil(t, err)
+	}
+	d3, err := dg.DeviceGet("uuid-3")
+	require.Nil(t, err)
+	require.Nil(t, d3.PutAktoml("[uptane]\npolling_sec = \"3600\"\n"))
+
+	setLastSeen := func(uuid string, ago time.Duration) {
+		stmt, err := db.Prepare("TestSetLastSeen", "UPDATE devices SET last_seen=? WHERE uuid=?")
+		require.Nil(t, err)
+		_, err = stmt.Exec(time.Now().Add(-ago).Unix(), uuid)
+		require.Nil(t, err)
+	}
+	listState := func(state string) []string {
+		devices, count, err := s.DevicesList(DeviceListOpts{Limit: 10, State: state, OrderBy: OrderByDeviceUuidAsc})
+		require.Nil(t, err)
+		uuids := make([]string, 0, len(devices))
+		for _, d := range devices {
+			uuids = append(uuids, d.Uuid)
+		}
+		require.Equal(t, len(uuids), count)
+		return uuids
+	}
+
+	// New devices are online
+	changes, err := s.UpdateDevicesConnectivity(5 * time.Minute)
+	require.Nil(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, []string{"uuid-1", "uuid-2", "uuid-3"}, listState(DeviceStateOnline))
+
+	// Two missed polls plus a minute, unless a device reports a longer polling interval
+	setLastSeen("uuid-1", 10*time.Minute)
+	setLastSeen("uuid-2", 12*time.Minute)
+	setLastSeen("uuid-3", 12*time.Minute)
+	changes, err = s.UpdateDevicesConnectivity(5 * time.Minute)
+	require.Nil(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "uuid-2", changes[0].Uuid)
+	assert.False(t, changes[0].Online)
+	assert.Equal(t, []string{"uuid-1", "uuid-3"}, listState(DeviceStateOnline))
+	assert.Equal(t, []string{"uuid-2"}, listState(DeviceStateOffline))
+	assert.Equal(t, []string{"uuid-1", "uuid-2", "uuid-3"}, listState(""))
+
+	d, err := s.DeviceGet("uuid-3")
+	require.Nil(t, err)
+	assert.True(t, d.Online)
+	assert.Equal(t, int64(3600), d.PollingInterval)
+
+	devices, _, err := s.DevicesList(DeviceListOpts{Limit: 10, OrderBy: OrderByDeviceOnlineAsc})
+	require.Nil(t, err)
+	assert.Equal(t, "uuid-2", devices[0].Uuid)
+	assert.False(t, devices[0].Online)
+
+	_, _, err = s.DevicesList(DeviceListOpts{Limit: 10, State: "sleeping"})
+	assert.NotNil(t, err)
+
+	// A device is back online, and nothing changes on the next run
+	setLastSeen("uuid-2", 0)
+	changes, err = s.UpdateDevicesConnectivity(5 * time.Minute)
+	require.Nil(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "uuid-2", changes[0].Uuid)
+	assert.True(t, changes[0].Online)
+	changes, err = s.UpdateDevicesConnectivity(5 * time.Minute)
+	require.Nil(t, err)
+	assert.Empty(t, changes)
+
+	events, err := fs.Webhooks.ListEvents()
+	require.Nil(t, err)
+	var types []string
+	for _, evt := range events {
+		types = append(types, evt.Type)
+	}
+	assert.Contains(t, types, storage.WebhookEventDeviceOffline)
+	assert.Contains(t, types, storage.WebhookEventDeviceOnline)
+
+	counts, err := s.CountDevices()
+	require.Nil(t, err)
+	assert.Equal(t, []DeviceCount{{Online: true, Count: 3}}, counts)
+}
+
 func TestUploadConfigs(t *testing.T) {
 	tmpdir := t.TempDir()
 	dbFile := filepath.Join(tmpdir, "sql.db")
@@ -133,6 +277,10 @@ func TestUploadConfigs(t *testing.T) {
 	require.Nil(t, err)
 	s, err := NewStorage(db, fs)
 	require.Nil(t, err)
+	dg, err := gateway.NewStorage(db, fs)
+	require.Nil(t, err)
+	_, err = dg.DeviceCreate("uuid", "pubkey", false)
+	require.Nil(t, err)
 
 	createTar := storageTesting.CreateTarBuffer
 
@@ -221,4 +369,49 @@ func TestUploadConfigs(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Failure on invalid config template", func(t *testing.T) {
+		for name, value := range map[string]string{
+			"unclosed action": `{{ .Labels.site `,
+			"unknown field":   `{{ .Hostname }}`,
+		} {
+			t.Run(name, func(t *testing.T) {
+				cfg, err := json.Marshal(map[string]ConfigFile{"hostname": {Value: value, Template: true}})
+				require.NoError(t, err)
+				r := createTar(t, map[string]string{
+					"group/alpha/.journal": "bad:2003\n",
+					"group/alpha/bad":      string(cfg),
+				})
+				err = s.UploadConfigs(r)
+				require.ErrorIs(t, err, ErrInvalidConfig)
+				require.ErrorContains(t, err, "group/alpha/bad")
+				require.ErrorContains(t, err, "invalid template in config file hostname")
+			})
+		}
+		t.Run("null file", func(t *testing.T) {
+			r := createTar(t, map[string]string{
+				"group/alpha/.journal": "bad:2003\n",
+				"group/alpha/bad":      `{"wifi.conf":null}`,
+			})
+			err := s.UploadConfigs(r)
+			require.ErrorIs(t, err, ErrInvalidConfig)
+			require.ErrorContains(t, err, "config file wifi.conf is null")
+		})
+		// Previous configs are intact.
+		history, err := s.fs.Configs.ReadGroupConfigHistory("alpha", 5)
+		require.NoError(t, err)
+		require.Equal(t, []string{`{"omega":{"Value":"contra spem spero"}}`}, history)
+
+		// Dry run validates configs the same way.
+		_, err = s.DiffConfigsUpload(createTar(t, map[string]string{"device/unknown/.journal": ""}))
+		require.ErrorIs(t, err, ErrInvalidConfig)
+		require.ErrorContains(t, err, "device 'unknown' does not exist")
+
+		// The same value is fine when it is not marked as a template.
+		r := createTar(t, map[string]string{
+			"group/alpha/.journal": "raw:2003\n",
+			"group/alpha/raw":      `{"hostname":{"Value":"{{ .Labels.site "}}`,
+		})
+		require.NoError(t, s.UploadConfigs(r))
+	})
 }
@@ -0,0 +1,315 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/foundriesio/dg-satellite/storage"
+)
+
+type (
+	WebhookAttempt  = storage.WebhookAttempt
+	WebhookDelivery = storage.WebhookDelivery
+	WebhookEvent    = storage.WebhookEvent
+)
+
+var (
+	ErrInvalidWebhook = errors.New("invalid webhook")
+
+	WebhookEventTypes = storage.WebhookEventTypes
+)
+
+// WebhookReq is a user provided webhook definition.
+type WebhookReq struct {
+	Url         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+// Validate checks that a webhook points to an HTTP(S) endpoint and subscribes to known events.
+func (r WebhookReq) Validate() error {
+	if u, err := url.Parse(r.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	for _, evt := range r.Events {
+		if !slices.Contains(WebhookEventTypes, evt) {
+			return fmt.Errorf("%w: unknown event '%s'", ErrInvalidWebhook, evt)
+		}
+	}
+	if len(r.Description) > 80 {
+		return fmt.Errorf("%w: description must be at most 80 characters", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+type Webhook struct {
+	Id          int64    `json:"id"`
+	Url         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	CreatedAt   int64    `json:"created-at"`
+	// Secret is only returned once, when a webhook is created.
+	Secret string `json:"secret,omitempty"`
+
+	secret  string
+	storage Storage
+}
+
+// Subscribed tells if a webhook wants to receive events of a given type.
+func (w Webhook) Subscribed(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// Sign returns a value of the signature header for a webhook payload.
+// A receiver verifies it by computing the HMAC-SHA256 of the request body with a webhook secret.
+func (w Webhook) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Update(req WebhookReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	w.Url = req.Url
+	w.Events = req.Events
+	w.Description = req.Description
+	return w.storage.stmtWebhookUpdate.run(*w)
+}
+
+func (w Webhook) Delete() error {
+	err1 := w.storage.stmtWebhookDelete.run(w.Id)
+	err2 := w.storage.fs.Webhooks.DeleteWebhook(w.Id)
+	return errors.Join(err1, err2)
+}
+
+// Deliveries returns up to limit latest delivery attempts of a webhook, newest first.
+func (w Webhook) Deliveries(limit int) ([]WebhookAttempt, error) {
+	return w.storage.fs.Webhooks.ReadHistory(w.Id, limit)
+}
+
+func (s Storage) CreateWebhook(req WebhookReq) (*Webhook, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	w := Webhook{
+		Url:         req.Url,
+		Events:      req.Events,
+		Description: req.Description,
+		CreatedAt:   time.Now().Unix(),
+		secret:      rand.Text(),
+		storage:     s,
+	}
+	w.Secret = w.secret
+	if err := s.stmtWebhookCreate.run(&w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s Storage) GetWebhook(id int64) (*Webhook, error) {
+	w := Webhook{Id: id, storage: s}
+	if err := s.stmtWebhookGet.run(&w); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s Storage) ListWebhooks() ([]Webhook, error) {
+	return s.stmtWebhookList.run(s)
+}
+
+// DispatchWebhookEvents queues pending fleet events for delivery to all webhooks subscribed to them.
+func (s Storage) DispatchWebhookEvents() error {
+	events, err := s.fs.Webhooks.ListEvents()
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	webhooks, err := s.ListWebhooks()
+	if err != nil {
+		return err
+	}
+	for _, evt := range events {
+		for _, w := range webhooks {
+			if w.Subscribed(evt.Type) {
+				if err = s.fs.Webhooks.QueueDelivery(WebhookDelivery{WebhookId: w.Id, Event: evt}); err != nil {
+					return err
+				}
+			}
+		}
+		if err = s.fs.Webhooks.DeleteEvent(evt.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns all queued webhook deliveries, oldest events first.
+func (s Storage) ListWebhookDeliveries() ([]WebhookDelivery, error) {
+	return s.fs.Webhooks.ListDeliveries()
+}
+
+// SaveWebhookAttempt records a delivery attempt in the webhook history.
+// A delivery is rescheduled when retryAt is set; otherwise, it is removed from the queue.
+func (s Storage) SaveWebhookAttempt(d WebhookDelivery, attempt WebhookAttempt, retryAt int64) error {
+	attempt.Final = retryAt == 0
+	if err := s.fs.Webhooks.AppendAttempt(d.WebhookId, attempt); err != nil {
+		return err
+	}
+	if retryAt == 0 {
+		return s.fs.Webhooks.DeleteDelivery(d)
+	}
+	d.Attempts = attempt.Attempt
+	d.NextAttempt = retryAt
+	return s.fs.Webhooks.SaveDelivery(d)
+}
+
+// DropWebhookDelivery removes a delivery from the queue, e.g. when its webhook no longer exists.
+func (s Storage) DropWebhookDelivery(d WebhookDelivery) error {
+	return s.fs.Webhooks.DeleteDelivery(d)
+}
+
+// addWebhookEvent saves a fleet event for webhooks; a failure is not critical for an operation emitting the event.
+func (s Storage) addWebhookEvent(eventType string, data any) {
+	if err := s.fs.Webhooks.AddEvent(eventType, data); err != nil {
+		slog.Error("Failed to save webhook event", "event", eventType, "error", err)
+	}
+}
+
+type stmtWebhookCreate storage.DbStmt
+
+func (s *stmtWebhookCreate) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiWebhookCreate", `
+		INSERT INTO webhooks (url, secret, events, description, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id`,
+	)
+	return
+}
+
+func (s *stmtWebhookCreate) run(w *Webhook) error {
+	events, err := marshalWebhookEvents(w.Events)
+	if err != nil {
+		return err
+	}
+	return s.Stmt.QueryRow(w.Url, w.secret, events, w.Description, w.CreatedAt).Scan(&w.Id)
+}
+
+type stmtWebhookDelete storage.DbStmt
+
+func (s *stmtWebhookDelete) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiWebhookDelete", `
+		UPDATE webhooks SET deleted=1 WHERE id=?`)
+	return
+}
+
+func (s *stmtWebhookDelete) run(id int64) error {
+	_, err := s.Stmt.Exec(id)
+	return err
+}
+
+type stmtWebhookGet storage.DbStmt
+
+func (s *stmtWebhookGet) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiWebhookGet", `
+		SELECT url, secret, events, description, created_at
+		FROM webhooks
+		WHERE id=? AND deleted=false`,
+	)
+	return
+}
+
+func (s *stmtWebhookGet) run(w *Webhook) error {
+	var events string
+	if err := s.Stmt.QueryRow(w.Id).Scan(&w.Url, &w.secret, &events, &w.Description, &w.CreatedAt); err != nil {
+		return err
+	}
+	return unmarshalWebhookEvents(events, &w.Events)
+}
+
+type stmtWebhookList storage.DbStmt
+
+func (s *stmtWebhookList) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiWebhookList", `
+		SELECT id, url, secret, events, description, created_at
+		FROM webhooks
+		WHERE deleted=false
+		ORDER BY id`,
+	)
+	return
+}
+
+func (s *stmtWebhookList) run(storage Storage) (res []Webhook, err error) {
+	rows, err := s.Stmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows in webhooks list", "error", err)
+		}
+	}()
+	for rows.Next() {
+		w := Webhook{storage: storage}
+		var events string
+		if err = rows.Scan(&w.Id, &w.Url, &w.secret, &events, &w.Description, &w.CreatedAt); err != nil {
+			return nil, err
+		} else if err = unmarshalWebhookEvents(events, &w.Events); err != nil {
+			return nil, err
+		}
+		res = append(res, w)
+	}
+	return res, rows.Err()
+}
+
+type stmtWebhookUpdate storage.DbStmt
+
+func (s *stmtWebhookUpdate) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("apiWebhookUpdate", `
+		UPDATE webhooks SET url=?, events=?, description=? WHERE id=? AND deleted=false`)
+	return
+}
+
+func (s *stmtWebhookUpdate) run(w Webhook) error {
+	events, err := marshalWebhookEvents(w.Events)
+	if err != nil {
+		return err
+	}
+	_, err = s.Stmt.Exec(w.Url, events, w.Description, w.Id)
+	return err
+}
+
+func marshalWebhookEvents(events []string) (string, error) {
+	if events == nil {
+		events = []string{}
+	}
+	if data, err := json.Marshal(events); err != nil {
+		return "", fmt.Errorf("unexpected error marshalling webhook events to JSON: %w", err)
+	} else {
+		return string(data), nil
+	}
+}
+
+func unmarshalWebhookEvents(data string, events *[]string) error {
+	if err := json.Unmarshal([]byte(data), events); err != nil {
+		return fmt.Errorf("unexpected error unmarshalling webhook events json: %w", err)
+	}
+	return nil
+}
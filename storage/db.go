@@ -45,6 +45,9 @@ func NewDb(dbfile string) (*DbHandle, error) {
 			return nil, err
 		}
 	}
+	if err := migrateTables(db); err != nil {
+		return nil, err
+	}
 	return &DbHandle{db: db}, nil
 }
 
@@ -159,6 +162,140 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
+// dbMigrations are applied in order on top of the schema created by createTables.
+// A database keeps the number of applied migrations in its user_version pragma.
+// Never change or reorder existing migrations; only append new ones.
+var dbMigrations = []string{
+	// 1: Rollouts can target devices on several tags, so remember which tag an assigned update belongs to.
+	`ALTER TABLE devices ADD COLUMN update_tag VARCHAR(80) DEFAULT "";`,
+	// 2-3: A tag which a device was asked to migrate to, and a time when the device reported that tag.
+	`ALTER TABLE devices ADD COLUMN tag_target VARCHAR(80) DEFAULT "";`,
+	`ALTER TABLE devices ADD COLUMN tag_migrated_at INT DEFAULT 0;`,
+	// 4-7: A config which a device received with its last config fetch, and when the device last found it unchanged.
+	`ALTER TABLE devices ADD COLUMN config_timestamp INT DEFAULT 0;`,
+	`ALTER TABLE devices ADD COLUMN config_hash VARCHAR(64) DEFAULT "";`,
+	`ALTER TABLE devices ADD COLUMN config_fetched_at INT DEFAULT 0;`,
+	`ALTER TABLE devices ADD COLUMN config_checked_at INT DEFAULT 0;`,
+	// 8: Outbound HTTP webhooks for fleet events; an empty events list subscribes to all events.
+	`CREATE TABLE webhooks (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		url         TEXT NOT NULL,
+		secret      VARCHAR(64) NOT NULL,
+		events      TEXT NOT NULL DEFAULT "[]",
+		description VARCHAR(80) DEFAULT "",
+		created_at  INT DEFAULT 0,
+		deleted     BOOL DEFAULT 0
+	);`,
+	// 9-11: A polling interval which a device reports in its aktoml, and a connectivity state kept by a heartbeat daemon.
+	// Devices seen recently are assumed online, so that the first heartbeat run does not report the whole fleet online.
+	`ALTER TABLE devices ADD COLUMN polling_interval INT DEFAULT 0;`,
+	`ALTER TABLE devices ADD COLUMN online BOOL DEFAULT false;`,
+	`UPDATE devices SET online = (last_seen >= CAST(strftime('%s', 'now') AS INT) - 660);`,
+	// 12-13: When and from where an API token was last used, to find stale tokens.
+	`ALTER TABLE tokens ADD COLUMN last_used_at INT DEFAULT 0;`,
+	`ALTER TABLE tokens ADD COLUMN last_used_ip VARCHAR(39) DEFAULT "";`,
+	// 14-15: Service accounts hold API tokens for automation, and cannot log in.
+	`ALTER TABLE users ADD COLUMN service_account BOOL DEFAULT false;`,
+	`ALTER TABLE users ADD COLUMN owner TEXT DEFAULT "";`,
+	// 16-21: Configs, rollouts, device labels, and the audit trail got dedicated scopes.
+	// Grant them to users, API tokens, and sessions which held scopes previously required for the same APIs.
+	`
+		UPDATE users SET allowed_scopes = allowed_scopes || ',configs:read'
+		WHERE ',' || allowed_scopes || ',' LIKE '%,devices:read,%' OR ',' || allowed_scopes || ',' LIKE '%,devices:read-update,%';
+		UPDATE tokens SET scopes = scopes || ',configs:read'
+		WHERE ',' || scopes || ',' LIKE '%,devices:read,%' OR ',' || scopes || ',' LIKE '%,devices:read-update,%';
+		UPDATE session SET scopes = scopes || ',configs:read'
+		WHERE ',' || scopes || ',' LIKE '%,devices:read,%' OR ',' || scopes || ',' LIKE '%,devices:read-update,%';
+	`,
+	`
+		UPDATE users SET allowed_scopes = allowed_scopes || ',configs:read-update'
+		WHERE ',' || allowed_scopes || ',' LIKE '%,devices:read-update,%' AND ',' || allowed_scopes || ',' LIKE '%,updates:read-update,%';
+		UPDATE tokens SET scopes = scopes || ',configs:read-update'
+		WHERE ',' || scopes || ',' LIKE '%,devices:read-update,%' AND ',' || scopes || ',' LIKE '%,updates:read-update,%';
+		UPDATE session SET scopes = scopes || ',configs:read-update'
+		WHERE ',' || scopes || ',' LIKE '%,devices:read-update,%' AND ',' || scopes || ',' LIKE '%,updates:read-update,%';
+	`,
+	`
+		UPDATE users SET allowed_scopes = allowed_scopes || ',rollouts:read'
+		WHERE ',' || allowed_scopes || ',' LIKE '%,updates:read,%' OR ',' || allowed_scopes || ',' LIKE '%,updates:read-update,%';
+		UPDATE tokens SET scopes = scopes || ',rollouts:read'
+		WHERE ',' || scopes || ',' LIKE '%,updates:read,%' OR ',' || scopes || ',' LIKE '%,updates:read-update,%';
+		UPDATE session SET scopes = scopes || ',rollouts:read'
+		WHERE ',' || scopes || ',' LIKE '%,updates:read,%' OR ',' || scopes || ',' LIKE '%,updates:read-update,%';
+	`,
+	// Approving rollouts to production is only granted to those who could already manage users.
+	`
+		UPDATE users SET allowed_scopes = allowed_scopes || ',rollouts:create'
+		WHERE ',' || allowed_scopes || ',' LIKE '%,updates:read-update,%';
+		UPDATE tokens SET scopes = scopes || ',rollouts:create'
+		WHERE ',' || scopes || ',' LIKE '%,updates:read-update,%';
+		UPDATE session SET scopes = scopes || ',rollouts:create'
+		WHERE ',' || scopes || ',' LIKE '%,updates:read-update,%';
+		UPDATE users SET allowed_scopes = allowed_scopes || ',rollouts:approve'
+		WHERE ',' || allowed_scopes || ',' LIKE '%,updates:read-update,%' AND ',' || allowed_scopes || ',' LIKE '%,users:read-update,%';
+		UPDATE tokens SET scopes = scopes || ',rollouts:approve'
+		WHERE ',' || scopes || ',' LIKE '%,updates:read-update,%' AND ',' || scopes || ',' LIKE '%,users:read-update,%';
+		UPDATE session SET scopes = scopes || ',rollouts:approve'
+		WHERE ',' || scopes || ',' LIKE '%,updates:read-update,%' AND ',' || scopes || ',' LIKE '%,users:read-update,%';
+	`,
+	`
+		UPDATE users SET allowed_scopes = allowed_scopes || ',labels:read-update'
+		WHERE ',' || allowed_scopes || ',' LIKE '%,devices:read-update,%';
+		UPDATE tokens SET scopes = scopes || ',labels:read-update'
+		WHERE ',' || scopes || ',' LIKE '%,devices:read-update,%';
+		UPDATE session SET scopes = scopes || ',labels:read-update'
+		WHERE ',' || scopes || ',' LIKE '%,devices:read-update,%';
+	`,
+	`
+		UPDATE users SET allowed_scopes = allowed_scopes || ',audit:read'
+		WHERE ',' || allowed_scopes || ',' LIKE '%,users:read,%' OR ',' || allowed_scopes || ',' LIKE '%,users:read-update,%';
+		UPDATE tokens SET scopes = scopes || ',audit:read'
+		WHERE ',' || scopes || ',' LIKE '%,users:read,%' OR ',' || scopes || ',' LIKE '%,users:read-update,%';
+		UPDATE session SET scopes = scopes || ',audit:read'
+		WHERE ',' || scopes || ',' LIKE '%,users:read,%' OR ',' || scopes || ',' LIKE '%,users:read-update,%';
+	`,
+	// 22-23: Access of a user may be limited to devices on some tags and in some groups.
+	`ALTER TABLE users ADD COLUMN allowed_tags TEXT DEFAULT "";`,
+	`ALTER TABLE users ADD COLUMN allowed_groups TEXT DEFAULT "";`,
+	// 24-25: Config templates render device labels, so a label change also changes a device config.
+	`ALTER TABLE devices ADD COLUMN labels_modified_at INT DEFAULT 0;`,
+	`
+		CREATE TRIGGER devices_after_update_labels_modified_at AFTER UPDATE ON devices
+		FOR EACH ROW
+		WHEN OLD.labels != NEW.labels
+		BEGIN
+			UPDATE devices
+			SET labels_modified_at = unixepoch('now')
+			WHERE uuid == NEW.uuid;
+		END;
+	`,
+}
+
+func migrateTables(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("unable to read database schema version: %w", err)
+	}
+	for ; version < len(dbMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("unable to start database migration %d: %w", version+1, err)
+		}
+		if _, err = tx.Exec(dbMigrations[version]); err == nil {
+			// PRAGMA does not support bind parameters.
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("unable to apply database migration %d: %w", version+1, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("unable to commit database migration %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
 type DbStmt struct {
 	Stmt *sql.Stmt
 }
@@ -0,0 +1,59 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dbVersionBeforeScopeSplit is a number of migrations applied before configs, rollouts, labels, and audit got their own scopes.
+const dbVersionBeforeScopeSplit = 15
+
+func TestScopeMigrations(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sql.db"))
+	require.Nil(t, err)
+	defer db.Close() //nolint:errcheck
+	require.Nil(t, createTables(db))
+
+	migrations := dbMigrations
+	dbMigrations = migrations[:dbVersionBeforeScopeSplit]
+	err = migrateTables(db)
+	dbMigrations = migrations
+	require.Nil(t, err)
+
+	// Scopes as they were stored before the split.
+	oldScopes := map[string]string{
+		"admin":    "devices:delete,devices:read-update,updates:read-update,users:create,users:read-update",
+		"releaser": "devices:read,updates:read-update",
+		"viewer":   "devices:read,updates:read",
+		"nobody":   "",
+	}
+	for name, scopes := range oldScopes {
+		_, err = db.Exec("INSERT INTO users (username, allowed_scopes) VALUES (?, ?)", name, scopes)
+		require.Nil(t, err)
+		_, err = db.Exec("INSERT INTO tokens (value, scopes) VALUES (?, ?)", name, scopes)
+		require.Nil(t, err)
+	}
+	require.Nil(t, migrateTables(db))
+
+	expected := map[string]string{
+		"admin": "devices:delete,devices:read-update,updates:read-update,users:create,users:read-update," +
+			"configs:read,configs:read-update,rollouts:read,rollouts:create,rollouts:approve,labels:read-update,audit:read",
+		"releaser": "devices:read,updates:read-update,configs:read,rollouts:read,rollouts:create",
+		"viewer":   "devices:read,updates:read,configs:read,rollouts:read",
+		"nobody":   "",
+	}
+	for name, scopes := range expected {
+		var userScopes, tokenScopes string
+		require.Nil(t, db.QueryRow("SELECT allowed_scopes FROM users WHERE username = ?", name).Scan(&userScopes))
+		require.Nil(t, db.QueryRow("SELECT scopes FROM tokens WHERE value = ?", name).Scan(&tokenScopes))
+		assert.Equal(t, scopes, userScopes, name)
+		assert.Equal(t, scopes, tokenScopes, name)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// Live events which the gateway publishes as devices talk to it.
+const (
+	LiveEventCheckIn       = "check-in"
+	LiveEventDeviceCreated = "device-created"
+	LiveEventUpdateEvent   = "update-event"
+	LiveEventAppsStates    = "apps-states"
+	LiveEventTestCompleted = "test-completed"
+)
+
+var LiveEventTypes = []string{
+	LiveEventCheckIn,
+	LiveEventDeviceCreated,
+	LiveEventUpdateEvent,
+	LiveEventAppsStates,
+	LiveEventTestCompleted,
+}
+
+const (
+	// A number of latest events kept in memory, so that clients can resume a stream after reconnecting.
+	eventBusHistorySize = 1000
+	// A number of events a subscriber can lag behind before it is disconnected.
+	eventBusSubscriberBuffer = 256
+)
+
+// LiveEvent is a device activity event published on the event bus.
+type LiveEvent struct {
+	Id        uint64 `json:"id"`
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+	Uuid      string `json:"uuid"`
+	Group     string `json:"group,omitempty"`
+	Tag       string `json:"tag,omitempty"`
+	Data      any    `json:"data,omitempty"`
+}
+
+// EventBus is an in-process publish/subscribe channel for live device activity.
+// Publishers never block: a subscriber which cannot keep up is disconnected, and may resume from its last event.
+type EventBus struct {
+	lock        sync.Mutex
+	lastId      uint64
+	history     []LiveEvent
+	subscribers map[chan LiveEvent]func(LiveEvent) bool
+}
+
+func NewEventBus() *EventBus {
+	// Event IDs start from the current time, so that they keep growing across server restarts.
+	// This way a client resuming after a restart does not skip new events.
+	return &EventBus{
+		lastId:      uint64(time.Now().UnixMicro()),
+		subscribers: make(map[chan LiveEvent]func(LiveEvent) bool),
+	}
+}
+
+// Publish assigns an ID and a timestamp to an event, and sends it to all interested subscribers.
+func (b *EventBus) Publish(evt LiveEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.lastId += 1
+	evt.Id = b.lastId
+	evt.Timestamp = time.Now().Unix()
+	if len(b.history) == eventBusHistorySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, evt)
+	for ch, filter := range b.subscribers {
+		if !filter(evt) {
+			continue
+		}
+		select {
+		case ch <- evt:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel of events matching a filter.
+// Events published after lastId and still kept in memory are replayed first; zero lastId means no replay.
+// The channel is closed when a subscriber falls behind, or when the returned cancel function is called.
+func (b *EventBus) Subscribe(lastId uint64, filter func(LiveEvent) bool) (<-chan LiveEvent, func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var replay []LiveEvent
+	if lastId > 0 {
+		for _, evt := range b.history {
+			if evt.Id > lastId && filter(evt) {
+				replay = append(replay, evt)
+			}
+		}
+	}
+	ch := make(chan LiveEvent, max(eventBusSubscriberBuffer, len(replay)))
+	for _, evt := range replay {
+		ch <- evt
+	}
+	b.subscribers[ch] = filter
+	cancel := func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	all := func(LiveEvent) bool { return true }
+	onlyFoo := func(evt LiveEvent) bool { return evt.Uuid == "foo" }
+
+	events, cancel := bus.Subscribe(0, onlyFoo)
+	bus.Publish(LiveEvent{Type: LiveEventCheckIn, Uuid: "foo"})
+	bus.Publish(LiveEvent{Type: LiveEventCheckIn, Uuid: "bar"})
+	bus.Publish(LiveEvent{Type: LiveEventAppsStates, Uuid: "foo"})
+	first, second := <-events, <-events
+	assert.Equal(t, LiveEventCheckIn, first.Type)
+	assert.Equal(t, LiveEventAppsStates, second.Type)
+	assert.Equal(t, first.Id+2, second.Id)
+	assert.Zero(t, len(events))
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+	cancel() // Safe to call twice
+
+	// Resume replays events kept in memory after the last seen event.
+	events, cancel = bus.Subscribe(first.Id, all)
+	require.Equal(t, 2, len(events))
+	assert.Equal(t, "bar", (<-events).Uuid)
+	assert.Equal(t, second.Id, (<-events).Id)
+	cancel()
+
+	// A subscriber which does not read its events is disconnected without blocking publishers.
+	events, _ = bus.Subscribe(0, all)
+	for i := 0; i <= eventBusSubscriberBuffer; i++ {
+		bus.Publish(LiveEvent{Type: LiveEventCheckIn, Uuid: "foo"})
+	}
+	assert.Equal(t, eventBusSubscriberBuffer, len(events))
+	for range events {
+	}
+	assert.Zero(t, len(bus.subscribers))
+
+	// Only a limited number of latest events is kept in memory.
+	for i := 0; i < eventBusHistorySize; i++ {
+		bus.Publish(LiveEvent{Type: LiveEventCheckIn, Uuid: "foo"})
+	}
+	assert.Equal(t, eventBusHistorySize, len(bus.history))
+	events, cancel = bus.Subscribe(first.Id, all)
+	defer cancel()
+	assert.Equal(t, eventBusHistorySize, len(events))
+}
@@ -19,13 +19,14 @@ import (
 
 const (
 	// Global files/dirs
-	AuditDir   = "audit"
-	AuthDir    = "auth"
-	CertsDir   = "certs"
-	ConfigsDir = "configs"
-	DbFile     = "db.sqlite"
-	DevicesDir = "devices"
-	UpdatesDir = "updates"
+	AuditDir    = "audit"
+	AuthDir     = "auth"
+	CertsDir    = "certs"
+	ConfigsDir  = "configs"
+	DbFile      = "db.sqlite"
+	DevicesDir  = "devices"
+	UpdatesDir  = "updates"
+	WebhooksDir = "webhooks"
 
 	partialFileSuffix  = "..part"
 	rolloutJournalFile = "rollouts.journal"
@@ -46,6 +47,7 @@ const (
 
 	// Per device files/dirs
 	AktomlFile          = "aktoml"
+	ConfigFetchedFile   = "config-fetched"
 	HwInfoFile          = "hardware-info"
 	NetInfoFile         = "network-info"
 	EventsPrefix        = "events"
@@ -116,6 +118,10 @@ func (c FsConfig) UpdatesDir() string {
 	return filepath.Join(string(c), UpdatesDir)
 }
 
+func (c FsConfig) WebhooksDir() string {
+	return filepath.Join(string(c), WebhooksDir)
+}
+
 func (c FsConfig) UpdatesCiDir() string {
 	return filepath.Join(c.UpdatesDir(), UpdatesCiDir)
 }
@@ -126,25 +132,29 @@ func (c FsConfig) UpdatesProdDir() string {
 
 type FsHandle struct {
 	Config FsConfig
-
-	Audit   AuditLogsFsHandle
-	Auth    AuthFsHandle
-	Certs   CertsFsHandle
-	Configs ConfigsFsHandle
-	Devices DevicesFsHandle
-	Updates struct {
+	// Events are not stored on disk; they are shared by all storages working with the same data directory.
+	Events *EventBus
+
+	Audit    AuditLogsFsHandle
+	Auth     AuthFsHandle
+	Certs    CertsFsHandle
+	Configs  ConfigsFsHandle
+	Devices  DevicesFsHandle
+	Webhooks WebhooksFsHandle
+	Updates  struct {
 		Ci   updatesFsHandleWrap
 		Prod updatesFsHandleWrap
 	}
 }
 
 func NewFs(root string) (*FsHandle, error) {
-	fs := &FsHandle{Config: FsConfig(root)}
+	fs := &FsHandle{Config: FsConfig(root), Events: NewEventBus()}
 	fs.Audit.root = fs.Config.AuditDir()
 	fs.Auth.root = fs.Config.AuthDir()
 	fs.Certs.root = fs.Config.CertsDir()
 	fs.Configs.root = fs.Config.ConfigsDir()
 	fs.Devices.root = fs.Config.DevicesDir()
+	fs.Webhooks.init(fs.Config.WebhooksDir())
 	fs.Updates.Ci.init(fs.Config.UpdatesCiDir())
 	fs.Updates.Prod.init(fs.Config.UpdatesProdDir())
 
@@ -154,6 +164,10 @@ func NewFs(root string) (*FsHandle, error) {
 		fs.Certs.baseFsHandle,
 		fs.Configs.baseFsHandle,
 		fs.Devices.baseFsHandle,
+		fs.Webhooks.baseFsHandle,
+		fs.Webhooks.events,
+		fs.Webhooks.queue,
+		fs.Webhooks.history,
 		fs.Updates.Ci.baseFsHandle,
 		fs.Updates.Prod.baseFsHandle,
 	} {
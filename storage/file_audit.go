@@ -4,15 +4,82 @@
 package storage
 
 import (
+	"encoding/json"
 	"fmt"
+	"iter"
 	"log/slog"
 	"time"
 )
 
+// Audit trail files hold one JSON entry per line, a separate file for each month.
+const (
+	auditTrailPrefix     = "trail-"
+	auditTrailTimeFormat = "2006-01"
+)
+
+// AuditEntry is a record of an API call which changes server data.
+type AuditEntry struct {
+	Timestamp  int64  `json:"timestamp"`
+	Actor      string `json:"actor"`
+	AuthMethod string `json:"auth-method,omitempty"`
+	AuthId     string `json:"auth-id,omitempty"`
+	RemoteIp   string `json:"remote-ip"`
+	RequestId  string `json:"request-id,omitempty"`
+	Method     string `json:"method"`
+	Route      string `json:"route"`
+	Resource   string `json:"resource"`
+	Status     int    `json:"status"`
+	Success    bool   `json:"success"`
+}
+
 type AuditLogsFsHandle struct {
 	baseFsHandle
 }
 
+func (h AuditLogsFsHandle) AppendEntry(entry AuditEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unexpected error marshalling audit entry to JSON: %w", err)
+	}
+	name := auditTrailPrefix + time.Unix(entry.Timestamp, 0).UTC().Format(auditTrailTimeFormat)
+	return h.appendFile(name, string(content)+"\n", defaultFileAccess)
+}
+
+// ReadEntries iterates over audit entries, oldest first.
+// Only files which may contain entries between since and until are read; zero means no bound.
+// A caller still has to filter entries by their timestamps.
+func (h AuditLogsFsHandle) ReadEntries(since, until int64) iter.Seq2[AuditEntry, error] {
+	return func(yield func(AuditEntry, error) bool) {
+		names, err := h.matchFiles(auditTrailPrefix, false)
+		if err != nil {
+			yield(AuditEntry{}, err)
+			return
+		}
+		for _, name := range names {
+			month, err := time.Parse(auditTrailTimeFormat, name[len(auditTrailPrefix):])
+			if err != nil {
+				slog.Warn("Skipping unexpected audit trail file", "name", name)
+				continue
+			} else if since > 0 && month.AddDate(0, 1, 0).Unix() <= since {
+				continue
+			} else if until > 0 && month.Unix() > until {
+				continue
+			}
+			for line, err := range h.readFileLines(name, true, nil) {
+				var entry AuditEntry
+				if err == nil {
+					if err = json.Unmarshal([]byte(line), &entry); err != nil {
+						err = fmt.Errorf("unexpected error unmarshalling audit entry json: %w", err)
+					}
+				}
+				if !yield(entry, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
 func (h AuditLogsFsHandle) AppendEvent(userid int64, event string) {
 	msg := fmt.Sprintf("%s: %s\n", time.Now().Format(time.RFC3339), event)
 	if err := h.appendFile(fmt.Sprintf("users-%d", userid), msg, defaultFileAccess); err != nil {
@@ -25,6 +25,11 @@ type AuthConfig struct {
 	Type                 string
 	SessionTimeoutHours  int // Default is 48 hours
 	NewUserDefaultScopes []string
+	// GroupScopes maps identity provider groups to scopes granted to their members.
+	// When set, SSO and LDAP users get scopes of their groups at each login, instead of the default ones.
+	GroupScopes map[string][]string
+	// MaxTokenLifetimeDays limits how long API tokens stay valid after they are created, no limit if zero.
+	MaxTokenLifetimeDays int
 	RateLimits           RateLimitConfig
 	Config               json.RawMessage
 }
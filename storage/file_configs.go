@@ -6,8 +6,10 @@ package storage
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
@@ -26,6 +28,8 @@ import (
 // Note: a config file can be technicallt anything; using a sha256 hash as a name simply allows to avoid collisions.
 // An interesting aspect is that any config rollbacks will result into the same hash, effectively compressing disk usage.
 
+var ErrInvalidConfig = errors.New("invalid config")
+
 type ErrConfigUploadBroken struct {
 	err         error
 	UploadPath  string
@@ -40,6 +44,13 @@ type ConfigsFsHandle struct {
 	baseFsHandle
 }
 
+// ConfigVersion is a single item of config history.
+type ConfigVersion struct {
+	Hash      string
+	Timestamp int64
+	Content   string
+}
+
 func (s ConfigsFsHandle) ReadFactoryConfig() (content string, timestamp int64, err error) {
 	h, _ := s.factoryLocalHandle(false)
 	content, timestamp, err = h.readConfig()
@@ -58,6 +69,15 @@ func (s ConfigsFsHandle) ReadFactoryConfigHistory(latest int) (contents []string
 	return
 }
 
+func (s ConfigsFsHandle) ReadFactoryConfigVersions(latest int) (versions []ConfigVersion, err error) {
+	h, _ := s.factoryLocalHandle(false)
+	versions, err = h.readVersions(latest)
+	if err != nil {
+		err = fmt.Errorf("unexpected error reading factory config history: %w", err)
+	}
+	return
+}
+
 func (s ConfigsFsHandle) WriteFactoryConfig(content string) error {
 	if h, err := s.factoryLocalHandle(true); err != nil {
 		return err
@@ -77,7 +97,10 @@ func (s ConfigsFsHandle) PurgeFactoryConfigHistory(keepLatest int) error {
 }
 
 func (s ConfigsFsHandle) ReadGroupConfig(name string) (content string, timestamp int64, err error) {
-	h, _ := s.groupLocalHandle(name, false)
+	h, err := s.groupLocalHandle(name, false)
+	if err != nil {
+		return
+	}
 	content, timestamp, err = h.readConfig()
 	if err != nil {
 		err = fmt.Errorf("unexpected error reading group config for %s: %w", name, err)
@@ -86,7 +109,10 @@ func (s ConfigsFsHandle) ReadGroupConfig(name string) (content string, timestamp
 }
 
 func (s ConfigsFsHandle) ReadGroupConfigHistory(name string, latest int) (contents []string, err error) {
-	h, _ := s.groupLocalHandle(name, false)
+	h, err := s.groupLocalHandle(name, false)
+	if err != nil {
+		return
+	}
 	contents, err = h.readHistory(latest)
 	if err != nil {
 		err = fmt.Errorf("unexpected error reading group config history for %s: %w", name, err)
@@ -94,6 +120,18 @@ func (s ConfigsFsHandle) ReadGroupConfigHistory(name string, latest int) (conten
 	return
 }
 
+func (s ConfigsFsHandle) ReadGroupConfigVersions(name string, latest int) (versions []ConfigVersion, err error) {
+	h, err := s.groupLocalHandle(name, false)
+	if err != nil {
+		return
+	}
+	versions, err = h.readVersions(latest)
+	if err != nil {
+		err = fmt.Errorf("unexpected error reading group config history for %s: %w", name, err)
+	}
+	return
+}
+
 func (s ConfigsFsHandle) WriteGroupConfig(name, content string) error {
 	if h, err := s.groupLocalHandle(name, true); err != nil {
 		return err
@@ -130,6 +168,15 @@ func (s ConfigsFsHandle) ReadDeviceConfigHistory(uuid string, latest int) (conte
 	return
 }
 
+func (s ConfigsFsHandle) ReadDeviceConfigVersions(uuid string, latest int) (versions []ConfigVersion, err error) {
+	h, _ := s.deviceLocalHandle(uuid, false)
+	versions, err = h.readVersions(latest)
+	if err != nil {
+		err = fmt.Errorf("unexpected error reading device config history for %s: %w", uuid, err)
+	}
+	return
+}
+
 func (s ConfigsFsHandle) WriteDeviceConfig(uuid, content string) error {
 	if h, err := s.deviceLocalHandle(uuid, true); err != nil {
 		return err
@@ -139,7 +186,9 @@ func (s ConfigsFsHandle) WriteDeviceConfig(uuid, content string) error {
 	return nil
 }
 
-func (s ConfigsFsHandle) SaveUpload(payload io.Reader, onCleanupFailure func(error)) error {
+// SaveUpload replaces all configs with those from a tarball, once they pass validation.
+// An inspect callback receives uploaded configs before they become active; returning an error aborts an upload.
+func (s ConfigsFsHandle) SaveUpload(payload io.Reader, inspect func(ConfigsFsHandle) error, onCleanupFailure func(error)) error {
 	txDir := ".configs-upload-" + rand.Text()[:10]
 	root, destDir := filepath.Split(s.root)
 	h := tarFsHandle{root: root}
@@ -149,6 +198,15 @@ func (s ConfigsFsHandle) SaveUpload(payload io.Reader, onCleanupFailure func(err
 		TarUnpackUseTmpDir(txDir),
 		TarUnpackOnEvents(tarUnpackEvents{
 			onTmpCleanupError: onCleanupFailure,
+			onUnpackComplete: func() error {
+				unpackedDir := filepath.Join(root, txDir, "unpacked")
+				if err := validateConfigsDir(unpackedDir); err != nil {
+					return err
+				} else if inspect != nil {
+					return inspect(ConfigsFsHandle{baseFsHandle{root: unpackedDir}})
+				}
+				return nil
+			},
 			onTmpRenameError: func(err error) (bool, error) {
 				return true, ErrConfigUploadBroken{
 					err:         fmt.Errorf("failed to make uploaded config active: %s", err),
@@ -169,6 +227,148 @@ func (s ConfigsFsHandle) PurgeDeviceConfigHistory(uuid string, keepLatest int) e
 	return nil
 }
 
+// ListGroups returns names of groups which have configs.
+func (s ConfigsFsHandle) ListGroups() ([]string, error) {
+	h := baseFsHandle{root: filepath.Join(s.root, ConfigsGroupDir)}
+	return h.matchFiles("", false)
+}
+
+// ListDevices returns UUIDs of devices which have configs.
+func (s ConfigsFsHandle) ListDevices() ([]string, error) {
+	h := baseFsHandle{root: filepath.Join(s.root, ConfigsDeviceDir)}
+	return h.matchFiles("", false)
+}
+
+// validateConfigsDir verifies the structure of an uploaded configs directory and all config files inside it,
+// so that a bad config is rejected on upload instead of breaking device config fetches.
+func validateConfigsDir(root string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return fmt.Errorf("failed to read uploaded configs: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() {
+			return fmt.Errorf("%w: unexpected file '%s'", ErrInvalidConfig, name)
+		}
+		switch name {
+		case ConfigsFactoryDir:
+			err = validateConfigDir(root, name)
+		case ConfigsGroupDir, ConfigsDeviceDir:
+			var scopes []os.DirEntry
+			if scopes, err = os.ReadDir(filepath.Join(root, name)); err != nil {
+				return fmt.Errorf("failed to read uploaded configs: %w", err)
+			}
+			for _, scope := range scopes {
+				path := filepath.Join(name, scope.Name())
+				if !scope.IsDir() {
+					return fmt.Errorf("%w: unexpected file '%s'", ErrInvalidConfig, path)
+				} else if name == ConfigsGroupDir && !ValidGroupName(scope.Name()) {
+					return fmt.Errorf("%w: group name '%s' must match a given regexp: %s",
+						ErrInvalidConfig, scope.Name(), ValidLabelValueRegex)
+				} else if err = validateConfigDir(root, path); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("%w: unexpected directory '%s'", ErrInvalidConfig, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateConfigDir verifies all config versions of a single scope, and that its journal points to an existing config.
+func validateConfigDir(root, dir string) error {
+	entries, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return fmt.Errorf("failed to read uploaded configs: %w", err)
+	}
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			return fmt.Errorf("%w: unexpected directory '%s'", ErrInvalidConfig, name)
+		} else if entry.Name() == ConfigsJournalFile {
+			continue
+		}
+		if content, err := os.ReadFile(filepath.Join(root, name)); err != nil {
+			return fmt.Errorf("failed to read config file '%s': %w", name, err)
+		} else if err = ValidateConfig(string(content)); err != nil {
+			return fmt.Errorf("%w '%s': %v", ErrInvalidConfig, name, err)
+		}
+	}
+	h := configsFsHandle{baseFsHandle{root: filepath.Join(root, dir)}}
+	if _, _, err = h.readConfig(); err != nil {
+		return fmt.Errorf("%w '%s': %v", ErrInvalidConfig, filepath.Join(dir, ConfigsJournalFile), err)
+	}
+	return nil
+}
+
+// ReadConfigLayers returns 3 configs (in order): factory, group, device; and their latest modification timestamp.
+// A group config is empty when a device does not belong to any group.
+func (s ConfigsFsHandle) ReadConfigLayers(uuid, groupName string) (configs [3]string, timestamp int64, err error) {
+	var ts int64
+	if configs[0], timestamp, err = s.ReadFactoryConfig(); err != nil {
+		return
+	}
+	// Devices labeled before group names were checked may have a group which cannot have a config.
+	if ValidGroupName(groupName) {
+		if configs[1], ts, err = s.ReadGroupConfig(groupName); err != nil {
+			return
+		}
+		timestamp = max(timestamp, ts)
+	}
+	if configs[2], ts, err = s.ReadDeviceConfig(uuid); err != nil {
+		return
+	}
+	timestamp = max(timestamp, ts)
+	return
+}
+
+// ConfigTimestamps are modification times of the latest factory, group, and device configs.
+type ConfigTimestamps struct {
+	Factory int64
+	Groups  map[string]int64
+	Devices map[string]int64
+}
+
+// Device returns a latest modification time of configs which a device receives.
+func (t ConfigTimestamps) Device(uuid, groupName string) int64 {
+	return max(t.Factory, t.Groups[groupName], t.Devices[uuid])
+}
+
+// ReadConfigTimestamps reads modification times of all configs at once, without reading configs themselves.
+func (s ConfigsFsHandle) ReadConfigTimestamps() (res ConfigTimestamps, err error) {
+	h, _ := s.factoryLocalHandle(false)
+	if res.Factory, err = h.readTimestamp(); err != nil {
+		return res, fmt.Errorf("unexpected error reading factory config timestamp: %w", err)
+	}
+	res.Groups = make(map[string]int64)
+	var names []string
+	if names, err = s.ListGroups(); err != nil {
+		return res, fmt.Errorf("unexpected error listing group configs: %w", err)
+	}
+	for _, name := range names {
+		h, _ = s.groupLocalHandle(name, false)
+		if res.Groups[name], err = h.readTimestamp(); err != nil {
+			return res, fmt.Errorf("unexpected error reading group config timestamp for %s: %w", name, err)
+		}
+	}
+	res.Devices = make(map[string]int64)
+	if names, err = s.ListDevices(); err != nil {
+		return res, fmt.Errorf("unexpected error listing device configs: %w", err)
+	}
+	for _, uuid := range names {
+		h, _ = s.deviceLocalHandle(uuid, false)
+		if res.Devices[uuid], err = h.readTimestamp(); err != nil {
+			return res, fmt.Errorf("unexpected error reading device config timestamp for %s: %w", uuid, err)
+		}
+	}
+	return
+}
+
 func (s ConfigsFsHandle) factoryLocalHandle(forUpdate bool) (h configsFsHandle, err error) {
 	h.root = filepath.Join(s.root, ConfigsFactoryDir)
 	if forUpdate {
@@ -180,7 +380,12 @@ func (s ConfigsFsHandle) factoryLocalHandle(forUpdate bool) (h configsFsHandle,
 }
 
 func (s ConfigsFsHandle) groupLocalHandle(name string, forUpdate bool) (h configsFsHandle, err error) {
-	h.root = filepath.Join(s.root, ConfigsGroupDir, name)
+	groups := filepath.Join(s.root, ConfigsGroupDir)
+	h.root = filepath.Join(groups, name)
+	if !ValidGroupName(name) || filepath.Dir(h.root) != groups {
+		// A group name comes from a request path or a device label, and must not escape a group directory.
+		return h, fmt.Errorf("%w: invalid group name '%s'", ErrInvalidConfig, name)
+	}
 	if forUpdate {
 		if err = h.mkdirs(defaultDirAccess, true); err != nil {
 			err = fmt.Errorf("unable to create file storage for group config %s: %w", name, err)
@@ -221,6 +426,14 @@ func (s configsFsHandle) readConfig() (content string, timestamp int64, err erro
 	return
 }
 
+func (s configsFsHandle) readTimestamp() (timestamp int64, err error) {
+	var journal []configJournalItem
+	if journal, err = s.readJournal(); err == nil && len(journal) > 0 {
+		timestamp = journal[len(journal)-1].timestamp
+	}
+	return
+}
+
 func (s configsFsHandle) writeConfig(content string) error {
 	// A file based 2-phase commit: write to file and then to journal.
 	// If either write fails - config write operation is considered as failed.
@@ -260,6 +473,29 @@ func (s configsFsHandle) readHistory(latest int) ([]string, error) {
 	return configs, nil
 }
 
+func (s configsFsHandle) readVersions(latest int) ([]ConfigVersion, error) {
+	items, err := s.readJournal()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > latest {
+		items = items[len(items)-latest:]
+	}
+	slices.Reverse(items) // Return the latest config as the first item.
+	versions := make([]ConfigVersion, 0, len(items))
+	for _, item := range items {
+		if content, err := s.readFile(item.name, false); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				break // Older config files were purged.
+			}
+			return nil, fmt.Errorf("failed to read config file %s: %w", item.name, err)
+		} else {
+			versions = append(versions, ConfigVersion{Hash: item.name, Timestamp: item.timestamp, Content: content})
+		}
+	}
+	return versions, nil
+}
+
 func (s configsFsHandle) purgeHistory(keepLatest int) (err error) {
 	// Only files on disk are purged, not the journal file.
 	// That's fine, as the journal file size is minimal.
@@ -159,6 +159,10 @@ func (s tarFsHandle) _checkDestDir(destDir, destDirPath string, cfg tarUnpackCon
 		}
 	} else if !destEmpty {
 		if cfg.replaceDest {
+			if len(cfg.tmpDir) > 0 {
+				// A destination is replaced by a temporary directory only after a successful unpack.
+				return nil
+			}
 			if err := os.RemoveAll(destDirPath); err != nil && !errors.Is(err, os.ErrNotExist) {
 				return fmt.Errorf("failed to clean destination '%s': %w", destDir, err)
 			}
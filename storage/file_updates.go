@@ -41,38 +41,78 @@ func (s *updatesFsHandleWrap) init(root string) {
 	s.Logs.category = UpdatesLogsDir
 }
 
-// checkUpdateTargets ensures that the update contains a valid targets.json file by looking for:
-//   - is it valid JSON?
-//   - does it have a target with the given tag
-func checkUpdateTargets(targetsPath, tag string) error {
-	content, err := os.ReadFile(targetsPath)
-	if err != nil {
+type updateTargets struct {
+	Signed struct {
+		Targets map[string]struct {
+			Custom struct {
+				Tags        []string            `json:"tags"`
+				ComposeApps map[string]struct{} `json:"docker_compose_apps"`
+			} `json:"custom"`
+		} `json:"targets"`
+	} `json:"signed"`
+}
+
+func readUpdateTargets(targetsPath string) (targets updateTargets, err error) {
+	var content []byte
+	if content, err = os.ReadFile(targetsPath); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return fmt.Errorf("missing required targets.json file in tuf directory")
+			err = fmt.Errorf("missing required targets.json file in tuf directory")
+		} else {
+			err = fmt.Errorf("error reading targets.json: %w", err)
 		}
-		return fmt.Errorf("error reading targets.json: %w", err)
+	} else if err = json.Unmarshal(content, &targets); err != nil {
+		err = fmt.Errorf("error parsing targets.json: %w", err)
 	}
+	return
+}
 
-	var targets struct {
-		Signed struct {
-			Targets map[string]struct {
-				Custom struct {
-					Tags []string `json:"tags"`
-				} `json:"custom"`
-			} `json:"targets"`
-		} `json:"signed"`
+// checkUpdateTargets ensures that the update contains a valid targets.json file by looking for:
+//   - is it valid JSON?
+//   - does it have a target with each of the given tags
+func checkUpdateTargets(targetsPath string, tags ...string) error {
+	targets, err := readUpdateTargets(targetsPath)
+	if err != nil {
+		return err
 	}
 
-	if err = json.Unmarshal(content, &targets); err != nil {
-		return fmt.Errorf("error parsing targets.json: %w", err)
+TAGS:
+	for _, tag := range tags {
+		for _, t := range targets.Signed.Targets {
+			if slices.Contains(t.Custom.Tags, tag) {
+				continue TAGS
+			}
+		}
+		return fmt.Errorf("no target with tag '%s' found in targets.json", tag)
 	}
+	return nil
+}
 
+// ListTargetsApps returns a sorted list of compose apps contained in update targets with a given device tag.
+func (s updatesFsHandleWrap) ListTargetsApps(tag, update, deviceTag string) ([]string, error) {
+	targets, err := readUpdateTargets(s.Tuf.FilePath(tag, update, TufTargetsFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading targets for tag %s update %s: %w", tag, update, err)
+	}
+	var apps []string
 	for _, t := range targets.Signed.Targets {
-		if slices.Contains(t.Custom.Tags, tag) {
-			return nil
+		if slices.Contains(t.Custom.Tags, deviceTag) {
+			for app := range t.Custom.ComposeApps {
+				if !slices.Contains(apps, app) {
+					apps = append(apps, app)
+				}
+			}
 		}
 	}
-	return fmt.Errorf("no target with tag '%s' found in targets.json", tag)
+	slices.Sort(apps)
+	return apps, nil
+}
+
+// CheckTargetsTags verifies that an existing update has targets for each of the given device tags.
+func (s updatesFsHandleWrap) CheckTargetsTags(tag, update string, tags []string) error {
+	if err := checkUpdateTargets(s.Tuf.FilePath(tag, update, TufTargetsFile), tags...); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+	return nil
 }
 
 func (s updatesFsHandleWrap) SaveUpload(tag, update string, payload io.Reader, onCleanupFailure func(error)) error {
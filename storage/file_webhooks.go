@@ -0,0 +1,232 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	webhooksEventsDir  = "events"
+	webhooksQueueDir   = "queue"
+	webhooksHistoryDir = "history"
+
+	// A delivery history file is rolled over once it grows above this size; one previous file is kept.
+	webhookHistoryMaxSize = 256 * 1024
+	webhookHistoryOldFile = ".1"
+)
+
+// WebhooksFsHandle keeps webhook deliveries on disk, so that they survive server restarts.
+// Directory structure:
+// - events/<event-id> - fleet events not yet queued for delivery to subscribed webhooks.
+// - queue/<webhook-id>-<event-id> - pending deliveries of an event to a webhook.
+// - history/<webhook-id> - delivery attempts of a webhook, one JSON per line.
+type WebhooksFsHandle struct {
+	baseFsHandle
+	events  baseFsHandle
+	queue   baseFsHandle
+	history baseFsHandle
+}
+
+// WebhookDelivery is a pending delivery of an event to a webhook.
+type WebhookDelivery struct {
+	WebhookId   int64        `json:"webhook-id"`
+	Event       WebhookEvent `json:"event"`
+	Attempts    int          `json:"attempts"`
+	NextAttempt int64        `json:"next-attempt"`
+}
+
+// Id uniquely identifies a delivery; it is the same for all attempts to deliver an event to a webhook.
+func (d WebhookDelivery) Id() string {
+	return fmt.Sprintf("%d-%s", d.WebhookId, d.Event.Id)
+}
+
+// WebhookAttempt is a result of a single attempt to deliver an event to a webhook.
+type WebhookAttempt struct {
+	DeliveryId string `json:"delivery-id"`
+	Event      string `json:"event"`
+	Attempt    int    `json:"attempt"`
+	Timestamp  int64  `json:"timestamp"`
+	StatusCode int    `json:"status-code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+	// Final is set when there will be no more attempts to deliver this event.
+	Final bool `json:"final"`
+}
+
+func (h *WebhooksFsHandle) init(root string) {
+	h.root = root
+	h.events.root = filepath.Join(root, webhooksEventsDir)
+	h.queue.root = filepath.Join(root, webhooksQueueDir)
+	h.history.root = filepath.Join(root, webhooksHistoryDir)
+}
+
+// AddEvent saves a fleet event to be delivered to webhooks subscribed to its type.
+func (h WebhooksFsHandle) AddEvent(eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("unexpected error marshalling webhook event data to JSON: %w", err)
+	}
+	now := time.Now()
+	// Event IDs sort in the order of events creation; a random suffix avoids collisions between processes.
+	evt := WebhookEvent{
+		Id:        fmt.Sprintf("%019d-%s", now.UnixNano(), strings.ToLower(rand.Text()[:8])),
+		Type:      eventType,
+		Timestamp: now.Unix(),
+		Data:      payload,
+	}
+	if content, err := json.Marshal(evt); err != nil {
+		return fmt.Errorf("unexpected error marshalling webhook event to JSON: %w", err)
+	} else {
+		return h.events.writeFile(evt.Id, string(content), defaultFileAccess)
+	}
+}
+
+// ListEvents returns fleet events not yet queued for delivery, oldest first.
+func (h WebhooksFsHandle) ListEvents() ([]WebhookEvent, error) {
+	names, err := h.events.matchFiles("", false)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	events := make([]WebhookEvent, 0, len(names))
+	for _, name := range names {
+		var evt WebhookEvent
+		if err = h.readJson(h.events, name, &evt); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+func (h WebhooksFsHandle) DeleteEvent(id string) error {
+	return h.events.deleteFile(id, true)
+}
+
+// QueueDelivery adds a delivery to the queue unless it is already there.
+// This makes a fan-out of an event to webhooks safe to repeat after a failure in the middle.
+func (h WebhooksFsHandle) QueueDelivery(d WebhookDelivery) error {
+	if _, err := os.Stat(filepath.Join(h.queue.root, d.Id())); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return h.SaveDelivery(d)
+}
+
+// SaveDelivery saves a queued delivery, e.g. after a failed attempt.
+func (h WebhooksFsHandle) SaveDelivery(d WebhookDelivery) error {
+	if content, err := json.Marshal(d); err != nil {
+		return fmt.Errorf("unexpected error marshalling webhook delivery to JSON: %w", err)
+	} else {
+		return h.queue.writeFile(d.Id(), string(content), defaultFileAccess)
+	}
+}
+
+func (h WebhooksFsHandle) DeleteDelivery(d WebhookDelivery) error {
+	return h.queue.deleteFile(d.Id(), true)
+}
+
+// ListDeliveries returns queued deliveries, oldest events first.
+func (h WebhooksFsHandle) ListDeliveries() ([]WebhookDelivery, error) {
+	names, err := h.queue.matchFiles("", false)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]WebhookDelivery, 0, len(names))
+	for _, name := range names {
+		var d WebhookDelivery
+		if err = h.readJson(h.queue, name, &d); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	slices.SortStableFunc(deliveries, func(a, b WebhookDelivery) int {
+		return strings.Compare(a.Event.Id, b.Event.Id)
+	})
+	return deliveries, nil
+}
+
+// AppendAttempt records a delivery attempt in the webhook history.
+func (h WebhooksFsHandle) AppendAttempt(webhookId int64, attempt WebhookAttempt) error {
+	content, err := json.Marshal(attempt)
+	if err != nil {
+		return fmt.Errorf("unexpected error marshalling webhook attempt to JSON: %w", err)
+	}
+	name := strconv.FormatInt(webhookId, 10)
+	if err = h.history.appendFile(name, string(content)+"\n", defaultFileAccess); err != nil {
+		return err
+	}
+	if info, err := os.Stat(filepath.Join(h.history.root, name)); err != nil {
+		return err
+	} else if info.Size() > webhookHistoryMaxSize {
+		return os.Rename(filepath.Join(h.history.root, name), filepath.Join(h.history.root, name+webhookHistoryOldFile))
+	}
+	return nil
+}
+
+// ReadHistory returns up to limit latest delivery attempts of a webhook, newest first.
+func (h WebhooksFsHandle) ReadHistory(webhookId int64, limit int) ([]WebhookAttempt, error) {
+	name := strconv.FormatInt(webhookId, 10)
+	var attempts []WebhookAttempt
+	for _, file := range []string{name + webhookHistoryOldFile, name} {
+		for line, err := range h.history.readFileLines(file, true, nil) {
+			if err != nil {
+				return nil, err
+			}
+			var attempt WebhookAttempt
+			if err = json.Unmarshal([]byte(line), &attempt); err != nil {
+				return nil, fmt.Errorf("unexpected error unmarshalling webhook attempt json: %w", err)
+			}
+			attempts = append(attempts, attempt)
+		}
+	}
+	slices.Reverse(attempts)
+	if limit > 0 && len(attempts) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
+
+// DeleteWebhook removes a delivery history and all pending deliveries of a webhook.
+func (h WebhooksFsHandle) DeleteWebhook(webhookId int64) error {
+	name := strconv.FormatInt(webhookId, 10)
+	errs := []error{
+		h.history.deleteFile(name, true),
+		h.history.deleteFile(name+webhookHistoryOldFile, true),
+	}
+	if names, err := h.queue.matchFiles(name+"-", false); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, name := range names {
+			errs = append(errs, h.queue.deleteFile(name, true))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h WebhooksFsHandle) readJson(dir baseFsHandle, name string, v any) error {
+	if content, err := dir.readFile(name, false); err != nil {
+		return err
+	} else if err = json.Unmarshal([]byte(content), v); err != nil {
+		return fmt.Errorf("unexpected error unmarshalling webhook file %s: %w", name, err)
+	}
+	return nil
+}
@@ -7,8 +7,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/BurntSushi/toml"
+
 	"github.com/foundriesio/dg-satellite/storage"
 )
 
@@ -18,12 +23,16 @@ type (
 	FsHandle = storage.FsHandle
 
 	AppsStates        = storage.AppsStates
+	ConfigFile        = storage.ConfigFile
+	ConfigFetched     = storage.ConfigFetched
 	DeviceUpdateEvent = storage.DeviceUpdateEvent
+	PacmanConfig      = storage.PacmanConfig
 )
 
 var (
-	NewDb = storage.NewDb
-	NewFs = storage.NewFs
+	MergeConfigs = storage.MergeConfigs
+	NewDb        = storage.NewDb
+	NewFs        = storage.NewFs
 
 	TestIdRegex        = storage.TestIdRegex
 	ValidCorrelationId = storage.ValidCorrelationId
@@ -36,9 +45,15 @@ const (
 	CertsTlsPemFile = storage.CertsTlsPemFile
 
 	// Per device files/dirs
-	AktomlFile  = storage.AktomlFile
-	HwInfoFile  = storage.HwInfoFile
-	NetInfoFile = storage.NetInfoFile
+	AktomlFile        = storage.AktomlFile
+	ConfigFetchedFile = storage.ConfigFetchedFile
+	HwInfoFile        = storage.HwInfoFile
+	NetInfoFile       = storage.NetInfoFile
+
+	SotaOverrideFile = storage.SotaOverrideFile
+
+	// Config layers
+	ConfigsDeviceDir = storage.ConfigsDeviceDir
 
 	EventsPrefix = storage.EventsPrefix
 	StatesPrefix = storage.StatesPrefix
@@ -54,9 +69,12 @@ type Storage struct {
 	db *DbHandle
 	fs *FsHandle
 
-	stmtDeviceCheckIn stmtDeviceCheckIn
-	stmtDeviceCreate  stmtDeviceCreate
-	stmtDeviceGet     stmtDeviceGet
+	stmtDeviceCheckIn       stmtDeviceCheckIn
+	stmtDeviceConfigChecked stmtDeviceConfigChecked
+	stmtDeviceConfigFetched stmtDeviceConfigFetched
+	stmtDeviceCreate        stmtDeviceCreate
+	stmtDeviceGet           stmtDeviceGet
+	stmtDevicePolling       stmtDevicePolling
 
 	maxEvents int
 	maxStates int
@@ -71,13 +89,19 @@ type Device struct {
 	GroupName  string `json:"group_name"`
 	IsProd     bool   `json:"is_prod"`
 	LastSeen   int64  `json:"last_seen"`
+	Name       string `json:"name"`
 	OstreeHash string `json:"ostree_hash"`
 	PubKey     string `json:"pubkey"`
 	TargetName string `json:"target_name"`
 	Tag        string `json:"tag"`
 	UpdateName string `json:"update_name"`
+	UpdateTag  string `json:"update_tag"`
 
-	groupNameModifiedAt int64
+	Labels map[string]string `json:"labels"`
+
+	configCheckedAt int64
+	// labelsModifiedAt is a latest change of device labels, which select a group config and fill config templates.
+	labelsModifiedAt int64
 }
 
 func (d *Device) CheckIn(targetName, tag, ostreeHash string, apps string) error {
@@ -92,13 +116,62 @@ func (d *Device) CheckIn(targetName, tag, ostreeHash string, apps string) error
 	d.OstreeHash = ostreeHash
 	d.Tag = tag
 	d.TargetName = targetName
-	return d.storage.stmtDeviceCheckIn.run(d.Uuid, targetName, tag, ostreeHash, apps, now)
+	if err := d.storage.stmtDeviceCheckIn.run(d.Uuid, targetName, tag, ostreeHash, apps, now); err != nil {
+		return err
+	}
+	d.publish(storage.LiveEventCheckIn, map[string]any{"target-name": targetName, "ostree-hash": ostreeHash, "apps": apps})
+	return nil
+}
+
+// publish sends a live event about this device to the event bus.
+func (d Device) publish(eventType string, data any) {
+	d.storage.fs.Events.Publish(storage.LiveEvent{
+		Type: eventType, Uuid: d.Uuid, Group: d.GroupName, Tag: d.Tag, Data: data,
+	})
+}
+
+// updateTag returns the tag under which the device's assigned update is stored.
+// It differs from the device tag when a rollout targets devices on several tags.
+func (d Device) updateTag(fallback string) string {
+	if len(d.UpdateTag) > 0 {
+		return d.UpdateTag
+	}
+	return fallback
 }
 
 func (d *Device) PutFile(name string, content string) error {
 	return d.storage.fs.Devices.WriteFile(d.Uuid, name, content)
 }
 
+// PutAktoml saves aktualizr-lite configuration of a device, and remembers a polling interval the device reports.
+func (d *Device) PutAktoml(content string) error {
+	if err := d.PutFile(AktomlFile, content); err != nil {
+		return err
+	}
+	return d.storage.stmtDevicePolling.run(d.Uuid, parsePollingInterval(content))
+}
+
+// parsePollingInterval returns a polling interval in seconds from aktoml, or zero if it is not there.
+// Aktualizr-lite reports all values as strings, but a number is accepted as well.
+func parsePollingInterval(aktoml string) int64 {
+	var cfg struct {
+		Uptane struct {
+			PollingSec any `toml:"polling_sec"`
+		} `toml:"uptane"`
+	}
+	if _, err := toml.Decode(aktoml, &cfg); err != nil {
+		return 0
+	}
+	var interval int64
+	switch v := cfg.Uptane.PollingSec.(type) {
+	case int64:
+		interval = v
+	case string:
+		interval, _ = strconv.ParseInt(v, 10, 64)
+	}
+	return max(interval, 0)
+}
+
 func (d Device) ProcessEvents(events []storage.DeviceUpdateEvent) error {
 	var corrId string
 	for _, evt := range events {
@@ -117,6 +190,15 @@ func (d Device) ProcessEvents(events []storage.DeviceUpdateEvent) error {
 		if err := d.storage.fs.Devices.AppendFile(d.Uuid, name, string(bytes)+"\n"); err != nil {
 			return err
 		}
+		d.publish(storage.LiveEventUpdateEvent, evt)
+		if evt.InstallationFailed() {
+			d.storage.addWebhookEvent(storage.WebhookEventInstallationFailed, map[string]any{
+				"uuid":           d.Uuid,
+				"correlation-id": corrId,
+				"target-name":    evt.Event.TargetName,
+				"details":        evt.Event.Details,
+			})
+		}
 		if status := evt.ParseStatus(); len(d.UpdateName) > 0 && len(d.Tag) > 0 {
 			status.Uuid = d.Uuid
 			bytes, err = json.Marshal(status)
@@ -127,7 +209,7 @@ func (d Device) ProcessEvents(events []storage.DeviceUpdateEvent) error {
 			if d.IsProd {
 				fs = d.storage.fs.Updates.Prod.Logs
 			}
-			if err = fs.AppendFile(d.Tag, d.UpdateName, storage.LogRolloutsFile, string(bytes)+"\n"); err != nil {
+			if err = fs.AppendFile(d.updateTag(d.Tag), d.UpdateName, storage.LogRolloutsFile, string(bytes)+"\n"); err != nil {
 				return err
 			}
 		}
@@ -136,6 +218,24 @@ func (d Device) ProcessEvents(events []storage.DeviceUpdateEvent) error {
 }
 
 func (d Device) SaveAppsStates(content string) error {
+	// Apps become unhealthy when they are unhealthy now, but were not in the previous apps states.
+	unhealthy := d.unhealthyApps(content)
+	if len(unhealthy) > 0 {
+		names, err := d.storage.fs.Devices.ListFiles(d.Uuid, storage.StatesPrefix, true)
+		if err != nil {
+			return err
+		} else if len(names) > 0 {
+			if prev, err := d.storage.fs.Devices.ReadFile(d.Uuid, names[len(names)-1]); err != nil {
+				return err
+			} else {
+				prevUnhealthy := d.unhealthyApps(prev)
+				unhealthy = slices.DeleteFunc(unhealthy, func(app string) bool {
+					return slices.Contains(prevUnhealthy, app)
+				})
+			}
+		}
+	}
+
 	// Apps states ordering depends onto ModTime.
 	// Make sure that a later events file gets a later ModTime.
 	time.Sleep(4 * time.Millisecond)
@@ -143,55 +243,84 @@ func (d Device) SaveAppsStates(content string) error {
 	if err := d.storage.fs.Devices.WriteFile(d.Uuid, name, content); err != nil {
 		return err
 	}
+	d.publish(storage.LiveEventAppsStates, json.RawMessage(content))
+	if len(unhealthy) > 0 {
+		d.storage.addWebhookEvent(storage.WebhookEventAppsUnhealthy, map[string]any{"uuid": d.Uuid, "apps": unhealthy})
+	}
 	return d.storage.fs.Devices.RolloverFiles(d.Uuid, storage.StatesPrefix, d.storage.maxStates)
 }
 
+func (d Device) unhealthyApps(content string) []string {
+	var states AppsStates
+	if err := json.Unmarshal([]byte(content), &states); err != nil {
+		// A gateway handler verifies new apps states; this can only happen to a corrupted previous file.
+		slog.Warn("Failed to parse apps states", "uuid", d.Uuid, "error", err)
+		return nil
+	}
+	return states.UnhealthyApps()
+}
+
 func (d Device) GetAppsFilePath(file string) string {
 	if d.IsProd {
-		return d.storage.fs.Updates.Prod.Apps.FilePath(d.Tag, d.UpdateName, file)
+		return d.storage.fs.Updates.Prod.Apps.FilePath(d.updateTag(d.Tag), d.UpdateName, file)
 	} else {
-		return d.storage.fs.Updates.Ci.Apps.FilePath(d.Tag, d.UpdateName, file)
+		return d.storage.fs.Updates.Ci.Apps.FilePath(d.updateTag(d.Tag), d.UpdateName, file)
 	}
 }
 
 func (d Device) GetOstreeFilePath(file string) string {
 	if d.IsProd {
-		return d.storage.fs.Updates.Prod.Ostree.FilePath(d.Tag, d.UpdateName, file)
+		return d.storage.fs.Updates.Prod.Ostree.FilePath(d.updateTag(d.Tag), d.UpdateName, file)
 	} else {
-		return d.storage.fs.Updates.Ci.Ostree.FilePath(d.Tag, d.UpdateName, file)
+		return d.storage.fs.Updates.Ci.Ostree.FilePath(d.updateTag(d.Tag), d.UpdateName, file)
 	}
 }
 
 func (d Device) GetTufMeta(tag, file string) (string, error) {
 	if d.IsProd {
-		return d.storage.fs.Updates.Prod.Tuf.ReadFile(tag, d.UpdateName, file)
+		return d.storage.fs.Updates.Prod.Tuf.ReadFile(d.updateTag(tag), d.UpdateName, file)
 	} else {
-		return d.storage.fs.Updates.Ci.Tuf.ReadFile(tag, d.UpdateName, file)
+		return d.storage.fs.Updates.Ci.Tuf.ReadFile(d.updateTag(tag), d.UpdateName, file)
 	}
 }
 
 func (d Device) GetConfigs() (configs [3]string, timestamp int64, err error) {
 	// Returns 3 configs (in order): factory, group, device; and their latest modification timestamp.
-	var ts int64
-	timestamp = d.groupNameModifiedAt
-	if configs[0], ts, err = d.storage.fs.Configs.ReadFactoryConfig(); err != nil {
-		return
-	} else if ts > timestamp {
-		timestamp = ts
+	// A device group or other label change also changes its config, so it is accounted for in the timestamp.
+	configs, timestamp, err = d.storage.fs.Configs.ReadConfigLayers(d.Uuid, d.GroupName)
+	timestamp = max(timestamp, d.labelsModifiedAt)
+	return
+}
+
+// ConfigTemplateData returns values which templated config files are rendered with for this device.
+func (d Device) ConfigTemplateData() storage.ConfigTemplateData {
+	return storage.ConfigTemplateData{Uuid: d.Uuid, Name: d.Name, Labels: d.Labels}
+}
+
+// SaveConfigFetched remembers which config a device received, so that operators can compare it to the latest one.
+func (d *Device) SaveConfigFetched(timestamp int64, files map[string]*ConfigFile) error {
+	fetched, err := storage.NewConfigFetched(timestamp, time.Now().Unix(), files)
+	if err != nil {
+		return err
 	}
-	if len(d.GroupName) > 0 {
-		if configs[1], ts, err = d.storage.fs.Configs.ReadGroupConfig(d.GroupName); err != nil {
-			return
-		} else if ts > timestamp {
-			timestamp = ts
-		}
+	if bytes, err := json.Marshal(fetched); err != nil {
+		return fmt.Errorf("unexpected error marshalling fetched config to JSON: %w", err)
+	} else if err = d.PutFile(storage.ConfigFetchedFile, string(bytes)); err != nil {
+		return err
 	}
-	if configs[2], ts, err = d.storage.fs.Configs.ReadDeviceConfig(d.Uuid); err != nil {
-		return
-	} else if ts > timestamp {
-		timestamp = ts
+	d.configCheckedAt = fetched.FetchedAt
+	return d.storage.stmtDeviceConfigFetched.run(d.Uuid, fetched.Timestamp, fetched.Hash, fetched.FetchedAt)
+}
+
+// SaveConfigChecked remembers when a device found its config unchanged.
+func (d *Device) SaveConfigChecked() error {
+	now := time.Now().Unix()
+	if now-d.configCheckedAt < 60 {
+		// Skip database updating when the last check was less than a minute ago.
+		return nil
 	}
-	return
+	d.configCheckedAt = now
+	return d.storage.stmtDeviceConfigChecked.run(d.Uuid, now)
 }
 
 func NewStorage(db *storage.DbHandle, fs *storage.FsHandle) (*Storage, error) {
@@ -204,7 +333,10 @@ func NewStorage(db *storage.DbHandle, fs *storage.FsHandle) (*Storage, error) {
 
 	if err := db.InitStmt(
 		&handle.stmtDeviceCheckIn,
+		&handle.stmtDeviceConfigChecked,
+		&handle.stmtDeviceConfigFetched,
 		&handle.stmtDeviceCreate,
+		&handle.stmtDevicePolling,
 		&handle.stmtDeviceGet,
 	); err != nil {
 		return nil, err
@@ -228,6 +360,8 @@ func (s Storage) DeviceCreate(uuid, pubkey string, isProd bool) (*Device, error)
 		PubKey:   pubkey,
 		IsProd:   isProd,
 	}
+	s.addWebhookEvent(storage.WebhookEventDeviceCreated, map[string]any{"uuid": uuid, "is-prod": isProd})
+	d.publish(storage.LiveEventDeviceCreated, map[string]any{"is-prod": isProd})
 	return &d, nil
 }
 
@@ -242,13 +376,22 @@ func (s Storage) DeviceGet(uuid string) (*Device, error) {
 	return &d, nil
 }
 
+// addWebhookEvent saves a fleet event for webhooks; a failure is not critical for a device.
+func (s Storage) addWebhookEvent(eventType string, data any) {
+	if err := s.fs.Webhooks.AddEvent(eventType, data); err != nil {
+		slog.Error("Failed to save webhook event", "event", eventType, "error", err)
+	}
+}
+
 type stmtDeviceCheckIn storage.DbStmt
 
 func (s *stmtDeviceCheckIn) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("DeviceCheckIn", `
 		UPDATE devices
-		SET target_name=?, tag=?, ostree_hash=?, apps=?, last_seen=?
-		WHERE uuid = ?`,
+		SET target_name=?1, tag=?2, ostree_hash=?3, apps=?4, last_seen=?5,
+			-- Remember when a device first reported a tag it is being migrated to.
+			tag_migrated_at=IIF(tag_target != '' AND tag_target = ?2, IIF(tag_migrated_at = 0, ?5, tag_migrated_at), 0)
+		WHERE uuid = ?6`,
 	)
 	return
 }
@@ -258,12 +401,56 @@ func (s *stmtDeviceCheckIn) run(uuid, targetName, tag, ostreeHash, apps string,
 	return err
 }
 
+type stmtDeviceConfigChecked storage.DbStmt
+
+func (s *stmtDeviceConfigChecked) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("DeviceConfigChecked", `
+		UPDATE devices SET config_checked_at=? WHERE uuid = ?`,
+	)
+	return
+}
+
+func (s *stmtDeviceConfigChecked) run(uuid string, checkedAt int64) error {
+	_, err := s.Stmt.Exec(checkedAt, uuid)
+	return err
+}
+
+type stmtDevicePolling storage.DbStmt
+
+func (s *stmtDevicePolling) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("DevicePolling", `
+		UPDATE devices SET polling_interval=? WHERE uuid = ?`,
+	)
+	return
+}
+
+func (s *stmtDevicePolling) run(uuid string, interval int64) error {
+	_, err := s.Stmt.Exec(interval, uuid)
+	return err
+}
+
+type stmtDeviceConfigFetched storage.DbStmt
+
+func (s *stmtDeviceConfigFetched) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("DeviceConfigFetched", `
+		UPDATE devices
+		SET config_timestamp=?1, config_hash=?2, config_fetched_at=?3, config_checked_at=?3
+		WHERE uuid = ?4`,
+	)
+	return
+}
+
+func (s *stmtDeviceConfigFetched) run(uuid string, timestamp int64, hash string, fetchedAt int64) error {
+	_, err := s.Stmt.Exec(timestamp, hash, fetchedAt, uuid)
+	return err
+}
+
 type stmtDeviceCreate storage.DbStmt
 
 func (s *stmtDeviceCreate) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("DeviceCreate", `
-		INSERT INTO devices(uuid, pubkey, created_at, last_seen, is_prod, deleted)
-		VALUES (?, ?, ?, ?, ?, false)`,
+		INSERT INTO devices(uuid, pubkey, created_at, last_seen, is_prod, deleted, online)
+		VALUES (?, ?, ?, ?, ?, false, true)`,
 	)
 	return
 }
@@ -279,7 +466,7 @@ func (s *stmtDeviceGet) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("DeviceGet", `
 		SELECT
 			deleted, pubkey, group_name, update_name, last_seen, is_prod, tag, target_name,
-			ostree_hash, apps, group_name_modified_at
+			ostree_hash, apps, MAX(group_name_modified_at, labels_modified_at), update_tag, name, json(labels), config_checked_at
 		FROM devices
 		WHERE uuid = ?`,
 	)
@@ -287,7 +474,14 @@ func (s *stmtDeviceGet) Init(db storage.DbHandle) (err error) {
 }
 
 func (s *stmtDeviceGet) run(uuid string, d *Device) error {
-	return s.Stmt.QueryRow(uuid).Scan(
+	var labels string
+	if err := s.Stmt.QueryRow(uuid).Scan(
 		&d.Deleted, &d.PubKey, &d.GroupName, &d.UpdateName, &d.LastSeen, &d.IsProd, &d.Tag, &d.TargetName,
-		&d.OstreeHash, &d.Apps, &d.groupNameModifiedAt)
+		&d.OstreeHash, &d.Apps, &d.labelsModifiedAt, &d.UpdateTag, &d.Name, &labels, &d.configCheckedAt,
+	); err != nil {
+		return err
+	} else if err = json.Unmarshal([]byte(labels), &d.Labels); err != nil {
+		return fmt.Errorf("failed to parse device labels: %w", err)
+	}
+	return nil
 }
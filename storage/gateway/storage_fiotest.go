@@ -61,6 +61,7 @@ func (d *Device) TestComplete(testId, status, details string, results []storage.
 	if err := d.storage.fs.Devices.WriteFile(d.Uuid, fmt.Sprintf("%s%s", storage.TestsPrefix, testId), string(testBytes)); err != nil {
 		return fmt.Errorf("failed to save completed test data for %s: %w", testId, err)
 	}
+	d.publish(storage.LiveEventTestCompleted, t)
 	return nil
 }
 
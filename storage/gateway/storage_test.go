@@ -368,3 +368,12 @@ func Test_Fiotest(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, "artifact content", string(content))
 }
+
+func TestParsePollingInterval(t *testing.T) {
+	require.Equal(t, int64(300), parsePollingInterval("[uptane]\npolling_sec = \"300\"\n"))
+	require.Equal(t, int64(60), parsePollingInterval("[uptane]\npolling_sec = 60\n"))
+	require.Equal(t, int64(0), parsePollingInterval("[uptane]\nrepo_server = \"x\"\n"))
+	require.Equal(t, int64(0), parsePollingInterval("[uptane]\npolling_sec = \"soon\"\n"))
+	require.Equal(t, int64(0), parsePollingInterval("[uptane]\npolling_sec = -5\n"))
+	require.Equal(t, int64(0), parsePollingInterval("[config]\nkey=value"))
+}
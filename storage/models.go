@@ -4,7 +4,17 @@
 package storage
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
 )
 
 // DeviceUpdateEvent represents update events that devices send the
@@ -18,6 +28,18 @@ type DeviceUpdateEvent struct {
 
 var ValidCorrelationId = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`).MatchString
 
+// Device label values are case-sensitive. Group names are label values too,
+// so that configs of each group can be stored in its own directory.
+const ValidLabelValueRegex = `^[a-zA-Z0-9_\-\.]+$`
+
+var ValidLabelValue = regexp.MustCompile(ValidLabelValueRegex).MatchString
+
+// ValidGroupName tells if a label value can name a group.
+// As it names a config directory, relative path elements are not allowed.
+func ValidGroupName(name string) bool {
+	return ValidLabelValue(name) && name != "." && name != ".."
+}
+
 type DeviceEvent struct {
 	CorrelationId string `json:"correlationId"`
 	Ecu           string `json:"ecu"`
@@ -122,3 +144,293 @@ type TargetTest struct {
 	Artifacts   []string           `json:"artifacts,omitempty"`
 	Results     []TargetTestResult `json:"results,omitempty"`
 }
+
+// SotaOverrideFile is a config file which devices merge on top of their aktualizr-lite configuration.
+const SotaOverrideFile = "z-50-fioctl.toml"
+
+// SotaOverrideOnChanged is a handler which applies the SotaOverrideFile changes on devices.
+var SotaOverrideOnChanged = []string{"/usr/share/fioconfig/handlers/aktualizr-toml-update"}
+
+type ConfigFile struct {
+	Value       string
+	Unencrypted *bool    `json:"Unencrypted,omitempty"`
+	OnChanged   []string `json:"OnChanged,omitempty"`
+	// Template marks a value as a Go text template, rendered for each device with ConfigTemplateData.
+	// Devices receive rendered values without this marker.
+	Template bool `json:"Template,omitempty"`
+}
+
+// ConfigTemplateData is what templated config values can refer to, e.g. {{ .Labels.site }}.
+// Missing labels are rendered as empty strings.
+type ConfigTemplateData struct {
+	Uuid   string
+	Name   string
+	Labels map[string]string
+}
+
+// Render renders a templated config value; a value which is not a template is left as is.
+func (f *ConfigFile) Render(name string, data ConfigTemplateData) error {
+	if !f.Template {
+		return nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(f.Value)
+	if err != nil {
+		return err
+	}
+	var buf strings.Builder
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	f.Value = buf.String()
+	f.Template = false
+	return nil
+}
+
+// ValidateConfig verifies that a config parses, and that its templated values render for any device.
+func ValidateConfig(content string) error {
+	if len(content) == 0 {
+		return nil
+	}
+	var files map[string]*ConfigFile
+	if err := json.Unmarshal([]byte(content), &files); err != nil {
+		return fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	for name, file := range files {
+		if file == nil {
+			return fmt.Errorf("%w: config file %s is null", ErrInvalidConfig, name)
+		} else if err := ValidateConfigFile(name, *file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateConfigFile verifies that a templated config value renders for any device,
+// and that a sota toml override file parses.
+func ValidateConfigFile(name string, file ConfigFile) error {
+	// Execution catches references to unknown fields, which parsing alone does not.
+	if err := file.Render(name, ConfigTemplateData{}); err != nil {
+		return fmt.Errorf("invalid template in config file %s: %w", name, err)
+	}
+	if name == SotaOverrideFile {
+		if err := make(PacmanConfig).Merge(file.Value); err != nil {
+			return fmt.Errorf("invalid sota toml in config file %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ConfigLayers are names of config layers in the order they are merged for a device.
+var ConfigLayers = [3]string{ConfigsFactoryDir, ConfigsGroupDir, ConfigsDeviceDir}
+
+// MergeConfigs merges factory, group, and device configs into a config which a device receives.
+// Templated values are rendered for a device before merging; a file which fails to render is left out.
+// A file in a later layer replaces the same file in an earlier layer, except for the SotaOverrideFile,
+// whose TOML content is merged across layers.
+// It also returns names of layers which define each file, in the merge order.
+func MergeConfigs(
+	configs [3]string, data ConfigTemplateData,
+) (files map[string]*ConfigFile, layers map[string][]string, err error) {
+	// A reference type here allows manipulating map values directly below.
+	files = make(map[string]*ConfigFile)
+	layers = make(map[string][]string)
+	pacmanCfg := make(PacmanConfig)
+	for i, rawConfig := range configs {
+		var cfg map[string]*ConfigFile
+		if len(rawConfig) == 0 {
+			continue
+		} else if err = json.Unmarshal([]byte(rawConfig), &cfg); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s config JSON: %w", ConfigLayers[i], err)
+		}
+		for k, v := range cfg {
+			if v == nil {
+				// Configs stored before validation was added may have null files.
+				continue
+			}
+			// Templates are validated on upload, but may still fail with labels of some device.
+			// Such a file is left out, so that a device still gets the rest of its config.
+			if err := v.Render(k, data); err != nil {
+				slog.Warn("Skipping config file which failed to render",
+					"uuid", data.Uuid, "layer", ConfigLayers[i], "file", k, "error", err)
+				continue
+			} else if k == SotaOverrideFile {
+				if err := pacmanCfg.Merge(v.Value); err != nil {
+					slog.Warn("Skipping sota toml config which failed to parse",
+						"uuid", data.Uuid, "layer", ConfigLayers[i], "error", err)
+					continue
+				}
+			}
+			files[k] = v
+			layers[k] = append(layers[k], ConfigLayers[i])
+		}
+	}
+	if !pacmanCfg.Empty() {
+		if files[SotaOverrideFile].Value, err = pacmanCfg.Encode(); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode merged sota toml config: %w", err)
+		}
+	}
+	return
+}
+
+// ConfigFileDigest identifies a config file content without keeping its possibly secret value.
+type ConfigFileDigest struct {
+	Hash        string   `json:"hash"`
+	Unencrypted *bool    `json:"unencrypted,omitempty"`
+	OnChanged   []string `json:"on-changed,omitempty"`
+}
+
+func NewConfigFileDigest(file ConfigFile) ConfigFileDigest {
+	return ConfigFileDigest{
+		Hash:        fmt.Sprintf("%x", sha256.Sum256([]byte(file.Value))),
+		Unencrypted: file.Unencrypted,
+		OnChanged:   file.OnChanged,
+	}
+}
+
+func (d ConfigFileDigest) Equal(other ConfigFileDigest) bool {
+	unencrypted := func(v *bool) bool { return v != nil && *v }
+	return d.Hash == other.Hash &&
+		unencrypted(d.Unencrypted) == unencrypted(other.Unencrypted) &&
+		slices.Equal(d.OnChanged, other.OnChanged)
+}
+
+// ConfigFetched describes a config which a device received last time it fetched a changed config.
+type ConfigFetched struct {
+	// Timestamp is a modification time of a config (the Date header value), FetchedAt is when it was served.
+	Timestamp int64                       `json:"timestamp"`
+	FetchedAt int64                       `json:"fetched-at"`
+	Hash      string                      `json:"hash"`
+	Files     map[string]ConfigFileDigest `json:"files"`
+}
+
+// NewConfigFetched digests config files served to a device; a hash identifies the whole config it received.
+func NewConfigFetched(timestamp, fetchedAt int64, files map[string]*ConfigFile) (res ConfigFetched, err error) {
+	res = ConfigFetched{
+		Timestamp: timestamp,
+		FetchedAt: fetchedAt,
+		Files:     make(map[string]ConfigFileDigest, len(files)),
+	}
+	for name, file := range files {
+		res.Files[name] = NewConfigFileDigest(*file)
+	}
+	// JSON encoding sorts map keys, so that the same files always produce the same hash.
+	if bytes, err := json.Marshal(res.Files); err != nil {
+		return res, fmt.Errorf("unexpected error marshalling config digest to JSON: %w", err)
+	} else {
+		res.Hash = fmt.Sprintf("%x", sha256.Sum256(bytes))
+	}
+	return
+}
+
+// PacmanConfig is a parsed content of the SotaOverrideFile.
+type PacmanConfig map[string]map[string]interface{}
+
+func (p PacmanConfig) Empty() bool {
+	return len(p) == 0
+}
+
+func (p PacmanConfig) Encode() (string, error) {
+	buf := new(bytes.Buffer)
+	encoder := toml.NewEncoder(buf)
+	encoder.Indent = ""
+	if err := encoder.Encode(p); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (p PacmanConfig) Merge(tomlString string) error {
+	var data PacmanConfig
+	err := toml.Unmarshal([]byte(tomlString), &data)
+	if err != nil {
+		return err
+	}
+	for section, values := range data {
+		if p[section] == nil {
+			p[section] = values
+			continue
+		}
+		for k, v := range values {
+			p[section][k] = v
+		}
+	}
+	return nil
+}
+
+// Fleet events which webhooks can subscribe to.
+const (
+	WebhookEventDeviceCreated      = "device-created"
+	WebhookEventDeviceDeleted      = "device-deleted"
+	WebhookEventDeviceOffline      = "device-offline"
+	WebhookEventDeviceOnline       = "device-online"
+	WebhookEventUpdateUploaded     = "update-uploaded"
+	WebhookEventRolloutCreated     = "rollout-created"
+	WebhookEventRolloutCommitted   = "rollout-committed"
+	WebhookEventInstallationFailed = "installation-failed"
+	WebhookEventAppsUnhealthy      = "apps-unhealthy"
+)
+
+var WebhookEventTypes = []string{
+	WebhookEventDeviceCreated,
+	WebhookEventDeviceDeleted,
+	WebhookEventDeviceOffline,
+	WebhookEventDeviceOnline,
+	WebhookEventUpdateUploaded,
+	WebhookEventRolloutCreated,
+	WebhookEventRolloutCommitted,
+	WebhookEventInstallationFailed,
+	WebhookEventAppsUnhealthy,
+}
+
+// WebhookEvent is a payload which webhooks receive for each fleet event they subscribe to.
+type WebhookEvent struct {
+	Id        string          `json:"id"`
+	Type      string          `json:"type"`
+	Timestamp int64           `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// InstallationFailed tells if an event reports a failed update installation.
+func (e DeviceUpdateEvent) InstallationFailed() bool {
+	return e.EventType.Id == "EcuInstallationCompleted" && e.Event.Success != nil && !*e.Event.Success
+}
+
+// UnhealthyApps returns a sorted list of apps which are unhealthy or have unhealthy services.
+func (s AppsStates) UnhealthyApps() (res []string) {
+	for name, app := range s.Apps {
+		unhealthy := app.State == "unhealthy"
+		for _, svc := range app.Services {
+			unhealthy = unhealthy || svc.Health == "unhealthy"
+		}
+		if unhealthy {
+			res = append(res, name)
+		}
+	}
+	slices.Sort(res)
+	return
+}
+
+// DeviceFilter limits access to devices on one of the given tags and in one of the given groups.
+// An empty list of tags or groups does not limit access by that property.
+type DeviceFilter struct {
+	Tags   []string `json:"tags,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Unrestricted tells if a filter allows access to all devices.
+func (f DeviceFilter) Unrestricted() bool {
+	return len(f.Tags) == 0 && len(f.Groups) == 0
+}
+
+func (f DeviceFilter) AllowsTag(tag string) bool {
+	return len(f.Tags) == 0 || slices.Contains(f.Tags, tag)
+}
+
+func (f DeviceFilter) AllowsGroup(group string) bool {
+	return len(f.Groups) == 0 || slices.Contains(f.Groups, group)
+}
+
+// Allows tells if a device on a given tag and in a given group passes a filter.
+func (f DeviceFilter) Allows(tag, group string) bool {
+	return f.AllowsTag(tag) && f.AllowsGroup(group)
+}
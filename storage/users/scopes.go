@@ -4,6 +4,7 @@
 package users
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -20,9 +21,13 @@ const (
 	scopeC Scopes = 1 << 2
 	scopeD Scopes = 1 << 3
 
-	scopeShiftDevices Scopes = 0
-	scopeShiftUpdates Scopes = 4
-	scopeShiftUsers   Scopes = 8
+	scopeShiftDevices  Scopes = 0
+	scopeShiftUpdates  Scopes = 4
+	scopeShiftUsers    Scopes = 8
+	scopeShiftConfigs  Scopes = 12
+	scopeShiftRollouts Scopes = 16
+	scopeShiftLabels   Scopes = 20
+	scopeShiftAudit    Scopes = 24
 
 	ScopeDevicesR  = scopeR << scopeShiftDevices
 	ScopeDevicesRU = (scopeU | scopeR) << scopeShiftDevices
@@ -35,6 +40,20 @@ const (
 	ScopeUsersRU = (scopeU | scopeR) << scopeShiftUsers
 	ScopeUsersC  = scopeC << scopeShiftUsers
 	ScopeUsersD  = scopeD << scopeShiftUsers
+
+	ScopeConfigsR  = scopeR << scopeShiftConfigs
+	ScopeConfigsRU = (scopeU | scopeR) << scopeShiftConfigs
+
+	// Rollouts of CI updates require rollouts:create, while rollouts of production updates also require
+	// rollouts:approve, so that those who create updates need not be able to push them to production devices.
+	ScopeRolloutsR       = scopeR << scopeShiftRollouts
+	ScopeRolloutsC       = scopeC << scopeShiftRollouts
+	ScopeRolloutsApprove = scopeU << scopeShiftRollouts
+
+	// Labels are read along with devices, so there is only a scope to change them.
+	ScopeLabelsRU = (scopeU | scopeR) << scopeShiftLabels
+
+	ScopeAuditR = scopeR << scopeShiftAudit
 )
 
 var maskToString = map[Scopes]string{
@@ -49,6 +68,17 @@ var maskToString = map[Scopes]string{
 	ScopeUsersRU: "users:read-update",
 	ScopeUsersC:  "users:create",
 	ScopeUsersD:  "users:delete",
+
+	ScopeConfigsR:  "configs:read",
+	ScopeConfigsRU: "configs:read-update",
+
+	ScopeRolloutsR:       "rollouts:read",
+	ScopeRolloutsC:       "rollouts:create",
+	ScopeRolloutsApprove: "rollouts:approve",
+
+	ScopeLabelsRU: "labels:read-update",
+
+	ScopeAuditR: "audit:read",
 }
 
 var stringToMask = map[string]Scopes{}
@@ -80,7 +110,11 @@ func ScopesAvailable() []string {
 }
 
 // ScopesFromString parses a comma-separated list of scopes into a Scopes bitmask.
+// An empty string means no scopes, as stored for users whose access was revoked.
 func ScopesFromString(scopes string) (Scopes, error) {
+	if len(scopes) == 0 {
+		return 0, nil
+	}
 	return ScopesFromSlice(strings.Split(scopes, ","))
 }
 
@@ -121,6 +155,23 @@ OUTER:
 	return result
 }
 
+// MarshalJSON encodes scopes as a list of their names, so that API clients need not know the bitmask.
+func (s Scopes) MarshalJSON() ([]byte, error) {
+	scopes := s.ToSlice()
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return json.Marshal(scopes)
+}
+
+func (s *Scopes) UnmarshalJSON(data []byte) (err error) {
+	var scopes []string
+	if err = json.Unmarshal(data, &scopes); err == nil {
+		*s, err = ScopesFromSlice(scopes)
+	}
+	return
+}
+
 func (s Scopes) Has(scope Scopes) bool {
 	return s&scope == scope
 }
@@ -4,6 +4,7 @@
 package users
 
 import (
+	"encoding/json"
 	"slices"
 	"testing"
 )
@@ -43,6 +44,11 @@ func TestScopesFromString(t *testing.T) {
 			want:   ScopeDevicesRU | ScopeUpdatesR,
 			has:    []Scopes{ScopeDevicesR, ScopeDevicesRU, ScopeUpdatesR},
 		},
+		{
+			name:   "No scopes",
+			scopes: "",
+			want:   0,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -94,6 +100,11 @@ func TestScopes_ToSlice(t *testing.T) {
 			scopes: ScopeUsersRU | ScopeUsersC | ScopeUpdatesRU,
 			want:   []string{"updates:read-update", "users:create", "users:read-update"},
 		},
+		{
+			name:   "rollouts:read, rollouts:create, rollouts:approve",
+			scopes: ScopeRolloutsR | ScopeRolloutsC | ScopeRolloutsApprove,
+			want:   []string{"rollouts:approve", "rollouts:create", "rollouts:read"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -109,6 +120,18 @@ func TestScopes_ToSlice(t *testing.T) {
 			if got != tt.scopes {
 				t.Errorf("ScopesFromSlice() = %v, want %v", got, tt.scopes)
 			}
+
+			data, err := json.Marshal(tt.scopes)
+			if err != nil {
+				t.Fatalf("json.Marshal() failed: %v", err)
+			}
+			var fromJson Scopes
+			if err = json.Unmarshal(data, &fromJson); err != nil {
+				t.Fatalf("json.Unmarshal(%s) failed: %v", data, err)
+			}
+			if fromJson != tt.scopes {
+				t.Errorf("json.Unmarshal(%s) = %v, want %v", data, fromJson, tt.scopes)
+			}
 		})
 	}
 }
@@ -8,12 +8,30 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/foundriesio/dg-satellite/storage"
 )
 
+// sessionPublicIDLen is a length of a hashed session ID prefix, which identifies a session without revealing its cookie.
+const sessionPublicIDLen = 16
+
+// Session describes an active session of a user, without its cookie.
+type Session struct {
+	ID        string `json:"id"`
+	RemoteIP  string `json:"remote-ip"`
+	CreatedAt int64  `json:"created-at"`
+	ExpiresAt int64  `json:"expires-at"`
+	Scopes    Scopes `json:"scopes"`
+	// Current is set by handlers for a session that made a current request.
+	Current bool `json:"current,omitempty"`
+}
+
+var ErrServiceAccountLogin = errors.New("service accounts cannot log in")
+
 func (s Storage) hashSessionID(id string) (string, error) {
 	key, err := s.genTokenKey(id)
 	if err != nil {
@@ -44,12 +62,17 @@ func (s Storage) GetBySession(id string) (*User, error) {
 	if u != nil {
 		u.h = s
 		u.AllowedScopes = sess.Scopes & u.AllowedScopes
+		u.AuthMethod = AuthMethodSession
+		u.AuthId = hashed[:sessionPublicIDLen]
 	}
 
 	return u, err
 }
 
 func (u User) CreateSession(remoteIP string, expires int64, scopes Scopes) (string, error) {
+	if u.ServiceAccount {
+		return "", ErrServiceAccountLogin
+	}
 	if scopes&u.AllowedScopes != scopes {
 		return "", fmt.Errorf("requested scopes %s exceed allowed scopes %s", scopes.String(), u.AllowedScopes.String())
 	}
@@ -62,7 +85,7 @@ func (u User) CreateSession(remoteIP string, expires int64, scopes Scopes) (stri
 		return "", fmt.Errorf("unable to create session: %w", err)
 	}
 
-	msg := fmt.Sprintf("Session created (ip=%s, expires=%d, scopes=%s)", remoteIP, expires, scopes)
+	msg := fmt.Sprintf("Session created (id=%s, ip=%s, expires=%d, scopes=%s)", hashed[:sessionPublicIDLen], remoteIP, expires, scopes)
 	u.h.fs.Audit.AppendEvent(u.id, msg)
 	return idStr, nil
 }
@@ -75,11 +98,40 @@ func (u User) DeleteSession(id string) error {
 	if err := u.h.stmtSessionDelete.run(hashed); err != nil {
 		return fmt.Errorf("unable to delete session: %w", err)
 	}
-	msg := fmt.Sprintf("Session deleted id=%s", id)
+	msg := fmt.Sprintf("Session deleted id=%s", hashed[:sessionPublicIDLen])
 	u.h.fs.Audit.AppendEvent(u.id, msg)
 	return nil
 }
 
+// ListSessions returns unexpired sessions of a user, oldest first.
+func (u User) ListSessions() ([]Session, error) {
+	return u.h.stmtSessionList.run(u, time.Now().Unix())
+}
+
+// RevokeSession deletes a session by its public ID, returning false if a user has no such session.
+func (u User) RevokeSession(id string, by string) (bool, error) {
+	if len(id) != sessionPublicIDLen {
+		return false, nil
+	}
+	deleted, err := u.h.stmtSessionRevoke.run(u, id)
+	if err != nil {
+		return false, fmt.Errorf("unable to revoke session: %w", err)
+	} else if deleted {
+		msg := fmt.Sprintf("Session revoked id=%s by %s", id, by)
+		u.h.fs.Audit.AppendEvent(u.id, msg)
+	}
+	return deleted, nil
+}
+
+// RevokeAllSessions logs a user out everywhere.
+func (u User) RevokeAllSessions(by string) error {
+	if err := u.h.stmtSessionDeleteAll.run(u); err != nil {
+		return fmt.Errorf("unable to revoke sessions: %w", err)
+	}
+	u.h.fs.Audit.AppendEvent(u.id, "All sessions revoked by "+by)
+	return nil
+}
+
 type session struct {
 	UserID    int64
 	RemoteIP  string
@@ -124,6 +176,21 @@ func (s *stmtSessionDelete) run(id string) error {
 	return err
 }
 
+type stmtSessionDeleteAll storage.DbStmt
+
+func (s *stmtSessionDeleteAll) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("sessionDeleteAll", `
+		DELETE FROM session
+		WHERE user_id = ?`,
+	)
+	return
+}
+
+func (s *stmtSessionDeleteAll) run(u User) error {
+	_, err := s.Stmt.Exec(u.id)
+	return err
+}
+
 type stmtSessionDeleteExpired storage.DbStmt
 
 func (s *stmtSessionDeleteExpired) Init(db storage.DbHandle) (err error) {
@@ -170,3 +237,68 @@ func (s *stmtSessionGet) run(id string) (*session, error) {
 	}
 	return &sess, nil
 }
+
+type stmtSessionList storage.DbStmt
+
+func (s *stmtSessionList) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("sessionList", `
+		SELECT substr(id, 1, 16), remote_ip, created_at, expires_at, scopes
+		FROM session
+		WHERE user_id = ? AND expires_at >= ?
+		ORDER BY created_at ASC`,
+	)
+	return
+}
+
+func (s *stmtSessionList) run(u User, now int64) ([]Session, error) {
+	var sessions []Session
+	rows, err := s.Stmt.Query(u.id, now)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("stmtSessionList: failed to close rows", "error", err)
+		}
+	}()
+
+	for rows.Next() {
+		var scopesStr string
+		var sess Session
+		err := rows.Scan(
+			&sess.ID,
+			&sess.RemoteIP,
+			&sess.CreatedAt,
+			&sess.ExpiresAt,
+			&scopesStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sess.Scopes, err = ScopesFromString(scopesStr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse scopes: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+type stmtSessionRevoke storage.DbStmt
+
+func (s *stmtSessionRevoke) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("sessionRevoke", `
+		DELETE FROM session
+		WHERE user_id = ? AND substr(id, 1, 16) = ?`,
+	)
+	return
+}
+
+func (s *stmtSessionRevoke) run(u User, id string) (bool, error) {
+	res, err := s.Stmt.Exec(u.id, id)
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
@@ -8,9 +8,12 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/foundriesio/dg-satellite/storage"
@@ -18,12 +21,30 @@ import (
 )
 
 type Token struct {
-	PublicID    int64
-	CreatedAt   int64
-	ExpiresAt   int64
-	Description string
-	Scopes      Scopes
-	Value       string
+	PublicID    int64  `json:"id"`
+	CreatedAt   int64  `json:"created-at"`
+	ExpiresAt   int64  `json:"expires-at"`
+	Description string `json:"description"`
+	Scopes      Scopes `json:"scopes"`
+	Value       string `json:"value,omitempty"`
+	LastUsedAt  int64  `json:"last-used-at,omitempty"`
+	LastUsedIP  string `json:"last-used-ip,omitempty"`
+}
+
+// tokenUsageInterval limits how often a token usage is saved, so that busy clients do not write on each request.
+const tokenUsageInterval = 60
+
+// SetMaxTokenLifetime limits how long API tokens stay valid after they are created, no limit if zero.
+// Existing tokens which outlived it are rejected, even if they expire later.
+func (s *Storage) SetMaxTokenLifetime(lifetime time.Duration) {
+	s.maxTokenLifetime = int64(lifetime.Seconds())
+}
+
+// capExpiry lowers a token expiration to the maximum token lifetime.
+func (s Storage) capExpiry(t *Token) {
+	if s.maxTokenLifetime > 0 {
+		t.ExpiresAt = min(t.ExpiresAt, t.CreatedAt+s.maxTokenLifetime)
+	}
 }
 
 func (s Storage) genTokenKey(token string) ([]byte, error) {
@@ -38,7 +59,8 @@ func (s Storage) genTokenKey(token string) ([]byte, error) {
 	return key, nil
 }
 
-func (s Storage) GetByToken(token string) (*User, error) {
+// GetByToken returns a user owning a token, and notes when and from where the token was used.
+func (s Storage) GetByToken(token, remoteIP string) (*User, error) {
 	key, err := s.genTokenKey(token)
 	if err != nil {
 		return nil, err
@@ -56,20 +78,34 @@ func (s Storage) GetByToken(token string) (*User, error) {
 		return nil, nil
 	}
 
-	if t.ExpiresAt < time.Now().Unix() {
+	now := time.Now().Unix()
+	if s.capExpiry(t); t.ExpiresAt < now {
 		return nil, nil
 	}
+	if t.LastUsedAt+tokenUsageInterval <= now || t.LastUsedIP != remoteIP {
+		if err := s.stmtTokenUse.run(t.PublicID, now, remoteIP); err != nil {
+			slog.Error("Unable to save token usage", "token", t.PublicID, "error", err)
+		}
+	}
 	u, err := s.stmtUserGetById.run(userID)
 	if u != nil {
 		u.h = s
 		u.AllowedScopes = t.Scopes & u.AllowedScopes
+		u.AuthMethod = AuthMethodToken
+		u.AuthId = strconv.FormatInt(t.PublicID, 10)
 	}
 	return u, err
 }
 
+// ErrScopesExceeded is returned when a token would get scopes its user is not allowed.
+var ErrScopesExceeded = errors.New("requested scopes exceed allowed scopes")
+
 func (u User) GenerateToken(description string, expires int64, scopes Scopes) (*Token, error) {
 	if scopes&u.AllowedScopes != scopes {
-		return nil, fmt.Errorf("requested scopes %s exceed allowed scopes %s", scopes.String(), u.AllowedScopes.String())
+		return nil, fmt.Errorf("%w: requested %s, allowed %s", ErrScopesExceeded, scopes.String(), u.AllowedScopes.String())
+	}
+	if maxExpires := time.Now().Unix() + u.h.maxTokenLifetime; u.h.maxTokenLifetime > 0 && expires > maxExpires {
+		return nil, fmt.Errorf("tokens cannot be valid for more than %d days", u.h.maxTokenLifetime/86400)
 	}
 
 	value := rand.Text()
@@ -110,8 +146,52 @@ func (u User) DeleteToken(id int64) error {
 	return nil
 }
 
+func (u User) RevokeAllTokens(by string) error {
+	if err := u.h.stmtTokenDeleteAll.run(u); err != nil {
+		return fmt.Errorf("unable to revoke tokens: %w", err)
+	}
+	u.h.fs.Audit.AppendEvent(u.id, "All tokens revoked by "+by)
+	return nil
+}
+
 func (u User) ListTokens() ([]Token, error) {
-	return u.h.stmtTokenList.run(u)
+	tokens, err := u.h.stmtTokenList.run(u)
+	for i := range tokens {
+		u.h.capExpiry(&tokens[i])
+	}
+	return tokens, err
+}
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// RotateToken replaces a token with a new one, which has the same description, scopes, and lifetime.
+// The old token stays valid for a grace period, so that clients can switch to the new one without downtime.
+func (u User) RotateToken(id int64, grace time.Duration) (*Token, error) {
+	tokens, err := u.ListTokens()
+	if err != nil {
+		return nil, err
+	}
+	idx := slices.IndexFunc(tokens, func(t Token) bool { return t.PublicID == id })
+	if idx < 0 {
+		return nil, ErrTokenNotFound
+	}
+	old := tokens[idx]
+	now := time.Now()
+	if old.ExpiresAt < now.Unix() {
+		return nil, ErrTokenNotFound
+	}
+
+	t, err := u.GenerateToken(old.Description, now.Unix()+old.ExpiresAt-old.CreatedAt, old.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	oldExpires := min(old.ExpiresAt, now.Add(grace).Unix())
+	if err = u.h.stmtTokenExpire.run(u, id, oldExpires); err != nil {
+		return nil, fmt.Errorf("unable to expire rotated token: %w", err)
+	}
+	msg := fmt.Sprintf("Token rotated id=%d (replaced by id=%d, old token expires=%d)", id, t.PublicID, oldExpires)
+	u.h.fs.Audit.AppendEvent(u.id, msg)
+	return t, nil
 }
 
 type stmtTokenCreate storage.DbStmt
@@ -173,6 +253,21 @@ func (s *stmtTokenDeleteAll) run(u User) error {
 	return err
 }
 
+type stmtTokenExpire storage.DbStmt
+
+func (s *stmtTokenExpire) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("tokenExpire", `
+		UPDATE tokens SET expires_at = ?
+		WHERE user_id = ? and public_id = ?`,
+	)
+	return
+}
+
+func (s *stmtTokenExpire) run(u User, id, expires int64) error {
+	_, err := s.Stmt.Exec(expires, u.id, id)
+	return err
+}
+
 type stmtTokenDeleteExpired storage.DbStmt
 
 func (s *stmtTokenDeleteExpired) Init(db storage.DbHandle) (err error) {
@@ -192,7 +287,7 @@ type stmtTokenList storage.DbStmt
 
 func (s *stmtTokenList) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("tokenList", `
-		SELECT public_id, created_at, expires_at, description, scopes
+		SELECT public_id, created_at, expires_at, description, scopes, last_used_at, last_used_ip
 		FROM tokens
 		WHERE user_id = ?
 		ORDER BY created_at ASC`,
@@ -221,6 +316,8 @@ func (s *stmtTokenList) run(u User) ([]Token, error) {
 			&t.ExpiresAt,
 			&t.Description,
 			&scopesStr,
+			&t.LastUsedAt,
+			&t.LastUsedIP,
 		)
 		if err != nil {
 			return nil, err
@@ -238,7 +335,7 @@ type stmtTokenLookup storage.DbStmt
 
 func (s *stmtTokenLookup) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("tokenLookup", `
-		SELECT user_id, public_id, created_at, expires_at, scopes
+		SELECT user_id, public_id, created_at, expires_at, scopes, last_used_at, last_used_ip
 		FROM tokens
 		WHERE value = ?`,
 	)
@@ -255,6 +352,8 @@ func (s *stmtTokenLookup) run(value string) (*Token, int64, error) {
 		&t.CreatedAt,
 		&t.ExpiresAt,
 		&scopesStr,
+		&t.LastUsedAt,
+		&t.LastUsedIP,
 	)
 	if err == sql.ErrNoRows {
 		return nil, 0, nil
@@ -268,3 +367,18 @@ func (s *stmtTokenLookup) run(value string) (*Token, int64, error) {
 	}
 	return &t, userID, nil
 }
+
+type stmtTokenUse storage.DbStmt
+
+func (s *stmtTokenUse) Init(db storage.DbHandle) (err error) {
+	s.Stmt, err = db.Prepare("tokenUse", `
+		UPDATE tokens SET last_used_at = ?, last_used_ip = ?
+		WHERE public_id = ?`,
+	)
+	return
+}
+
+func (s *stmtTokenUse) run(id, usedAt int64, remoteIP string) error {
+	_, err := s.Stmt.Exec(usedAt, remoteIP, id)
+	return err
+}
@@ -5,8 +5,10 @@ package users
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/foundriesio/dg-satellite/storage"
@@ -16,26 +18,78 @@ type User struct {
 	h  Storage
 	id int64
 
-	Username string
-	Password string
-	Email    string
+	Username string `json:"username"`
+	Password string `json:"-"`
+	Email    string `json:"email,omitempty"`
 
-	CreatedAt int64
-	Deleted   bool
+	CreatedAt int64 `json:"created-at"`
+	Deleted   bool  `json:"-"`
 
-	AllowedScopes Scopes
+	AllowedScopes Scopes `json:"scopes"`
+	// AllowedTags and AllowedGroups limit access of a user to devices on these tags and in these groups.
+	// An empty list does not limit access.
+	AllowedTags   []string `json:"allowed-tags,omitempty"`
+	AllowedGroups []string `json:"allowed-groups,omitempty"`
 
-	AuthProviderData []byte
+	// ServiceAccount users cannot log in, and only hold API tokens for automation.
+	// Owner is a team or an administrator responsible for a service account.
+	ServiceAccount bool   `json:"service-account,omitempty"`
+	Owner          string `json:"owner,omitempty"`
+
+	AuthProviderData []byte `json:"-"`
+
+	// AuthMethod and AuthId tell how a user authenticated a current request, if it was a session or a token.
+	AuthMethod string `json:"-"`
+	AuthId     string `json:"-"`
 }
 
+const (
+	AuthMethodSession = "session"
+	AuthMethodToken   = "token"
+)
+
 func (u User) Delete() error {
 	u.Deleted = true
 	if err := u.h.stmtTokenDeleteAll.run(u); err != nil {
 		return fmt.Errorf("unable to delete user while deleting tokens: %w", err)
+	} else if err := u.h.stmtSessionDeleteAll.run(u); err != nil {
+		return fmt.Errorf("unable to delete user while deleting sessions: %w", err)
 	}
 	return u.Update("User deleted")
 }
 
+// SetScopes changes scopes allowed for a user.
+// When they change, all sessions and API tokens of a user are revoked, as they may grant scopes which are no longer allowed.
+func (u *User) SetScopes(scopes Scopes, by string) error {
+	if scopes == u.AllowedScopes {
+		return nil
+	}
+	u.AllowedScopes = scopes
+	if err := u.Update("Scopes changed by " + by); err != nil {
+		return err
+	} else if err := u.RevokeAllSessions(by); err != nil {
+		return err
+	}
+	return u.RevokeAllTokens(by)
+}
+
+// DeviceFilter returns a filter of devices which a user is allowed to access.
+func (u User) DeviceFilter() storage.DeviceFilter {
+	return storage.DeviceFilter{Tags: u.AllowedTags, Groups: u.AllowedGroups}
+}
+
+// SetDeviceFilter limits access of a user to devices which pass a filter; an empty filter removes limits.
+// Sessions and API tokens are not revoked, as a filter of their user applies to them on each request.
+func (u *User) SetDeviceFilter(filter storage.DeviceFilter, by string) error {
+	u.AllowedTags = filter.Tags
+	u.AllowedGroups = filter.Groups
+	if filter.Unrestricted() {
+		return u.Update("Device access limits removed by " + by)
+	}
+	return u.Update(fmt.Sprintf("Device access limited to tags=[%s] groups=[%s] by %s",
+		strings.Join(filter.Tags, ","), strings.Join(filter.Groups, ","), by))
+}
+
 func (u User) Update(reason string) error {
 	if err := u.h.stmtUserUpdate.run(u); err != nil {
 		return err
@@ -53,6 +107,8 @@ type Storage struct {
 	fs *storage.FsHandle
 
 	hmacSecret []byte
+	// maxTokenLifetime in seconds, no limit if zero.
+	maxTokenLifetime int64
 
 	stmtUserCreate    stmtUserCreate
 	stmtUserGetById   stmtUserGetById
@@ -62,15 +118,20 @@ type Storage struct {
 
 	stmtSessionCreate        stmtSessionCreate
 	stmtSessionDelete        stmtSessionDelete
+	stmtSessionDeleteAll     stmtSessionDeleteAll
 	stmtSessionDeleteExpired stmtSessionDeleteExpired
 	stmtSessionGet           stmtSessionGet
+	stmtSessionList          stmtSessionList
+	stmtSessionRevoke        stmtSessionRevoke
 
 	stmtTokenCreate        stmtTokenCreate
 	stmtTokenDelete        stmtTokenDelete
 	stmtTokenDeleteAll     stmtTokenDeleteAll
 	stmtTokenDeleteExpired stmtTokenDeleteExpired
+	stmtTokenExpire        stmtTokenExpire
 	stmtTokenList          stmtTokenList
 	stmtTokenLookup        stmtTokenLookup
+	stmtTokenUse           stmtTokenUse
 }
 
 func NewStorage(db *storage.DbHandle, fs *storage.FsHandle) (*Storage, error) {
@@ -92,14 +153,19 @@ func NewStorage(db *storage.DbHandle, fs *storage.FsHandle) (*Storage, error) {
 		&handle.stmtUserUpdate,
 		&handle.stmtSessionCreate,
 		&handle.stmtSessionDelete,
+		&handle.stmtSessionDeleteAll,
 		&handle.stmtSessionDeleteExpired,
 		&handle.stmtSessionGet,
+		&handle.stmtSessionList,
+		&handle.stmtSessionRevoke,
 		&handle.stmtTokenCreate,
 		&handle.stmtTokenDelete,
 		&handle.stmtTokenDeleteAll,
 		&handle.stmtTokenDeleteExpired,
+		&handle.stmtTokenExpire,
 		&handle.stmtTokenList,
 		&handle.stmtTokenLookup,
+		&handle.stmtTokenUse,
 	); err != nil {
 		return nil, err
 	}
@@ -129,6 +195,25 @@ func (s Storage) Create(u *User) error {
 	return err
 }
 
+// CreateServiceAccount adds a user which cannot log in, and only holds API tokens.
+// Tokens of a service account outlive its owner, unlike tokens of a human user which are deleted along with them.
+func (s Storage) CreateServiceAccount(name, owner string, scopes Scopes, by string) (*User, error) {
+	if len(owner) == 0 {
+		return nil, errors.New("service accounts require an owner")
+	}
+	u := &User{
+		Username:       name,
+		AllowedScopes:  scopes,
+		ServiceAccount: true,
+		Owner:          owner,
+	}
+	if err := s.Create(u); err != nil {
+		return nil, err
+	}
+	s.fs.Audit.AppendEvent(u.id, fmt.Sprintf("Service account created by %s (owner=%s)", by, owner))
+	return u, nil
+}
+
 func (s Storage) Upsert(username, email string, scopes Scopes) (*User, error) {
 	u, err := s.stmtUserGetByName.run(username)
 	switch err {
@@ -170,8 +255,11 @@ type stmtUserCreate storage.DbStmt
 
 func (s *stmtUserCreate) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("userCreate", `
-		INSERT INTO users (username, password, email, created_at, deleted, allowed_scopes, auth_provider_data)
-		VALUES (?, ?, ?, ?, ?, ?, jsonb(?))`,
+		INSERT INTO users (
+			username, password, email, created_at, deleted, allowed_scopes, allowed_tags, allowed_groups,
+			service_account, owner, auth_provider_data
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, jsonb(?))`,
 	)
 	return
 }
@@ -190,6 +278,10 @@ func (s *stmtUserCreate) run(u *User) error {
 		u.CreatedAt,
 		u.Deleted,
 		u.AllowedScopes.String(),
+		strings.Join(u.AllowedTags, ","),
+		strings.Join(u.AllowedGroups, ","),
+		u.ServiceAccount,
+		u.Owner,
 		u.AuthProviderData,
 	)
 	if err != nil {
@@ -206,7 +298,9 @@ type stmtUserGetById storage.DbStmt
 
 func (s *stmtUserGetById) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("userGetId", `
-		SELECT id, username, password, email, created_at, allowed_scopes, json_extract(auth_provider_data, '$')
+		SELECT
+			id, username, password, email, created_at, allowed_scopes, allowed_tags, allowed_groups,
+			service_account, owner, json_extract(auth_provider_data, '$')
 		FROM users
 		WHERE id = ? and deleted = false`,
 	)
@@ -215,7 +309,7 @@ func (s *stmtUserGetById) Init(db storage.DbHandle) (err error) {
 
 func (s *stmtUserGetById) run(id int64) (*User, error) {
 	u := User{}
-	scopeStr := ""
+	var scopeStr, tagsStr, groupsStr string
 	err := s.Stmt.QueryRow(id).Scan(
 		&u.id,
 		&u.Username,
@@ -223,6 +317,10 @@ func (s *stmtUserGetById) run(id int64) (*User, error) {
 		&u.Email,
 		&u.CreatedAt,
 		&scopeStr,
+		&tagsStr,
+		&groupsStr,
+		&u.ServiceAccount,
+		&u.Owner,
 		&u.AuthProviderData,
 	)
 	if err == nil {
@@ -230,6 +328,7 @@ func (s *stmtUserGetById) run(id int64) (*User, error) {
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse scopes: %w", err)
 		}
+		u.AllowedTags, u.AllowedGroups = splitList(tagsStr), splitList(groupsStr)
 	}
 	return &u, err
 }
@@ -238,7 +337,9 @@ type stmtUserGetByName storage.DbStmt
 
 func (s *stmtUserGetByName) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("userGet", `
-		SELECT id, username, password, email, created_at, allowed_scopes, json_extract(auth_provider_data, '$')
+		SELECT
+			id, username, password, email, created_at, allowed_scopes, allowed_tags, allowed_groups,
+			service_account, owner, json_extract(auth_provider_data, '$')
 		FROM users
 		WHERE username = ? AND deleted = false`,
 	)
@@ -247,7 +348,7 @@ func (s *stmtUserGetByName) Init(db storage.DbHandle) (err error) {
 
 func (s *stmtUserGetByName) run(username string) (*User, error) {
 	u := User{}
-	var scopesStr string
+	var scopesStr, tagsStr, groupsStr string
 	err := s.Stmt.QueryRow(username).Scan(
 		&u.id,
 		&u.Username,
@@ -255,6 +356,10 @@ func (s *stmtUserGetByName) run(username string) (*User, error) {
 		&u.Email,
 		&u.CreatedAt,
 		&scopesStr,
+		&tagsStr,
+		&groupsStr,
+		&u.ServiceAccount,
+		&u.Owner,
 		&u.AuthProviderData,
 	)
 	if err == nil {
@@ -262,6 +367,7 @@ func (s *stmtUserGetByName) run(username string) (*User, error) {
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse scopes: %w", err)
 		}
+		u.AllowedTags, u.AllowedGroups = splitList(tagsStr), splitList(groupsStr)
 	}
 	return &u, err
 }
@@ -270,7 +376,9 @@ type stmtUserList storage.DbStmt
 
 func (s *stmtUserList) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("userList", `
-		SELECT id, username, password, email, created_at, deleted, allowed_scopes
+		SELECT
+			id, username, password, email, created_at, deleted, allowed_scopes, allowed_tags, allowed_groups,
+			service_account, owner
 		FROM users
 		WHERE deleted = false`,
 	)
@@ -291,7 +399,7 @@ func (s *stmtUserList) run() ([]User, error) {
 
 	for rows.Next() {
 		var u User
-		var scopesStr string
+		var scopesStr, tagsStr, groupsStr string
 		err := rows.Scan(
 			&u.id,
 			&u.Username,
@@ -300,6 +408,10 @@ func (s *stmtUserList) run() ([]User, error) {
 			&u.CreatedAt,
 			&u.Deleted,
 			&scopesStr,
+			&tagsStr,
+			&groupsStr,
+			&u.ServiceAccount,
+			&u.Owner,
 		)
 		if err != nil {
 			return nil, err
@@ -308,6 +420,7 @@ func (s *stmtUserList) run() ([]User, error) {
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse scopes: %w", err)
 		}
+		u.AllowedTags, u.AllowedGroups = splitList(tagsStr), splitList(groupsStr)
 		users = append(users, u)
 	}
 	return users, rows.Err()
@@ -318,7 +431,9 @@ type stmtUserUpdate storage.DbStmt
 func (s *stmtUserUpdate) Init(db storage.DbHandle) (err error) {
 	s.Stmt, err = db.Prepare("userUpdate", `
 		UPDATE users
-		SET username = ?, password = ?, email = ?, allowed_scopes = ?, deleted = ?, auth_provider_data = jsonb(?)
+		SET
+			username = ?, password = ?, email = ?, allowed_scopes = ?, allowed_tags = ?, allowed_groups = ?,
+			deleted = ?, owner = ?, auth_provider_data = jsonb(?)
 		WHERE id = ?`,
 	)
 	return
@@ -328,6 +443,18 @@ func (s *stmtUserUpdate) run(u User) error {
 	if u.AuthProviderData == nil {
 		u.AuthProviderData = []byte("{}")
 	}
-	_, err := s.Stmt.Exec(u.Username, u.Password, u.Email, u.AllowedScopes.String(), u.Deleted, u.AuthProviderData, u.id)
+	_, err := s.Stmt.Exec(
+		u.Username, u.Password, u.Email, u.AllowedScopes.String(),
+		strings.Join(u.AllowedTags, ","), strings.Join(u.AllowedGroups, ","),
+		u.Deleted, u.Owner, u.AuthProviderData, u.id,
+	)
 	return err
 }
+
+// splitList parses a comma-separated list, as stored for allowed tags and groups.
+func splitList(value string) []string {
+	if len(value) == 0 {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
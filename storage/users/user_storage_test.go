@@ -5,7 +5,10 @@ package users
 
 import (
 	"encoding/json"
+	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -130,14 +133,14 @@ func TestTokens(t *testing.T) {
 	require.Nil(t, err)
 	require.NotEqual(t, t1.Value, t2.Value)
 
-	u2, err := users.GetByToken(t1.Value)
+	u2, err := users.GetByToken(t1.Value, "127.0.0.1")
 	require.Nil(t, err)
 	require.NotNil(t, u2)
 	require.Equal(t, u.id, u2.id)
 	require.True(t, u2.AllowedScopes.Has(ScopeDevicesR))
 	require.False(t, u2.AllowedScopes.Has(ScopeDevicesRU))
 
-	u2, err = users.GetByToken(t2.Value)
+	u2, err = users.GetByToken(t2.Value, "127.0.0.1")
 	require.Nil(t, err)
 	require.Nil(t, u2)
 
@@ -167,7 +170,7 @@ func TestTokens(t *testing.T) {
 	// Downgrade user to devices:read
 	u.AllowedScopes = ScopeDevicesR
 	require.Nil(t, u.Update("test"))
-	u2, err = users.GetByToken(t1.Value)
+	u2, err = users.GetByToken(t1.Value, "127.0.0.1")
 	require.Nil(t, err)
 	require.True(t, u2.AllowedScopes.Has(ScopeDevicesR))
 	require.False(t, u2.AllowedScopes.Has(ScopeDevicesRU))
@@ -180,6 +183,215 @@ func TestTokens(t *testing.T) {
 	require.Contains(t, events, "User deleted")
 }
 
+func TestTokenUsageAndRotation(t *testing.T) {
+	tmpdir := t.TempDir()
+	dbFile := filepath.Join(tmpdir, "sql.db")
+	db, err := storage.NewDb(dbFile)
+	require.Nil(t, err)
+	fs, err := storage.NewFs(tmpdir)
+	require.Nil(t, err)
+	require.Nil(t, fs.Auth.InitHmacSecret())
+
+	users, err := NewStorage(db, fs)
+	require.Nil(t, err)
+
+	u := User{Username: "testuser", AllowedScopes: ScopeDevicesRU}
+	require.Nil(t, users.Create(&u))
+	expires := time.Now().Add(30 * 24 * time.Hour).Unix()
+	t1, err := u.GenerateToken("ci", expires, ScopeDevicesR)
+	require.Nil(t, err)
+
+	tokens, err := u.ListTokens()
+	require.Nil(t, err)
+	require.Zero(t, tokens[0].LastUsedAt)
+	require.Empty(t, tokens[0].LastUsedIP)
+
+	_, err = users.GetByToken(t1.Value, "10.0.0.1")
+	require.Nil(t, err)
+	tokens, err = u.ListTokens()
+	require.Nil(t, err)
+	require.InDelta(t, time.Now().Unix(), tokens[0].LastUsedAt, 5)
+	require.Equal(t, "10.0.0.1", tokens[0].LastUsedIP)
+	_, err = users.GetByToken(t1.Value, "10.0.0.2")
+	require.Nil(t, err)
+	tokens, err = u.ListTokens()
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.2", tokens[0].LastUsedIP)
+
+	// A rotated token keeps its scopes and lifetime, and the old one expires after a grace period.
+	_, err = u.RotateToken(t1.PublicID+100, time.Hour)
+	require.ErrorIs(t, err, ErrTokenNotFound)
+	t2, err := u.RotateToken(t1.PublicID, time.Hour)
+	require.Nil(t, err)
+	require.NotEqual(t, t1.Value, t2.Value)
+	require.Equal(t, "ci", t2.Description)
+	require.Equal(t, ScopeDevicesR, t2.Scopes)
+	require.InDelta(t, expires, t2.ExpiresAt, 5)
+	tokens, err = u.ListTokens()
+	require.Nil(t, err)
+	require.Len(t, tokens, 2)
+	require.InDelta(t, time.Now().Add(time.Hour).Unix(), tokens[0].ExpiresAt, 5)
+	u2, err := users.GetByToken(t1.Value, "10.0.0.1")
+	require.Nil(t, err)
+	require.NotNil(t, u2)
+	u2, err = users.GetByToken(t2.Value, "10.0.0.1")
+	require.Nil(t, err)
+	require.NotNil(t, u2)
+
+	// No grace period expires an old token right away.
+	t3, err := u.RotateToken(t2.PublicID, 0)
+	require.Nil(t, err)
+	time.Sleep(time.Second)
+	u2, err = users.GetByToken(t2.Value, "10.0.0.1")
+	require.Nil(t, err)
+	require.Nil(t, u2)
+
+	// A maximum lifetime limits new tokens and rejects existing ones which outlived it.
+	users.SetMaxTokenLifetime(7 * 24 * time.Hour)
+	u.h = *users
+	_, err = u.GenerateToken("too long", expires, ScopeDevicesR)
+	require.ErrorContains(t, err, "more than 7 days")
+	_, err = u.GenerateToken("short", time.Now().Add(24*time.Hour).Unix(), ScopeDevicesR)
+	require.Nil(t, err)
+	require.Nil(t, users.stmtTokenExpire.run(u, t3.PublicID, expires))
+	backdate, err := db.Prepare("testTokenBackdate", "UPDATE tokens SET created_at = ? WHERE public_id = ?")
+	require.Nil(t, err)
+	_, err = backdate.Exec(time.Now().Add(-8*24*time.Hour).Unix(), t3.PublicID)
+	require.Nil(t, err)
+	u2, err = users.GetByToken(t3.Value, "10.0.0.1")
+	require.Nil(t, err)
+	require.Nil(t, u2)
+
+	events, err := fs.Audit.ReadEvents(u.id)
+	require.Nil(t, err)
+	require.Contains(t, events, fmt.Sprintf("Token rotated id=%d (replaced by id=%d", t1.PublicID, t2.PublicID))
+}
+
+func TestServiceAccounts(t *testing.T) {
+	tmpdir := t.TempDir()
+	dbFile := filepath.Join(tmpdir, "sql.db")
+	db, err := storage.NewDb(dbFile)
+	require.Nil(t, err)
+	fs, err := storage.NewFs(tmpdir)
+	require.Nil(t, err)
+	require.Nil(t, fs.Auth.InitHmacSecret())
+
+	users, err := NewStorage(db, fs)
+	require.Nil(t, err)
+
+	owner := User{Username: "engineer", AllowedScopes: ScopeDevicesRU}
+	require.Nil(t, users.Create(&owner))
+	_, err = users.CreateServiceAccount("ci", "", ScopeDevicesR, "engineer")
+	require.NotNil(t, err)
+	sa, err := users.CreateServiceAccount("ci", "engineer", ScopeDevicesR, "engineer")
+	require.Nil(t, err)
+	require.True(t, sa.ServiceAccount)
+
+	// Service accounts only hold tokens, which are kept when their owner leaves.
+	_, err = sa.CreateSession("127.0.0.1", time.Now().Add(time.Hour).Unix(), ScopeDevicesR)
+	require.ErrorIs(t, err, ErrServiceAccountLogin)
+	token, err := sa.GenerateToken("pipeline", time.Now().Add(time.Hour).Unix(), ScopeDevicesR)
+	require.Nil(t, err)
+	require.Nil(t, owner.Delete())
+	u, err := users.GetByToken(token.Value, "127.0.0.1")
+	require.Nil(t, err)
+	require.NotNil(t, u)
+	require.True(t, u.ServiceAccount)
+	require.Equal(t, "engineer", u.Owner)
+
+	u.Owner = "platform-team"
+	require.Nil(t, u.Update("Owner changed"))
+	list, err := users.List()
+	require.Nil(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "ci", list[0].Username)
+	require.True(t, list[0].ServiceAccount)
+	require.Equal(t, "platform-team", list[0].Owner)
+
+	events, err := fs.Audit.ReadEvents(sa.id)
+	require.Nil(t, err)
+	require.Contains(t, events, "Service account created by engineer (owner=engineer)")
+}
+
+func TestSessions(t *testing.T) {
+	tmpdir := t.TempDir()
+	dbFile := filepath.Join(tmpdir, "sql.db")
+	db, err := storage.NewDb(dbFile)
+	require.Nil(t, err)
+	fs, err := storage.NewFs(tmpdir)
+	require.Nil(t, err)
+	require.Nil(t, fs.Auth.InitHmacSecret())
+
+	users, err := NewStorage(db, fs)
+	require.Nil(t, err)
+
+	u := User{Username: "testuser", AllowedScopes: ScopeDevicesRU}
+	require.Nil(t, users.Create(&u))
+	other := User{Username: "other", AllowedScopes: ScopeDevicesRU}
+	require.Nil(t, users.Create(&other))
+
+	expires := time.Now().Add(time.Hour).Unix()
+	id1, err := u.CreateSession("10.0.0.1", expires, ScopeDevicesR)
+	require.Nil(t, err)
+	id2, err := u.CreateSession("10.0.0.2", expires, ScopeDevicesRU)
+	require.Nil(t, err)
+	_, err = u.CreateSession("10.0.0.3", time.Now().Add(-time.Hour).Unix(), ScopeDevicesR)
+	require.Nil(t, err)
+	otherId, err := other.CreateSession("10.0.0.4", expires, ScopeDevicesR)
+	require.Nil(t, err)
+
+	// Expired sessions are not listed, and IDs do not reveal session cookies.
+	sessions, err := u.ListSessions()
+	require.Nil(t, err)
+	require.Len(t, sessions, 2)
+	// Sessions created within the same second have no particular order.
+	slices.SortFunc(sessions, func(a, b Session) int { return strings.Compare(a.RemoteIP, b.RemoteIP) })
+	s1, err := users.GetBySession(id1)
+	require.Nil(t, err)
+	require.Equal(t, s1.AuthId, sessions[0].ID)
+	require.Equal(t, "10.0.0.1", sessions[0].RemoteIP)
+	require.Equal(t, ScopeDevicesR, sessions[0].Scopes)
+	require.Equal(t, expires, sessions[0].ExpiresAt)
+	require.NotEqual(t, id1, sessions[0].ID)
+	require.Equal(t, "10.0.0.2", sessions[1].RemoteIP)
+
+	// Users cannot revoke sessions of others.
+	otherSession, err := users.GetBySession(otherId)
+	require.Nil(t, err)
+	found, err := u.RevokeSession(otherSession.AuthId, "admin")
+	require.Nil(t, err)
+	require.False(t, found)
+	revoked := sessions[0].ID
+	found, err = u.RevokeSession(revoked, "admin")
+	require.Nil(t, err)
+	require.True(t, found)
+	s1, err = users.GetBySession(id1)
+	require.Nil(t, err)
+	require.Nil(t, s1)
+	s2, err := users.GetBySession(id2)
+	require.Nil(t, err)
+	require.NotNil(t, s2)
+
+	require.Nil(t, u.RevokeAllSessions("admin"))
+	sessions, err = u.ListSessions()
+	require.Nil(t, err)
+	require.Len(t, sessions, 0)
+	otherSession, err = users.GetBySession(otherId)
+	require.Nil(t, err)
+	require.NotNil(t, otherSession)
+
+	// Deleting a user deletes their sessions.
+	require.Nil(t, other.Delete())
+	otherSession, err = users.GetBySession(otherId)
+	require.Nil(t, err)
+	require.Nil(t, otherSession)
+
+	log, err := u.GetAuditLog()
+	require.Nil(t, err)
+	require.Contains(t, log, "Session revoked id="+revoked+" by admin")
+	require.Contains(t, log, "All sessions revoked by admin")
+}
+
 func TestGc(t *testing.T) {
 	tmpdir := t.TempDir()
 	dbFile := filepath.Join(tmpdir, "sql.db")